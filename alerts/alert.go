@@ -0,0 +1,48 @@
+package alerts
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Severities of alerts.
+const (
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Alert is a problem with CI health. It is identified by its labels.
+type Alert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	StartsAt    time.Time         `json:"startsAt"`
+	// EndsAt is the time when the alert is resolved, or, for firing alerts,
+	// the time after which the alert is considered resolved unless it is
+	// sent again.
+	EndsAt time.Time `json:"endsAt"`
+}
+
+// Fingerprint returns a string that identifies the alert.
+func (a Alert) Fingerprint() string {
+	var names []string
+	for name := range a.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(a.Labels[name])
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// Notifier sends alerts to an external system.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, alerts []Alert) error
+}
@@ -0,0 +1,47 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Alertmanager posts alerts to the Alertmanager API, so they go through its
+// routing, grouping and silences.
+type Alertmanager struct {
+	URL string
+}
+
+func (am *Alertmanager) Name() string {
+	return "alertmanager"
+}
+
+func (am *Alertmanager) Notify(ctx context.Context, alerts []Alert) error {
+	if len(alerts) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(alerts); err != nil {
+		return err
+	}
+	u := strings.TrimSuffix(am.URL, "/") + "/api/v2/alerts"
+	req, err := http.NewRequestWithContext(ctx, "POST", u, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("got unexpected http response from %s: %s", u, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/completion"
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/output"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+// RegressionAlertName is the alertname of sustained regressions.
+const RegressionAlertName = "CITestRegression"
+
+// RegressionOptions are thresholds for regression alerts.
+type RegressionOptions struct {
+	Filter       string
+	Days         int
+	BaselineDays int
+	// Threshold and CriticalThreshold are drops of the pass rate below the
+	// baseline, from 0 to 1, for warning and critical alerts.
+	Threshold         float64
+	CriticalThreshold float64
+	MinRuns           int
+}
+
+// RegressionAlerts evaluates sustained regressions and returns an alert for
+// every variant in which a regressed test fails. Firing alerts end after ttl
+// unless they are sent again.
+func RegressionAlerts(db *database.DB, ropts RegressionOptions, now time.Time, ttl time.Duration) ([]Alert, error) {
+	regressions, err := db.SustainedRegressions(ropts.Filter, ropts.Days, ropts.BaselineDays, ropts.Threshold, ropts.MinRuns)
+	if err != nil {
+		return nil, err
+	}
+
+	today := now.UTC().Truncate(24 * time.Hour)
+	alerts := []Alert{}
+	for _, reg := range regressions {
+		severity := SeverityWarning
+		if reg.BaselinePassRate-reg.PassRate >= ropts.CriticalThreshold {
+			severity = SeverityCritical
+		}
+
+		variants, err := db.BuildStatsWith("sippytags", ropts.Filter, strconv.Itoa(ropts.Days), reg.Test, database.PeriodOptions{AlignDays: true})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range variants.Data {
+			v := row.Values[0]
+			if v.Fail == 0 {
+				continue
+			}
+			alerts = append(alerts, Alert{
+				Labels: map[string]string{
+					"alertname": RegressionAlertName,
+					"test":      reg.Test,
+					"variant":   row.Columns[0],
+					"severity":  severity,
+				},
+				Annotations: map[string]string{
+					"summary": fmt.Sprintf("%s regressed on %s", reg.Test, row.Columns[0]),
+					"description": fmt.Sprintf(
+						"The pass rate has been %.1f%% for %d days, the %d-day baseline is %.1f%%. %d of %d runs on %s failed.",
+						100*reg.PassRate, ropts.Days, ropts.BaselineDays, 100*reg.BaselinePassRate,
+						v.Fail, v.Pass+v.Flake+v.Fail, row.Columns[0],
+					),
+				},
+				StartsAt: today.AddDate(0, 0, -ropts.Days),
+				EndsAt:   now.Add(ttl),
+			})
+		}
+	}
+	return alerts, nil
+}
+
+type AlertsOptions struct {
+	regression        RegressionOptions
+	threshold         float64
+	critical          float64
+	resolveTimeout    time.Duration
+	alertmanagerURL   string
+	pagerDutyURL      string
+	pagerDutyKeyFile  string
+	pagerDutySeverity string
+	output            string
+
+	out io.Writer
+}
+
+func printAlerts(out io.Writer, alerts []Alert) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "SEVERITY\tALERT\tTEST\tVARIANT")
+	for _, a := range alerts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", a.Labels["severity"], a.Labels["alertname"], a.Labels["test"], a.Labels["variant"])
+	}
+	return w.Flush()
+}
+
+func (opts *AlertsOptions) Run(ctx context.Context) (err error) {
+	if err := output.Validate(opts.output); err != nil {
+		return err
+	}
+	if opts.regression.Days <= 0 || opts.regression.BaselineDays <= 0 {
+		return fmt.Errorf("--days and --baseline-days must be positive")
+	}
+
+	var notifiers []Notifier
+	if opts.alertmanagerURL != "" {
+		notifiers = append(notifiers, &Alertmanager{URL: opts.alertmanagerURL})
+	}
+	if opts.pagerDutyKeyFile != "" {
+		pd, err := NewPagerDuty(opts.pagerDutyURL, opts.pagerDutyKeyFile, opts.pagerDutySeverity)
+		if err != nil {
+			return err
+		}
+		notifiers = append(notifiers, pd)
+	}
+	opts.regression.Threshold = opts.threshold / 100
+	opts.regression.CriticalThreshold = opts.critical / 100
+
+	db, err := database.OpenDefault()
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer func() {
+		closeErr := db.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	alerts, err := RegressionAlerts(db, opts.regression, time.Now(), opts.resolveTimeout)
+	if err != nil {
+		return fmt.Errorf("unable to evaluate alerts: %w", err)
+	}
+	sort.SliceStable(alerts, func(i, j int) bool {
+		return alerts[i].Labels["severity"] == SeverityCritical && alerts[j].Labels["severity"] != SeverityCritical
+	})
+
+	for _, n := range notifiers {
+		if err := n.Notify(ctx, alerts); err != nil {
+			return fmt.Errorf("unable to send alerts to %s: %w", n.Name(), err)
+		}
+		klog.Infof("Sent %d alerts to %s", len(alerts), n.Name())
+	}
+
+	return output.Print(opts.out, opts.output, alerts, func(out io.Writer) error {
+		return printAlerts(out, alerts)
+	})
+}
+
+func NewCmdAlerts() *cobra.Command {
+	opts := &AlertsOptions{
+		out: os.Stdout,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "alerts",
+		Short: "Evaluate alerts and send them to Alertmanager",
+		Long: heredoc.Doc(`
+			Find tests whose pass rate has been below their baseline for several
+			days in a row and produce an alert for every variant in which they
+			fail. The alerts have the alertname, test, variant and severity
+			labels.
+
+			With --alertmanager-url, the alerts are posted to Alertmanager, so they
+			flow through its routing and silences. Run the command periodically:
+			alerts that are not sent again within the resolve timeout are resolved.
+
+			With --pagerduty-routing-key-file, alerts of at least --pagerduty-severity
+			trigger PagerDuty incidents. Alerts about the same test and variant are
+			deduplicated into one incident, which has to be resolved in PagerDuty,
+			as the command doesn't keep track of alerts between runs.
+		`),
+		Example: heredoc.Doc(`
+			ci-results alerts --filter=4.10
+			ci-results alerts --filter=4.10 --alertmanager-url=http://alertmanager:9093 --resolve-timeout=2h
+			ci-results alerts --filter="4.10 blocking" --pagerduty-routing-key-file=key
+		`),
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.regression.Filter, "filter", "", "Space separated list of tags, tags prefixed with - are excluded.")
+	cmd.Flags().IntVar(&opts.regression.Days, "days", 3, "Number of consecutive days the test has to be regressed.")
+	cmd.Flags().IntVar(&opts.regression.BaselineDays, "baseline-days", 14, "Number of days before the regression that the pass rate is compared with.")
+	cmd.Flags().Float64Var(&opts.threshold, "threshold", 10, "Minimal drop of the daily pass rate below the baseline, in percentage points.")
+	cmd.Flags().Float64Var(&opts.critical, "critical-threshold", 30, "Drop of the pass rate that makes the alert critical, in percentage points.")
+	cmd.Flags().IntVar(&opts.regression.MinRuns, "min-runs", 5, "Minimal number of runs per day and in the baseline.")
+	cmd.Flags().DurationVar(&opts.resolveTimeout, "resolve-timeout", 2*time.Hour, "Time after which Alertmanager resolves alerts that are not sent again.")
+	cmd.Flags().StringVar(&opts.alertmanagerURL, "alertmanager-url", "", "Alertmanager to send the alerts to.")
+	cmd.Flags().StringVar(&opts.pagerDutyKeyFile, "pagerduty-routing-key-file", "", "File with the integration key of a PagerDuty service to send the alerts to.")
+	cmd.Flags().StringVar(&opts.pagerDutySeverity, "pagerduty-severity", SeverityCritical, "Lowest severity of alerts that are sent to PagerDuty (warning, critical).")
+	cmd.Flags().StringVar(&opts.pagerDutyURL, "pagerduty-url", DefaultPagerDutyURL, "PagerDuty Events API v2 endpoint.")
+	output.AddFlag(cmd, &opts.output)
+
+	completion.RegisterFilterFlag(cmd)
+
+	return cmd
+}
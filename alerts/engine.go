@@ -0,0 +1,172 @@
+package alerts
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dmage/ci-results/database"
+	"k8s.io/klog/v2"
+)
+
+// States of alerts produced by rules.
+const (
+	StatePending  = "pending"
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+// ActiveAlert is an alert whose rule condition holds.
+type ActiveAlert struct {
+	Alert
+	State    string    `json:"state"`
+	ActiveAt time.Time `json:"activeAt"`
+}
+
+// Engine evaluates rules and tracks the states of their alerts.
+type Engine struct {
+	db        *database.DB
+	rules     []Rule
+	notifiers []Notifier
+
+	mu     sync.Mutex
+	alerts map[string]*ActiveAlert
+}
+
+func NewEngine(db *database.DB, rules *Rules, notifiers []Notifier) *Engine {
+	return &Engine{
+		db:        db,
+		rules:     rules.Rules,
+		notifiers: notifiers,
+		alerts:    map[string]*ActiveAlert{},
+	}
+}
+
+// notifyTimeout limits the time a notifier has to send the alerts of one
+// evaluation.
+const notifyTimeout = 30 * time.Second
+
+type ruleResult struct {
+	rule   *Rule
+	alerts []Alert
+}
+
+// Evaluate checks the rules. Alerts become firing when their condition has
+// held for the duration of the rule, firing alerts whose condition no longer
+// holds are resolved. Firing and resolved alerts are sent to the notifiers,
+// firing alerts end after ttl unless they are sent again.
+//
+// The lock of the engine is held only while the states are updated, so the
+// queries and the notifiers don't block readers of the alerts.
+func (e *Engine) Evaluate(ctx context.Context, now time.Time, ttl time.Duration) {
+	var results []ruleResult
+	failed := map[string]bool{}
+	for i := range e.rules {
+		rule := &e.rules[i]
+		stats, err := e.db.BuildStats(rule.Columns, rule.Filter, strconv.Itoa(rule.days), rule.TestName)
+		if err != nil {
+			klog.Errorf("Unable to evaluate alert rule %s: %v", rule.Name, err)
+			failed[rule.Name] = true
+			continue
+		}
+		results = append(results, ruleResult{rule: rule, alerts: rule.check(stats)})
+	}
+
+	notify := e.update(results, failed, now, ttl)
+	if len(notify) == 0 {
+		return
+	}
+	for _, n := range e.notifiers {
+		notifyCtx, cancel := context.WithTimeout(ctx, notifyTimeout)
+		err := n.Notify(notifyCtx, notify)
+		cancel()
+		if err != nil {
+			klog.Errorf("Unable to send alerts to %s: %v", n.Name(), err)
+		}
+	}
+}
+
+// update sets the states of the alerts from the results of the rules and
+// returns the alerts that should be sent to the notifiers.
+func (e *Engine) update(results []ruleResult, failed map[string]bool, now time.Time, ttl time.Duration) []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	alerts := map[string]*ActiveAlert{}
+	var notify []Alert
+	for _, result := range results {
+		for _, alert := range result.alerts {
+			fp := alert.Fingerprint()
+			active, ok := e.alerts[fp]
+			if !ok || active.State == StateResolved {
+				active = &ActiveAlert{State: StatePending, ActiveAt: now}
+			}
+			active.Alert.Labels = alert.Labels
+			active.Alert.Annotations = alert.Annotations
+			if active.State == StatePending && now.Sub(active.ActiveAt) >= result.rule.forDuration {
+				active.State = StateFiring
+				active.StartsAt = now
+			}
+			if active.State == StateFiring {
+				active.EndsAt = now.Add(ttl)
+				notify = append(notify, active.Alert)
+			}
+			alerts[fp] = active
+		}
+	}
+
+	for fp, active := range e.alerts {
+		if _, ok := alerts[fp]; ok {
+			continue
+		}
+		if failed[active.Labels["alertname"]] {
+			alerts[fp] = active
+			continue
+		}
+		if active.State == StateFiring {
+			active.State = StateResolved
+			active.EndsAt = now
+			notify = append(notify, active.Alert)
+		}
+	}
+	e.alerts = alerts
+	return notify
+}
+
+// Run evaluates the rules every interval until the context is done.
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	// Alertmanager should not resolve alerts if an evaluation is late.
+	ttl := 4 * interval
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		e.Evaluate(ctx, time.Now(), ttl)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Alerts returns the pending and firing alerts.
+func (e *Engine) Alerts() []ActiveAlert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	alerts := []ActiveAlert{}
+	for _, active := range e.alerts {
+		alerts = append(alerts, *active)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		a, b := alerts[i], alerts[j]
+		if a.State != b.State {
+			return a.State == StateFiring
+		}
+		return a.Fingerprint() < b.Fingerprint()
+	})
+	return alerts
+}
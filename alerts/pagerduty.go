@@ -0,0 +1,185 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const DefaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+var severityLevels = map[string]int{
+	SeverityWarning:  1,
+	SeverityCritical: 2,
+}
+
+// PagerDuty sends alerts as events to the PagerDuty Events API v2. Alerts
+// about the same test and variant share a deduplication key, so they page
+// once and are grouped into one incident.
+type PagerDuty struct {
+	URL        string
+	RoutingKey string
+	// Severity is the lowest severity of alerts that are sent, all alerts
+	// are sent if it is empty.
+	Severity string
+}
+
+// NewPagerDuty returns a notifier that uses the integration key from the
+// file.
+func NewPagerDuty(url string, routingKeyFile string, severity string) (*PagerDuty, error) {
+	if severity != "" && severityLevels[severity] == 0 {
+		return nil, fmt.Errorf("unknown severity %q, expected %s or %s", severity, SeverityWarning, SeverityCritical)
+	}
+	data, err := ioutil.ReadFile(routingKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the PagerDuty routing key: %w", err)
+	}
+	return &PagerDuty{
+		URL:        url,
+		RoutingKey: strings.TrimSpace(string(data)),
+		Severity:   severity,
+	}, nil
+}
+
+func (pd *PagerDuty) Name() string {
+	return "pagerduty"
+}
+
+// DedupKey returns the deduplication key of the alert. Alerts without the
+// test and variant labels are identified by all their labels.
+func DedupKey(a Alert) string {
+	id := a.Fingerprint()
+	if a.Labels["test"] != "" || a.Labels["variant"] != "" {
+		id = a.Labels["test"] + "\x00" + a.Labels["variant"]
+	}
+	h := sha1.Sum([]byte(id))
+	return "ci-results-" + hex.EncodeToString(h[:])
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp,omitempty"`
+	Component     string            `json:"component,omitempty"`
+	Group         string            `json:"group,omitempty"`
+	Class         string            `json:"class,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+func (pd *PagerDuty) event(a Alert, now time.Time) pagerDutyEvent {
+	event := pagerDutyEvent{
+		RoutingKey:  pd.RoutingKey,
+		EventAction: "trigger",
+		DedupKey:    DedupKey(a),
+	}
+	if !a.EndsAt.IsZero() && !a.EndsAt.After(now) {
+		event.EventAction = "resolve"
+		return event
+	}
+
+	summary := a.Annotations["summary"]
+	if summary == "" {
+		summary = fmt.Sprintf("%s: %s %s", a.Labels["alertname"], a.Labels["test"], a.Labels["variant"])
+	}
+	if len(summary) > 1024 {
+		summary = summary[:1021] + "..."
+	}
+	severity := a.Labels["severity"]
+	if severityLevels[severity] == 0 {
+		severity = "error"
+	}
+	details := map[string]string{}
+	for k, v := range a.Labels {
+		details[k] = v
+	}
+	for k, v := range a.Annotations {
+		details[k] = v
+	}
+	event.Payload = &pagerDutyPayload{
+		Summary:       summary,
+		Source:        "ci-results",
+		Severity:      severity,
+		Component:     a.Labels["test"],
+		Group:         a.Labels["variant"],
+		Class:         a.Labels["alertname"],
+		CustomDetails: details,
+	}
+	if !a.StartsAt.IsZero() {
+		event.Payload.Timestamp = a.StartsAt.UTC().Format(time.RFC3339)
+	}
+	return event
+}
+
+func (pd *PagerDuty) send(ctx context.Context, event pagerDutyEvent) error {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(event); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", pd.URL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("got unexpected http response from %s: %s", pd.URL, resp.Status)
+	}
+	return nil
+}
+
+// Notify sends an event for each alert of at least the configured severity.
+// Firing alerts trigger incidents, resolved alerts resolve them unless
+// another alert with the same deduplication key is still firing.
+func (pd *PagerDuty) Notify(ctx context.Context, alerts []Alert) error {
+	now := time.Now()
+	var events []pagerDutyEvent
+	firing := map[string]bool{}
+	for _, a := range alerts {
+		if pd.Severity != "" && severityLevels[a.Labels["severity"]] < severityLevels[pd.Severity] {
+			continue
+		}
+		event := pd.event(a, now)
+		if event.EventAction == "trigger" {
+			firing[event.DedupKey] = true
+		}
+		events = append(events, event)
+	}
+
+	failed := 0
+	var firstErr error
+	for _, event := range events {
+		if event.EventAction == "resolve" && firing[event.DedupKey] {
+			continue
+		}
+		if err := pd.send(ctx, event); err != nil {
+			if failed == 0 {
+				firstErr = err
+			}
+			failed++
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d events were not sent, the first error is %w", failed, firstErr)
+	}
+	return nil
+}
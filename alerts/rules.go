@@ -0,0 +1,217 @@
+package alerts
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmage/ci-results/database"
+	"gopkg.in/yaml.v2"
+)
+
+var ruleNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// metrics are the values of stats that rules can check.
+var metrics = map[string]func(v database.StatsValues) float64{
+	"pass_rate": func(v database.StatsValues) float64 {
+		return ratio(v.Pass+v.Flake, v)
+	},
+	"fail_rate": func(v database.StatsValues) float64 {
+		return ratio(v.Fail, v)
+	},
+	"flake_rate": func(v database.StatsValues) float64 {
+		return ratio(v.Flake, v)
+	},
+	"runs": func(v database.StatsValues) float64 {
+		return float64(v.Pass + v.Flake + v.Fail)
+	},
+	"failures": func(v database.StatsValues) float64 {
+		return float64(v.Fail)
+	},
+}
+
+func ratio(n int, v database.StatsValues) float64 {
+	total := v.Pass + v.Flake + v.Fail
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+var operators = map[string]func(a, b float64) bool{
+	"<":  func(a, b float64) bool { return a < b },
+	"<=": func(a, b float64) bool { return a <= b },
+	">":  func(a, b float64) bool { return a > b },
+	">=": func(a, b float64) bool { return a >= b },
+}
+
+// Rule is a condition over the stats. Every row of the stats, for example
+// every job if Columns is name, is checked on its own and produces its own
+// alert.
+type Rule struct {
+	Name     string `yaml:"name"`
+	Filter   string `yaml:"filter"`
+	Columns  string `yaml:"columns"`
+	TestName string `yaml:"testname"`
+	// Metric is one of pass_rate, fail_rate, flake_rate, runs and failures.
+	// Rates are from 0 to 1.
+	Metric    string  `yaml:"metric"`
+	Op        string  `yaml:"op"`
+	Threshold float64 `yaml:"threshold"`
+	// Window is the number of days the stats are computed for, e.g. 3d.
+	Window string `yaml:"window"`
+	// For is how long the condition has to hold before the alert fires.
+	For      string `yaml:"for"`
+	MinRuns  int    `yaml:"min_runs"`
+	Severity string `yaml:"severity"`
+	// Labels and Annotations are added to the alerts.
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations"`
+
+	days        int
+	forDuration time.Duration
+}
+
+// Rules are the alert rules that the server evaluates periodically.
+type Rules struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+func parseDays(s string) (int, error) {
+	days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+	if err != nil || days <= 0 {
+		return 0, fmt.Errorf("invalid number of days %q", s)
+	}
+	return days, nil
+}
+
+func (r *Rule) validate() error {
+	if !ruleNameRe.MatchString(r.Name) {
+		return fmt.Errorf("invalid name %q", r.Name)
+	}
+	if _, ok := metrics[r.Metric]; !ok {
+		return fmt.Errorf("unknown metric %q", r.Metric)
+	}
+	if r.Op == "" {
+		r.Op = "<"
+	}
+	if _, ok := operators[r.Op]; !ok {
+		return fmt.Errorf("unknown operator %q", r.Op)
+	}
+	if r.Window == "" {
+		r.Window = "1d"
+	}
+	days, err := parseDays(r.Window)
+	if err != nil {
+		return fmt.Errorf("window: %w", err)
+	}
+	r.days = days
+	if r.For != "" {
+		r.forDuration, err = time.ParseDuration(r.For)
+		if err != nil {
+			return fmt.Errorf("for: %w", err)
+		}
+	}
+	switch r.Severity {
+	case "":
+		r.Severity = SeverityWarning
+	case SeverityWarning, SeverityCritical:
+	default:
+		return fmt.Errorf("unknown severity %q", r.Severity)
+	}
+	return nil
+}
+
+func ParseRules(data []byte) (*Rules, error) {
+	var rules Rules
+	if err := yaml.UnmarshalStrict(data, &rules); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for i := range rules.Rules {
+		rule := &rules.Rules[i]
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("rule #%d: %w", i+1, err)
+		}
+		if seen[rule.Name] {
+			return nil, fmt.Errorf("rule #%d: duplicate name %q", i+1, rule.Name)
+		}
+		seen[rule.Name] = true
+	}
+	return &rules, nil
+}
+
+func LoadRules(filename string) (*Rules, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := ParseRules(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return rules, nil
+}
+
+// columnLabel returns the name of the alert label for the stats column.
+func columnLabel(column string) string {
+	switch column {
+	case "sippytags":
+		return "variant"
+	case "name":
+		return "job"
+	}
+	if dimension := strings.TrimPrefix(column, "variant."); dimension != column {
+		return dimension
+	}
+	return column
+}
+
+// check evaluates the rule over the stats and returns alerts for the rows
+// that match the condition.
+func (r *Rule) check(stats *database.Stats) []Alert {
+	var columns []string
+	if r.Columns != "" {
+		columns = strings.Split(r.Columns, ",")
+	}
+	metric, op := metrics[r.Metric], operators[r.Op]
+	var alerts []Alert
+	for _, row := range stats.Data {
+		v := row.Values[0]
+		if v.Pass+v.Flake+v.Fail < r.MinRuns {
+			continue
+		}
+		value := metric(v)
+		if !op(value, r.Threshold) {
+			continue
+		}
+
+		labels := map[string]string{}
+		for k, v := range r.Labels {
+			labels[k] = v
+		}
+		for i, col := range columns {
+			labels[columnLabel(col)] = row.Columns[i]
+		}
+		if r.TestName != "" {
+			labels["test"] = r.TestName
+		}
+		labels["alertname"] = r.Name
+		labels["severity"] = r.Severity
+
+		annotations := map[string]string{}
+		for k, v := range r.Annotations {
+			annotations[k] = v
+		}
+		annotations["value"] = strconv.FormatFloat(value, 'g', 4, 64)
+
+		alerts = append(alerts, Alert{
+			Labels:      labels,
+			Annotations: annotations,
+		})
+	}
+	return alerts
+}
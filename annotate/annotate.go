@@ -0,0 +1,207 @@
+package annotate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/completion"
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/output"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+func withDB(fn func(db *database.DB) error) (err error) {
+	db, err := database.OpenDefault()
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer func() {
+		closeErr := db.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	return fn(db)
+}
+
+type AddOptions struct {
+	job    string
+	build  string
+	test   string
+	author string
+	note   string
+}
+
+func (opts *AddOptions) Run(ctx context.Context) error {
+	return withDB(func(db *database.DB) error {
+		var id int64
+		err := db.Transaction(func(tx *database.Tx) (err error) {
+			id, err = tx.AddAnnotation(opts.job, opts.build, opts.test, opts.note, opts.author)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		klog.Infof("Added annotation %d", id)
+		return nil
+	})
+}
+
+type ListOptions struct {
+	job    string
+	build  string
+	test   string
+	output string
+
+	out io.Writer
+}
+
+func (opts *ListOptions) Run(ctx context.Context) error {
+	if err := output.Validate(opts.output); err != nil {
+		return err
+	}
+	return withDB(func(db *database.DB) error {
+		annotations, err := db.ListAnnotations(database.AnnotationFilter{
+			Job:   opts.job,
+			Build: opts.build,
+			Test:  opts.test,
+		})
+		if err != nil {
+			return err
+		}
+		return output.Print(opts.out, opts.output, annotations, func(out io.Writer) error {
+			w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tCREATED\tAUTHOR\tTARGET\tNOTE")
+			for _, a := range annotations {
+				var target []string
+				if a.Job != "" {
+					target = append(target, a.Job+"/"+a.Build)
+				}
+				if a.Test != "" {
+					target = append(target, a.Test)
+				}
+				created := time.Unix(a.Created/1000, 0).UTC().Format("2006-01-02 15:04")
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", a.ID, created, a.Author, strings.Join(target, " "), a.Note)
+			}
+			return w.Flush()
+		})
+	})
+}
+
+func NewCmdAdd() *cobra.Command {
+	opts := &AddOptions{
+		author: os.Getenv("USER"),
+	}
+
+	cmd := &cobra.Command{
+		Use:   "add NOTE",
+		Short: "Attach a note to a build or a test",
+		Example: heredoc.Doc(`
+			ci-results annotate add --job=periodic-ci-openshift-release-master-nightly-4.9-e2e-aws --build=1412345 "known infra outage"
+			ci-results annotate add --test="[sig-network] Services should serve a basic endpoint from pods" "fixed by PR #123"
+		`),
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.note = args[0]
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.job, "job", "", "Name of the job of the build.")
+	cmd.Flags().StringVar(&opts.build, "build", "", "Number of the build.")
+	cmd.Flags().StringVar(&opts.test, "test", "", "Name of the test.")
+	cmd.Flags().StringVar(&opts.author, "author", opts.author, "Author of the note.")
+
+	completion.RegisterJobFlag(cmd)
+
+	return cmd
+}
+
+func NewCmdList() *cobra.Command {
+	opts := &ListOptions{
+		out: os.Stdout,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List notes",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.job, "job", "", "Show only notes for builds of the job.")
+	cmd.Flags().StringVar(&opts.build, "build", "", "Show only notes for builds with the number.")
+	cmd.Flags().StringVar(&opts.test, "test", "", "Show only notes for the test.")
+	output.AddFlag(cmd, &opts.output)
+
+	completion.RegisterJobFlag(cmd)
+
+	return cmd
+}
+
+func NewCmdRemove() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "remove ID...",
+		Short: "Remove notes",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := withDB(func(db *database.DB) error {
+				var ids []int64
+				for _, arg := range args {
+					id, err := strconv.ParseInt(arg, 10, 64)
+					if err != nil {
+						return fmt.Errorf("invalid annotation id %q", arg)
+					}
+					ids = append(ids, id)
+				}
+				return db.Transaction(func(tx *database.Tx) error {
+					for _, id := range ids {
+						if err := tx.RemoveAnnotation(id); err != nil {
+							return err
+						}
+					}
+					return nil
+				})
+			})
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	return cmd
+}
+
+func NewCmdAnnotate() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "annotate",
+		Short: "Manage notes on builds and tests",
+		Long: heredoc.Doc(`
+			Attach notes to builds and tests, for example to mark failures caused
+			by an infrastructure outage. The notes are included in the statistics
+			of the builds and the tests and in reports.
+		`),
+	}
+
+	cmd.AddCommand(NewCmdAdd())
+	cmd.AddCommand(NewCmdList())
+	cmd.AddCommand(NewCmdRemove())
+
+	return cmd
+}
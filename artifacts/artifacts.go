@@ -0,0 +1,86 @@
+// Package artifacts reads metadata that Prow uploads for each job run.
+package artifacts
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// DefaultURL is the location of artifacts of periodic OpenShift CI jobs.
+const DefaultURL = "https://storage.googleapis.com/origin-ci-test/logs"
+
+// Results of finished runs.
+const (
+	ResultSuccess = "SUCCESS"
+	ResultFailure = "FAILURE"
+	ResultAborted = "ABORTED"
+	ResultError   = "ERROR"
+)
+
+// Finished is the content of finished.json.
+type Finished struct {
+	Timestamp int64  `json:"timestamp"`
+	Passed    *bool  `json:"passed"`
+	Result    string `json:"result"`
+}
+
+type Client struct {
+	// BaseURL is the location of the directories of jobs.
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL: baseURL,
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// BuildURL returns the location of the artifacts of the run.
+func BuildURL(baseURL, jobName, number string) string {
+	return strings.TrimSuffix(baseURL, "/") + "/" + url.PathEscape(jobName) + "/" + url.PathEscape(number)
+}
+
+func (c *Client) finishedURL(jobName, number string) string {
+	return BuildURL(c.BaseURL, jobName, number) + "/finished.json"
+}
+
+// Finished returns the metadata of the finished run, or nil if the run
+// hasn't finished.
+func (c *Client) Finished(jobName, number string) (*Finished, error) {
+	u := c.finishedURL(jobName, number)
+	klog.V(4).Infof("downloading %s...", u)
+	resp, err := c.HTTPClient.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got unexpected http response from %s: %s", u, resp.Status)
+	}
+	var finished Finished
+	if err := json.NewDecoder(resp.Body).Decode(&finished); err != nil {
+		return nil, fmt.Errorf("%s: %w", u, err)
+	}
+	if finished.Result == "" && finished.Passed != nil {
+		// Older versions of Prow don't set the result.
+		if *finished.Passed {
+			finished.Result = ResultSuccess
+		} else {
+			finished.Result = ResultFailure
+		}
+	}
+	return &finished, nil
+}
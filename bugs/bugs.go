@@ -0,0 +1,157 @@
+package bugs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+type Bug struct {
+	Tracker string
+	ID      string
+	Summary string
+	Status  string
+	URL     string
+}
+
+type Tracker interface {
+	Name() string
+	Search(ctx context.Context, testName string) ([]Bug, error)
+}
+
+// httpClient has a timeout, so that an unresponsive tracker doesn't stall
+// the indexer.
+var httpClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
+
+func getJSON(req *http.Request, v interface{}) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("got unexpected http response from %s: %s", req.URL.Host, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+type Bugzilla struct {
+	URL string
+}
+
+func (b *Bugzilla) Name() string {
+	return "bugzilla"
+}
+
+func (b *Bugzilla) Search(ctx context.Context, testName string) ([]Bug, error) {
+	u, err := url.Parse(strings.TrimSuffix(b.URL, "/") + "/rest/bug")
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = url.Values{
+		"quicksearch":    {`"` + strings.ReplaceAll(testName, `"`, ``) + `"`},
+		"include_fields": {"id,summary,status"},
+		"limit":          {"20"},
+	}.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	klog.V(2).Infof("searching bugzilla for %q...", testName)
+
+	var result struct {
+		Bugs []struct {
+			ID      int    `json:"id"`
+			Summary string `json:"summary"`
+			Status  string `json:"status"`
+		} `json:"bugs"`
+	}
+	if err := getJSON(req, &result); err != nil {
+		return nil, err
+	}
+
+	var bugs []Bug
+	for _, bug := range result.Bugs {
+		id := strconv.Itoa(bug.ID)
+		bugs = append(bugs, Bug{
+			Tracker: b.Name(),
+			ID:      id,
+			Summary: bug.Summary,
+			Status:  bug.Status,
+			URL:     strings.TrimSuffix(b.URL, "/") + "/show_bug.cgi?id=" + id,
+		})
+	}
+	return bugs, nil
+}
+
+type Jira struct {
+	URL   string
+	Token string
+}
+
+func (j *Jira) Name() string {
+	return "jira"
+}
+
+func jqlString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"\"` + r.Replace(s) + `\""`
+}
+
+func (j *Jira) Search(ctx context.Context, testName string) ([]Bug, error) {
+	u, err := url.Parse(strings.TrimSuffix(j.URL, "/") + "/rest/api/2/search")
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = url.Values{
+		"jql":        {"text ~ " + jqlString(testName)},
+		"fields":     {"summary,status"},
+		"maxResults": {"20"},
+	}.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if j.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+j.Token)
+	}
+	klog.V(2).Infof("searching jira for %q...", testName)
+
+	var result struct {
+		Issues []struct {
+			Key    string `json:"key"`
+			Fields struct {
+				Summary string `json:"summary"`
+				Status  struct {
+					Name string `json:"name"`
+				} `json:"status"`
+			} `json:"fields"`
+		} `json:"issues"`
+	}
+	if err := getJSON(req, &result); err != nil {
+		return nil, err
+	}
+
+	var bugs []Bug
+	for _, issue := range result.Issues {
+		bugs = append(bugs, Bug{
+			Tracker: j.Name(),
+			ID:      issue.Key,
+			Summary: issue.Fields.Summary,
+			Status:  issue.Fields.Status.Name,
+			URL:     strings.TrimSuffix(j.URL, "/") + "/browse/" + issue.Key,
+		})
+	}
+	return bugs, nil
+}
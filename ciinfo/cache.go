@@ -0,0 +1,57 @@
+package ciinfo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cache stores configresolver responses on disk keyed by URL. The
+// modification time of a file is the time when the response was received.
+type cache struct {
+	dir string
+}
+
+func (c *cache) path(u string) string {
+	sum := sha256.Sum256([]byte(u))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// load returns the cached response for the URL and its age. It returns nil if
+// there is no cached response.
+func (c *cache) load(u string) ([]byte, time.Duration, error) {
+	p := c.path(u)
+	fi, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+	body, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, 0, err
+	}
+	return body, time.Since(fi.ModTime()), nil
+}
+
+func (c *cache) store(u string, body []byte) error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(c.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(body); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), c.path(u))
+}
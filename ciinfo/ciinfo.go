@@ -1,33 +1,59 @@
 package ciinfo
 
 import (
-	"encoding/json"
 	"fmt"
-	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
 )
 
 type Env struct {
-	Name    string `json:name"`
-	Default string `json:"default"`
+	Name    string `json:"name" yaml:"name"`
+	Default string `json:"default" yaml:"default"`
 }
 
 type Step struct {
-	As   string `json:"as"`
-	From string `json:"from"`
-	Env  []Env  `json:"env"`
+	As   string `json:"as" yaml:"as"`
+	From string `json:"from" yaml:"from"`
+	Env  []Env  `json:"env" yaml:"env"`
 }
 
 type LiteralSteps struct {
 	ClusterProfile string `json:"cluster_profile"`
+	Timeout        string `json:"timeout"`
 	Pre            []Step `json:"pre"`
 	Test           []Step `json:"test"`
 	Post           []Step `json:"post"`
 }
 
+// TestStep is a literal step, or a reference to a step or a chain in the step
+// registry.
+type TestStep struct {
+	Step  `yaml:",inline"`
+	Ref   string `json:"ref,omitempty" yaml:"ref,omitempty"`
+	Chain string `json:"chain,omitempty" yaml:"chain,omitempty"`
+}
+
+// MultiStageTest is a test that may use a workflow, chains and steps from the
+// step registry.
+type MultiStageTest struct {
+	ClusterProfile string            `json:"cluster_profile" yaml:"cluster_profile"`
+	Workflow       string            `json:"workflow" yaml:"workflow"`
+	Timeout        string            `json:"timeout" yaml:"timeout"`
+	Pre            []TestStep        `json:"pre" yaml:"pre"`
+	Test           []TestStep        `json:"test" yaml:"test"`
+	Post           []TestStep        `json:"post" yaml:"post"`
+	Env            map[string]string `json:"env" yaml:"env"`
+}
+
 type Test struct {
-	As           string       `json:"as"`
-	Cron         string       `json:"cron"`
-	LiteralSteps LiteralSteps `json:"literal_steps"`
+	As           string          `json:"as"`
+	Cron         string          `json:"cron"`
+	Timeout      string          `json:"timeout"`
+	Steps        *MultiStageTest `json:"steps"`
+	LiteralSteps LiteralSteps    `json:"literal_steps"`
 }
 
 type GeneratedMetadata struct {
@@ -37,35 +63,53 @@ type GeneratedMetadata struct {
 	Variant string `json:"variant"`
 }
 
+// Release describes how a release payload is obtained, only one of the
+// fields is set.
+type Release struct {
+	Candidate *struct {
+		Version string `json:"version"`
+	} `json:"candidate"`
+	Release *struct {
+		Version string `json:"version"`
+	} `json:"release"`
+	Prerelease *struct {
+		VersionBounds struct {
+			Lower string `json:"lower"`
+		} `json:"version_bounds"`
+	} `json:"prerelease"`
+	Integration *struct {
+		Name string `json:"name"`
+	} `json:"integration"`
+}
+
+var minorVersionRe = regexp.MustCompile(`^\d+\.\d+`)
+
+// MinorVersion returns the version of the release in the form X.Y, or an
+// empty string if it is unknown.
+func (r Release) MinorVersion() string {
+	var v string
+	switch {
+	case r.Candidate != nil:
+		v = r.Candidate.Version
+	case r.Release != nil:
+		v = r.Release.Version
+	case r.Prerelease != nil:
+		v = r.Prerelease.VersionBounds.Lower
+	case r.Integration != nil:
+		v = r.Integration.Name
+	}
+	return minorVersionRe.FindString(v)
+}
+
 type Config struct {
-	ZZGeneratedMetadata GeneratedMetadata `json:"zz_generated_metadata"`
-	Tests               []Test            `json:"tests"`
+	ZZGeneratedMetadata GeneratedMetadata  `json:"zz_generated_metadata"`
+	Releases            map[string]Release `json:"releases"`
+	Tests               []Test             `json:"tests"`
 }
 
+// DownloadConfig gets the config from the configresolver without caching.
 func DownloadConfig(org, repo, branch, variant string) (*Config, error) {
-	req, err := http.NewRequest("GET", "https://config.ci.openshift.org/config", nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request for configresolver: %w", err)
-	}
-	query := req.URL.Query()
-	query.Add("org", org)
-	query.Add("repo", repo)
-	query.Add("branch", branch)
-	if variant != "" {
-		query.Add("variant", variant)
-	}
-	req.URL.RawQuery = query.Encode()
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to make request to configresolver: %w", err)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("got unexpected http response from configresolver: %s", resp.Status)
-	}
-	var data Config
-	err = json.NewDecoder(resp.Body).Decode(&data)
-	return &data, err
+	return NewResolver().DownloadConfig(org, repo, branch, variant)
 }
 
 func getEnv(envs []Env, key string) string {
@@ -91,10 +135,87 @@ func testSuiteSlug(suite string) string {
 	return "unknown"
 }
 
-func Tags(test Test) []string {
+// stepsEnv returns the value of the parameter from the first step that has
+// it.
+func stepsEnv(steps LiteralSteps, key string) string {
+	for _, stage := range [][]Step{steps.Pre, steps.Test, steps.Post} {
+		for _, step := range stage {
+			for _, env := range step.Env {
+				if env.Name == key {
+					return env.Default
+				}
+			}
+		}
+	}
+	return ""
+}
+
+var tagUnsafeRe = regexp.MustCompile(`[^a-z0-9.]+`)
+
+func tagSlug(s string) string {
+	return strings.Trim(tagUnsafeRe.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+func networkSlug(networkType string) string {
+	switch networkType {
+	case "OVNKubernetes":
+		return "ovn"
+	case "OpenShiftSDN", "":
+		return "sdn"
+	}
+	return tagSlug(networkType)
+}
+
+func topologySlug(steps LiteralSteps) string {
+	switch stepsEnv(steps, "CONTROL_PLANE_TOPOLOGY") {
+	case "SingleReplica":
+		return "single-node"
+	case "External":
+		return "external"
+	}
+	for _, step := range steps.Pre {
+		if strings.Contains(step.As, "single-node") {
+			return "single-node"
+		}
+	}
+	return "ha"
+}
+
+// timeoutSlug formats the duration without zero minutes and seconds, e.g. 4h
+// or 1h30m.
+func timeoutSlug(timeout string) string {
+	d, err := time.ParseDuration(timeout)
+	if err != nil || d <= 0 {
+		return ""
+	}
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+func Tags(cfg *Config, test Test) []string {
 	var tags []string
+	tags = append(tags, "x-target-"+test.As)
 	tags = append(tags, "x-platform-"+test.LiteralSteps.ClusterProfile)
+	tags = append(tags, "x-network-"+networkSlug(stepsEnv(test.LiteralSteps, "NETWORK_TYPE")))
+	tags = append(tags, "x-topology-"+topologySlug(test.LiteralSteps))
+	if stepsEnv(test.LiteralSteps, "FIPS_ENABLED") == "true" {
+		tags = append(tags, "x-fips")
+	}
+	timeout := test.Timeout
+	if timeout == "" {
+		timeout = test.LiteralSteps.Timeout
+	}
+	if slug := timeoutSlug(timeout); slug != "" {
+		tags = append(tags, "x-timeout-"+slug)
+	}
 	foundTest := false
+	upgrade := false
 	for _, step := range test.LiteralSteps.Test {
 		switch step.As {
 		case "openshift-e2e-libvirt-test":
@@ -134,14 +255,29 @@ func Tags(test Test) []string {
 			foundTest = true
 			tags = append(tags, tag)
 		}
+		if strings.HasPrefix(getEnv(step.Env, "TEST_TYPE"), "upgrade") {
+			upgrade = true
+		}
 	}
 	if !foundTest {
 		tags = append(tags, "x-test-unknown")
 	}
+	if upgrade && cfg != nil {
+		if from := cfg.Releases["initial"].MinorVersion(); from != "" {
+			tags = append(tags, "x-upgrade-from-"+from)
+		}
+		if to := cfg.Releases["latest"].MinorVersion(); to != "" {
+			tags = append(tags, "x-upgrade-to-"+to)
+		}
+	}
 	return tags
 }
 
 type Tagger struct {
+	// Registry is used to resolve tests that are not resolved by the
+	// configresolver.
+	Registry *Registry
+
 	jobs map[string][]string
 }
 
@@ -159,10 +295,23 @@ func (t *Tagger) AddConfig(cfg *Config) {
 
 	for _, test := range cfg.Tests {
 		jobName := jobPrefix + test.As
-		t.jobs[jobName] = Tags(test)
+		if len(test.LiteralSteps.Test) == 0 && test.Steps != nil && t.Registry != nil {
+			steps, err := t.Registry.Resolve(*test.Steps)
+			if err != nil {
+				klog.Warningf("unable to resolve steps of %s: %v", jobName, err)
+			} else {
+				test.LiteralSteps = steps
+			}
+		}
+		t.jobs[jobName] = Tags(cfg, test)
 	}
 }
 
+// Len returns the number of jobs that the tagger has configs for.
+func (t *Tagger) Len() int {
+	return len(t.jobs)
+}
+
 func (t *Tagger) GetTags(jobName string) []string {
 	tags := t.jobs[jobName]
 	if len(tags) == 0 {
@@ -0,0 +1,175 @@
+package ciinfo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// maxChainDepth limits nesting of chains to detect cycles.
+const maxChainDepth = 16
+
+type chain struct {
+	As    string     `yaml:"as"`
+	Steps []TestStep `yaml:"steps"`
+	Env   []Env      `yaml:"env"`
+}
+
+type workflow struct {
+	As    string         `yaml:"as"`
+	Steps MultiStageTest `yaml:"steps"`
+}
+
+type registryFile struct {
+	Ref      *Step     `yaml:"ref"`
+	Chain    *chain    `yaml:"chain"`
+	Workflow *workflow `yaml:"workflow"`
+}
+
+// Registry is the step registry of OpenShift CI. It has steps (refs), chains
+// of steps and workflows.
+type Registry struct {
+	refs      map[string]Step
+	chains    map[string]chain
+	workflows map[string]MultiStageTest
+}
+
+// LoadRegistry reads the step registry from a directory, usually
+// ci-operator/step-registry in a checkout of openshift/release.
+func LoadRegistry(dir string) (*Registry, error) {
+	r := &Registry{
+		refs:      make(map[string]Step),
+		chains:    make(map[string]chain),
+		workflows: make(map[string]MultiStageTest),
+	}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, "-ref.yaml") && !strings.HasSuffix(name, "-chain.yaml") && !strings.HasSuffix(name, "-workflow.yaml") {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var f registryFile
+		if err := yaml.Unmarshal(data, &f); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		switch {
+		case f.Ref != nil:
+			r.refs[f.Ref.As] = *f.Ref
+		case f.Chain != nil:
+			r.chains[f.Chain.As] = *f.Chain
+		case f.Workflow != nil:
+			r.workflows[f.Workflow.As] = f.Workflow.Steps
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// setDefaults overrides defaults of the step parameters that are set in env.
+func setDefaults(step Step, env map[string]string) Step {
+	step.Env = append([]Env(nil), step.Env...)
+	for i, e := range step.Env {
+		if v, ok := env[e.Name]; ok {
+			step.Env[i].Default = v
+		}
+	}
+	return step
+}
+
+func (r *Registry) expand(steps []TestStep, env map[string]string, depth int) ([]Step, error) {
+	if depth > maxChainDepth {
+		return nil, fmt.Errorf("chains are nested too deeply")
+	}
+	var result []Step
+	for _, s := range steps {
+		switch {
+		case s.Ref != "":
+			ref, ok := r.refs[s.Ref]
+			if !ok {
+				return nil, fmt.Errorf("unknown step %s", s.Ref)
+			}
+			result = append(result, setDefaults(ref, env))
+		case s.Chain != "":
+			c, ok := r.chains[s.Chain]
+			if !ok {
+				return nil, fmt.Errorf("unknown chain %s", s.Chain)
+			}
+			// Parameters of the chain override defaults of its steps unless
+			// they are set by the test.
+			chainEnv := make(map[string]string, len(c.Env)+len(env))
+			for _, e := range c.Env {
+				chainEnv[e.Name] = e.Default
+			}
+			for k, v := range env {
+				chainEnv[k] = v
+			}
+			expanded, err := r.expand(c.Steps, chainEnv, depth+1)
+			if err != nil {
+				return nil, fmt.Errorf("chain %s: %w", s.Chain, err)
+			}
+			result = append(result, expanded...)
+		default:
+			result = append(result, setDefaults(s.Step, env))
+		}
+	}
+	return result, nil
+}
+
+// Resolve expands the workflow, chains and references of the test into
+// literal steps.
+func (r *Registry) Resolve(test MultiStageTest) (LiteralSteps, error) {
+	env := make(map[string]string)
+	if test.Workflow != "" {
+		wf, ok := r.workflows[test.Workflow]
+		if !ok {
+			return LiteralSteps{}, fmt.Errorf("unknown workflow %s", test.Workflow)
+		}
+		if test.ClusterProfile == "" {
+			test.ClusterProfile = wf.ClusterProfile
+		}
+		if test.Timeout == "" {
+			test.Timeout = wf.Timeout
+		}
+		if test.Pre == nil {
+			test.Pre = wf.Pre
+		}
+		if test.Test == nil {
+			test.Test = wf.Test
+		}
+		if test.Post == nil {
+			test.Post = wf.Post
+		}
+		for k, v := range wf.Env {
+			env[k] = v
+		}
+	}
+	for k, v := range test.Env {
+		env[k] = v
+	}
+
+	var err error
+	literal := LiteralSteps{ClusterProfile: test.ClusterProfile, Timeout: test.Timeout}
+	if literal.Pre, err = r.expand(test.Pre, env, 0); err != nil {
+		return LiteralSteps{}, err
+	}
+	if literal.Test, err = r.expand(test.Test, env, 0); err != nil {
+		return LiteralSteps{}, err
+	}
+	if literal.Post, err = r.expand(test.Post, env, 0); err != nil {
+		return LiteralSteps{}, err
+	}
+	return literal, nil
+}
@@ -0,0 +1,185 @@
+package ciinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+	"k8s.io/klog/v2"
+)
+
+// ConfigRef identifies a ci-operator config.
+type ConfigRef struct {
+	Org     string
+	Repo    string
+	Branch  string
+	Variant string
+}
+
+func (r ConfigRef) String() string {
+	s := fmt.Sprintf("%s/%s@%s", r.Org, r.Repo, r.Branch)
+	if r.Variant != "" {
+		s += "__" + r.Variant
+	}
+	return s
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ListConfigs finds ci-operator configs of the org in a checkout of
+// openshift/release. Repositories and branches are matched using shell
+// patterns.
+func ListConfigs(releaseRepo, org string, repoPatterns, branches []string) ([]ConfigRef, error) {
+	orgDir := filepath.Join(releaseRepo, "ci-operator", "config", org)
+	repos, err := ioutil.ReadDir(orgDir)
+	if err != nil {
+		return nil, err
+	}
+	var refs []ConfigRef
+	for _, repo := range repos {
+		if !repo.IsDir() || !matchAny(repoPatterns, repo.Name()) {
+			continue
+		}
+		files, err := ioutil.ReadDir(filepath.Join(orgDir, repo.Name()))
+		if err != nil {
+			return nil, err
+		}
+		prefix := org + "-" + repo.Name() + "-"
+		for _, f := range files {
+			name := f.Name()
+			if f.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".yaml") {
+				continue
+			}
+			ref := ConfigRef{Org: org, Repo: repo.Name()}
+			ref.Branch = strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".yaml")
+			if i := strings.Index(ref.Branch, "__"); i != -1 {
+				ref.Variant = ref.Branch[i+2:]
+				ref.Branch = ref.Branch[:i]
+			}
+			if matchAny(branches, ref.Branch) {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].String() < refs[j].String()
+	})
+	return refs, nil
+}
+
+// DownloadAll gets all configs of the org that match the repository and
+// branch patterns. The configs are enumerated from the checkout of
+// openshift/release in ReleaseRepo. Configs that can't be downloaded are
+// skipped with a warning.
+func (r *Resolver) DownloadAll(org string, repoPatterns, branches []string) ([]*Config, error) {
+	if r.ReleaseRepo == "" {
+		return nil, fmt.Errorf("a checkout of openshift/release is required to enumerate configs")
+	}
+	refs, err := ListConfigs(r.ReleaseRepo, org, repoPatterns, branches)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list configs: %w", err)
+	}
+
+	configs := make([]*Config, len(refs))
+	ch := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range ch {
+				ref := refs[i]
+				cfg, err := r.DownloadConfig(ref.Org, ref.Repo, ref.Branch, ref.Variant)
+				if err != nil {
+					klog.Warningf("unable to get config %s: %v", ref, err)
+					continue
+				}
+				configs[i] = cfg
+			}
+		}()
+	}
+	for i := range refs {
+		ch <- i
+	}
+	close(ch)
+	wg.Wait()
+
+	result := configs[:0]
+	for _, cfg := range configs {
+		if cfg != nil {
+			result = append(result, cfg)
+		}
+	}
+	klog.V(2).Infof("Downloaded %d of %d configs for %s", len(result), len(refs), org)
+	return result, nil
+}
+
+func (r ConfigRef) filename() string {
+	name := fmt.Sprintf("%s-%s-%s", r.Org, r.Repo, r.Branch)
+	if r.Variant != "" {
+		name += "__" + r.Variant
+	}
+	return filepath.Join("ci-operator", "config", r.Org, r.Repo, name+".yaml")
+}
+
+// jsonCompatible converts maps decoded by yaml.v2 so that they can be encoded
+// as JSON.
+func jsonCompatible(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonCompatible(value)
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = jsonCompatible(v[i])
+		}
+	}
+	return v
+}
+
+// readConfig reads the config from the checkout of openshift/release. The
+// YAML is converted to JSON to decode it the same way as the configresolver
+// responses.
+func (r *Resolver) readConfig(ref ConfigRef) (*Config, error) {
+	if r.ReleaseRepo == "" {
+		return nil, fmt.Errorf("a checkout of openshift/release is required to read configs locally")
+	}
+	filename := filepath.Join(r.ReleaseRepo, ref.filename())
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	buf, err := json.Marshal(jsonCompatible(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(buf, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	// Old configs don't have the generated metadata.
+	if cfg.ZZGeneratedMetadata.Org == "" {
+		cfg.ZZGeneratedMetadata = GeneratedMetadata{Org: ref.Org, Repo: ref.Repo, Branch: ref.Branch, Variant: ref.Variant}
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,123 @@
+package ciinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// DefaultResolverURL is the configresolver of OpenShift CI.
+const DefaultResolverURL = "https://config.ci.openshift.org"
+
+// Resolver gets ci-operator configs from the configresolver.
+type Resolver struct {
+	URL        string
+	HTTPClient *http.Client
+
+	// CacheDir is the directory to store responses in, caching is disabled
+	// if it is empty.
+	CacheDir string
+	// CacheTTL is how long cached responses are used without asking the
+	// configresolver.
+	CacheTTL time.Duration
+	// Offline makes the resolver serve only cached responses regardless of
+	// their age.
+	Offline bool
+	// ReleaseRepo is a checkout of openshift/release that is used to
+	// enumerate configs.
+	ReleaseRepo string
+	// Local makes the resolver read configs from ReleaseRepo instead of the
+	// configresolver. The configs are not resolved, so the Tagger needs the
+	// step registry.
+	Local bool
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{
+		URL:        DefaultResolverURL,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+func (r *Resolver) configURL(org, repo, branch, variant string) string {
+	query := url.Values{
+		"org":    {org},
+		"repo":   {repo},
+		"branch": {branch},
+	}
+	if variant != "" {
+		query.Set("variant", variant)
+	}
+	return r.URL + "/config?" + query.Encode()
+}
+
+func (r *Resolver) fetch(u string) ([]byte, error) {
+	resp, err := r.HTTPClient.Get(u)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request to configresolver: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got unexpected http response from configresolver: %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// get returns the response for the URL. When the configresolver is
+// unavailable, a stale cached response is used.
+func (r *Resolver) get(u string) ([]byte, error) {
+	if r.CacheDir == "" {
+		if r.Offline {
+			return nil, fmt.Errorf("offline mode requires a cache directory")
+		}
+		return r.fetch(u)
+	}
+
+	c := &cache{dir: r.CacheDir}
+	cached, age, err := c.load(u)
+	if err != nil {
+		klog.Warningf("unable to read cached config for %s: %v", u, err)
+	}
+	if r.Offline {
+		if cached == nil {
+			return nil, fmt.Errorf("no cached config for %s in offline mode", u)
+		}
+		return cached, nil
+	}
+	if cached != nil && age < r.CacheTTL {
+		return cached, nil
+	}
+
+	body, err := r.fetch(u)
+	if err != nil {
+		if cached == nil {
+			return nil, err
+		}
+		klog.Warningf("%v, using cached config from %s ago", err, age.Round(time.Second))
+		return cached, nil
+	}
+	if err := c.store(u, body); err != nil {
+		klog.Warningf("unable to cache config for %s: %v", u, err)
+	}
+	return body, nil
+}
+
+func (r *Resolver) DownloadConfig(org, repo, branch, variant string) (*Config, error) {
+	if r.Local {
+		return r.readConfig(ConfigRef{Org: org, Repo: repo, Branch: branch, Variant: variant})
+	}
+	body, err := r.get(r.configURL(org, repo, branch, variant))
+	if err != nil {
+		return nil, err
+	}
+	var data Config
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("unable to decode config for %s/%s@%s: %w", org, repo, branch, err)
+	}
+	return &data, nil
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/dmage/ci-results/database"
+)
+
+// Client reads data from the HTTP API of a ci-results server.
+type Client struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+func New(serverURL string) *Client {
+	return &Client{
+		URL:        strings.TrimSuffix(serverURL, "/"),
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+func (c *Client) String() string {
+	return c.URL
+}
+
+func (c *Client) Get(ctx context.Context, path string, params url.Values, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.URL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: unexpected status %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// BuildStats gets statistics from /api/builds, extra has optional parameters
+// like anchor or tz.
+func (c *Client) BuildStats(ctx context.Context, columns string, filter string, periods string, testName string, extra url.Values) (*database.Stats, error) {
+	var stats *database.Stats
+	params := url.Values{
+		"columns":  {columns},
+		"filter":   {filter},
+		"periods":  {periods},
+		"testname": {testName},
+	}
+	for k, v := range extra {
+		params[k] = v
+	}
+	err := c.Get(ctx, "/api/builds", params, &stats)
+	return stats, err
+}
+
+func (c *Client) Timeline(ctx context.Context, columns string, filter string, job string, testName string, days int) (*database.Timeline, error) {
+	var timeline *database.Timeline
+	err := c.Get(ctx, "/api/timeline", url.Values{
+		"columns":  {columns},
+		"filter":   {filter},
+		"job":      {job},
+		"testname": {testName},
+		"days":     {strconv.Itoa(days)},
+	}, &timeline)
+	return timeline, err
+}
+
+func (c *Client) ListJobs(ctx context.Context, filter string, days int) ([]database.JobInfo, error) {
+	var jobs []database.JobInfo
+	err := c.Get(ctx, "/api/jobs", url.Values{
+		"filter": {filter},
+		"days":   {strconv.Itoa(days)},
+	}, &jobs)
+	return jobs, err
+}
+
+func (c *Client) FailureStreaks(ctx context.Context, filter string, days int, minFailures int) ([]database.FailureStreak, error) {
+	var streaks []database.FailureStreak
+	err := c.Get(ctx, "/api/streaks", url.Values{
+		"filter": {filter},
+		"days":   {strconv.Itoa(days)},
+		"min":    {strconv.Itoa(minFailures)},
+	}, &streaks)
+	return streaks, err
+}
@@ -0,0 +1,146 @@
+package completion
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/database"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+func withDB(fn func(db *database.DB) ([]string, error)) ([]string, cobra.ShellCompDirective) {
+	db, err := database.OpenDefault()
+	if err != nil {
+		cobra.CompErrorln(err.Error())
+		return nil, cobra.ShellCompDirectiveError
+	}
+	defer db.Close()
+
+	values, err := fn(db)
+	if err != nil {
+		cobra.CompErrorln(err.Error())
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return values, cobra.ShellCompDirectiveNoFileComp
+}
+
+func withPrefix(values []string, prefix string) []string {
+	var results []string
+	for _, v := range values {
+		if strings.HasPrefix(v, prefix) {
+			results = append(results, v)
+		}
+	}
+	return results
+}
+
+// Jobs completes names of jobs.
+func Jobs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return withDB(func(db *database.DB) ([]string, error) {
+		names, err := db.JobNames()
+		return withPrefix(names, toComplete), err
+	})
+}
+
+// Tags completes job tags.
+func Tags(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return withDB(func(db *database.DB) ([]string, error) {
+		tags, err := db.AllTags()
+		return withPrefix(tags, toComplete), err
+	})
+}
+
+// Filter completes the last term of a space separated list of tags, where
+// tags may be prefixed with - to exclude them.
+func Filter(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return withDB(func(db *database.DB) ([]string, error) {
+		tags, err := db.AllTags()
+		if err != nil {
+			return nil, err
+		}
+
+		head, last := "", toComplete
+		if i := strings.LastIndex(toComplete, " "); i != -1 {
+			head, last = toComplete[:i+1], toComplete[i+1:]
+		}
+		exclude := strings.HasPrefix(last, "-")
+		last = strings.TrimPrefix(last, "-")
+
+		var results []string
+		for _, tag := range withPrefix(tags, last) {
+			if exclude {
+				tag = "-" + tag
+			}
+			results = append(results, head+tag)
+		}
+		return results, nil
+	})
+}
+
+// Tests completes test names.
+func Tests(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) != 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return withDB(func(db *database.DB) ([]string, error) {
+		names, err := db.SearchTests(toComplete, 100)
+		return withPrefix(names, toComplete), err
+	})
+}
+
+// RegisterFilterFlag enables completion for the --filter flag of the command.
+func RegisterFilterFlag(cmd *cobra.Command) {
+	if err := cmd.RegisterFlagCompletionFunc("filter", Filter); err != nil {
+		klog.Fatal(err)
+	}
+}
+
+// RegisterJobFlag enables completion for the --job flag of the command.
+func RegisterJobFlag(cmd *cobra.Command) {
+	if err := cmd.RegisterFlagCompletionFunc("job", Jobs); err != nil {
+		klog.Fatal(err)
+	}
+}
+
+func NewCmdCompletion() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "completion [bash|zsh|fish|powershell]",
+		Short: "Generate a shell completion script",
+		Long: heredoc.Doc(`
+			Generate a completion script for the given shell.
+
+			Job names, tags and test names are completed from the local database.
+		`),
+		Example: heredoc.Doc(`
+			source <(ci-results completion bash)
+			ci-results completion zsh > "${fpath[1]}/_ci-results"
+			ci-results completion fish > ~/.config/fish/completions/ci-results.fish
+		`),
+		ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+		Args:      cobra.ExactValidArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var err error
+			root := cmd.Root()
+			switch args[0] {
+			case "bash":
+				err = root.GenBashCompletion(os.Stdout)
+			case "zsh":
+				err = root.GenZshCompletion(os.Stdout)
+			case "fish":
+				err = root.GenFishCompletion(os.Stdout, true)
+			case "powershell":
+				err = root.GenPowerShellCompletion(os.Stdout)
+			default:
+				err = fmt.Errorf("unsupported shell %s", args[0])
+			}
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"k8s.io/klog/v2"
+)
+
+const DefaultFile = ".ci-results.yaml"
+
+// loaded is the config file that has been read by Load.
+var loaded *viper.Viper
+
+// sectionKey returns the prefix for keys of the command's own flags, for
+// example "export.subset." for "ci-results export subset".
+func sectionKey(cmd *cobra.Command) string {
+	var names []string
+	for c := cmd; c.HasParent(); c = c.Parent() {
+		names = append([]string{c.Name()}, names...)
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return strings.Join(names, ".") + "."
+}
+
+func apply(v *viper.Viper, flags *pflag.FlagSet, prefix string) error {
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		key := prefix + f.Name
+		if err != nil || f.Changed || !v.IsSet(key) {
+			return
+		}
+		switch f.Value.Type() {
+		case "stringSlice", "stringArray":
+			for _, s := range v.GetStringSlice(key) {
+				if err = f.Value.Set(s); err != nil {
+					break
+				}
+			}
+		default:
+			err = f.Value.Set(v.GetString(key))
+		}
+		if err != nil {
+			err = fmt.Errorf("%s: %w", key, err)
+		}
+	})
+	return err
+}
+
+// Load reads the config file and sets flags of the command that are not set
+// on the command line. Flags of the root command are top-level keys, flags of
+// subcommands are nested under the names of the subcommands.
+//
+// If path is empty, ~/.ci-results.yaml is used if it exists.
+func Load(cmd *cobra.Command, path string) error {
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		path = filepath.Join(home, DefaultFile)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil
+		}
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("unable to read config file: %w", err)
+	}
+	if err := apply(v, cmd.InheritedFlags(), ""); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := apply(v, cmd.LocalFlags(), sectionKey(cmd)); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	loaded = v
+	klog.V(2).Infof("Using config file %s", path)
+	return nil
+}
+
+// UnmarshalKey decodes a section of the config file that doesn't correspond
+// to flags, e.g. the list of reports of the server. It does nothing if there
+// is no config file.
+func UnmarshalKey(key string, out interface{}) error {
+	if loaded == nil || !loaded.IsSet(key) {
+		return nil
+	}
+	if err := loaded.UnmarshalKey(key, out); err != nil {
+		return fmt.Errorf("%s: %s: %w", loaded.ConfigFileUsed(), key, err)
+	}
+	return nil
+}
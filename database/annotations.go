@@ -0,0 +1,189 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type Annotation struct {
+	ID        int64  `json:"id"`
+	Job       string `json:"job,omitempty"`
+	Dashboard string `json:"dashboard,omitempty"`
+	Build     string `json:"build,omitempty"`
+	Test      string `json:"test,omitempty"`
+	Note      string `json:"note"`
+	Author    string `json:"author"`
+	Created   int64  `json:"created"`
+	// Links are links to pages of the annotated job or build, they are
+	// filled by the server and reports.
+	Links map[string]string `json:"links,omitempty"`
+}
+
+type AnnotationFilter struct {
+	Job   string
+	Build string
+	Test  string
+	Since int64
+}
+
+// AddAnnotation attaches a note to a build (jobName and number), to a test,
+// or to a test in a build.
+func (db *dbImpl) AddAnnotation(jobName string, number string, testName string, note string, author string) (int64, error) {
+	if strings.TrimSpace(note) == "" {
+		return 0, newErrInvalidParam("note", note, "note is empty")
+	}
+	if (jobName == "") != (number == "") {
+		return 0, newErrInvalidParam("build", jobName+"/"+number, "both job and build number are required to annotate a build")
+	}
+	if jobName == "" && testName == "" {
+		return 0, newErrInvalidParam("test", testName, "either a build or a test is required")
+	}
+
+	var buildID, testID sql.NullInt64
+	if jobName != "" {
+		jobID, err := db.FindJob(jobName)
+		if err != nil {
+			return 0, err
+		}
+		err = db.QueryRow("SELECT id FROM builds WHERE job_id = ? AND number = ?", jobID, number).Scan(&buildID)
+		if err == sql.ErrNoRows {
+			return 0, newErrNotFound("build %s/%s does not exist", jobName, number)
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	if testName != "" {
+		id, err := db.FindTest(testName)
+		if err != nil {
+			return 0, err
+		}
+		testID = sql.NullInt64{Int64: id, Valid: true}
+	}
+
+	result, err := db.Exec("INSERT INTO annotations (build_id, test_id, note, author, created) VALUES (?, ?, ?, ?, ?)",
+		buildID, testID, note, author, time.Now().Unix()*1000)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (db *dbImpl) RemoveAnnotation(id int64) error {
+	result, err := db.Exec("DELETE FROM annotations WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return newErrNotFound("annotation %d does not exist", id)
+	}
+	return nil
+}
+
+func (db *dbImpl) queryAnnotations(cond string, params ...interface{}) ([]Annotation, error) {
+	results := []Annotation{}
+	rows, err := db.Query(`
+		SELECT a.id, IFNULL(j.name, ''), IFNULL(j.dashboard, ''), IFNULL(b.number, ''), IFNULL(t.name, ''), a.note, a.author, a.created
+		FROM annotations a
+		LEFT JOIN builds b ON b.id = a.build_id
+		LEFT JOIN jobs j ON j.id = b.job_id
+		LEFT JOIN test_names t ON t.id = a.test_id
+		WHERE `+cond+`
+		ORDER BY a.created, a.id`, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a Annotation
+		if err := rows.Scan(&a.ID, &a.Job, &a.Dashboard, &a.Build, &a.Test, &a.Note, &a.Author, &a.Created); err != nil {
+			return nil, err
+		}
+		results = append(results, a)
+	}
+	return results, rows.Err()
+}
+
+// GetAnnotation returns the annotation with the given id.
+func (db *dbImpl) GetAnnotation(id int64) (Annotation, error) {
+	annotations, err := db.queryAnnotations("a.id = ?", id)
+	if err != nil {
+		return Annotation{}, err
+	}
+	if len(annotations) == 0 {
+		return Annotation{}, newErrNotFound("annotation %d does not exist", id)
+	}
+	return annotations[0], nil
+}
+
+func (db *dbImpl) ListAnnotations(filter AnnotationFilter) ([]Annotation, error) {
+	conds := []string{"1"}
+	var params []interface{}
+	if filter.Job != "" {
+		conds = append(conds, "j.name = ?")
+		params = append(params, filter.Job)
+	}
+	if filter.Build != "" {
+		conds = append(conds, "b.number = ?")
+		params = append(params, filter.Build)
+	}
+	if filter.Test != "" {
+		conds = append(conds, "t.name = ?")
+		params = append(params, filter.Test)
+	}
+	if filter.Since != 0 {
+		conds = append(conds, "a.created >= ?")
+		params = append(params, filter.Since)
+	}
+	return db.queryAnnotations(strings.Join(conds, " AND "), params...)
+}
+
+// attachAnnotations adds annotations to the rows of stats that are grouped by
+// job name or test. Build annotations are attached only if the build is not
+// older than since.
+func (db *dbImpl) attachAnnotations(stats *Stats, columns string, testName string, since int64) error {
+	jobIdx, testIdx := -1, -1
+	for i, col := range strings.Split(columns, ",") {
+		switch col {
+		case "name":
+			jobIdx = i
+		case "test":
+			testIdx = i
+		}
+	}
+	if jobIdx == -1 && testIdx == -1 && testName == "" {
+		return nil
+	}
+
+	annotations, err := db.queryAnnotations("a.build_id IS NULL OR b.timestamp >= ?", since)
+	if err != nil {
+		return err
+	}
+	if len(annotations) == 0 {
+		return nil
+	}
+
+	for _, row := range stats.Data {
+		rowJob, rowTest := "", testName
+		if jobIdx != -1 {
+			rowJob = row.Columns[jobIdx]
+		}
+		if testIdx != -1 {
+			rowTest = row.Columns[testIdx]
+		}
+		for _, a := range annotations {
+			if a.Test != "" && a.Test != rowTest {
+				continue
+			}
+			if a.Job != "" && a.Job != rowJob && (rowJob != "" || a.Test == "") {
+				continue
+			}
+			row.Annotations = append(row.Annotations, a)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+type Anomaly struct {
+	Columns          []string    `json:"columns"`
+	Recent           StatsValues `json:"recent"`
+	Baseline         StatsValues `json:"baseline"`
+	RecentFailRate   float64     `json:"recent_fail_rate"`
+	BaselineFailRate float64     `json:"baseline_fail_rate"`
+	ZScore           float64     `json:"zscore"`
+}
+
+func failRate(v StatsValues) float64 {
+	total := v.Pass + v.Flake + v.Fail
+	if total == 0 {
+		return 0
+	}
+	return float64(v.Fail) / float64(total)
+}
+
+// zScore returns how many standard deviations the recent failure rate is
+// above the baseline one. It is not defined for recent stats without runs.
+func zScore(recent, baseline StatsValues) float64 {
+	n := recent.Pass + recent.Flake + recent.Fail
+	// Laplace smoothing keeps the variance non-zero for baselines without failures.
+	p0 := float64(baseline.Fail+1) / float64(baseline.Pass+baseline.Flake+baseline.Fail+2)
+	p1 := failRate(recent)
+	return (p1 - p0) / math.Sqrt(p0*(1-p0)/float64(n))
+}
+
+func (db *dbImpl) Anomalies(columns string, filter string, recentDays int, baselineDays int, threshold float64, minRuns int) ([]Anomaly, error) {
+	if minRuns < 1 {
+		return nil, newErrInvalidParam("minruns", fmt.Sprint(minRuns), "at least one run is needed to score a row")
+	}
+
+	stats, err := db.BuildStats(columns, filter, fmt.Sprintf("%d,%d", recentDays, baselineDays), "")
+	if err != nil {
+		return nil, err
+	}
+
+	anomalies := []Anomaly{}
+	for _, row := range stats.Data {
+		recent, baseline := row.Values[0], row.Values[1]
+		n := recent.Pass + recent.Flake + recent.Fail
+		if n == 0 || n < minRuns {
+			continue
+		}
+
+		z := zScore(recent, baseline)
+		if z < threshold {
+			continue
+		}
+
+		anomalies = append(anomalies, Anomaly{
+			Columns:          row.Columns,
+			Recent:           recent,
+			Baseline:         baseline,
+			RecentFailRate:   failRate(recent),
+			BaselineFailRate: failRate(baseline),
+			ZScore:           z,
+		})
+	}
+	sort.Slice(anomalies, func(i, j int) bool {
+		return anomalies[i].ZScore > anomalies[j].ZScore
+	})
+	return anomalies, nil
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"math"
+	"testing"
+)
+
+func TestZScore(t *testing.T) {
+	testCases := []struct {
+		name     string
+		recent   StatsValues
+		baseline StatsValues
+		want     float64
+	}{
+		{
+			// p0 = 1/10, p1 = 4/4, sd = sqrt(0.1*0.9/4) = 0.15.
+			name:     "all recent runs fail",
+			recent:   StatsValues{Fail: 4},
+			baseline: StatsValues{Pass: 8},
+			want:     6,
+		},
+		{
+			// p0 = 2/4, p1 = 2/4.
+			name:     "same rate",
+			recent:   StatsValues{Pass: 1, Fail: 1},
+			baseline: StatsValues{Pass: 1, Fail: 1},
+			want:     0,
+		},
+		{
+			// p0 = 9/10, p1 = 0/9, sd = sqrt(0.9*0.1/9) = 0.1.
+			name:     "recovered",
+			recent:   StatsValues{Pass: 6, Flake: 3},
+			baseline: StatsValues{Fail: 8},
+			want:     -9,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := zScore(tc.recent, tc.baseline)
+			if math.Abs(got-tc.want) > 1e-9 {
+				t.Errorf("got %g, want %g", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"time"
+)
+
+func bucketStart(t time.Time, bucket string) (time.Time, error) {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch bucket {
+	case "day":
+		return day, nil
+	case "week":
+		// Weeks start on Monday.
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7), nil
+	}
+	return time.Time{}, newErrInvalidParam("bucket", bucket, "unknown bucket", "day", "week")
+}
+
+func bucketStep(bucket string) int {
+	if bucket == "week" {
+		return 7
+	}
+	return 1
+}
+
+func (db *dbImpl) BuildStatsByBucket(columns string, filter string, bucket string, count int, testName string) (*Stats, error) {
+	start, err := bucketStart(time.Now().UTC(), bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	var labels []string
+	var periods []period
+	end := int64(0)
+	for i := 0; i < count; i++ {
+		labels = append(labels, start.Format("2006-01-02"))
+		periods = append(periods, period{start: start.Unix() * 1000, end: end})
+		end = start.Unix() * 1000
+		start = start.AddDate(0, 0, -bucketStep(bucket))
+	}
+
+	stats, err := db.periodStats(columns, filter, testName, periods)
+	if err != nil {
+		return nil, err
+	}
+	stats.Buckets = labels
+	return stats, nil
+}
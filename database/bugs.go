@@ -0,0 +1,89 @@
+package database
+
+import (
+	"time"
+
+	"github.com/dmage/ci-results/testgrid"
+)
+
+type LinkedBug struct {
+	Tracker string `json:"tracker"`
+	ID      string `json:"id"`
+	Summary string `json:"summary"`
+	Status  string `json:"status"`
+	URL     string `json:"url"`
+}
+
+func (db *dbImpl) SetTestBugs(testName string, tracker string, bugs []LinkedBug) error {
+	testID, err := db.FindTest(testName)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("DELETE FROM test_bugs WHERE test_id = ? AND tracker = ?", testID, tracker)
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix() * 1000
+	for _, bug := range bugs {
+		_, err := db.Exec(
+			"INSERT OR REPLACE INTO test_bugs (test_id, tracker, bug_id, summary, status, url, updated) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			testID, tracker, bug.ID, bug.Summary, bug.Status, bug.URL, now,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *dbImpl) TestBugs(testName string) ([]LinkedBug, error) {
+	results := []LinkedBug{}
+	rows, err := db.Query(`
+		SELECT tb.tracker, tb.bug_id, tb.summary, tb.status, tb.url
+		FROM test_bugs tb
+		JOIN test_names t ON t.id = tb.test_id
+		WHERE t.name = ?
+		ORDER BY tb.tracker, tb.bug_id
+	`, testName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bug LinkedBug
+		if err := rows.Scan(&bug.Tracker, &bug.ID, &bug.Summary, &bug.Status, &bug.URL); err != nil {
+			return nil, err
+		}
+		results = append(results, bug)
+	}
+	return results, rows.Err()
+}
+
+// FailingTests returns the names of the tests that failed most often during
+// the last days.
+func (db *dbImpl) FailingTests(days int, limit int) ([]string, error) {
+	var results []string
+	rows, err := db.Query(`
+		SELECT t.name
+		FROM test_results tr
+		JOIN builds b ON b.id = tr.build_id
+		JOIN test_names t ON t.id = tr.test_id
+		WHERE tr.status IN (`+sqlStatusList(testgrid.CategoryFail)+`) AND b.timestamp >= ? AND t.name != 'Overall'
+		GROUP BY t.name
+		ORDER BY COUNT(*) DESC
+		LIMIT ?
+	`, time.Now().AddDate(0, 0, -days).Unix()*1000, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		results = append(results, name)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"sort"
+	"time"
+
+	"github.com/dmage/ci-results/testgrid"
+)
+
+type CorrelatedPair struct {
+	Tests    [2]string `json:"tests"`
+	Together int       `json:"together"`
+	Failures [2]int    `json:"failures"`
+	Jaccard  float64   `json:"jaccard"`
+}
+
+type CorrelatedFailures struct {
+	Pairs  []CorrelatedPair `json:"pairs"`
+	Groups [][]string       `json:"groups"`
+}
+
+func (db *dbImpl) CorrelatedFailures(filter string, days int, minTogether int, minJaccard float64) (*CorrelatedFailures, error) {
+	results := &CorrelatedFailures{
+		Pairs:  []CorrelatedPair{},
+		Groups: [][]string{},
+	}
+
+	since := time.Now().AddDate(0, 0, -days).Unix() * 1000
+
+	jobCond := ""
+	if filter != "" {
+		jobIDs, err := db.findJobIDsByFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		if len(jobIDs) == 0 {
+			return results, nil
+		}
+		jobCond = " AND b.job_id IN (" + sqlInt64List(jobIDs) + ")"
+	}
+
+	failures := map[int64]int{}
+	names := map[int64]string{}
+	rows, err := db.Query(`
+		SELECT t.id, t.name, COUNT(*)
+		FROM test_results tr
+		JOIN builds b ON b.id = tr.build_id
+		JOIN test_names t ON t.id = tr.test_id
+		WHERE tr.status IN (`+sqlStatusList(testgrid.CategoryFail)+`) AND t.name != 'Overall' AND b.timestamp >= ?`+jobCond+`
+		GROUP BY t.id
+	`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var name string
+		var count int
+		if err := rows.Scan(&id, &name, &count); err != nil {
+			return nil, err
+		}
+		failures[id] = count
+		names[id] = name
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`
+		SELECT a.test_id, c.test_id, COUNT(*)
+		FROM test_results a
+		JOIN test_results c ON c.build_id = a.build_id AND c.test_id > a.test_id AND c.status IN (`+sqlStatusList(testgrid.CategoryFail)+`)
+		JOIN builds b ON b.id = a.build_id
+		WHERE a.status IN (`+sqlStatusList(testgrid.CategoryFail)+`) AND b.timestamp >= ?`+jobCond+`
+		GROUP BY a.test_id, c.test_id
+		HAVING COUNT(*) >= ?
+	`, since, minTogether)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parent := map[int64]int64{}
+	var find func(id int64) int64
+	find = func(id int64) int64 {
+		p, ok := parent[id]
+		if !ok || p == id {
+			parent[id] = id
+			return id
+		}
+		root := find(p)
+		parent[id] = root
+		return root
+	}
+
+	for rows.Next() {
+		var a, c int64
+		var together int
+		if err := rows.Scan(&a, &c, &together); err != nil {
+			return nil, err
+		}
+		if _, ok := names[a]; !ok {
+			continue
+		}
+		if _, ok := names[c]; !ok {
+			continue
+		}
+		jaccard := float64(together) / float64(failures[a]+failures[c]-together)
+		if jaccard < minJaccard {
+			continue
+		}
+		results.Pairs = append(results.Pairs, CorrelatedPair{
+			Tests:    [2]string{names[a], names[c]},
+			Together: together,
+			Failures: [2]int{failures[a], failures[c]},
+			Jaccard:  jaccard,
+		})
+		parent[find(a)] = find(c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	groups := map[int64][]string{}
+	for id := range parent {
+		root := find(id)
+		groups[root] = append(groups[root], names[id])
+	}
+	for _, group := range groups {
+		sort.Strings(group)
+		results.Groups = append(results.Groups, group)
+	}
+
+	sort.Slice(results.Pairs, func(i, j int) bool {
+		if results.Pairs[i].Together != results.Pairs[j].Together {
+			return results.Pairs[i].Together > results.Pairs[j].Together
+		}
+		return results.Pairs[i].Jaccard > results.Pairs[j].Jaccard
+	})
+	sort.Slice(results.Groups, func(i, j int) bool {
+		if len(results.Groups[i]) != len(results.Groups[j]) {
+			return len(results.Groups[i]) > len(results.Groups[j])
+		}
+		return results.Groups[i][0] < results.Groups[j][0]
+	})
+
+	return results, nil
+}
@@ -0,0 +1,34 @@
+// Package databasetest provides databases for tests.
+package databasetest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/dmage/ci-results/database"
+)
+
+// Open returns an empty database in a temporary directory. Leak detection is
+// enabled, and the database is closed when the test finishes, so the test
+// fails if it leaves rows or transactions open.
+func Open(t testing.TB) *database.DB {
+	t.Helper()
+
+	detectLeaks := database.DetectLeaks
+	database.DetectLeaks = true
+
+	db, err := database.Open(filepath.Join(t.TempDir(), "results.db"))
+	if err != nil {
+		database.DetectLeaks = detectLeaks
+		t.Fatalf("unable to open database: %v", err)
+	}
+	t.Cleanup(func() {
+		defer func() {
+			database.DetectLeaks = detectLeaks
+		}()
+		if err := db.Close(); err != nil {
+			t.Errorf("unable to close database: %v", err)
+		}
+	})
+	return db
+}
@@ -0,0 +1,36 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// DataVersion detects changes of the database committed by any connection,
+// including connections of other processes like the indexer.
+type DataVersion struct {
+	mu   sync.Mutex
+	conn *sql.Conn
+}
+
+// DataVersion reserves a connection for tracking changes of the database.
+func (db *DB) DataVersion(ctx context.Context) (*DataVersion, error) {
+	conn, err := db.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &DataVersion{conn: conn}, nil
+}
+
+// Get returns a number that changes after the database is modified.
+func (v *DataVersion) Get(ctx context.Context) (int64, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var version int64
+	err := v.conn.QueryRowContext(ctx, "pragma data_version").Scan(&version)
+	return version, err
+}
+
+func (v *DataVersion) Close() error {
+	return v.conn.Close()
+}
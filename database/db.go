@@ -2,6 +2,7 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -10,7 +11,6 @@ import (
 
 	"github.com/dmage/ci-results/testgrid"
 	lru "github.com/hashicorp/golang-lru"
-	_ "github.com/mattn/go-sqlite3"
 	"k8s.io/klog/v2"
 )
 
@@ -19,8 +19,18 @@ type JobTags struct {
 	Mod      string
 	TestType string
 	Sippy    []string
+	// CIInfo are tags derived from ci-operator configs.
+	CIInfo []string
+	// Variants maps variant dimensions to their values.
+	Variants map[string]string
 }
 
+const (
+	FailureInstall = "install"
+	FailureTests   = "tests"
+	FailureInfra   = "infra"
+)
+
 type errNotFound struct {
 	msg string
 }
@@ -40,6 +50,46 @@ func IsNotFound(err error) bool {
 	return ok
 }
 
+// errInvalidParam reports an invalid parameter of a query, it is caused by
+// the user rather than by the database.
+type errInvalidParam struct {
+	param    string
+	value    string
+	reason   string
+	accepted []string
+}
+
+func newErrInvalidParam(param, value, reason string, accepted ...string) errInvalidParam {
+	return errInvalidParam{
+		param:    param,
+		value:    value,
+		reason:   reason,
+		accepted: accepted,
+	}
+}
+
+func (e errInvalidParam) Error() string {
+	msg := fmt.Sprintf("invalid %s %q: %s", e.param, e.value, e.reason)
+	if len(e.accepted) > 0 {
+		msg += " (accepted: " + strings.Join(e.accepted, ", ") + ")"
+	}
+	return msg
+}
+
+// InvalidParam returns an error that reports an invalid parameter of a
+// request, IsInvalidParam is true for it.
+func InvalidParam(param, value, reason string, accepted ...string) error {
+	return newErrInvalidParam(param, value, reason, accepted...)
+}
+
+func IsInvalidParam(err error) bool {
+	var e errInvalidParam
+	return errors.As(err, &e)
+}
+
+// statsColumns are the columns that statistics can be grouped by.
+var statsColumns = []string{"sippytags", "name", "dashboard", "test", "sig", "owner", "variant.DIMENSION"}
+
 type buildKey struct {
 	JobID  int64
 	Number string
@@ -48,6 +98,7 @@ type buildKey struct {
 type sqlConn interface {
 	Prepare(query string) (*sql.Stmt, error)
 	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
 	Exec(query string, args ...interface{}) (sql.Result, error)
 }
 
@@ -58,6 +109,18 @@ type dbImpl struct {
 	buildsCache *lru.Cache
 	testsCache  *lru.Cache
 
+	// testIDs has ids of all tests if they are preloaded.
+	testIDs map[string]int64
+
+	// renames maps old test names to new ones.
+	renames map[string]string
+
+	// parallelPeriods is the number of periods from which BuildStats runs a
+	// query per period concurrently, 0 disables it.
+	parallelPeriods int
+
+	fts bool
+
 	selectJobStmt        *sql.Stmt
 	insertJobStmt        *sql.Stmt
 	selectBuildStmt      *sql.Stmt
@@ -65,7 +128,6 @@ type dbImpl struct {
 	selectTestStmt       *sql.Stmt
 	selectAllTestsStmt   *sql.Stmt
 	insertTestStmt       *sql.Stmt
-	selectTestResultStmt *sql.Stmt
 	insertTestResultStmt *sql.Stmt
 }
 
@@ -80,16 +142,29 @@ type Tx struct {
 }
 
 func Open(dsn string) (*DB, error) {
-	sqlDB, err := sql.Open("sqlite3", dsn)
+	return OpenWithOptions(dsn, Options{})
+}
+
+func OpenWithOptions(dsn string, opts Options) (*DB, error) {
+	sqlDB, err := sql.Open(driverName, opts.DSN(dsn))
 	if err != nil {
 		return nil, fmt.Errorf("unable to open database: %w", err)
 	}
+	if opts.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(opts.MaxOpenConns)
+	}
 
 	db := &DB{
 		dbImpl: dbImpl{sqlConn: sqlDB},
 		db:     sqlDB,
 	}
 
+	err = (&Migrator{db: sqlDB}).ensureLatest()
+	if err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("unable to migrate database: %w", err)
+	}
+
 	err = db.init()
 	if err != nil {
 		sqlDB.Close()
@@ -101,11 +176,25 @@ func Open(dsn string) (*DB, error) {
 	return db, err
 }
 
+var DefaultDSN = "./results.db?_journal_mode=WAL&_cache_size=-10000"
+
 func OpenDefault() (*DB, error) {
-	return Open("./results.db?_journal_mode=WAL&_cache_size=-10000")
+	return OpenWithOptions(DefaultDSN, DefaultOptions)
+}
+
+// Begin starts a write transaction. The write lock is taken right away (the
+// DSN has _txlock=immediate), so statements of the transaction don't fail if
+// another process writes to the database. If the database is still locked
+// after the busy timeout, Begin retries with backoff.
+func (db *DB) Begin() (tx *Tx, err error) {
+	err = retryBusy(func() error {
+		tx, err = db.begin()
+		return err
+	})
+	return tx, err
 }
 
-func (db *DB) Begin() (*Tx, error) {
+func (db *DB) begin() (*Tx, error) {
 	tx, err := db.db.Begin()
 	if err != nil {
 		return nil, err
@@ -113,13 +202,26 @@ func (db *DB) Begin() (*Tx, error) {
 
 	impl := db.dbImpl
 	impl.sqlConn = tx
+	for _, stmt := range impl.stmts() {
+		*stmt = tx.Stmt(*stmt)
+	}
 	return &Tx{
 		dbImpl: impl,
 		tx:     tx,
-	}, impl.initStmts()
+	}, nil
 }
 
+// DetectLeaks makes Close fail if some connections are still in use, which
+// means that rows or transactions have not been closed.
+var DetectLeaks = false
+
 func (db *DB) Close() error {
+	if DetectLeaks {
+		if inUse := db.db.Stats().InUse; inUse > 0 {
+			db.db.Close()
+			return fmt.Errorf("%d database connections are still in use: rows or transactions are not closed", inUse)
+		}
+	}
 	return db.db.Close()
 }
 
@@ -127,6 +229,45 @@ func (tx *Tx) Commit() error {
 	return tx.tx.Commit()
 }
 
+// Rollback aborts the transaction. The caches are shared with the database,
+// so they are purged as they may have ids of rows that no longer exist.
+func (tx *Tx) Rollback() error {
+	tx.purgeCaches()
+	return tx.tx.Rollback()
+}
+
+// Savepoint starts a nested transaction that can be undone with RollbackTo.
+func (tx *Tx) Savepoint(name string) error {
+	_, err := tx.Exec("SAVEPOINT " + name)
+	return err
+}
+
+// Release keeps the changes made since the savepoint.
+func (tx *Tx) Release(name string) error {
+	_, err := tx.Exec("RELEASE " + name)
+	return err
+}
+
+// RollbackTo undoes the changes made since the savepoint and removes it.
+func (tx *Tx) RollbackTo(name string) error {
+	tx.purgeCaches()
+	if _, err := tx.Exec("ROLLBACK TO " + name); err != nil {
+		return err
+	}
+	return tx.Release(name)
+}
+
+func (db *dbImpl) purgeCaches() {
+	db.jobsCache.Purge()
+	db.buildsCache.Purge()
+	db.testsCache.Purge()
+	// UpsertTest finds tests that are missing in the preloaded map in the
+	// database, so it is safe to empty it.
+	for name := range db.testIDs {
+		delete(db.testIDs, name)
+	}
+}
+
 func (db *dbImpl) init() error {
 	var err error
 
@@ -145,50 +286,45 @@ func (db *dbImpl) init() error {
 		return err
 	}
 
-	initStatements := []string{
-		`create table if not exists jobs (
-			id integer not null primary key,
-			name text not null,
-			dashboard text not null,
-			platform text not null,
-			mod text not null,
-			testtype text not null
-		);`,
-		`create table if not exists jobs_sippy_tags (
-			job_id integer not null,
-			tag text not null
-		);`,
-		`create table if not exists builds (
-			id integer not null primary key,
-			job_id integer not null,
-			number text not null,
-			timestamp integer not null,
-			status integer not null
-		);`,
-		`create table if not exists tests (
-			id integer not null primary key,
-			name text not null
-		);`,
-		`create table if not exists test_results (
-			build_id integer not null,
-			test_id integer not null,
-			status integer not null
-		);`,
-		`create unique index if not exists jobs_name on jobs (name);`,
-		`create unique index if not exists jobs_sippy_tags_job_tag on jobs_sippy_tags (job_id, tag);`,
-		`create unique index if not exists builds_job_number on builds (job_id, number);`,
-		`create unique index if not exists tests_name on tests (name);`,
-		`create unique index if not exists test_results_build_test on test_results (build_id, test_id);`,
-		`create        index if not exists test_results_test_id_status on test_results (test_id, status);`,
-	}
-	for _, stmt := range initStatements {
-		_, err := db.Exec(stmt)
-		if err != nil {
-			return fmt.Errorf("%s: %s", err, stmt)
-		}
+	err = db.loadTestRenames()
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return db.initFTS()
+}
+
+func (db *dbImpl) addColumn(table string, column string, definition string) (added bool, err error) {
+	var exists int
+	row := db.QueryRow("select count(*) from pragma_table_info(?) where name = ?", table, column)
+	if err := row.Scan(&exists); err != nil {
+		return false, err
+	}
+	if exists != 0 {
+		return false, nil
+	}
+
+	stmt := fmt.Sprintf("alter table %s add column %s %s;", table, column, definition)
+	_, err = db.Exec(stmt)
+	if err != nil {
+		return false, fmt.Errorf("%s: %s", err, stmt)
+	}
+	return true, nil
+}
+
+// stmts returns pointers to all prepared statements, so that transactions can
+// replace them with their transaction-specific versions.
+func (db *dbImpl) stmts() []**sql.Stmt {
+	return []**sql.Stmt{
+		&db.selectJobStmt,
+		&db.insertJobStmt,
+		&db.selectBuildStmt,
+		&db.insertBuildStmt,
+		&db.selectTestStmt,
+		&db.selectAllTestsStmt,
+		&db.insertTestStmt,
+		&db.insertTestResultStmt,
+	}
 }
 
 func (db *dbImpl) initStmts() error {
@@ -209,7 +345,7 @@ func (db *dbImpl) initStmts() error {
 		return err
 	}
 
-	db.insertBuildStmt, err = db.Prepare("insert or ignore into builds (job_id, number, timestamp, status) values (?, ?, ?, ?)")
+	db.insertBuildStmt, err = db.Prepare("insert or ignore into builds (job_id, number, timestamp, status, failure) values (?, ?, ?, ?, ?)")
 	if err != nil {
 		return err
 	}
@@ -224,12 +360,7 @@ func (db *dbImpl) initStmts() error {
 		return err
 	}
 
-	db.insertTestStmt, err = db.Prepare("insert or ignore into tests (name) values (?)")
-	if err != nil {
-		return err
-	}
-
-	db.selectTestResultStmt, err = db.Prepare("select 1 from test_results where build_id = ? and test_id = ?")
+	db.insertTestStmt, err = db.Prepare("insert or ignore into tests (name, sig) values (?, ?)")
 	if err != nil {
 		return err
 	}
@@ -289,39 +420,98 @@ func (db *dbImpl) InsertJob(name string, dashboard string, tags JobTags) (int64,
 		}
 	}
 	/* } */
+	if err := db.SetJobCIInfoTags(id, tags.CIInfo); err != nil {
+		return id, err
+	}
+	if err := db.insertJobVariants(id, tags.Variants); err != nil {
+		return id, err
+	}
 	return id, nil
 }
 
-func (db *dbImpl) UpsertBuild(jobID int64, number string, timestamp int64, status int) (int64, error) {
+func (db *dbImpl) UpsertBuild(jobID int64, number string, timestamp int64, status int, failure string) (int64, error) {
+	id, _, err := db.InsertBuild(jobID, number, timestamp, status, failure)
+	return id, err
+}
+
+// InsertBuild is like UpsertBuild, inserted reports whether the build is new.
+// The status and the failure of known builds are kept.
+func (db *dbImpl) InsertBuild(jobID int64, number string, timestamp int64, status int, failure string) (id int64, inserted bool, err error) {
 	obj, ok := db.buildsCache.Get(buildKey{JobID: jobID, Number: number})
 	if ok {
-		return obj.(int64), nil
+		return obj.(int64), false, nil
 	}
 
-	var id int64
-	row := db.selectBuildStmt.QueryRow(jobID, number)
-	err := row.Scan(&id)
-	if err == nil {
-		db.buildsCache.Add(buildKey{JobID: jobID, Number: number}, id)
-		return id, nil
+	// New builds are more common than known builds that are not in the
+	// cache, so try to insert first.
+	var failureValue interface{}
+	if failure != "" {
+		failureValue = failure
 	}
-	if err != sql.ErrNoRows {
-		return 0, err
+	result, err := db.insertBuildStmt.Exec(jobID, number, timestamp, status, failureValue)
+	if err != nil {
+		return 0, false, err
 	}
-
-	result, err := db.insertBuildStmt.Exec(jobID, number, timestamp, status)
+	affected, err := result.RowsAffected()
 	if err != nil {
-		return 0, err
+		return 0, false, err
+	}
+
+	inserted = affected != 0
+	if inserted {
+		id, err = result.LastInsertId()
+	} else {
+		err = db.selectBuildStmt.QueryRow(jobID, number).Scan(&id)
 	}
-	id, err = result.LastInsertId()
 	if err != nil {
-		return 0, err
+		return 0, false, err
 	}
 	db.buildsCache.Add(buildKey{JobID: jobID, Number: number}, id)
-	return id, nil
+	return id, inserted, nil
+}
+
+// SetBuildStatus sets the status and the failure type of the build.
+func (db *dbImpl) SetBuildStatus(buildID int64, status int, failure string) error {
+	var failureValue interface{}
+	if failure != "" {
+		failureValue = failure
+	}
+	_, err := db.Exec("update builds set status = ?, failure = ? where id = ?", status, failureValue, buildID)
+	return err
+}
+
+// DeleteBuild removes the build with its results and annotations.
+func (db *dbImpl) DeleteBuild(buildID int64) error {
+	stmts := []string{
+		"DELETE FROM annotations WHERE build_id = ?",
+		"DELETE FROM test_results WHERE build_id = ?",
+		"DELETE FROM builds WHERE id = ?",
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt, buildID); err != nil {
+			return err
+		}
+	}
+	// The cache is keyed by job and number, which are not known here.
+	db.buildsCache.Purge()
+	return nil
+}
+
+func (db *dbImpl) SetBuildDuration(buildID int64, duration float64) error {
+	_, err := db.Exec("update builds set duration = ? where id = ?", duration, buildID)
+	return err
 }
 
 func (db *dbImpl) UpsertTest(name string) (int64, error) {
+	name = db.renamedTest(name)
+
+	if db.testIDs != nil {
+		if id, ok := db.testIDs[name]; ok {
+			return id, nil
+		}
+		return db.insertTest(name)
+	}
+
 	obj, ok := db.testsCache.Get(name)
 	if ok {
 		return obj.(int64), nil
@@ -338,24 +528,83 @@ func (db *dbImpl) UpsertTest(name string) (int64, error) {
 		return 0, err
 	}
 
-	result, err := db.insertTestStmt.Exec(name)
+	return db.insertTest(name)
+}
+
+func (db *dbImpl) insertTest(name string) (int64, error) {
+	result, err := db.insertTestStmt.Exec(name, TestSig(name))
 	if err != nil {
 		return 0, err
 	}
-	id, err = result.LastInsertId()
+	inserted, err := result.RowsAffected()
 	if err != nil {
 		return 0, err
 	}
-	db.testsCache.Add(name, id)
+
+	var id int64
+	if inserted != 0 {
+		id, err = result.LastInsertId()
+	} else {
+		// Another connection has added the test.
+		err = db.selectTestStmt.QueryRow(name).Scan(&id)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if db.testIDs != nil {
+		db.testIDs[name] = id
+	} else {
+		db.testsCache.Add(name, id)
+	}
 	return id, nil
 }
 
+var sigRe = regexp.MustCompile(`\[(sig-[a-zA-Z0-9-]+)\]`)
+
+func TestSig(name string) string {
+	m := sigRe.FindStringSubmatch(name)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+func (db *dbImpl) backfillTestSigs() error {
+	rows, err := db.Query("select id, name from tests")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	sigs := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		if sig := TestSig(name); sig != "" {
+			sigs[id] = sig
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, sig := range sigs {
+		_, err := db.Exec("update tests set sig = ? where id = ?", sig, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (db *dbImpl) ListTests() ([]string, error) {
 	results := []string{} // prefer to have an empty list intead of null in json
 	rows, err := db.selectAllTestsStmt.Query()
 	if err != nil {
 		return results, err
 	}
+	defer rows.Close()
 	for rows.Next() {
 		var name string
 		if err := rows.Scan(&name); err != nil {
@@ -363,72 +612,82 @@ func (db *dbImpl) ListTests() ([]string, error) {
 		}
 		results = append(results, name)
 	}
-	return results, nil
+	return results, rows.Err()
 }
 
+// UpsertTestResult stores the result, existing results are kept.
 func (db *dbImpl) UpsertTestResult(buildID, testID int64, status testgrid.TestStatus) error {
-	var i int
-	row := db.selectTestResultStmt.QueryRow(buildID, testID)
-	err := row.Scan(&i)
-	if err == nil {
-		return nil
-	}
+	_, err := db.insertTestResultStmt.Exec(buildID, testID, status)
+	return err
+}
 
-	_, err = db.insertTestResultStmt.Exec(buildID, testID, status)
+func (db *dbImpl) SetTestResultDuration(buildID, testID int64, duration float64) error {
+	_, err := db.Exec("update test_results set duration = ? where build_id = ? and test_id = ?", duration, buildID, testID)
+	return err
+}
+
+// SetTestResultMessage stores the message of the result, e.g. its failure.
+func (db *dbImpl) SetTestResultMessage(buildID, testID int64, message string) error {
+	_, err := db.Exec("update test_results set message = ? where build_id = ? and test_id = ?", message, buildID, testID)
+	return err
+}
+
+// SetStaleTests marks results of the build for the given tests as stale and
+// the rest of its results as fresh.
+func (db *dbImpl) SetStaleTests(buildID int64, testIDs []int64) error {
+	_, err := db.Exec("update test_results set stale = (test_id in ("+sqlInt64List(testIDs)+")) where build_id = ?", buildID)
 	return err
 }
 
 type StatsValues struct {
-	Pass  int `json:"pass"`
-	Flake int `json:"flake"`
-	Fail  int `json:"fail"`
+	Pass        int `json:"pass"`
+	Flake       int `json:"flake"`
+	Fail        int `json:"fail"`
+	FailInstall int `json:"fail_install,omitempty"`
+	FailTests   int `json:"fail_tests,omitempty"`
+	FailInfra   int `json:"fail_infra,omitempty"`
+	Infra       int `json:"infra,omitempty"`
 }
 
 type StatsRow struct {
-	Columns []string      `json:"columns"`
-	Values  []StatsValues `json:"values"`
+	Columns     []string      `json:"columns"`
+	Values      []StatsValues `json:"values"`
+	PValue      *float64      `json:"pvalue,omitempty"`
+	Annotations []Annotation  `json:"annotations,omitempty"`
 }
 
 type Stats struct {
-	Data []*StatsRow `json:"data"`
+	Buckets []string    `json:"buckets,omitempty"`
+	Data    []*StatsRow `json:"data"`
 }
 
+// filterTermRe matches a filter term, tags can have any characters except
+// whitespace.
+var filterTermRe = regexp.MustCompile(`^-?[[:graph:]]+$`)
+
 func (db *dbImpl) findJobIDsByFilter(filter string) ([]int64, error) {
-	tagRe := regexp.MustCompile("^[a-z0-9.-]+$")
-	terms := strings.Split(filter, " ")
+	terms := strings.Fields(filter)
 
 	joins := ""
 	conds := ""
-	c := 0
-	for _, term := range terms {
-		if len(term) == 0 {
-			continue
+	var params []interface{}
+	for c, term := range terms {
+		if !filterTermRe.MatchString(term) {
+			return nil, newErrInvalidParam("filter", filter, fmt.Sprintf("invalid term %q", term), "TAG", "-TAG")
 		}
-		if !tagRe.MatchString(term) {
-			return nil, fmt.Errorf("invalid filter term: %s", term)
+		if joins != "" {
+			joins += " "
 		}
-		c++
 		if term[0] == '-' {
-			term = term[1:]
-			if joins != "" {
-				joins += " "
-			}
-			joins += fmt.Sprintf(
-				"LEFT JOIN jobs_sippy_tags jst%d ON jst%d.job_id = j.id AND jst%d.tag = \"%s\"",
-				c, c, c, term,
-			)
+			joins += fmt.Sprintf("LEFT JOIN job_all_tags jst%d ON jst%d.job_id = j.id AND jst%d.tag = ?", c, c, c)
+			params = append(params, term[1:])
 			if conds != "" {
 				conds += " AND "
 			}
 			conds += fmt.Sprintf("jst%d.job_id IS NULL", c)
 		} else {
-			if joins != "" {
-				joins += " "
-			}
-			joins += fmt.Sprintf(
-				"JOIN jobs_sippy_tags jst%d ON jst%d.job_id = j.id AND jst%d.tag = \"%s\"",
-				c, c, c, term,
-			)
+			joins += fmt.Sprintf("JOIN job_all_tags jst%d ON jst%d.job_id = j.id AND jst%d.tag = ?", c, c, c)
+			params = append(params, term)
 		}
 	}
 	if conds != "" {
@@ -436,10 +695,11 @@ func (db *dbImpl) findJobIDsByFilter(filter string) ([]int64, error) {
 	}
 
 	var result []int64
-	rows, err := db.Query("SELECT j.id FROM jobs j " + joins + " " + conds)
+	rows, err := db.Query("SELECT j.id FROM jobs j "+joins+" "+conds, params...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	for rows.Next() {
 		var id int64
 		err := rows.Scan(&id)
@@ -449,7 +709,7 @@ func (db *dbImpl) findJobIDsByFilter(filter string) ([]int64, error) {
 
 		result = append(result, id)
 	}
-	return result, nil
+	return result, rows.Err()
 }
 
 type QueryBuilder struct {
@@ -475,6 +735,13 @@ func (qb *QueryBuilder) Join(j string, params ...interface{}) {
 	qb.joinParams = append(qb.joinParams, params...)
 }
 
+// CrossJoin is like Join, but SQLite doesn't reorder cross joins, so the
+// tables before it are scanned first.
+func (qb *QueryBuilder) CrossJoin(j string, params ...interface{}) {
+	qb.joins = append(qb.joins, "CROSS JOIN "+j)
+	qb.joinParams = append(qb.joinParams, params...)
+}
+
 func (qb *QueryBuilder) Where(cond string, params ...interface{}) {
 	if qb.condition != "" {
 		qb.condition += " AND "
@@ -535,15 +802,43 @@ func sqlInt64List(a []int64) string {
 	return s
 }
 
-func (db *dbImpl) BuildStats(columns string, filter string, periods string, testName string) (*Stats, error) {
-	now := time.Now()
+// sqlStatusList returns a comma separated list of the test statuses that
+// belong to the category.
+func sqlStatusList(c testgrid.Category) string {
+	var s string
+	for i, status := range c.Statuses() {
+		if i != 0 {
+			s += ","
+		}
+		s += strconv.Itoa(int(status))
+	}
+	return s
+}
 
-	results := Stats{
-		Data: []*StatsRow{},
+type statsQuery struct {
+	QueryBuilder
+	columnsPtrs []*string
+	statusField string
+	status      int
+	failure     sql.NullString
+}
+
+func (q *statsQuery) joinTests() {
+	if q.statusField == "tr.status" {
+		return
 	}
-	resultsByTag := map[string]*StatsRow{}
+	q.statusField = "tr.status"
+	// Without statistics SQLite prefers to scan test_results instead of
+	// using the builds timestamp index.
+	q.CrossJoin("test_results tr ON tr.build_id = b.id AND tr.stale = 0")
+	q.Join("test_names t ON t.id = tr.test_id")
+}
 
-	var query QueryBuilder
+// newStatsQuery returns nil if the query cannot match any build.
+func (db *dbImpl) newStatsQuery(columns string, filter string, testName string) (*statsQuery, error) {
+	query := &statsQuery{
+		statusField: "b.status",
+	}
 	query.from = "builds b"
 	query.Join("jobs j ON j.id = b.job_id")
 
@@ -553,80 +848,293 @@ func (db *dbImpl) BuildStats(columns string, filter string, periods string, test
 			return nil, err
 		}
 		if len(jobIDs) == 0 {
-			return &results, nil
+			return nil, nil
 		}
-		query.Where("j.id IN (" + sqlInt64List(jobIDs) + ")")
+		// Filter on builds, so the builds_job_id_timestamp index can be used.
+		query.Where("b.job_id IN (" + sqlInt64List(jobIDs) + ")")
 	}
 
-	var columnsPtrs []*string
-	statusField := "b.status"
-	for _, col := range strings.Split(columns, ",") {
+	var columnsList []string
+	if columns != "" {
+		columnsList = strings.Split(columns, ",")
+	}
+	for _, col := range columnsList {
 		switch col {
 		case "sippytags":
 			var val string
 			query.Join("jobs_sippy_tags jst ON jst.job_id = j.id")
 			query.Select("jst.tag", &val)
 			query.GroupBy("jst.tag")
-			columnsPtrs = append(columnsPtrs, &val)
+			query.columnsPtrs = append(query.columnsPtrs, &val)
 		case "name":
 			var val string
 			query.Select("j.name", &val)
 			query.GroupBy("j.name")
-			columnsPtrs = append(columnsPtrs, &val)
+			query.columnsPtrs = append(query.columnsPtrs, &val)
 		case "dashboard":
 			var val string
 			query.Select("j.dashboard", &val)
 			query.GroupBy("j.dashboard")
-			columnsPtrs = append(columnsPtrs, &val)
+			query.columnsPtrs = append(query.columnsPtrs, &val)
 		case "test":
 			var val string
-			statusField = "tr.status"
-			query.Join("test_results tr ON tr.build_id = b.id")
-			query.Join("tests t ON t.id = tr.test_id")
+			query.joinTests()
 			query.Select("t.name", &val)
 			query.GroupBy("t.name")
-			columnsPtrs = append(columnsPtrs, &val)
+			query.columnsPtrs = append(query.columnsPtrs, &val)
+		case "sig":
+			var val string
+			query.joinTests()
+			query.Select("COALESCE(NULLIF(t.sig, ''), 'none')", &val)
+			query.GroupBy("t.sig")
+			query.columnsPtrs = append(query.columnsPtrs, &val)
+		case "owner":
+			var val string
+			query.Select("COALESCE(j.owner, 'none')", &val)
+			query.GroupBy("j.owner")
+			query.columnsPtrs = append(query.columnsPtrs, &val)
 		default:
-			return nil, fmt.Errorf("unknown column %s", col)
+			if dimension := strings.TrimPrefix(col, "variant."); dimension != col {
+				var val string
+				alias := fmt.Sprintf("jv%d", len(query.columnsPtrs))
+				query.Join("job_variants "+alias+" ON "+alias+".job_id = j.id AND "+alias+".dimension = ?", dimension)
+				query.Select(alias+".value", &val)
+				query.GroupBy(alias + ".value")
+				query.columnsPtrs = append(query.columnsPtrs, &val)
+				continue
+			}
+			return nil, newErrInvalidParam("columns", columns, fmt.Sprintf("unknown column %q", col), statsColumns...)
 		}
 	}
 
 	if testName != "" {
-		testID, err := db.FindTest(testName)
+		testIDs, err := db.findTestIDs(testName)
 		if IsNotFound(err) {
-			return &results, nil
+			return nil, nil
 		} else if err != nil {
 			return nil, err
 		}
-		if statusField == "tr.status" {
-			query.Where("tr.test_id = ?", testID)
+		if query.statusField == "tr.status" {
+			query.Where("tr.test_id IN (" + sqlInt64List(testIDs) + ")")
 		} else {
-			statusField = "tr.status"
-			query.Join("test_results tr ON tr.build_id = b.id AND tr.test_id = ?", testID)
+			query.statusField = "tr.status"
+			query.Join("test_results tr ON tr.build_id = b.id AND tr.test_id IN (" + sqlInt64List(testIDs) + ") AND tr.stale = 0")
 		}
 	}
 
-	var status int
-	query.Select(statusField, &status)
-	query.GroupBy(statusField)
+	query.Select(query.statusField, &query.status)
+	query.GroupBy(query.statusField)
+	if query.statusField == "b.status" {
+		query.Select("b.failure", &query.failure)
+		query.GroupBy("b.failure")
+	}
 
-	var periodsPtrs []*int
-	var days int64
+	return query, nil
+}
+
+func (q *statsQuery) columns() (key string, values []string) {
+	values = []string{}
+	for _, p := range q.columnsPtrs {
+		key += "/" + *p
+		values = append(values, *p)
+	}
+	return key, values
+}
+
+func (q *statsQuery) add(values []StatsValues, counts []*int) {
+	if q.statusField == "tr.status" {
+		switch testgrid.TestStatus(q.status).Category() {
+		case testgrid.CategoryPass:
+			for i, p := range counts {
+				values[i].Pass += *p
+			}
+		case testgrid.CategoryFlake:
+			for i, p := range counts {
+				values[i].Flake += *p
+			}
+		case testgrid.CategoryFail:
+			for i, p := range counts {
+				values[i].Fail += *p
+			}
+		case testgrid.CategoryInfra:
+			for i, p := range counts {
+				values[i].Infra += *p
+			}
+		default:
+			klog.Infof("unexpected test status: %d", q.status)
+		}
+	} else {
+		if q.status == 1 {
+			for i, p := range counts {
+				values[i].Pass += *p
+			}
+		} else if q.status == 2 {
+			for i, p := range counts {
+				values[i].Fail += *p
+				switch q.failure.String {
+				case FailureInstall:
+					values[i].FailInstall += *p
+				case FailureTests:
+					values[i].FailTests += *p
+				case FailureInfra:
+					values[i].FailInfra += *p
+				}
+			}
+		}
+	}
+}
+
+type period struct {
+	start int64
+	end   int64 // 0 means the period is not bounded
+}
+
+// PeriodOptions control how period boundaries are computed.
+type PeriodOptions struct {
+	// Ref is the reference time, the current time is used if it is zero.
+	Ref time.Time
+	// AlignDays moves the reference time to the start of its day, so
+	// periods consist of whole calendar days.
+	AlignDays bool
+	// Location is the timezone for calendar days, UTC if it is nil.
+	Location *time.Location
+}
+
+// String returns a representation of the options that can be used as a key.
+func (o PeriodOptions) String() string {
+	loc := "UTC"
+	if o.Location != nil {
+		loc = o.Location.String()
+	}
+	var ref int64
+	if !o.Ref.IsZero() {
+		ref = o.Ref.UnixNano()
+	}
+	return fmt.Sprintf("ref=%d align=%t tz=%s", ref, o.AlignDays, loc)
+}
+
+// ParseRefTime parses a reference time given either in RFC 3339 or as a Unix
+// timestamp in seconds.
+func ParseRefTime(s string) (time.Time, error) {
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, newErrInvalidParam("timestamp", s, "cannot be parsed", "RFC 3339", "Unix seconds")
+	}
+	return t, nil
+}
+
+// parsePeriods parses a comma separated list of period lengths in days.
+// Periods go back in time one after another from the reference time, periods
+// prefixed with + go forward. If the reference time is the current time, the
+// first period before it also includes everything after it. It also returns
+// the start of the earliest period.
+func parsePeriods(periods string, popts PeriodOptions) ([]period, int64, error) {
+	loc := popts.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	unbounded := popts.Ref.IsZero() && !popts.AlignDays
+	ref := popts.Ref
+	if ref.IsZero() {
+		ref = time.Now()
+	}
+	ref = ref.In(loc)
+	if popts.AlignDays {
+		ref = time.Date(ref.Year(), ref.Month(), ref.Day(), 0, 0, 0, 0, loc)
+	}
+	day := func(n int) int64 {
+		return ref.AddDate(0, 0, n).Unix() * 1000
+	}
+
+	var bounds []period
+	var back, forward int
 	for _, per := range strings.Split(periods, ",") {
-		p, err := strconv.ParseInt(per, 10, 0)
-		if err != nil {
-			return nil, err
+		after := strings.HasPrefix(per, "+")
+		p, err := strconv.Atoi(strings.TrimPrefix(per, "+"))
+		if err != nil || p <= 0 {
+			return nil, 0, newErrInvalidParam("periods", periods, fmt.Sprintf("%q is not a positive number of days", per), "N", "+N")
+		}
+		if after {
+			bounds = append(bounds, period{start: day(forward), end: day(forward + p)})
+			forward += p
+			continue
+		}
+		if back == 0 && unbounded {
+			bounds = append(bounds, period{start: day(-p)})
+		} else {
+			bounds = append(bounds, period{start: day(-back - p), end: day(-back)})
 		}
+		back += p
+	}
+	return bounds, day(-back), nil
+}
+
+func (db *dbImpl) BuildStats(columns string, filter string, periods string, testName string) (*Stats, error) {
+	return db.BuildStatsWith(columns, filter, periods, testName, PeriodOptions{})
+}
+
+// BuildStatsWith is like BuildStats, but the period boundaries are computed
+// according to popts.
+func (db *dbImpl) BuildStatsWith(columns string, filter string, periods string, testName string, popts PeriodOptions) (*Stats, error) {
+	bounds, since, err := parsePeriods(periods, popts)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := db.periodStats(columns, filter, testName, bounds)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.attachAnnotations(stats, columns, testName, since)
+	return stats, err
+}
+
+func (db *dbImpl) periodStats(columns string, filter string, testName string, periods []period) (*Stats, error) {
+	if _, ok := db.sqlConn.(*sql.DB); ok && db.parallelPeriods > 0 && len(periods) >= db.parallelPeriods {
+		return db.parallelPeriodStats(columns, filter, testName, periods)
+	}
+	return db.queryPeriodStats(columns, filter, testName, periods)
+}
+
+func (db *dbImpl) queryPeriodStats(columns string, filter string, testName string, periods []period) (*Stats, error) {
+	results := Stats{
+		Data: []*StatsRow{},
+	}
+	resultsByTag := map[string]*StatsRow{}
+
+	query, err := db.newStatsQuery(columns, filter, testName)
+	if err != nil {
+		return nil, err
+	}
+	if query == nil {
+		return &results, nil
+	}
+
+	var periodsPtrs []*int
+	minStart, maxEnd := periods[0].start, periods[0].end
+	for _, p := range periods {
 		var val int
-		if days == 0 {
-			query.Select("SUM(? <= b.timestamp)", &val, (now.Unix()-86400*p)*1000)
+		if p.end == 0 {
+			query.Select("SUM(? <= b.timestamp)", &val, p.start)
 		} else {
-			query.Select("SUM(? <= b.timestamp AND b.timestamp < ?)", &val, (now.Unix()-86400*(days+p))*1000, (now.Unix()-86400*days)*1000)
+			query.Select("SUM(? <= b.timestamp AND b.timestamp < ?)", &val, p.start, p.end)
 		}
 		periodsPtrs = append(periodsPtrs, &val)
-		days += p
+		if p.start < minStart {
+			minStart = p.start
+		}
+		if maxEnd != 0 && (p.end == 0 || p.end > maxEnd) {
+			maxEnd = p.end
+		}
+	}
+	query.Where("b.timestamp >= ?", minStart)
+	if maxEnd != 0 {
+		query.Where("b.timestamp < ?", maxEnd)
 	}
-	query.Where("b.timestamp >= ?", (now.Unix()-86400*days)*1000)
 
 	sql, params, scanParams := query.SQL()
 
@@ -634,18 +1142,14 @@ func (db *dbImpl) BuildStats(columns string, filter string, periods string, test
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	for rows.Next() {
 		err := rows.Scan(scanParams...)
 		if err != nil {
 			return nil, err
 		}
 
-		key := ""
-		columnsValues := []string{}
-		for _, p := range columnsPtrs {
-			key += "/" + *p
-			columnsValues = append(columnsValues, *p)
-		}
+		key, columnsValues := query.columns()
 
 		row, ok := resultsByTag[key]
 		if !ok {
@@ -657,33 +1161,7 @@ func (db *dbImpl) BuildStats(columns string, filter string, periods string, test
 			resultsByTag[key] = row
 		}
 
-		if statusField == "tr.status" {
-			if status == int(testgrid.TestStatusPass) || status == int(testgrid.TestStatusPassWithSkips) {
-				for i, p := range periodsPtrs {
-					row.Values[i].Pass += *p
-				}
-			} else if status == int(testgrid.TestStatusFlaky) {
-				for i, p := range periodsPtrs {
-					row.Values[i].Flake += *p
-				}
-			} else if status == int(testgrid.TestStatusFail) {
-				for i, p := range periodsPtrs {
-					row.Values[i].Fail += *p
-				}
-			} else {
-				klog.Infof("unexpected test status: %d", status)
-			}
-		} else {
-			if status == 1 {
-				for i, p := range periodsPtrs {
-					row.Values[i].Pass += *p
-				}
-			} else if status == 2 {
-				for i, p := range periodsPtrs {
-					row.Values[i].Fail += *p
-				}
-			}
-		}
+		query.add(row.Values, periodsPtrs)
 	}
-	return &results, err
+	return &results, rows.Err()
 }
@@ -0,0 +1,615 @@
+package database_test
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/database/databasetest"
+	"github.com/dmage/ci-results/testgrid"
+)
+
+type testBuild struct {
+	job    string
+	tags   []string
+	number string
+	status int
+	tests  map[string]testgrid.TestStatus
+	// age is how long ago the build started, one hour if it's zero.
+	age time.Duration
+}
+
+func insertBuilds(t *testing.T, db *database.DB, builds []testBuild) {
+	t.Helper()
+	now := time.Now()
+	err := db.Transaction(func(tx *database.Tx) error {
+		for _, b := range builds {
+			age := b.age
+			if age == 0 {
+				age = time.Hour
+			}
+			timestamp := now.Add(-age).Unix() * 1000
+			jobID, err := tx.FindJob(b.job)
+			if database.IsNotFound(err) {
+				jobID, err = tx.InsertJob(b.job, "dashboard", database.JobTags{Sippy: b.tags})
+			}
+			if err != nil {
+				return err
+			}
+			failure := ""
+			if b.status == 2 {
+				failure = database.FailureTests
+			}
+			buildID, err := tx.UpsertBuild(jobID, b.number, timestamp, b.status, failure)
+			if err != nil {
+				return err
+			}
+			for testName, status := range b.tests {
+				testID, err := tx.UpsertTest(testName)
+				if err != nil {
+					return err
+				}
+				if err := tx.UpsertTestResult(buildID, testID, status); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestBuildStatsDoesNotLeak runs the queries with leak detection, so the test
+// fails when the database is closed if rows are left open, including on error
+// paths.
+func TestBuildStatsDoesNotLeak(t *testing.T) {
+	db := databasetest.Open(t)
+	insertBuilds(t, db, []testBuild{
+		{job: "job-aws", tags: []string{"aws"}, number: "1", status: 1, tests: map[string]testgrid.TestStatus{"test-a": testgrid.TestStatusPass}},
+		{job: "job-aws", tags: []string{"aws"}, number: "2", status: 2, tests: map[string]testgrid.TestStatus{"test-a": testgrid.TestStatusFail}},
+		{job: "job-gcp", tags: []string{"gcp"}, number: "1", status: 1, tests: map[string]testgrid.TestStatus{"test-a": testgrid.TestStatusFlaky}},
+	})
+
+	testCases := []struct {
+		name     string
+		filter   string
+		testName string
+		want     map[string]database.StatsValues
+		wantErr  bool
+	}{
+		{
+			name: "all jobs",
+			want: map[string]database.StatsValues{
+				"job-aws": {Pass: 1, Fail: 1, FailTests: 1},
+				"job-gcp": {Pass: 1},
+			},
+		},
+		{
+			name:   "tag",
+			filter: "aws",
+			want: map[string]database.StatsValues{
+				"job-aws": {Pass: 1, Fail: 1, FailTests: 1},
+			},
+		},
+		{
+			name:   "negated tag",
+			filter: "-aws",
+			want: map[string]database.StatsValues{
+				"job-gcp": {Pass: 1},
+			},
+		},
+		{
+			name:   "unknown tag",
+			filter: "azure",
+			want:   map[string]database.StatsValues{},
+		},
+		{
+			name:     "test",
+			filter:   "gcp",
+			testName: "test-a",
+			want: map[string]database.StatsValues{
+				"job-gcp": {Flake: 1},
+			},
+		},
+		{
+			name:    "invalid filter",
+			filter:  "aws \x01",
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stats, err := db.BuildStats("name", tc.filter, "7", tc.testName)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]database.StatsValues{}
+			for _, row := range stats.Data {
+				got[row.Columns[0]] = row.Values[0]
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %d rows %+v, want %+v", len(got), got, tc.want)
+			}
+			for name, want := range tc.want {
+				if got[name] != want {
+					t.Errorf("%s: got %+v, want %+v", name, got[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestIsInvalidParam(t *testing.T) {
+	db := databasetest.Open(t)
+	_, err := db.BuildStats("color", "", "7", "")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !database.IsInvalidParam(err) {
+		t.Errorf("%v: expected an invalid parameter", err)
+	}
+	if wrapped := fmt.Errorf("unable to get stats: %w", err); !database.IsInvalidParam(wrapped) {
+		t.Errorf("%v: expected an invalid parameter when wrapped", wrapped)
+	}
+	if database.IsInvalidParam(fmt.Errorf("database is locked")) {
+		t.Error("unexpected invalid parameter for other errors")
+	}
+}
+
+func TestAnomalies(t *testing.T) {
+	db := databasetest.Open(t)
+	const day = 24 * time.Hour
+	var builds []testBuild
+	add := func(job string, status int, age time.Duration, count int) {
+		for i := 0; i < count; i++ {
+			builds = append(builds, testBuild{
+				job:    job,
+				number: fmt.Sprintf("%d-%d", age/day, len(builds)),
+				status: status,
+				age:    age,
+			})
+		}
+	}
+	// job-broken used to pass and fails now.
+	add("job-broken", 1, 5*day, 8)
+	add("job-broken", 2, time.Hour, 4)
+	// job-stable passes before and now.
+	add("job-stable", 1, 5*day, 8)
+	add("job-stable", 1, time.Hour, 4)
+	// job-idle has no recent runs.
+	add("job-idle", 1, 5*day, 8)
+	insertBuilds(t, db, builds)
+
+	testCases := []struct {
+		name      string
+		threshold float64
+		minRuns   int
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name:      "failing job",
+			threshold: 3,
+			minRuns:   3,
+			want:      []string{"job-broken"},
+		},
+		{
+			name:      "not enough runs",
+			threshold: 3,
+			minRuns:   5,
+			want:      []string{},
+		},
+		{
+			name:      "rows without recent runs are not scored",
+			threshold: 0,
+			minRuns:   1,
+			want:      []string{"job-broken"},
+		},
+		{
+			name:    "no runs required",
+			minRuns: 0,
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			anomalies, err := db.Anomalies("name", "", 2, 14, tc.threshold, tc.minRuns)
+			if tc.wantErr {
+				if !database.IsInvalidParam(err) {
+					t.Fatalf("got %v, want an invalid parameter", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, a := range anomalies {
+				got = append(got, a.Columns[0])
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDoctorDeletesEmptyBuilds(t *testing.T) {
+	db := databasetest.Open(t)
+	insertBuilds(t, db, []testBuild{
+		{job: "job-aws", number: "1", status: 1, tests: map[string]testgrid.TestStatus{"test-a": testgrid.TestStatusPass}},
+		{job: "job-aws", number: "2", status: 2},
+	})
+	err := db.Transaction(func(tx *database.Tx) error {
+		for _, number := range []string{"1", "2"} {
+			if _, err := tx.AddAnnotation("job-aws", number, "", "infra outage", "test"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	findings, err := db.Diagnose(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixed := 0
+	err = db.Transaction(func(tx *database.Tx) error {
+		for _, f := range findings {
+			if f.Check != "empty-builds" {
+				continue
+			}
+			if f.Count != 1 {
+				t.Errorf("got %d empty builds, want 1", f.Count)
+			}
+			fixed++
+			if err := tx.Fix(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fixed != 1 {
+		t.Fatalf("got findings %+v, want the empty build", findings)
+	}
+
+	findings, err = db.Diagnose(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range findings {
+		t.Errorf("unexpected finding after the fix: %+v", f)
+	}
+	annotations, err := db.ListAnnotations(database.AnnotationFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(annotations) != 1 || annotations[0].Build != "1" {
+		t.Errorf("got annotations %+v, want only the annotation of build 1", annotations)
+	}
+}
+
+// TestConcurrentWriters checks that a transaction holds the write lock from
+// the start, so another process waits for it instead of making it fail when
+// it starts writing.
+func TestConcurrentWriters(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "results.db") + "?_journal_mode=WAL"
+	db1, err := database.Open(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db1.Close()
+	db2, err := database.Open(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db2.Close()
+
+	tx, err := db1.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.FindJob("job-aws"); !database.IsNotFound(err) {
+		t.Fatalf("got %v, want not found", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- db2.Transaction(func(tx *database.Tx) error {
+			_, err := tx.InsertJob("job-gcp", "dashboard", database.JobTags{})
+			return err
+		})
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("the second writer didn't wait for the lock: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if _, err := tx.InsertJob("job-aws", "dashboard", database.JobTags{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSearchTests(t *testing.T) {
+	db := databasetest.Open(t)
+	insertBuilds(t, db, []testBuild{
+		{job: "job-aws", number: "1", status: 1, tests: map[string]testgrid.TestStatus{
+			"[sig-network] Services should serve endpoints": testgrid.TestStatusPass,
+			"[sig-storage] Volumes should mount":            testgrid.TestStatusPass,
+		}},
+	})
+
+	testCases := []struct {
+		q    string
+		want []string
+	}{
+		{q: "services endpoints", want: []string{"[sig-network] Services should serve endpoints"}},
+		{q: "sig-storage", want: []string{"[sig-storage] Volumes should mount"}},
+		{q: "should", want: []string{"[sig-storage] Volumes should mount", "[sig-network] Services should serve endpoints"}},
+		{q: "ingress", want: []string{}},
+		{q: " ", want: []string{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.q, func(t *testing.T) {
+			got, err := db.SearchTests(tc.q, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSignificance(t *testing.T) {
+	db := databasetest.Open(t)
+	const day = 24 * time.Hour
+	var builds []testBuild
+	add := func(job string, status int, age time.Duration, count int) {
+		for i := 0; i < count; i++ {
+			builds = append(builds, testBuild{
+				job:    job,
+				number: fmt.Sprintf("%d", len(builds)),
+				status: status,
+				age:    age,
+			})
+		}
+	}
+	add("job-broken", 1, 5*day, 10)
+	add("job-broken", 2, time.Hour, 5)
+	add("job-unchanged", 1, 5*day, 2)
+	add("job-unchanged", 2, 5*day, 2)
+	add("job-unchanged", 1, time.Hour, 2)
+	add("job-unchanged", 2, time.Hour, 2)
+	add("job-idle", 2, 5*day, 3)
+	insertBuilds(t, db, builds)
+
+	stats, err := db.BuildStats("name", "", "2,14", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats.ComputeSignificance()
+	got := map[string]float64{}
+	for _, row := range stats.Data {
+		if row.PValue == nil {
+			t.Fatalf("%s: no p-value", row.Columns[0])
+		}
+		got[row.Columns[0]] = *row.PValue
+	}
+
+	testCases := []struct {
+		job  string
+		want float64
+	}{
+		// All 5 recent builds failed, the probability of that with 10 passes
+		// among the 15 builds is 1/C(15,5).
+		{job: "job-broken", want: 1.0 / 3003},
+		// 2 of 4 passes in both periods: P(X <= 2) = (1 + 16 + 36) / C(8,4).
+		{job: "job-unchanged", want: 53.0 / 70},
+		// Without recent builds there is nothing to compare.
+		{job: "job-idle", want: 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.job, func(t *testing.T) {
+			p, ok := got[tc.job]
+			if !ok {
+				t.Fatalf("no row for %s in %v", tc.job, got)
+			}
+			if math.Abs(p-tc.want) > 1e-9 {
+				t.Errorf("got p-value %g, want %g", p, tc.want)
+			}
+		})
+	}
+
+	stats.FilterSignificantRegressions(0.05)
+	if len(stats.Data) != 1 || stats.Data[0].Columns[0] != "job-broken" {
+		t.Errorf("got %d significant regressions, want only job-broken", len(stats.Data))
+	}
+}
+
+func TestCorrelatedFailures(t *testing.T) {
+	db := databasetest.Open(t)
+	fail, pass := testgrid.TestStatusFail, testgrid.TestStatusPass
+	insertBuilds(t, db, []testBuild{
+		{job: "job-aws", tags: []string{"aws"}, number: "1", status: 2, tests: map[string]testgrid.TestStatus{"test-a": fail, "test-b": fail}},
+		{job: "job-aws", tags: []string{"aws"}, number: "2", status: 2, tests: map[string]testgrid.TestStatus{"test-a": fail, "test-b": fail}},
+		{job: "job-aws", tags: []string{"aws"}, number: "3", status: 2, tests: map[string]testgrid.TestStatus{"test-a": fail, "test-b": pass, "test-c": fail}},
+		{job: "job-gcp", tags: []string{"gcp"}, number: "1", status: 2, tests: map[string]testgrid.TestStatus{"test-c": fail, "test-d": fail}},
+	})
+
+	// test-a fails 3 times, test-b and test-c 2 times, test-d once.
+	ab := database.CorrelatedPair{Tests: [2]string{"test-a", "test-b"}, Together: 2, Failures: [2]int{3, 2}, Jaccard: 2.0 / 3}
+	cd := database.CorrelatedPair{Tests: [2]string{"test-c", "test-d"}, Together: 1, Failures: [2]int{2, 1}, Jaccard: 1.0 / 2}
+	ac := database.CorrelatedPair{Tests: [2]string{"test-a", "test-c"}, Together: 1, Failures: [2]int{3, 2}, Jaccard: 1.0 / 4}
+
+	testCases := []struct {
+		name        string
+		filter      string
+		minTogether int
+		minJaccard  float64
+		wantPairs   []database.CorrelatedPair
+		wantGroups  [][]string
+	}{
+		{
+			name:        "all pairs",
+			minTogether: 1,
+			wantPairs:   []database.CorrelatedPair{ab, cd, ac},
+			wantGroups:  [][]string{{"test-a", "test-b", "test-c", "test-d"}},
+		},
+		{
+			name:        "failed together twice",
+			minTogether: 2,
+			wantPairs:   []database.CorrelatedPair{ab},
+			wantGroups:  [][]string{{"test-a", "test-b"}},
+		},
+		{
+			name:        "similar failures",
+			minTogether: 1,
+			minJaccard:  0.4,
+			wantPairs:   []database.CorrelatedPair{ab, cd},
+			wantGroups:  [][]string{{"test-a", "test-b"}, {"test-c", "test-d"}},
+		},
+		{
+			name:        "filter",
+			filter:      "aws",
+			minTogether: 1,
+			wantPairs: []database.CorrelatedPair{
+				ab,
+				{Tests: [2]string{"test-a", "test-c"}, Together: 1, Failures: [2]int{3, 1}, Jaccard: 1.0 / 3},
+			},
+			wantGroups: [][]string{{"test-a", "test-b", "test-c"}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := db.CorrelatedFailures(tc.filter, 7, tc.minTogether, tc.minJaccard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The order of the tests in a pair depends on their ids.
+			for i, p := range got.Pairs {
+				if p.Tests[0] > p.Tests[1] {
+					p.Tests[0], p.Tests[1] = p.Tests[1], p.Tests[0]
+					p.Failures[0], p.Failures[1] = p.Failures[1], p.Failures[0]
+				}
+				p.Jaccard = math.Round(p.Jaccard*1e9) / 1e9
+				got.Pairs[i] = p
+			}
+			for i := range tc.wantPairs {
+				tc.wantPairs[i].Jaccard = math.Round(tc.wantPairs[i].Jaccard*1e9) / 1e9
+			}
+			if fmt.Sprint(got.Pairs) != fmt.Sprint(tc.wantPairs) {
+				t.Errorf("got pairs %v, want %v", got.Pairs, tc.wantPairs)
+			}
+			if fmt.Sprint(got.Groups) != fmt.Sprint(tc.wantGroups) {
+				t.Errorf("got groups %v, want %v", got.Groups, tc.wantGroups)
+			}
+		})
+	}
+}
+
+func TestTestDetailReliability(t *testing.T) {
+	db := databasetest.Open(t)
+	fail, pass, flaky := testgrid.TestStatusFail, testgrid.TestStatusPass, testgrid.TestStatusFlaky
+	build := func(job string, number string, age time.Duration, status testgrid.TestStatus) testBuild {
+		return testBuild{
+			job:    job,
+			tags:   []string{strings.TrimPrefix(job, "job-")},
+			number: number,
+			status: 1,
+			tests:  map[string]testgrid.TestStatus{"test-a": status, "test-b": pass},
+			age:    age,
+		}
+	}
+	insertBuilds(t, db, []testBuild{
+		// Failures 2h and 6h apart, recovered after 3h both times.
+		build("job-aws", "1", 12*time.Hour, fail),
+		build("job-aws", "2", 10*time.Hour, fail),
+		build("job-aws", "3", 9*time.Hour, pass),
+		build("job-aws", "4", 4*time.Hour, fail),
+		build("job-aws", "5", 1*time.Hour, flaky),
+		// A failure in another job doesn't change the intervals.
+		build("job-gcp", "1", 5*time.Hour, fail),
+	})
+
+	hours := func(h float64) *float64 {
+		return &h
+	}
+	testCases := []struct {
+		name     string
+		testName string
+		filter   string
+		want     database.TestReliability
+		values   database.StatsValues
+	}{
+		{
+			name:     "all jobs",
+			testName: "test-a",
+			want:     database.TestReliability{Failures: 4, Recovered: 2, MTBFHours: hours(4), MTTRHours: hours(3)},
+			values:   database.StatsValues{Pass: 1, Flake: 1, Fail: 4},
+		},
+		{
+			name:     "single failure",
+			testName: "test-a",
+			filter:   "gcp",
+			want:     database.TestReliability{Failures: 1},
+			values:   database.StatsValues{Fail: 1},
+		},
+		{
+			name:     "never failed",
+			testName: "test-b",
+			want:     database.TestReliability{},
+			values:   database.StatsValues{Pass: 6},
+		},
+	}
+	format := func(r database.TestReliability) string {
+		f := func(v *float64) string {
+			if v == nil {
+				return "nil"
+			}
+			return fmt.Sprintf("%g", *v)
+		}
+		return fmt.Sprintf("failures=%d recovered=%d mtbf=%s mttr=%s", r.Failures, r.Recovered, f(r.MTBFHours), f(r.MTTRHours))
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			detail, err := db.TestDetail(tc.testName, tc.filter, 7)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := format(detail.Reliability), format(tc.want); got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+			if detail.Values != tc.values {
+				t.Errorf("got values %+v, want %+v", detail.Values, tc.values)
+			}
+		})
+	}
+}
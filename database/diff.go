@@ -0,0 +1,182 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+
+	"github.com/dmage/ci-results/testgrid"
+)
+
+type RateChange struct {
+	Name    string  `json:"name"`
+	OldRate float64 `json:"old_rate"`
+	NewRate float64 `json:"new_rate"`
+	OldRuns int     `json:"old_runs"`
+	NewRuns int     `json:"new_runs"`
+	Delta   float64 `json:"delta"`
+}
+
+type SnapshotDiff struct {
+	JobsAdded    []string     `json:"jobs_added"`
+	JobsRemoved  []string     `json:"jobs_removed"`
+	TestsAdded   []string     `json:"tests_added"`
+	TestsRemoved []string     `json:"tests_removed"`
+	Jobs         []RateChange `json:"jobs"`
+	Tests        []RateChange `json:"tests"`
+}
+
+type rate struct {
+	passed int
+	runs   int
+}
+
+func snapshotNames(ctx context.Context, conn *sql.Conn, query string) (map[string]bool, error) {
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	names := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names[name] = true
+	}
+	return names, rows.Err()
+}
+
+func snapshotRates(ctx context.Context, conn *sql.Conn, query string, params ...interface{}) (map[string]rate, error) {
+	rows, err := conn.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rates := map[string]rate{}
+	for rows.Next() {
+		var name string
+		var r rate
+		if err := rows.Scan(&name, &r.passed, &r.runs); err != nil {
+			return nil, err
+		}
+		rates[name] = r
+	}
+	return rates, rows.Err()
+}
+
+func setDiff(a, b map[string]bool) []string {
+	result := []string{}
+	for name := range a {
+		if !b[name] {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func rateChanges(old, new map[string]rate, threshold float64, minRuns int) []RateChange {
+	result := []RateChange{}
+	for name, n := range new {
+		o, ok := old[name]
+		if !ok || o.runs < minRuns || n.runs < minRuns {
+			continue
+		}
+		change := RateChange{
+			Name:    name,
+			OldRate: float64(o.passed) / float64(o.runs),
+			NewRate: float64(n.passed) / float64(n.runs),
+			OldRuns: o.runs,
+			NewRuns: n.runs,
+		}
+		change.Delta = change.NewRate - change.OldRate
+		if math.Abs(change.Delta) >= threshold {
+			result = append(result, change)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Delta < result[j].Delta
+	})
+	return result
+}
+
+// DiffSnapshots compares two database files. Pass rates are computed over
+// the last days days before the latest build in each snapshot. Changes are
+// reported if the pass rate changed at least by threshold (0..1).
+//
+// Both files are opened read-only and are not migrated.
+func DiffSnapshots(ctx context.Context, oldPath, newPath string, days int, threshold float64, minRuns int) (*SnapshotDiff, error) {
+	sqlDB, err := sql.Open(driverName, ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	defer sqlDB.Close()
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	for _, db := range []struct{ name, path string }{{"old", oldPath}, {"new", newPath}} {
+		u := url.URL{Scheme: "file", Opaque: db.path, RawQuery: "mode=ro"}
+		_, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS "+db.name, u.String())
+		if err != nil {
+			return nil, fmt.Errorf("unable to open %s: %w", db.path, err)
+		}
+	}
+
+	diff := &SnapshotDiff{}
+	var jobRates, testRates [2]map[string]rate
+	var jobs, tests [2]map[string]bool
+	for i, schema := range []string{"old", "new"} {
+		jobs[i], err = snapshotNames(ctx, conn, "SELECT name FROM "+schema+".jobs")
+		if err != nil {
+			return nil, err
+		}
+		tests[i], err = snapshotNames(ctx, conn, "SELECT name FROM "+schema+".tests")
+		if err != nil {
+			return nil, err
+		}
+
+		var latest int64
+		err = conn.QueryRowContext(ctx, "SELECT IFNULL(MAX(timestamp), 0) FROM "+schema+".builds").Scan(&latest)
+		if err != nil {
+			return nil, err
+		}
+		since := latest - int64(days)*86400000
+
+		jobRates[i], err = snapshotRates(ctx, conn, `
+			SELECT j.name, SUM(b.status = 1), COUNT(*)
+			FROM `+schema+`.builds b
+			JOIN `+schema+`.jobs j ON j.id = b.job_id
+			WHERE b.timestamp > ?
+			GROUP BY j.name`, since)
+		if err != nil {
+			return nil, err
+		}
+		testRates[i], err = snapshotRates(ctx, conn, `
+			SELECT t.name, SUM(tr.status IN (`+sqlStatusList(testgrid.CategoryPass)+`,`+sqlStatusList(testgrid.CategoryFlake)+`)), COUNT(*)
+			FROM `+schema+`.test_results tr
+			JOIN `+schema+`.builds b ON b.id = tr.build_id
+			JOIN `+schema+`.tests t ON t.id = tr.test_id
+			WHERE b.timestamp > ? AND tr.status IN (`+sqlStatusList(testgrid.CategoryPass)+`,`+sqlStatusList(testgrid.CategoryFlake)+`,`+sqlStatusList(testgrid.CategoryFail)+`)
+			GROUP BY t.name`, since)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	diff.JobsAdded = setDiff(jobs[1], jobs[0])
+	diff.JobsRemoved = setDiff(jobs[0], jobs[1])
+	diff.TestsAdded = setDiff(tests[1], tests[0])
+	diff.TestsRemoved = setDiff(tests[0], tests[1])
+	diff.Jobs = rateChanges(jobRates[0], jobRates[1], threshold, minRuns)
+	diff.Tests = rateChanges(testRates[0], testRates[1], threshold, minRuns)
+	return diff, nil
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type RenameCandidate struct {
+	Name       string  `json:"name"`
+	FirstSeen  int64   `json:"first_seen"`
+	Similarity float64 `json:"similarity"`
+}
+
+type DisappearedTest struct {
+	Name       string            `json:"name"`
+	LastSeen   int64             `json:"last_seen"`
+	Runs       int               `json:"runs"`
+	Candidates []RenameCandidate `json:"candidates"`
+}
+
+func nameTokens(name string) map[string]bool {
+	tokens := map[string]bool{}
+	for _, token := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		tokens[token] = true
+	}
+	return tokens
+}
+
+func nameSimilarity(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 0
+	}
+	common := 0
+	for token := range a {
+		if b[token] {
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(a)+len(b))
+}
+
+func (db *dbImpl) DisappearedTests(filter string, recentDays int, priorDays int, minSimilarity float64) ([]DisappearedTest, error) {
+	results := []DisappearedTest{}
+
+	now := time.Now()
+	recentStart := now.AddDate(0, 0, -recentDays).Unix() * 1000
+	priorStart := now.AddDate(0, 0, -recentDays-priorDays).Unix() * 1000
+
+	jobCond := ""
+	if filter != "" {
+		jobIDs, err := db.findJobIDsByFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		if len(jobIDs) == 0 {
+			return results, nil
+		}
+		jobCond = " AND b.job_id IN (" + sqlInt64List(jobIDs) + ")"
+	}
+
+	rows, err := db.Query(`
+		SELECT t.name, MIN(b.timestamp), MAX(b.timestamp), COUNT(*)
+		FROM test_results tr
+		JOIN builds b ON b.id = tr.build_id
+		JOIN test_names t ON t.id = tr.test_id
+		WHERE b.timestamp >= ?`+jobCond+`
+		GROUP BY t.name
+	`, priorStart)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type newTest struct {
+		name      string
+		firstSeen int64
+		tokens    map[string]bool
+	}
+	var newTests []newTest
+	for rows.Next() {
+		var name string
+		var firstSeen, lastSeen int64
+		var runs int
+		if err := rows.Scan(&name, &firstSeen, &lastSeen, &runs); err != nil {
+			return nil, err
+		}
+		if lastSeen < recentStart {
+			results = append(results, DisappearedTest{
+				Name:       name,
+				LastSeen:   lastSeen,
+				Runs:       runs,
+				Candidates: []RenameCandidate{},
+			})
+		} else if firstSeen >= recentStart {
+			newTests = append(newTests, newTest{
+				name:      name,
+				firstSeen: firstSeen,
+				tokens:    nameTokens(name),
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		tokens := nameTokens(results[i].Name)
+		for _, t := range newTests {
+			similarity := nameSimilarity(tokens, t.tokens)
+			if similarity < minSimilarity {
+				continue
+			}
+			results[i].Candidates = append(results[i].Candidates, RenameCandidate{
+				Name:       t.name,
+				FirstSeen:  t.firstSeen,
+				Similarity: similarity,
+			})
+		}
+		sort.Slice(results[i].Candidates, func(a, b int) bool {
+			return results[i].Candidates[a].Similarity > results[i].Candidates[b].Similarity
+		})
+		if len(results[i].Candidates) > 5 {
+			results[i].Candidates = results[i].Candidates[:5]
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Runs > results[j].Runs
+	})
+	return results, nil
+}
@@ -0,0 +1,296 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Finding struct {
+	Check   string `json:"check"`
+	Problem string `json:"problem"`
+	Count   int    `json:"count"`
+	Hint    string `json:"hint"`
+
+	fix func(db *dbImpl) error
+}
+
+func (f Finding) Fixable() bool {
+	return f.fix != nil
+}
+
+// Fix applies the fix for the finding. The finding should be produced by
+// Diagnose on the same database.
+func (tx *Tx) Fix(f Finding) error {
+	if f.fix == nil {
+		return fmt.Errorf("%s: no automatic fix available", f.Check)
+	}
+	return f.fix(&tx.dbImpl)
+}
+
+func schemaObjects(conn sqlConn) (map[string][]string, error) {
+	rows, err := conn.Query(`SELECT m.name, IFNULL(c.name, '') FROM sqlite_master m
+		LEFT JOIN pragma_table_info(m.name) c ON m.type IN ('table', 'view')
+		WHERE m.type IN ('table', 'view', 'index') AND m.name NOT LIKE 'sqlite_%' AND m.name NOT LIKE 'tests_fts%'`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	objects := map[string][]string{}
+	for rows.Next() {
+		var name, column string
+		if err := rows.Scan(&name, &column); err != nil {
+			return nil, err
+		}
+		if column == "" {
+			objects[name] = objects[name]
+		} else {
+			objects[name] = append(objects[name], column)
+		}
+	}
+	return objects, rows.Err()
+}
+
+// schemaDrift compares the schema of the database with the schema that is
+// produced by the migrations.
+func (db *DB) schemaDrift() ([]string, error) {
+	m, err := NewMigrator(":memory:")
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+	m.db.SetMaxOpenConns(1)
+	if _, err := m.Up(0); err != nil {
+		return nil, err
+	}
+
+	expected, err := schemaObjects(m.db)
+	if err != nil {
+		return nil, err
+	}
+	actual, err := schemaObjects(db.db)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	for name, columns := range expected {
+		actualColumns, ok := actual[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s is missing", name))
+			continue
+		}
+		have := map[string]bool{}
+		for _, c := range actualColumns {
+			have[c] = true
+		}
+		for _, c := range columns {
+			if !have[c] {
+				problems = append(problems, fmt.Sprintf("%s.%s is missing", name, c))
+			}
+			delete(have, c)
+		}
+		for c := range have {
+			problems = append(problems, fmt.Sprintf("%s.%s is unexpected", name, c))
+		}
+	}
+	for name := range actual {
+		if _, ok := expected[name]; !ok {
+			problems = append(problems, fmt.Sprintf("%s is unexpected", name))
+		}
+	}
+	sort.Strings(problems)
+	return problems, nil
+}
+
+var orphanChecks = []struct {
+	table string
+	cond  string
+}{
+	{"jobs_sippy_tags", "job_id NOT IN (SELECT id FROM jobs)"},
+	{"job_tags", "job_id NOT IN (SELECT id FROM jobs)"},
+	{"job_ciinfo_tags", "job_id NOT IN (SELECT id FROM jobs)"},
+	{"job_variants", "job_id NOT IN (SELECT id FROM jobs)"},
+	{"job_flakiness", "job_id NOT IN (SELECT id FROM jobs)"},
+	{"builds", "job_id NOT IN (SELECT id FROM jobs)"},
+	{"test_results", "build_id NOT IN (SELECT id FROM builds) OR test_id NOT IN (SELECT id FROM tests)"},
+	{"test_flakiness", "test_id NOT IN (SELECT id FROM tests)"},
+	{"test_bugs", "test_id NOT IN (SELECT id FROM tests)"},
+	{"test_issues", "test_id NOT IN (SELECT id FROM tests)"},
+	{"annotations", "build_id NOT IN (SELECT id FROM builds) OR test_id NOT IN (SELECT id FROM tests)"},
+	{"index_run_errors", "run_id NOT IN (SELECT id FROM index_runs)"},
+}
+
+func (db *dbImpl) count(query string, params ...interface{}) (int, error) {
+	var n int
+	err := db.QueryRow(query, params...).Scan(&n)
+	return n, err
+}
+
+func normalizeTestName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+func (db *dbImpl) duplicateTests() (map[int64][]int64, error) {
+	rows, err := db.Query("SELECT id, name FROM tests ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byName := map[string][]int64{}
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		key := normalizeTestName(name)
+		byName[key] = append(byName[key], id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	duplicates := map[int64][]int64{}
+	for _, ids := range byName {
+		if len(ids) > 1 {
+			duplicates[ids[0]] = ids[1:]
+		}
+	}
+	return duplicates, nil
+}
+
+func mergeTests(db *dbImpl, duplicates map[int64][]int64) error {
+	for id, dups := range duplicates {
+		for _, dup := range dups {
+			stmts := []string{
+				"UPDATE OR IGNORE test_results SET test_id = ? WHERE test_id = ?",
+				"UPDATE OR IGNORE test_bugs SET test_id = ? WHERE test_id = ?",
+				"UPDATE OR IGNORE test_issues SET test_id = ? WHERE test_id = ?",
+				"UPDATE annotations SET test_id = ? WHERE test_id = ?",
+			}
+			for _, stmt := range stmts {
+				if _, err := db.Exec(stmt, id, dup); err != nil {
+					return err
+				}
+			}
+			stmts = []string{
+				"DELETE FROM test_results WHERE test_id = ?",
+				"DELETE FROM test_bugs WHERE test_id = ?",
+				"DELETE FROM test_issues WHERE test_id = ?",
+				"DELETE FROM test_flakiness WHERE test_id = ?",
+				"DELETE FROM tests WHERE id = ?",
+			}
+			for _, stmt := range stmts {
+				if _, err := db.Exec(stmt, dup); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Diagnose checks the database for problems. Data is considered stale if
+// there are no builds in the last staleDays days.
+func (db *DB) Diagnose(staleDays int) ([]Finding, error) {
+	findings := []Finding{}
+
+	drift, err := db.schemaDrift()
+	if err != nil {
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+	if len(drift) > 0 {
+		findings = append(findings, Finding{
+			Check:   "schema",
+			Problem: "schema differs from the expected schema: " + strings.Join(drift, ", "),
+			Count:   len(drift),
+			Hint:    "check the schema version with 'ci-results migrate status'; objects changed by hand need to be fixed manually",
+		})
+	}
+
+	for _, c := range orphanChecks {
+		c := c
+		n, err := db.count("SELECT COUNT(*) FROM " + c.table + " WHERE " + c.cond)
+		if err != nil {
+			return nil, fmt.Errorf("orphans in %s: %w", c.table, err)
+		}
+		if n == 0 {
+			continue
+		}
+		findings = append(findings, Finding{
+			Check:   "orphans",
+			Problem: fmt.Sprintf("%d rows in %s reference missing rows", n, c.table),
+			Count:   n,
+			Hint:    "delete the rows with --fix",
+			fix: func(db *dbImpl) error {
+				_, err := db.Exec("DELETE FROM " + c.table + " WHERE " + c.cond)
+				return err
+			},
+		})
+	}
+
+	duplicates, err := db.duplicateTests()
+	if err != nil {
+		return nil, fmt.Errorf("duplicate tests: %w", err)
+	}
+	if len(duplicates) > 0 {
+		n := 0
+		for _, dups := range duplicates {
+			n += len(dups)
+		}
+		findings = append(findings, Finding{
+			Check:   "duplicate-tests",
+			Problem: fmt.Sprintf("%d tests differ from other tests only by whitespace", n),
+			Count:   n,
+			Hint:    "merge their results into the oldest test with --fix",
+			fix: func(db *dbImpl) error {
+				return mergeTests(db, duplicates)
+			},
+		})
+	}
+
+	const emptyBuilds = "id NOT IN (SELECT DISTINCT build_id FROM test_results)"
+	n, err := db.count("SELECT COUNT(*) FROM builds WHERE " + emptyBuilds)
+	if err != nil {
+		return nil, fmt.Errorf("empty builds: %w", err)
+	}
+	if n > 0 {
+		findings = append(findings, Finding{
+			Check:   "empty-builds",
+			Problem: fmt.Sprintf("%d builds have no test results", n),
+			Count:   n,
+			Hint:    "delete the builds and their annotations with --fix, they will be indexed again if they are still on TestGrid",
+			fix: func(db *dbImpl) error {
+				// The annotations are deleted first, as prune does, so that
+				// they don't become orphans.
+				_, err := db.Exec("DELETE FROM annotations WHERE build_id IN (SELECT id FROM builds WHERE " + emptyBuilds + ")")
+				if err != nil {
+					return err
+				}
+				_, err = db.Exec("DELETE FROM builds WHERE " + emptyBuilds)
+				return err
+			},
+		})
+	}
+
+	var last int64
+	err = db.QueryRow("SELECT IFNULL(MAX(timestamp), 0) FROM builds").Scan(&last)
+	if err != nil {
+		return nil, fmt.Errorf("stale data: %w", err)
+	}
+	if last < time.Now().AddDate(0, 0, -staleDays).Unix()*1000 {
+		problem := "the database has no builds"
+		if last != 0 {
+			problem = fmt.Sprintf("the latest build is from %s", time.Unix(last/1000, 0).UTC().Format("2006-01-02 15:04"))
+		}
+		findings = append(findings, Finding{
+			Check:   "stale-data",
+			Problem: problem,
+			Hint:    "check that 'ci-results indexer' runs periodically",
+		})
+	}
+
+	return findings, nil
+}
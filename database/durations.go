@@ -0,0 +1,154 @@
+package database
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+type DurationPercentiles struct {
+	Name string  `json:"name"`
+	Runs int     `json:"runs"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+}
+
+type DurationIncrease struct {
+	Name     string  `json:"name"`
+	Previous float64 `json:"previous"`
+	Current  float64 `json:"current"`
+	Increase float64 `json:"increase"`
+	Ratio    float64 `json:"ratio"`
+}
+
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+func (db *dbImpl) testDurations(filter string, testName string, since int64, until int64) (map[string][]float64, error) {
+	durations := map[string][]float64{}
+
+	query := `
+		SELECT t.name, tr.duration
+		FROM test_results tr
+		JOIN builds b ON b.id = tr.build_id
+		JOIN test_names t ON t.id = tr.test_id
+		WHERE tr.duration IS NOT NULL AND b.timestamp >= ? AND b.timestamp < ?`
+	params := []interface{}{since, until}
+
+	if filter != "" {
+		jobIDs, err := db.findJobIDsByFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		if len(jobIDs) == 0 {
+			return durations, nil
+		}
+		query += " AND b.job_id IN (" + sqlInt64List(jobIDs) + ")"
+	}
+
+	if testName != "" {
+		testIDs, err := db.findTestIDs(testName)
+		if IsNotFound(err) {
+			return durations, nil
+		} else if err != nil {
+			return nil, err
+		}
+		query += " AND tr.test_id IN (" + sqlInt64List(testIDs) + ")"
+	}
+
+	rows, err := db.Query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var duration float64
+		if err := rows.Scan(&name, &duration); err != nil {
+			return nil, err
+		}
+		durations[name] = append(durations[name], duration)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, d := range durations {
+		sort.Float64s(d)
+	}
+	return durations, nil
+}
+
+func (db *dbImpl) TestDurations(filter string, testName string, days int) ([]DurationPercentiles, error) {
+	now := time.Now()
+	durations, err := db.testDurations(filter, testName, now.AddDate(0, 0, -days).Unix()*1000, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []DurationPercentiles{}
+	for name, d := range durations {
+		results = append(results, DurationPercentiles{
+			Name: name,
+			Runs: len(d),
+			P50:  percentile(d, 0.5),
+			P90:  percentile(d, 0.9),
+			P99:  percentile(d, 0.99),
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].P50 > results[j].P50
+	})
+	return results, nil
+}
+
+func (db *dbImpl) DurationIncreases(filter string, limit int) ([]DurationIncrease, error) {
+	now := time.Now()
+	weekAgo := now.AddDate(0, 0, -7).Unix() * 1000
+
+	current, err := db.testDurations(filter, "", weekAgo, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := db.testDurations(filter, "", now.AddDate(0, 0, -14).Unix()*1000, weekAgo)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []DurationIncrease{}
+	for name, curr := range current {
+		prev, ok := previous[name]
+		if !ok {
+			continue
+		}
+		c, p := percentile(curr, 0.5), percentile(prev, 0.5)
+		if c <= p {
+			continue
+		}
+		increase := DurationIncrease{
+			Name:     name,
+			Previous: p,
+			Current:  c,
+			Increase: c - p,
+		}
+		if p > 0 {
+			increase.Ratio = c / p
+		}
+		results = append(results, increase)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Increase > results[j].Increase
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"time"
+
+	"github.com/dmage/ci-results/testgrid"
+)
+
+// TestFailure is a failed result of a test in a build.
+type TestFailure struct {
+	Job       string `json:"job"`
+	Dashboard string `json:"dashboard"`
+	Build     string `json:"build"`
+	Timestamp int64  `json:"timestamp"`
+	Message   string `json:"message,omitempty"`
+	// Target is the ci-operator test that the job runs, if it is known.
+	Target string `json:"-"`
+	// Links are links to pages of the job and to logs and artifacts of the
+	// build, they are filled by the server.
+	Links map[string]string `json:"links,omitempty"`
+}
+
+// RecentTestFailures returns the latest failed results of the test in the
+// last days, the latest first.
+func (db *dbImpl) RecentTestFailures(testName string, filter string, days int, limit int) ([]TestFailure, error) {
+	testIDs, err := db.findTestIDs(testName)
+	if err != nil {
+		return nil, err
+	}
+
+	failures := []TestFailure{}
+	query := `
+		SELECT j.name, j.dashboard, b.number, b.timestamp, IFNULL(tr.message, ''),
+			IFNULL((SELECT substr(t.tag, 10) FROM job_all_tags t WHERE t.job_id = j.id AND t.tag LIKE 'x-target-%' LIMIT 1), '')
+		FROM test_results tr
+		JOIN builds b ON b.id = tr.build_id
+		JOIN jobs j ON j.id = b.job_id
+		WHERE tr.test_id IN (` + sqlInt64List(testIDs) + `) AND tr.status IN (` + sqlStatusList(testgrid.CategoryFail) + `) AND b.timestamp >= ?`
+	if filter != "" {
+		jobIDs, err := db.findJobIDsByFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		if len(jobIDs) == 0 {
+			return failures, nil
+		}
+		query += " AND b.job_id IN (" + sqlInt64List(jobIDs) + ")"
+	}
+	query += " ORDER BY b.timestamp DESC LIMIT ?"
+
+	rows, err := db.Query(query, time.Now().AddDate(0, 0, -days).Unix()*1000, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var f TestFailure
+		if err := rows.Scan(&f.Job, &f.Dashboard, &f.Build, &f.Timestamp, &f.Message, &f.Target); err != nil {
+			return nil, err
+		}
+		failures = append(failures, f)
+	}
+	return failures, rows.Err()
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/dmage/ci-results/testgrid"
+)
+
+const (
+	flakinessWindow   = 30 * 24 * time.Hour
+	flakinessHalfLife = 7 * 24 * time.Hour
+)
+
+type FlakinessScore struct {
+	Name   string  `json:"name"`
+	Score  float64 `json:"score"`
+	Flakes int     `json:"flakes"`
+	Runs   int     `json:"runs"`
+	// Links are links to pages of the test or the job, they are filled by
+	// the server and reports.
+	Links map[string]string `json:"links,omitempty"`
+}
+
+type flakinessAccumulator struct {
+	weightedFlakes float64
+	weightedRuns   float64
+	flakes         int
+	runs           int
+}
+
+func (a *flakinessAccumulator) add(age time.Duration, flakes, runs int) {
+	weight := math.Pow(0.5, float64(age)/float64(flakinessHalfLife))
+	a.weightedFlakes += weight * float64(flakes)
+	a.weightedRuns += weight * float64(runs)
+	a.flakes += flakes
+	a.runs += runs
+}
+
+func (a *flakinessAccumulator) score() float64 {
+	if a.weightedRuns == 0 {
+		return 0
+	}
+	return a.weightedFlakes / a.weightedRuns
+}
+
+func (db *dbImpl) accumulateFlakiness(query string, now time.Time, params ...interface{}) (map[int64]*flakinessAccumulator, error) {
+	result := map[int64]*flakinessAccumulator{}
+	rows, err := db.Query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, day int64
+		var flakes, runs int
+		if err := rows.Scan(&id, &day, &flakes, &runs); err != nil {
+			return nil, err
+		}
+		acc, ok := result[id]
+		if !ok {
+			acc = &flakinessAccumulator{}
+			result[id] = acc
+		}
+		age := now.Sub(time.Unix(day*86400, 0))
+		acc.add(age, flakes, runs)
+	}
+	return result, rows.Err()
+}
+
+func (db *dbImpl) storeFlakiness(table string, idColumn string, scores map[int64]*flakinessAccumulator) error {
+	_, err := db.Exec("DELETE FROM " + table)
+	if err != nil {
+		return err
+	}
+	stmt, err := db.Prepare("INSERT INTO " + table + " (" + idColumn + ", score, flakes, runs) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for id, acc := range scores {
+		_, err := stmt.Exec(id, acc.score(), acc.flakes, acc.runs)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *dbImpl) UpdateFlakinessScores(now time.Time) error {
+	since := now.Add(-flakinessWindow).Unix() * 1000
+
+	testScores, err := db.accumulateFlakiness(`
+		SELECT tr.test_id, b.timestamp / 86400000 AS day, SUM(tr.status IN (`+sqlStatusList(testgrid.CategoryFlake)+`)), COUNT(*)
+		FROM test_results tr
+		JOIN builds b ON b.id = tr.build_id
+		WHERE b.timestamp >= ?
+		GROUP BY tr.test_id, day
+	`, now, since)
+	if err != nil {
+		return fmt.Errorf("unable to compute test flakiness: %w", err)
+	}
+	if err := db.storeFlakiness("test_flakiness", "test_id", testScores); err != nil {
+		return fmt.Errorf("unable to store test flakiness: %w", err)
+	}
+
+	jobScores, err := db.accumulateFlakiness(`
+		SELECT b.job_id, b.timestamp / 86400000 AS day, SUM(EXISTS (SELECT 1 FROM test_results tr WHERE tr.build_id = b.id AND tr.status IN (`+sqlStatusList(testgrid.CategoryFlake)+`))), COUNT(*)
+		FROM builds b
+		WHERE b.timestamp >= ?
+		GROUP BY b.job_id, day
+	`, now, since)
+	if err != nil {
+		return fmt.Errorf("unable to compute job flakiness: %w", err)
+	}
+	if err := db.storeFlakiness("job_flakiness", "job_id", jobScores); err != nil {
+		return fmt.Errorf("unable to store job flakiness: %w", err)
+	}
+
+	return nil
+}
+
+func (db *dbImpl) FlakinessScores(kind string, sort string, limit int) ([]FlakinessScore, error) {
+	var query string
+	switch kind {
+	case "tests":
+		query = "SELECT t.name, f.score, f.flakes, f.runs FROM test_flakiness f JOIN tests t ON t.id = f.test_id"
+	case "jobs":
+		query = "SELECT j.name, f.score, f.flakes, f.runs FROM job_flakiness f JOIN jobs j ON j.id = f.job_id"
+	default:
+		return nil, newErrInvalidParam("kind", kind, "unknown kind", "tests", "jobs")
+	}
+
+	switch sort {
+	case "score":
+		query += " ORDER BY f.score DESC, f.flakes DESC"
+	case "flakes":
+		query += " ORDER BY f.flakes DESC, f.score DESC"
+	case "runs":
+		query += " ORDER BY f.runs DESC"
+	case "name":
+		query += " ORDER BY 1"
+	default:
+		return nil, newErrInvalidParam("sort", sort, "unknown sort order", "score", "flakes", "runs", "name")
+	}
+	query += " LIMIT ?"
+
+	results := []FlakinessScore{}
+	rows, err := db.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s FlakinessScore
+		if err := rows.Scan(&s.Name, &s.Score, &s.Flakes, &s.Runs); err != nil {
+			return nil, err
+		}
+		results = append(results, s)
+	}
+	return results, rows.Err()
+}
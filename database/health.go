@@ -0,0 +1,187 @@
+package database
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dmage/ci-results/testgrid"
+)
+
+type HealthWeights struct {
+	Pass      float64
+	Flake     float64
+	Streak    float64
+	Freshness float64
+}
+
+type HealthComponents struct {
+	Pass      float64 `json:"pass"`
+	Flake     float64 `json:"flake"`
+	Streak    float64 `json:"streak"`
+	Freshness float64 `json:"freshness"`
+}
+
+type HealthScore struct {
+	Columns    []string         `json:"columns"`
+	Score      float64          `json:"score"`
+	Components HealthComponents `json:"components"`
+	Jobs       int              `json:"jobs"`
+	// Links are links to pages of the variant or the job, they are filled
+	// by the server and reports.
+	Links map[string]string `json:"links,omitempty"`
+}
+
+func (w HealthWeights) score(c HealthComponents) float64 {
+	total := w.Pass + w.Flake + w.Streak + w.Freshness
+	if total == 0 {
+		return 0
+	}
+	return (w.Pass*c.Pass + w.Flake*c.Flake + w.Streak*c.Streak + w.Freshness*c.Freshness) / total
+}
+
+type jobHealth struct {
+	name       string
+	builds     int
+	passed     int
+	flaky      int
+	streak     int
+	streakDone bool
+	lastBuild  int64
+}
+
+func (j *jobHealth) components(now time.Time) HealthComponents {
+	hours := now.Sub(time.Unix(j.lastBuild/1000, 0)).Hours()
+	return HealthComponents{
+		Pass:      float64(j.passed) / float64(j.builds),
+		Flake:     1 - float64(j.flaky)/float64(j.builds),
+		Streak:    1 / float64(1+j.streak),
+		Freshness: math.Pow(0.5, hours/24),
+	}
+}
+
+func (db *dbImpl) HealthScores(columns string, filter string, days int, weights HealthWeights) ([]HealthScore, error) {
+	now := time.Now()
+	results := []HealthScore{}
+
+	query := `
+		SELECT b.job_id, j.name, b.status, b.timestamp, EXISTS (SELECT 1 FROM test_results tr WHERE tr.build_id = b.id AND tr.status IN (` + sqlStatusList(testgrid.CategoryFlake) + `))
+		FROM builds b
+		JOIN jobs j ON j.id = b.job_id
+		WHERE b.timestamp >= ?`
+	if filter != "" {
+		jobIDs, err := db.findJobIDsByFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		if len(jobIDs) == 0 {
+			return results, nil
+		}
+		query += " AND j.id IN (" + sqlInt64List(jobIDs) + ")"
+	}
+	query += " ORDER BY b.job_id, b.timestamp DESC"
+
+	rows, err := db.Query(query, now.AddDate(0, 0, -days).Unix()*1000)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	jobs := map[int64]*jobHealth{}
+	for rows.Next() {
+		var jobID, timestamp int64
+		var name string
+		var status int
+		var flaky bool
+		if err := rows.Scan(&jobID, &name, &status, &timestamp, &flaky); err != nil {
+			return nil, err
+		}
+		job, ok := jobs[jobID]
+		if !ok {
+			job = &jobHealth{name: name, lastBuild: timestamp}
+			jobs[jobID] = job
+		}
+		job.builds++
+		if status == 1 {
+			job.passed++
+			job.streakDone = true
+		} else if !job.streakDone {
+			job.streak++
+		}
+		if flaky {
+			job.flaky++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	groups := map[string][]int64{}
+	switch columns {
+	case "name":
+		for id, job := range jobs {
+			groups[job.name] = append(groups[job.name], id)
+		}
+	case "sippytags":
+		if err := db.groupJobs(groups, jobs, "SELECT job_id, tag FROM jobs_sippy_tags"); err != nil {
+			return nil, err
+		}
+	case "owner":
+		if err := db.groupJobs(groups, jobs, "SELECT id, COALESCE(owner, 'none') FROM jobs"); err != nil {
+			return nil, err
+		}
+	default:
+		dimension := strings.TrimPrefix(columns, "variant.")
+		if dimension == columns {
+			return nil, newErrInvalidParam("columns", columns, "unknown column", "name", "sippytags", "owner", "variant.DIMENSION")
+		}
+		if err := db.groupJobs(groups, jobs, "SELECT job_id, value FROM job_variants WHERE dimension = ?", dimension); err != nil {
+			return nil, err
+		}
+	}
+
+	for key, ids := range groups {
+		var c HealthComponents
+		for _, id := range ids {
+			jc := jobs[id].components(now)
+			c.Pass += jc.Pass / float64(len(ids))
+			c.Flake += jc.Flake / float64(len(ids))
+			c.Streak += jc.Streak / float64(len(ids))
+			c.Freshness += jc.Freshness / float64(len(ids))
+		}
+		results = append(results, HealthScore{
+			Columns:    []string{key},
+			Score:      weights.score(c),
+			Components: c,
+			Jobs:       len(ids),
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score < results[j].Score
+		}
+		return results[i].Columns[0] < results[j].Columns[0]
+	})
+	return results, nil
+}
+
+// groupJobs adds known jobs to groups using a query that returns job IDs and
+// group keys.
+func (db *dbImpl) groupJobs(groups map[string][]int64, jobs map[int64]*jobHealth, query string, params ...interface{}) error {
+	rows, err := db.Query(query, params...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var key string
+		if err := rows.Scan(&id, &key); err != nil {
+			return err
+		}
+		if _, ok := jobs[id]; ok {
+			groups[key] = append(groups[key], id)
+		}
+	}
+	return rows.Err()
+}
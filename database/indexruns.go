@@ -0,0 +1,104 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Statuses of index runs.
+const (
+	IndexRunRunning   = "running"
+	IndexRunSucceeded = "succeeded"
+	IndexRunPartial   = "partial"
+	IndexRunFailed    = "failed"
+)
+
+// IndexRun records when the indexer was run and how it ended.
+type IndexRun struct {
+	ID       int64  `json:"id"`
+	Version  string `json:"version"`
+	Started  int64  `json:"started"`
+	Finished int64  `json:"finished,omitempty"`
+	Status   string `json:"status"`
+	Errors   int    `json:"errors"`
+}
+
+// IndexRunError is a dashboard, a job or a build that the indexer has
+// skipped.
+type IndexRunError struct {
+	Dashboard string `json:"dashboard"`
+	Job       string `json:"job,omitempty"`
+	Build     string `json:"build,omitempty"`
+	Error     string `json:"error"`
+}
+
+// StartIndexRun records the start of an index run and returns its id.
+func (db *dbImpl) StartIndexRun(version string) (int64, error) {
+	result, err := db.Exec("insert into index_runs (version, started, status) values (?, ?, ?)", version, time.Now().Unix()*1000, IndexRunRunning)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// FinishIndexRun stores the status of the run and the errors that it has
+// skipped.
+func (db *dbImpl) FinishIndexRun(id int64, status string, errs []IndexRunError) error {
+	for _, e := range errs {
+		_, err := db.Exec("insert into index_run_errors (run_id, dashboard, job, build, error) values (?, ?, ?, ?, ?)", id, e.Dashboard, e.Job, e.Build, e.Error)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := db.Exec("update index_runs set finished = ?, status = ? where id = ?", time.Now().Unix()*1000, status, id)
+	return err
+}
+
+// IndexRuns returns the latest runs, newest first.
+func (db *dbImpl) IndexRuns(limit int) ([]IndexRun, error) {
+	results := []IndexRun{}
+	rows, err := db.Query(`
+		SELECT r.id, r.version, r.started, IFNULL(r.finished, 0), r.status, COUNT(e.id)
+		FROM index_runs r
+		LEFT JOIN index_run_errors e ON e.run_id = r.id
+		GROUP BY r.id
+		ORDER BY r.id DESC
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var run IndexRun
+		if err := rows.Scan(&run.ID, &run.Version, &run.Started, &run.Finished, &run.Status, &run.Errors); err != nil {
+			return nil, err
+		}
+		results = append(results, run)
+	}
+	return results, rows.Err()
+}
+
+// IndexRunErrors returns the errors of the run.
+func (db *dbImpl) IndexRunErrors(id int64) ([]IndexRunError, error) {
+	var exists int
+	if err := db.QueryRow("SELECT 1 FROM index_runs WHERE id = ?", id).Scan(&exists); err == sql.ErrNoRows {
+		return nil, newErrNotFound("index run %d does not exist", id)
+	} else if err != nil {
+		return nil, err
+	}
+
+	results := []IndexRunError{}
+	rows, err := db.Query("SELECT dashboard, job, build, error FROM index_run_errors WHERE run_id = ? ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e IndexRunError
+		if err := rows.Scan(&e.Dashboard, &e.Job, &e.Build, &e.Error); err != nil {
+			return nil, err
+		}
+		results = append(results, e)
+	}
+	return results, rows.Err()
+}
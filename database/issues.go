@@ -0,0 +1,73 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// TestIssue is an issue that has been filed for a test.
+type TestIssue struct {
+	Test    string `json:"test"`
+	Tracker string `json:"tracker"`
+	Key     string `json:"key"`
+	URL     string `json:"url"`
+	Opened  int64  `json:"opened"`
+	Updated int64  `json:"updated"`
+}
+
+// currentTestID returns the id of the test under its current name.
+func (db *dbImpl) currentTestID(testName string) (int64, error) {
+	ids, err := db.findTestIDs(testName)
+	if err != nil {
+		return 0, err
+	}
+	return ids[len(ids)-1], nil
+}
+
+// TestIssue returns the issue that has been filed for the test in the
+// tracker.
+func (db *dbImpl) TestIssue(testName string, tracker string) (*TestIssue, error) {
+	testID, err := db.currentTestID(testName)
+	if err != nil {
+		return nil, err
+	}
+
+	issue := &TestIssue{
+		Test:    testName,
+		Tracker: tracker,
+	}
+	row := db.QueryRow("SELECT key, url, opened, updated FROM test_issues WHERE test_id = ? AND tracker = ?", testID, tracker)
+	if err := row.Scan(&issue.Key, &issue.URL, &issue.Opened, &issue.Updated); err == sql.ErrNoRows {
+		return nil, newErrNotFound("no %s issue for test %q", tracker, testName)
+	} else if err != nil {
+		return nil, err
+	}
+	return issue, nil
+}
+
+// SetTestIssue remembers the issue that has been filed for the test, it
+// replaces the previous issue from the tracker.
+func (db *dbImpl) SetTestIssue(testName string, tracker string, key string, url string) error {
+	testID, err := db.currentTestID(testName)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix() * 1000
+	_, err = db.Exec(
+		"INSERT OR REPLACE INTO test_issues (test_id, tracker, key, url, opened, updated) VALUES (?, ?, ?, ?, ?, ?)",
+		testID, tracker, key, url, now, now,
+	)
+	return err
+}
+
+// TouchTestIssue records that the issue of the test has been updated.
+func (db *dbImpl) TouchTestIssue(testName string, tracker string) error {
+	testID, err := db.currentTestID(testName)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("UPDATE test_issues SET updated = ? WHERE test_id = ? AND tracker = ?", time.Now().Unix()*1000, testID, tracker)
+	return err
+}
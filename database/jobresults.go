@@ -0,0 +1,133 @@
+package database
+
+import (
+	"database/sql"
+	"sort"
+
+	"github.com/dmage/ci-results/testgrid"
+)
+
+// JobResults rebuilds the TestGrid table of the job from the builds that
+// started at or after since (in milliseconds). Columns are ordered from the
+// newest build to the oldest one, as TestGrid does.
+func (db *dbImpl) JobResults(jobName string, since int64) (*testgrid.JobResults, error) {
+	jobID, err := db.FindJob(jobName)
+	if err != nil {
+		return nil, err
+	}
+
+	results := &testgrid.JobResults{
+		Query:       jobName,
+		Changelists: []string{},
+		Timestamps:  []int64{},
+	}
+	overall := testgrid.Test{Name: "Overall"}
+	columns := map[int64]int{}
+
+	rows, err := db.Query("SELECT id, number, timestamp, status FROM builds WHERE job_id = ? AND timestamp >= ? ORDER BY timestamp DESC, id DESC", jobID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var overallStatuses []testgrid.TestStatus
+	for rows.Next() {
+		var id, timestamp int64
+		var number string
+		var status int
+		if err := rows.Scan(&id, &number, &timestamp, &status); err != nil {
+			return nil, err
+		}
+		columns[id] = len(results.Changelists)
+		results.Changelists = append(results.Changelists, number)
+		results.Timestamps = append(results.Timestamps, timestamp)
+		if status == 1 {
+			overallStatuses = append(overallStatuses, testgrid.TestStatusPass)
+		} else {
+			overallStatuses = append(overallStatuses, testgrid.TestStatusFail)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return results, nil
+	}
+	overall.Statuses = encodeStatuses(overallStatuses)
+	results.Tests = append(results.Tests, overall)
+
+	type cell struct {
+		status   testgrid.TestStatus
+		duration sql.NullFloat64
+	}
+	tests := map[string][]cell{}
+	rows, err = db.Query(`
+		SELECT tr.build_id, t.name, tr.status, tr.duration
+		FROM test_results tr
+		JOIN test_names t ON t.id = tr.test_id
+		JOIN builds b ON b.id = tr.build_id
+		WHERE b.job_id = ? AND b.timestamp >= ? AND t.name != 'Overall'
+	`, jobID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var buildID int64
+		var name string
+		var c cell
+		if err := rows.Scan(&buildID, &name, &c.status, &c.duration); err != nil {
+			return nil, err
+		}
+		cells, ok := tests[name]
+		if !ok {
+			cells = make([]cell, len(columns))
+			tests[name] = cells
+		}
+		cells[columns[buildID]] = c
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(tests))
+	for name := range tests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cells := tests[name]
+		test := testgrid.Test{Name: name}
+		statuses := make([]testgrid.TestStatus, len(cells))
+		durations := make([]*float64, len(cells))
+		hasDurations := false
+		for i, c := range cells {
+			statuses[i] = c.status
+			if c.duration.Valid {
+				minutes := c.duration.Float64 / 60
+				durations[i] = &minutes
+				hasDurations = true
+			}
+		}
+		test.Statuses = encodeStatuses(statuses)
+		if hasDurations {
+			test.Graphs = []testgrid.Graph{{
+				Metric: []string{testgrid.MetricTestDuration},
+				Values: [][]*float64{durations},
+			}}
+		}
+		results.Tests = append(results.Tests, test)
+	}
+	return results, nil
+}
+
+func encodeStatuses(statuses []testgrid.TestStatus) []testgrid.TestResult {
+	var result []testgrid.TestResult
+	for _, s := range statuses {
+		if n := len(result); n > 0 && result[n-1].Value == s {
+			result[n-1].Count++
+			continue
+		}
+		result = append(result, testgrid.TestResult{Count: 1, Value: s})
+	}
+	return result
+}
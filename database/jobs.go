@@ -0,0 +1,112 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type JobInfo struct {
+	Name            string   `json:"name"`
+	Dashboard       string   `json:"dashboard"`
+	Tags            []string `json:"tags"`
+	LastBuild       *int64   `json:"last_build"`
+	LastBuildStatus string   `json:"last_build_status,omitempty"`
+	RecentBuilds    int      `json:"recent_builds"`
+	RecentPassRate  *float64 `json:"recent_pass_rate"`
+	// Links are links to pages of the job, they are filled by the server.
+	Links map[string]string `json:"links,omitempty"`
+}
+
+func (db *dbImpl) ListJobs(filter string, days int) ([]JobInfo, error) {
+	results := []JobInfo{}
+
+	since := time.Now().AddDate(0, 0, -days).Unix() * 1000
+
+	jobCond := ""
+	if filter != "" {
+		jobIDs, err := db.findJobIDsByFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		if len(jobIDs) == 0 {
+			return results, nil
+		}
+		jobCond = "WHERE j.id IN (" + sqlInt64List(jobIDs) + ")"
+	}
+
+	rows, err := db.Query(`
+		SELECT j.name, j.dashboard,
+			(SELECT GROUP_CONCAT(tag, ' ') FROM (SELECT tag FROM job_all_tags t WHERE t.job_id = j.id ORDER BY tag)),
+			lb.timestamp, lb.status,
+			(SELECT COUNT(*) FROM builds b WHERE b.job_id = j.id AND b.timestamp >= ?),
+			(SELECT SUM(b.status = 1) FROM builds b WHERE b.job_id = j.id AND b.timestamp >= ?)
+		FROM jobs j
+		LEFT JOIN builds lb ON lb.id = (SELECT id FROM builds b WHERE b.job_id = j.id ORDER BY b.timestamp DESC LIMIT 1)
+		`+jobCond+`
+		ORDER BY j.name
+	`, since, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var job JobInfo
+		var tags sql.NullString
+		var lastBuild, lastStatus, passed sql.NullInt64
+		if err := rows.Scan(&job.Name, &job.Dashboard, &tags, &lastBuild, &lastStatus, &job.RecentBuilds, &passed); err != nil {
+			return nil, err
+		}
+		job.Tags = strings.Fields(tags.String)
+		if lastBuild.Valid {
+			job.LastBuild = &lastBuild.Int64
+			job.LastBuildStatus = "failure"
+			if lastStatus.Int64 == 1 {
+				job.LastBuildStatus = "success"
+			}
+		}
+		if job.RecentBuilds > 0 {
+			rate := float64(passed.Int64) / float64(job.RecentBuilds)
+			job.RecentPassRate = &rate
+		}
+		results = append(results, job)
+	}
+	return results, rows.Err()
+}
+
+func (db *dbImpl) JobNames() ([]string, error) {
+	results := []string{}
+	rows, err := db.Query("SELECT name FROM jobs ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		results = append(results, name)
+	}
+	return results, rows.Err()
+}
+
+// LastBuildTimestamps returns the timestamp of the latest build for each job
+// that has builds.
+func (db *dbImpl) LastBuildTimestamps() (map[string]int64, error) {
+	results := make(map[string]int64)
+	rows, err := db.Query("SELECT j.name, MAX(b.timestamp) FROM jobs j JOIN builds b ON b.job_id = j.id GROUP BY j.id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var timestamp int64
+		if err := rows.Scan(&name, &timestamp); err != nil {
+			return nil, err
+		}
+		results[name] = timestamp
+	}
+	return results, rows.Err()
+}
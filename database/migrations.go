@@ -0,0 +1,662 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// AutoMigrate controls whether Open applies pending migrations. If it is
+// false, Open fails when the database schema is not up to date.
+var AutoMigrate = true
+
+type migration struct {
+	name string
+	up   func(db *dbImpl) error
+	down func(db *dbImpl) error
+}
+
+func execStatements(db *dbImpl, stmts ...string) error {
+	for _, stmt := range stmts {
+		_, err := db.Exec(stmt)
+		if err != nil {
+			return fmt.Errorf("%s: %s", err, stmt)
+		}
+	}
+	return nil
+}
+
+func addColumnMigration(table string, column string, definition string) migration {
+	return migration{
+		name: fmt.Sprintf("add %s.%s", table, column),
+		up: func(db *dbImpl) error {
+			_, err := db.addColumn(table, column, definition)
+			return err
+		},
+		down: func(db *dbImpl) error {
+			return db.dropColumn(table, column)
+		},
+	}
+}
+
+// The migrations are applied in order, the schema version is the number of
+// applied migrations. Databases created before the migrations were introduced
+// have the version 0 and some of the tables and columns, so the migrations
+// should be no-ops for objects that already exist.
+var migrations = []migration{
+	{
+		name: "create jobs, builds and tests",
+		up: func(db *dbImpl) error {
+			return execStatements(db,
+				`create table if not exists jobs (
+					id integer not null primary key,
+					name text not null,
+					dashboard text not null,
+					platform text not null,
+					mod text not null,
+					testtype text not null
+				);`,
+				`create table if not exists jobs_sippy_tags (
+					job_id integer not null,
+					tag text not null
+				);`,
+				`create table if not exists builds (
+					id integer not null primary key,
+					job_id integer not null,
+					number text not null,
+					timestamp integer not null,
+					status integer not null
+				);`,
+				`create table if not exists tests (
+					id integer not null primary key,
+					name text not null
+				);`,
+				`create table if not exists test_results (
+					build_id integer not null,
+					test_id integer not null,
+					status integer not null
+				);`,
+				`create unique index if not exists jobs_name on jobs (name);`,
+				`create unique index if not exists jobs_sippy_tags_job_tag on jobs_sippy_tags (job_id, tag);`,
+				`create unique index if not exists builds_job_number on builds (job_id, number);`,
+				`create unique index if not exists tests_name on tests (name);`,
+				`create unique index if not exists test_results_build_test on test_results (build_id, test_id);`,
+				`create        index if not exists test_results_test_id_status on test_results (test_id, status);`,
+			)
+		},
+		down: func(db *dbImpl) error {
+			return execStatements(db,
+				`drop table test_results;`,
+				`drop table tests;`,
+				`drop table builds;`,
+				`drop table jobs_sippy_tags;`,
+				`drop table jobs;`,
+			)
+		},
+	},
+	addColumnMigration("builds", "duration", "real"),
+	addColumnMigration("test_results", "duration", "real"),
+	{
+		name: "create test_flakiness and job_flakiness",
+		up: func(db *dbImpl) error {
+			return execStatements(db,
+				`create table if not exists test_flakiness (
+					test_id integer not null primary key,
+					score real not null,
+					flakes integer not null,
+					runs integer not null
+				);`,
+				`create table if not exists job_flakiness (
+					job_id integer not null primary key,
+					score real not null,
+					flakes integer not null,
+					runs integer not null
+				);`,
+			)
+		},
+		down: func(db *dbImpl) error {
+			return execStatements(db,
+				`drop table job_flakiness;`,
+				`drop table test_flakiness;`,
+			)
+		},
+	},
+	addColumnMigration("builds", "failure", "text"),
+	{
+		name: "add tests.sig",
+		up: func(db *dbImpl) error {
+			added, err := db.addColumn("tests", "sig", "text not null default ''")
+			if err != nil {
+				return err
+			}
+			if added {
+				err = db.backfillTestSigs()
+				if err != nil {
+					return fmt.Errorf("unable to set sig for existing tests: %w", err)
+				}
+			}
+			return nil
+		},
+		down: func(db *dbImpl) error {
+			return db.dropColumn("tests", "sig")
+		},
+	},
+	{
+		name: "create test_bugs",
+		up: func(db *dbImpl) error {
+			return execStatements(db,
+				`create table if not exists test_bugs (
+					test_id integer not null,
+					tracker text not null,
+					bug_id text not null,
+					summary text not null,
+					status text not null,
+					url text not null,
+					updated integer not null
+				);`,
+				`create unique index if not exists test_bugs_test_tracker_bug on test_bugs (test_id, tracker, bug_id);`,
+			)
+		},
+		down: func(db *dbImpl) error {
+			return execStatements(db,
+				`drop table test_bugs;`,
+			)
+		},
+	},
+	{
+		name: "create job_tags",
+		up: func(db *dbImpl) error {
+			return execStatements(db,
+				`create table if not exists job_tags (
+					job_id integer not null,
+					tag text not null
+				);`,
+				`create unique index if not exists job_tags_job_tag on job_tags (job_id, tag);`,
+				`create view if not exists job_all_tags as
+					select job_id, tag from jobs_sippy_tags
+					union
+					select job_id, tag from job_tags;`,
+			)
+		},
+		down: func(db *dbImpl) error {
+			return execStatements(db,
+				`drop view job_all_tags;`,
+				`drop table job_tags;`,
+			)
+		},
+	},
+	{
+		name: "create annotations",
+		up: func(db *dbImpl) error {
+			return execStatements(db,
+				`create table if not exists annotations (
+					id integer not null primary key,
+					build_id integer,
+					test_id integer,
+					note text not null,
+					author text not null,
+					created integer not null
+				);`,
+				`create index if not exists annotations_build_id on annotations (build_id);`,
+				`create index if not exists annotations_test_id on annotations (test_id);`,
+			)
+		},
+		down: func(db *dbImpl) error {
+			return execStatements(db,
+				`drop table annotations;`,
+			)
+		},
+	},
+	addColumnMigration("test_results", "stale", "integer not null default 0"),
+	{
+		name: "create job_variants",
+		up: func(db *dbImpl) error {
+			return execStatements(db,
+				`create table if not exists job_variants (
+					job_id integer not null,
+					dimension text not null,
+					value text not null
+				);`,
+				`create unique index if not exists job_variants_job_dimension on job_variants (job_id, dimension);`,
+				`drop view job_all_tags;`,
+				`create view job_all_tags as
+					select job_id, tag from jobs_sippy_tags
+					union
+					select job_id, tag from job_tags
+					union
+					select job_id, dimension || '.' || value from job_variants;`,
+			)
+		},
+		down: func(db *dbImpl) error {
+			return execStatements(db,
+				`drop view job_all_tags;`,
+				`create view job_all_tags as
+					select job_id, tag from jobs_sippy_tags
+					union
+					select job_id, tag from job_tags;`,
+				`drop table job_variants;`,
+			)
+		},
+	},
+	{
+		name: "create job_ciinfo_tags",
+		up: func(db *dbImpl) error {
+			return execStatements(db,
+				`create table if not exists job_ciinfo_tags (
+					job_id integer not null,
+					tag text not null
+				);`,
+				`create unique index if not exists job_ciinfo_tags_job_tag on job_ciinfo_tags (job_id, tag);`,
+				`insert or ignore into job_ciinfo_tags (job_id, tag)
+					select job_id, tag from jobs_sippy_tags where tag like 'x-%';`,
+				`delete from jobs_sippy_tags where tag like 'x-%';`,
+				`drop view job_all_tags;`,
+				`create view job_all_tags as
+					select job_id, tag from jobs_sippy_tags
+					union
+					select job_id, tag from job_tags
+					union
+					select job_id, tag from job_ciinfo_tags
+					union
+					select job_id, dimension || '.' || value from job_variants;`,
+			)
+		},
+		down: func(db *dbImpl) error {
+			return execStatements(db,
+				`drop view job_all_tags;`,
+				`create view job_all_tags as
+					select job_id, tag from jobs_sippy_tags
+					union
+					select job_id, tag from job_tags
+					union
+					select job_id, dimension || '.' || value from job_variants;`,
+				`insert or ignore into jobs_sippy_tags (job_id, tag)
+					select job_id, tag from job_ciinfo_tags;`,
+				`drop table job_ciinfo_tags;`,
+			)
+		},
+	},
+	{
+		name: "add jobs.owner",
+		up: func(db *dbImpl) error {
+			if _, err := db.addColumn("jobs", "owner", "text"); err != nil {
+				return err
+			}
+			return execStatements(db,
+				`drop view job_all_tags;`,
+				`create view job_all_tags as
+					select job_id, tag from jobs_sippy_tags
+					union
+					select job_id, tag from job_tags
+					union
+					select job_id, tag from job_ciinfo_tags
+					union
+					select job_id, dimension || '.' || value from job_variants
+					union
+					select id, 'owner.' || owner from jobs where owner is not null;`,
+			)
+		},
+		down: func(db *dbImpl) error {
+			if err := execStatements(db, `drop view job_all_tags;`); err != nil {
+				return err
+			}
+			if err := db.dropColumn("jobs", "owner"); err != nil {
+				return err
+			}
+			return execStatements(db,
+				`create view job_all_tags as
+					select job_id, tag from jobs_sippy_tags
+					union
+					select job_id, tag from job_tags
+					union
+					select job_id, tag from job_ciinfo_tags
+					union
+					select job_id, dimension || '.' || value from job_variants;`,
+			)
+		},
+	},
+	{
+		name: "create builds timestamp indexes",
+		up: func(db *dbImpl) error {
+			return execStatements(db,
+				`create index if not exists builds_timestamp on builds (timestamp);`,
+				`create index if not exists builds_job_id_timestamp on builds (job_id, timestamp);`,
+			)
+		},
+		down: func(db *dbImpl) error {
+			return execStatements(db,
+				`drop index builds_job_id_timestamp;`,
+				`drop index builds_timestamp;`,
+			)
+		},
+	},
+	{
+		name: "create test renames",
+		up: func(db *dbImpl) error {
+			return execStatements(db,
+				`create table if not exists test_renames (
+					old_name text primary key,
+					new_name text not null
+				);`,
+				`create index if not exists test_renames_new_name on test_renames (new_name);`,
+				`create view test_names as
+					select t.id, coalesce(r.new_name, t.name) as name, t.sig
+					from tests t
+					left join test_renames r on r.old_name = t.name;`,
+			)
+		},
+		down: func(db *dbImpl) error {
+			return execStatements(db,
+				`drop view test_names;`,
+				`drop table test_renames;`,
+			)
+		},
+	},
+	{
+		name: "create index runs",
+		up: func(db *dbImpl) error {
+			return execStatements(db,
+				`create table if not exists index_runs (
+					id integer not null primary key,
+					version text not null,
+					started integer not null,
+					finished integer,
+					status text not null
+				);`,
+				`create table if not exists index_run_errors (
+					id integer not null primary key,
+					run_id integer not null,
+					dashboard text not null,
+					job text not null,
+					build text not null,
+					error text not null
+				);`,
+				`create index if not exists index_run_errors_run_id on index_run_errors (run_id);`,
+			)
+		},
+		down: func(db *dbImpl) error {
+			return execStatements(db,
+				`drop table index_run_errors;`,
+				`drop table index_runs;`,
+			)
+		},
+	},
+	{
+		name: "create test issues",
+		up: func(db *dbImpl) error {
+			return execStatements(db,
+				`create table if not exists test_issues (
+					test_id integer not null,
+					tracker text not null,
+					key text not null,
+					url text not null,
+					opened integer not null,
+					updated integer not null,
+					primary key (test_id, tracker)
+				);`,
+			)
+		},
+		down: func(db *dbImpl) error {
+			return execStatements(db,
+				`drop table test_issues;`,
+			)
+		},
+	},
+	{
+		name: "create report runs",
+		up: func(db *dbImpl) error {
+			return execStatements(db,
+				`create table if not exists report_runs (
+					id integer not null primary key,
+					name text not null,
+					started integer not null,
+					finished integer,
+					status text not null,
+					error text not null default ''
+				);`,
+				`create index if not exists report_runs_name on report_runs (name);`,
+			)
+		},
+		down: func(db *dbImpl) error {
+			return execStatements(db,
+				`drop table report_runs;`,
+			)
+		},
+	},
+	addColumnMigration("test_results", "message", "text"),
+	{
+		// The full-text index is created only if SQLite has FTS5, otherwise
+		// tests are searched with LIKE. The index is not created later if
+		// the database is opened by a build with FTS5.
+		name: "create tests_fts",
+		up: func(db *dbImpl) error {
+			available, err := ftsAvailable(db)
+			if err != nil || !available {
+				return err
+			}
+			return execStatements(db,
+				`create virtual table if not exists tests_fts using fts5 (name, content = 'tests', content_rowid = 'id');`,
+				`create trigger if not exists tests_fts_insert after insert on tests begin
+					insert into tests_fts (rowid, name) values (new.id, new.name);
+				end;`,
+				`create trigger if not exists tests_fts_delete after delete on tests begin
+					insert into tests_fts (tests_fts, rowid, name) values ('delete', old.id, old.name);
+				end;`,
+				`create trigger if not exists tests_fts_update after update on tests begin
+					insert into tests_fts (tests_fts, rowid, name) values ('delete', old.id, old.name);
+					insert into tests_fts (rowid, name) values (new.id, new.name);
+				end;`,
+				// The index may be created for a database that already has tests.
+				`insert into tests_fts (tests_fts) values ('rebuild');`,
+			)
+		},
+		down: func(db *dbImpl) error {
+			return execStatements(db,
+				`drop trigger if exists tests_fts_update;`,
+				`drop trigger if exists tests_fts_delete;`,
+				`drop trigger if exists tests_fts_insert;`,
+				`drop table if exists tests_fts;`,
+			)
+		},
+	},
+}
+
+// dropColumn removes the column by rebuilding the table, as the bundled
+// SQLite doesn't support ALTER TABLE DROP COLUMN. Indexes and triggers of the
+// table are recreated.
+func (db *dbImpl) dropColumn(table string, column string) error {
+	rows, err := db.Query("select name, type, \"notnull\", dflt_value, pk from pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var defs, names []string
+	found := false
+	for rows.Next() {
+		var name, typ string
+		var notNull, pk bool
+		var dflt sql.NullString
+		if err := rows.Scan(&name, &typ, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			found = true
+			continue
+		}
+		def := name + " " + typ
+		if notNull {
+			def += " not null"
+		}
+		if pk {
+			def += " primary key"
+		}
+		if dflt.Valid {
+			def += " default " + dflt.String
+		}
+		defs = append(defs, def)
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if !found {
+		return nil
+	}
+
+	rows, err = db.Query("select sql from sqlite_master where tbl_name = ? and type in ('index', 'trigger') and sql is not null", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var objects []string
+	for rows.Next() {
+		var stmt string
+		if err := rows.Scan(&stmt); err != nil {
+			return err
+		}
+		objects = append(objects, stmt)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tmp := table + "_new"
+	stmts := []string{
+		fmt.Sprintf("create table %s (%s);", tmp, strings.Join(defs, ", ")),
+		fmt.Sprintf("insert into %s (%s) select %s from %s;", tmp, strings.Join(names, ", "), strings.Join(names, ", "), table),
+		fmt.Sprintf("drop table %s;", table),
+		fmt.Sprintf("alter table %s rename to %s;", tmp, table),
+	}
+	return execStatements(db, append(stmts, objects...)...)
+}
+
+type MigrationStatus struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	Applied bool   `json:"applied"`
+}
+
+type Migrator struct {
+	db *sql.DB
+}
+
+func NewMigrator(dsn string) (*Migrator, error) {
+	sqlDB, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open database: %w", err)
+	}
+	return &Migrator{db: sqlDB}, nil
+}
+
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
+
+func (m *Migrator) Version() (int, error) {
+	var version int
+	err := m.db.QueryRow("pragma user_version").Scan(&version)
+	return version, err
+}
+
+func (m *Migrator) Latest() int {
+	return SchemaVersion()
+}
+
+// SchemaVersion returns the schema version that this build expects.
+func SchemaVersion() int {
+	return len(migrations)
+}
+
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	version, err := m.Version()
+	if err != nil {
+		return nil, err
+	}
+	var result []MigrationStatus
+	for i, mig := range migrations {
+		result = append(result, MigrationStatus{
+			Version: i + 1,
+			Name:    mig.name,
+			Applied: i < version,
+		})
+	}
+	return result, nil
+}
+
+func (m *Migrator) migrate(version int, name string, fn func(db *dbImpl) error) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	err = fn(&dbImpl{sqlConn: tx})
+	if err == nil {
+		_, err = tx.Exec(fmt.Sprintf("pragma user_version = %d", version))
+	}
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("migration %d (%s): %w", version, name, err)
+	}
+	return tx.Commit()
+}
+
+// Up applies pending migrations up to the target version. If target is 0,
+// all pending migrations are applied.
+func (m *Migrator) Up(target int) ([]MigrationStatus, error) {
+	if target == 0 {
+		target = len(migrations)
+	}
+	if target < 0 || target > len(migrations) {
+		return nil, fmt.Errorf("unknown schema version %d", target)
+	}
+	version, err := m.Version()
+	if err != nil {
+		return nil, err
+	}
+	if version > len(migrations) {
+		return nil, fmt.Errorf("database schema version %d is newer than supported version %d", version, len(migrations))
+	}
+	var applied []MigrationStatus
+	for v := version + 1; v <= target; v++ {
+		mig := migrations[v-1]
+		if err := m.migrate(v, mig.name, mig.up); err != nil {
+			return applied, err
+		}
+		applied = append(applied, MigrationStatus{Version: v, Name: mig.name, Applied: true})
+	}
+	return applied, nil
+}
+
+// Down reverts the given number of the latest applied migrations.
+func (m *Migrator) Down(steps int) ([]MigrationStatus, error) {
+	version, err := m.Version()
+	if err != nil {
+		return nil, err
+	}
+	if version > len(migrations) {
+		return nil, fmt.Errorf("database schema version %d is newer than supported version %d", version, len(migrations))
+	}
+	var reverted []MigrationStatus
+	for v := version; v > 0 && v > version-steps; v-- {
+		mig := migrations[v-1]
+		if err := m.migrate(v-1, mig.name, mig.down); err != nil {
+			return reverted, err
+		}
+		reverted = append(reverted, MigrationStatus{Version: v, Name: mig.name, Applied: false})
+	}
+	return reverted, nil
+}
+
+func (m *Migrator) ensureLatest() error {
+	if AutoMigrate {
+		_, err := m.Up(0)
+		return err
+	}
+	version, err := m.Version()
+	if err != nil {
+		return err
+	}
+	if version != len(migrations) {
+		return fmt.Errorf("database schema version is %d, expected %d; run ci-results migrate up", version, len(migrations))
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+type NeverStableJob struct {
+	Name        string `json:"name"`
+	Dashboard   string `json:"dashboard"`
+	Builds      int    `json:"builds"`
+	FirstBuild  int64  `json:"first_build"`
+	LastBuild   int64  `json:"last_build"`
+	LastSuccess *int64 `json:"last_success"`
+	NeverPassed bool   `json:"never_passed"`
+	// Links are links to pages of the job, they are filled by the server.
+	Links map[string]string `json:"links,omitempty"`
+}
+
+func (db *dbImpl) NeverStableJobs(filter string, days int) ([]NeverStableJob, error) {
+	results := []NeverStableJob{}
+
+	since := time.Now().AddDate(0, 0, -days).Unix() * 1000
+
+	jobCond := ""
+	if filter != "" {
+		jobIDs, err := db.findJobIDsByFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		if len(jobIDs) == 0 {
+			return results, nil
+		}
+		jobCond = "WHERE j.id IN (" + sqlInt64List(jobIDs) + ")"
+	}
+
+	rows, err := db.Query(`
+		SELECT j.name, j.dashboard, COUNT(*), MIN(b.timestamp), MAX(b.timestamp), MAX(CASE WHEN b.status = 1 THEN b.timestamp END) AS last_success
+		FROM builds b
+		JOIN jobs j ON j.id = b.job_id
+		`+jobCond+`
+		GROUP BY j.id
+		HAVING MAX(b.timestamp) >= ? AND (last_success IS NULL OR last_success < ?)
+		ORDER BY j.name
+	`, since, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var job NeverStableJob
+		var lastSuccess sql.NullInt64
+		if err := rows.Scan(&job.Name, &job.Dashboard, &job.Builds, &job.FirstBuild, &job.LastBuild, &lastSuccess); err != nil {
+			return nil, err
+		}
+		if lastSuccess.Valid {
+			job.LastSuccess = &lastSuccess.Int64
+		} else {
+			job.NeverPassed = true
+		}
+		results = append(results, job)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"time"
+
+	"github.com/dmage/ci-results/testgrid"
+)
+
+type NewTest struct {
+	Name      string      `json:"name"`
+	FirstSeen int64       `json:"first_seen"`
+	Values    StatsValues `json:"values"`
+	PassRate  *float64    `json:"pass_rate"`
+}
+
+func (db *dbImpl) NewTests(filter string, days int) ([]NewTest, error) {
+	results := []NewTest{}
+
+	since := time.Now().AddDate(0, 0, -days).Unix() * 1000
+
+	jobCond := ""
+	if filter != "" {
+		jobIDs, err := db.findJobIDsByFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		if len(jobIDs) == 0 {
+			return results, nil
+		}
+		jobCond = "WHERE b.job_id IN (" + sqlInt64List(jobIDs) + ")"
+	}
+
+	rows, err := db.Query(`
+		SELECT t.name, MIN(b.timestamp) AS first_seen, SUM(tr.status IN (`+sqlStatusList(testgrid.CategoryPass)+`)), SUM(tr.status IN (`+sqlStatusList(testgrid.CategoryFlake)+`)), SUM(tr.status IN (`+sqlStatusList(testgrid.CategoryFail)+`))
+		FROM test_results tr
+		JOIN builds b ON b.id = tr.build_id
+		JOIN test_names t ON t.id = tr.test_id
+		`+jobCond+`
+		GROUP BY t.name
+		HAVING first_seen >= ?
+		ORDER BY first_seen DESC
+	`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t NewTest
+		if err := rows.Scan(&t.Name, &t.FirstSeen, &t.Values.Pass, &t.Values.Flake, &t.Values.Fail); err != nil {
+			return nil, err
+		}
+		if total := t.Values.Pass + t.Values.Flake + t.Values.Fail; total > 0 {
+			rate := float64(t.Values.Pass+t.Values.Flake) / float64(total)
+			t.PassRate = &rate
+		}
+		results = append(results, t)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// driverName is the sqlite3 driver extended with the _mmap_size DSN
+// parameter.
+const driverName = "sqlite3-ci-results"
+
+func init() {
+	sql.Register(driverName, &tunedDriver{})
+}
+
+type tunedDriver struct {
+	sqlite3.SQLiteDriver
+}
+
+func (d *tunedDriver) Open(dsn string) (driver.Conn, error) {
+	var mmapSize string
+	if i := strings.Index(dsn, "?"); i != -1 {
+		params, err := url.ParseQuery(dsn[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		mmapSize = params.Get("_mmap_size")
+		params.Del("_mmap_size")
+		dsn = dsn[:i+1] + params.Encode()
+	}
+
+	conn, err := d.SQLiteDriver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if mmapSize != "" {
+		n, err := strconv.ParseInt(mmapSize, 10, 64)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("invalid _mmap_size: %w", err)
+		}
+		_, err = conn.(*sqlite3.SQLiteConn).Exec(fmt.Sprintf("PRAGMA mmap_size = %d", n), nil)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// Options tune SQLite for the storage it runs on. Zero values keep the
+// settings from the DSN or the SQLite defaults.
+type Options struct {
+	// BusyTimeout is how long to wait for a locked database.
+	BusyTimeout time.Duration
+	// CacheSize is the page cache size in KiB.
+	CacheSize int
+	// MmapSize is the maximum number of bytes to access using memory-mapped
+	// I/O.
+	MmapSize int64
+	// Synchronous is the synchronous level: OFF, NORMAL, FULL or EXTRA.
+	Synchronous string
+	// MaxOpenConns limits the number of open connections.
+	MaxOpenConns int
+}
+
+// DefaultOptions are used by OpenDefault.
+var DefaultOptions Options
+
+// DSN returns dsn with the pragmas from the options, they override the
+// parameters that are already in dsn.
+func (o Options) DSN(dsn string) string {
+	path, rawQuery := dsn, ""
+	if i := strings.Index(dsn, "?"); i != -1 {
+		path, rawQuery = dsn[:i], dsn[i+1:]
+	}
+	params, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		// Let the driver report the invalid DSN.
+		return dsn
+	}
+	if o.BusyTimeout != 0 {
+		params.Set("_busy_timeout", strconv.FormatInt(o.BusyTimeout.Milliseconds(), 10))
+	}
+	if o.CacheSize != 0 {
+		params.Set("_cache_size", strconv.Itoa(-o.CacheSize))
+	}
+	if o.MmapSize != 0 {
+		params.Set("_mmap_size", strconv.FormatInt(o.MmapSize, 10))
+	}
+	if o.Synchronous != "" {
+		params.Set("_synchronous", o.Synchronous)
+	}
+	// Transactions start with BEGIN IMMEDIATE. A transaction that starts as a
+	// read transaction is not retried by SQLite when it's upgraded to a write
+	// transaction, but BEGIN IMMEDIATE waits for the lock up to the busy
+	// timeout.
+	params.Set("_txlock", "immediate")
+	return path + "?" + params.Encode()
+}
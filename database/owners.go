@@ -0,0 +1,41 @@
+package database
+
+// SetJobOwners updates owners of jobs, the owner is keyed by the job name.
+// Jobs that are not in owners get no owner. It returns the number of jobs
+// whose owner is changed.
+func (db *dbImpl) SetJobOwners(owners map[string]string) (int, error) {
+	rows, err := db.Query("SELECT id, name, COALESCE(owner, '') FROM jobs")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	type change struct {
+		id    int64
+		owner string
+	}
+	var changes []change
+	for rows.Next() {
+		var id int64
+		var name, owner string
+		if err := rows.Scan(&id, &name, &owner); err != nil {
+			return 0, err
+		}
+		if owners[name] != owner {
+			changes = append(changes, change{id: id, owner: owners[name]})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, c := range changes {
+		var owner interface{}
+		if c.owner != "" {
+			owner = c.owner
+		}
+		if _, err := db.Exec("UPDATE jobs SET owner = ? WHERE id = ?", owner, c.id); err != nil {
+			return 0, err
+		}
+	}
+	return len(changes), nil
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/dmage/ci-results/testgrid"
+)
+
+type BuildFailure struct {
+	Test     string   `json:"test"`
+	PassRate *float64 `json:"pass_rate"`
+}
+
+// BuildFailedTests returns the tests that failed in the build along with
+// their pass rates across all jobs over the last days.
+func (db *dbImpl) BuildFailedTests(jobName string, number string, days int) ([]BuildFailure, error) {
+	since := time.Now().AddDate(0, 0, -days).Unix() * 1000
+
+	var buildID int64
+	row := db.QueryRow("SELECT b.id FROM builds b JOIN jobs j ON j.id = b.job_id WHERE j.name = ? AND b.number = ?", jobName, number)
+	if err := row.Scan(&buildID); err == sql.ErrNoRows {
+		return nil, newErrNotFound("build %s/%s does not exist", jobName, number)
+	} else if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT t.name, (
+			SELECT 1.0 * SUM(tr2.status NOT IN (`+sqlStatusList(testgrid.CategoryFail)+`)) / COUNT(*)
+			FROM test_results tr2
+			JOIN builds b2 ON b2.id = tr2.build_id
+			WHERE tr2.test_id = tr.test_id AND b2.timestamp >= ?
+		)
+		FROM test_results tr
+		JOIN test_names t ON t.id = tr.test_id
+		WHERE tr.build_id = ? AND tr.status IN (`+sqlStatusList(testgrid.CategoryFail)+`) AND t.name != 'Overall'
+	`, since, buildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	results := []BuildFailure{}
+	for rows.Next() {
+		var f BuildFailure
+		var passRate sql.NullFloat64
+		if err := rows.Scan(&f.Test, &passRate); err != nil {
+			return nil, err
+		}
+		if passRate.Valid {
+			f.PassRate = &passRate.Float64
+		}
+		results = append(results, f)
+	}
+	return results, rows.Err()
+}
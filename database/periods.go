@@ -0,0 +1,66 @@
+package database
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SetParallelPeriods makes BuildStats run a separate query for each period
+// concurrently if there are at least n periods. The queries are cheaper as
+// each of them reads only builds from its period. 0 disables it.
+func (db *DB) SetParallelPeriods(n int) {
+	db.parallelPeriods = n
+}
+
+func (db *dbImpl) parallelPeriodStats(columns string, filter string, testName string, periods []period) (*Stats, error) {
+	stats := make([]*Stats, len(periods))
+	errs := make([]error, len(periods))
+	var wg sync.WaitGroup
+	for i, p := range periods {
+		wg.Add(1)
+		go func(i int, p period) {
+			defer wg.Done()
+			stats[i], errs[i] = db.queryPeriodStats(columns, filter, testName, []period{p})
+		}(i, p)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	results := Stats{
+		Data: []*StatsRow{},
+	}
+	rowsByKey := map[string]*StatsRow{}
+	for i, s := range stats {
+		for _, r := range s.Data {
+			key := strings.Join(r.Columns, "\x00")
+			row, ok := rowsByKey[key]
+			if !ok {
+				row = &StatsRow{
+					Columns: r.Columns,
+					Values:  make([]StatsValues, len(periods)),
+				}
+				results.Data = append(results.Data, row)
+				rowsByKey[key] = row
+			}
+			row.Values[i] = r.Values[0]
+		}
+	}
+
+	// Sort rows by the columns, the single query returns them roughly in
+	// this order too.
+	sort.SliceStable(results.Data, func(i, j int) bool {
+		a, b := results.Data[i].Columns, results.Data[j].Columns
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+	return &results, nil
+}
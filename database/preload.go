@@ -0,0 +1,49 @@
+package database
+
+import (
+	"k8s.io/klog/v2"
+)
+
+// testEntryOverhead is an estimate of the memory used by a single entry of
+// the preloaded tests map in addition to the test name.
+const testEntryOverhead = 80
+
+// PreloadTests loads ids of all tests into memory, so UpsertTest doesn't have
+// to query the database for known tests. Tests are not preloaded if they are
+// estimated to need more than budget bytes. It reports whether the tests have
+// been loaded.
+func (db *DB) PreloadTests(budget int64) (bool, error) {
+	var count, size int64
+	err := db.QueryRow("select count(*), coalesce(sum(length(cast(name as blob))), 0) from tests").Scan(&count, &size)
+	if err != nil {
+		return false, err
+	}
+	estimate := size + count*testEntryOverhead
+	if estimate > budget {
+		klog.Infof("Not preloading %d tests: they need about %d MiB, the budget is %d MiB", count, estimate>>20, budget>>20)
+		return false, nil
+	}
+
+	rows, err := db.Query("select id, name from tests")
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	testIDs := make(map[string]int64, count)
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return false, err
+		}
+		testIDs[name] = id
+	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+
+	db.testIDs = testIDs
+	klog.Infof("Preloaded %d tests", len(testIDs))
+	return true, nil
+}
@@ -0,0 +1,146 @@
+package database
+
+import (
+	"strings"
+)
+
+type PrunePolicy struct {
+	Filter          string
+	OlderThan       int64
+	KeepBuilds      int
+	DropUnusedTests bool
+}
+
+type PrunedJob struct {
+	Name        string `json:"name"`
+	Builds      int    `json:"builds"`
+	TestResults int    `json:"test_results"`
+}
+
+type PruneResult struct {
+	Jobs  []PrunedJob `json:"jobs"`
+	Tests []string    `json:"tests"`
+}
+
+// prunedBuildsQuery returns a query that selects the ids of builds that are
+// removed by the policy.
+func (db *dbImpl) prunedBuildsQuery(policy PrunePolicy) (string, []interface{}, error) {
+	var conds []string
+	var params []interface{}
+	if policy.OlderThan > 0 {
+		conds = append(conds, "timestamp < ?")
+		params = append(params, policy.OlderThan)
+	}
+	if policy.KeepBuilds > 0 {
+		conds = append(conds, `id IN (SELECT id FROM (
+			SELECT id, ROW_NUMBER() OVER (PARTITION BY job_id ORDER BY timestamp DESC) AS n FROM builds
+		) WHERE n > ?)`)
+		params = append(params, policy.KeepBuilds)
+	}
+	if len(conds) == 0 {
+		return "SELECT id FROM builds WHERE 0", nil, nil
+	}
+
+	query := "SELECT id FROM builds WHERE (" + strings.Join(conds, " OR ") + ")"
+	if policy.Filter != "" {
+		jobIDs, err := db.findJobIDsByFilter(policy.Filter)
+		if err != nil {
+			return "", nil, err
+		}
+		query += " AND job_id IN (" + sqlInt64List(jobIDs) + ")"
+	}
+	return query, params, nil
+}
+
+// Prune deletes builds and tests according to the policy. If dryRun is true,
+// it only reports what would be deleted.
+func (db *dbImpl) Prune(policy PrunePolicy, dryRun bool) (*PruneResult, error) {
+	builds, params, err := db.prunedBuildsQuery(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PruneResult{
+		Jobs:  []PrunedJob{},
+		Tests: []string{},
+	}
+
+	rows, err := db.Query(`SELECT j.name, COUNT(*), SUM((SELECT COUNT(*) FROM test_results tr WHERE tr.build_id = b.id))
+		FROM builds b JOIN jobs j ON j.id = b.job_id
+		WHERE b.id IN (`+builds+`)
+		GROUP BY j.name ORDER BY j.name`, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var job PrunedJob
+		err := rows.Scan(&job.Name, &job.Builds, &job.TestResults)
+		if err != nil {
+			return nil, err
+		}
+		result.Jobs = append(result.Jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	unusedTests := `SELECT t.id FROM tests t WHERE NOT EXISTS (
+		SELECT 1 FROM test_results tr WHERE tr.test_id = t.id AND tr.build_id NOT IN (` + builds + `)
+	)`
+	if policy.DropUnusedTests {
+		rows, err := db.Query("SELECT name FROM tests WHERE id IN ("+unusedTests+") ORDER BY name", params...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var name string
+			err := rows.Scan(&name)
+			if err != nil {
+				return nil, err
+			}
+			result.Tests = append(result.Tests, name)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if dryRun {
+		return result, nil
+	}
+
+	if policy.DropUnusedTests {
+		// Tests have to be removed first, as they are found using the builds
+		// that are about to be removed.
+		stmts := []string{
+			"DELETE FROM test_flakiness WHERE test_id IN (" + unusedTests + ")",
+			"DELETE FROM test_bugs WHERE test_id IN (" + unusedTests + ")",
+			"DELETE FROM test_issues WHERE test_id IN (" + unusedTests + ")",
+			"DELETE FROM annotations WHERE test_id IN (" + unusedTests + ")",
+			"DELETE FROM test_results WHERE test_id IN (" + unusedTests + ")",
+			"DELETE FROM tests WHERE id IN (" + unusedTests + ")",
+		}
+		for _, stmt := range stmts {
+			if _, err := db.Exec(stmt, params...); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	_, err = db.Exec("DELETE FROM annotations WHERE build_id IN ("+builds+")", params...)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec("DELETE FROM test_results WHERE build_id IN ("+builds+")", params...)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec("DELETE FROM builds WHERE id IN ("+builds+")", params...)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
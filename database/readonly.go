@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+type QueryResult struct {
+	Columns   []string        `json:"columns"`
+	Rows      [][]interface{} `json:"rows"`
+	Truncated bool            `json:"truncated,omitempty"`
+}
+
+// readOnlyDSN turns a DSN like ./results.db?_cache_size=-10000 into a URI
+// that opens the file read-only and with the query_only pragma.
+func readOnlyDSN(dsn string) string {
+	path, rawQuery := DSNPath(dsn), ""
+	if i := strings.Index(dsn, "?"); i != -1 {
+		rawQuery = dsn[i+1:]
+	}
+
+	params := []string{"mode=ro", "_query_only=true"}
+	for _, p := range strings.Split(rawQuery, "&") {
+		// The journal mode cannot be changed on a read-only connection, and
+		// it cannot take the write lock.
+		if p == "" || strings.HasPrefix(p, "mode=") || strings.HasPrefix(p, "_journal_mode=") || strings.HasPrefix(p, "_query_only=") || strings.HasPrefix(p, "_txlock=") {
+			continue
+		}
+		params = append(params, p)
+	}
+	return "file:" + path + "?" + strings.Join(params, "&")
+}
+
+// QueryReadOnly runs the query on a read-only connection to the database and
+// returns at most limit rows.
+func QueryReadOnly(ctx context.Context, dsn string, query string, limit int) (*QueryResult, error) {
+	sqlDB, err := sql.Open(driverName, readOnlyDSN(dsn))
+	if err != nil {
+		return nil, fmt.Errorf("unable to open database: %w", err)
+	}
+	defer sqlDB.Close()
+
+	rows, err := sqlDB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := &QueryResult{
+		Columns: columns,
+		Rows:    [][]interface{}{},
+	}
+	for rows.Next() {
+		if len(result.Rows) == limit {
+			result.Truncated = true
+			break
+		}
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	return result, rows.Err()
+}
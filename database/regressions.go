@@ -0,0 +1,78 @@
+package database
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SustainedRegression is a test whose pass rate has been below its baseline
+// for several days in a row.
+type SustainedRegression struct {
+	Test string `json:"test"`
+	// Days has stats of the regressed days, the latest day first.
+	Days             []StatsValues `json:"days"`
+	Baseline         StatsValues   `json:"baseline"`
+	PassRate         float64       `json:"pass_rate"`
+	BaselinePassRate float64       `json:"baseline_pass_rate"`
+}
+
+func statsPassRate(v StatsValues) float64 {
+	total := v.Pass + v.Flake + v.Fail
+	if total == 0 {
+		return 0
+	}
+	return float64(v.Pass+v.Flake) / float64(total)
+}
+
+// SustainedRegressions returns tests whose pass rate has been lower than
+// during the baseline by more than threshold on each of the last days. Days
+// are calendar days in UTC, the current day is not included as it is not
+// over yet. Every day and the baseline need at least minRuns runs.
+func (db *dbImpl) SustainedRegressions(filter string, days int, baselineDays int, threshold float64, minRuns int) ([]SustainedRegression, error) {
+	periods := strings.Repeat("1,", days) + strconv.Itoa(baselineDays)
+	stats, err := db.BuildStatsWith("test", filter, periods, "", PeriodOptions{AlignDays: true})
+	if err != nil {
+		return nil, err
+	}
+
+	regressions := []SustainedRegression{}
+rows:
+	for _, row := range stats.Data {
+		if row.Columns[0] == "Overall" {
+			continue
+		}
+		baseline := row.Values[days]
+		if baseline.Pass+baseline.Flake+baseline.Fail < minRuns {
+			continue
+		}
+		baselineRate := statsPassRate(baseline)
+
+		var total StatsValues
+		for _, v := range row.Values[:days] {
+			if v.Pass+v.Flake+v.Fail < minRuns || statsPassRate(v) >= baselineRate-threshold {
+				continue rows
+			}
+			total.Pass += v.Pass
+			total.Flake += v.Flake
+			total.Fail += v.Fail
+		}
+
+		regressions = append(regressions, SustainedRegression{
+			Test:             row.Columns[0],
+			Days:             row.Values[:days],
+			Baseline:         baseline,
+			PassRate:         statsPassRate(total),
+			BaselinePassRate: baselineRate,
+		})
+	}
+	sort.Slice(regressions, func(i, j int) bool {
+		di := regressions[i].BaselinePassRate - regressions[i].PassRate
+		dj := regressions[j].BaselinePassRate - regressions[j].PassRate
+		if di != dj {
+			return di > dj
+		}
+		return regressions[i].Test < regressions[j].Test
+	})
+	return regressions, nil
+}
@@ -0,0 +1,146 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var releaseRe = regexp.MustCompile(`\b(\d+)\.(\d+)\b`)
+
+type releaseVersion struct {
+	major int
+	minor int
+}
+
+func (v releaseVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.major, v.minor)
+}
+
+// jobFamily returns the release the job belongs to and its name with
+// versions replaced by placeholders relative to that release, so that
+// "nightly-4.9-upgrade-from-stable-4.8" and "nightly-4.10-upgrade-from-stable-4.9"
+// are in the same family.
+func jobFamily(name string) (release string, family string) {
+	var latest releaseVersion
+	found := false
+	for _, m := range releaseRe.FindAllStringSubmatch(name, -1) {
+		major, _ := strconv.Atoi(m[1])
+		minor, _ := strconv.Atoi(m[2])
+		if !found || major > latest.major || (major == latest.major && minor > latest.minor) {
+			latest = releaseVersion{major: major, minor: minor}
+			found = true
+		}
+	}
+	if !found {
+		return "", name
+	}
+
+	family = releaseRe.ReplaceAllStringFunc(name, func(s string) string {
+		m := releaseRe.FindStringSubmatch(s)
+		major, _ := strconv.Atoi(m[1])
+		minor, _ := strconv.Atoi(m[2])
+		if major != latest.major {
+			return s
+		}
+		if minor == latest.minor {
+			return "{R}"
+		}
+		return fmt.Sprintf("{R-%d}", latest.minor-minor)
+	})
+	return latest.String(), family
+}
+
+type ReleaseComparisonRow struct {
+	Name   string        `json:"name"`
+	Jobs   []string      `json:"jobs,omitempty"`
+	Values []StatsValues `json:"values"`
+}
+
+type ReleaseComparison struct {
+	Releases []string                `json:"releases"`
+	Data     []*ReleaseComparisonRow `json:"data"`
+}
+
+func (db *dbImpl) ReleaseComparison(by string, releases []string, days int, filter string, testName string) (*ReleaseComparison, error) {
+	var columns string
+	switch by {
+	case "job":
+		columns = "name"
+	case "test":
+		columns = "name,test"
+	default:
+		return nil, newErrInvalidParam("by", by, "unknown comparison", "job", "test")
+	}
+
+	releaseIndex := map[string]int{}
+	for i, r := range releases {
+		releaseIndex[r] = i
+	}
+
+	stats, err := db.BuildStats(columns, filter, strconv.Itoa(days), testName)
+	if err != nil {
+		return nil, err
+	}
+
+	results := &ReleaseComparison{
+		Releases: releases,
+		Data:     []*ReleaseComparisonRow{},
+	}
+	rowsByKey := map[string]*ReleaseComparisonRow{}
+	for _, statsRow := range stats.Data {
+		release, family := jobFamily(statsRow.Columns[0])
+		i, ok := releaseIndex[release]
+		if !ok {
+			continue
+		}
+
+		key := family
+		if by == "test" {
+			key = statsRow.Columns[1]
+		}
+
+		row, ok := rowsByKey[key]
+		if !ok {
+			row = &ReleaseComparisonRow{
+				Name:   key,
+				Values: make([]StatsValues, len(releases)),
+			}
+			if by == "job" {
+				row.Jobs = make([]string, len(releases))
+			}
+			results.Data = append(results.Data, row)
+			rowsByKey[key] = row
+		}
+
+		v := statsRow.Values[0]
+		row.Values[i].Pass += v.Pass
+		row.Values[i].Flake += v.Flake
+		row.Values[i].Fail += v.Fail
+		if by == "job" {
+			row.Jobs[i] = statsRow.Columns[0]
+		}
+	}
+
+	// Only rows that exist in more than one release can be compared.
+	data := []*ReleaseComparisonRow{}
+	for _, row := range results.Data {
+		present := 0
+		for _, v := range row.Values {
+			if v.Pass+v.Flake+v.Fail > 0 {
+				present++
+			}
+		}
+		if present > 1 {
+			data = append(data, row)
+		}
+	}
+	sort.Slice(data, func(i, j int) bool {
+		return strings.Compare(data[i].Name, data[j].Name) < 0
+	})
+	results.Data = data
+
+	return results, nil
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"database/sql"
+)
+
+// loadTestRenames reads the renames that UpsertTest applies to test names.
+func (db *dbImpl) loadTestRenames() error {
+	rows, err := db.Query("select old_name, new_name from test_renames")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	db.renames = map[string]string{}
+	for rows.Next() {
+		var oldName, newName string
+		if err := rows.Scan(&oldName, &newName); err != nil {
+			return err
+		}
+		db.renames[oldName] = newName
+	}
+	return rows.Err()
+}
+
+// SetTestRenames replaces the renames of tests, they are keyed by the old
+// name. Results of renamed tests are stored under the new name, and queries
+// merge the history of the old name into the new one. It returns the number
+// of renames that are added, changed or removed.
+func (db *dbImpl) SetTestRenames(renames map[string]string) (int, error) {
+	changed := 0
+	for oldName := range db.renames {
+		if _, ok := renames[oldName]; ok {
+			continue
+		}
+		if _, err := db.Exec("delete from test_renames where old_name = ?", oldName); err != nil {
+			return 0, err
+		}
+		delete(db.renames, oldName)
+		changed++
+	}
+	for oldName, newName := range renames {
+		if current, ok := db.renames[oldName]; ok && current == newName {
+			continue
+		}
+		if _, err := db.Exec("insert or replace into test_renames (old_name, new_name) values (?, ?)", oldName, newName); err != nil {
+			return 0, err
+		}
+		db.renames[oldName] = newName
+		changed++
+	}
+	return changed, nil
+}
+
+// renamedTest returns the current name of the test.
+func (db *dbImpl) renamedTest(name string) string {
+	if newName, ok := db.renames[name]; ok {
+		return newName
+	}
+	return name
+}
+
+// findTestIDs returns ids of the test and of the tests that were renamed to
+// it. The test can be referred to by any of its names.
+func (db *dbImpl) findTestIDs(testName string) ([]int64, error) {
+	var name string
+	err := db.QueryRow("select new_name from test_renames where old_name = ?", testName).Scan(&name)
+	if err == sql.ErrNoRows {
+		name = testName
+	} else if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		select id from tests where name = ?
+		union
+		select t.id from test_renames r join tests t on t.name = r.old_name where r.new_name = ?
+		order by id`, name, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, newErrNotFound("test %q does not exist", testName)
+	}
+	return ids, nil
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"time"
+)
+
+// Statuses of report runs.
+const (
+	ReportRunRunning   = "running"
+	ReportRunSucceeded = "succeeded"
+	ReportRunFailed    = "failed"
+)
+
+// ReportRun records when a scheduled report was rendered and published.
+type ReportRun struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Started  int64  `json:"started"`
+	Finished int64  `json:"finished,omitempty"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// StartReportRun records the start of a run of the report and returns its id.
+func (db *dbImpl) StartReportRun(name string) (int64, error) {
+	result, err := db.Exec("insert into report_runs (name, started, status) values (?, ?, ?)", name, time.Now().Unix()*1000, ReportRunRunning)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// FinishReportRun stores the status of the run. If the run has failed, errMsg
+// describes the failure.
+func (db *dbImpl) FinishReportRun(id int64, status string, errMsg string) error {
+	_, err := db.Exec("update report_runs set finished = ?, status = ?, error = ? where id = ?", time.Now().Unix()*1000, status, errMsg, id)
+	return err
+}
+
+// ReportRuns returns the latest runs, newest first. If name is not empty,
+// only runs of that report are returned.
+func (db *dbImpl) ReportRuns(name string, limit int) ([]ReportRun, error) {
+	results := []ReportRun{}
+	rows, err := db.Query(`
+		SELECT id, name, started, IFNULL(finished, 0), status, error
+		FROM report_runs
+		WHERE ? = '' OR name = ?
+		ORDER BY id DESC
+		LIMIT ?`, name, name, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var run ReportRun
+		if err := rows.Scan(&run.ID, &run.Name, &run.Started, &run.Finished, &run.Status, &run.Error); err != nil {
+			return nil, err
+		}
+		results = append(results, run)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,94 @@
+package database
+
+import (
+	"time"
+)
+
+type JobRuntimeRow struct {
+	Columns            []string   `json:"columns"`
+	Avg                []*float64 `json:"avg"`
+	Max                []*float64 `json:"max"`
+	ApproachingTimeout bool       `json:"approaching_timeout"`
+}
+
+type JobRuntimes struct {
+	Days []string         `json:"days"`
+	Data []*JobRuntimeRow `json:"data"`
+}
+
+func (db *dbImpl) JobRuntimes(column string, filter string, days int, timeout time.Duration, threshold float64) (*JobRuntimes, error) {
+	var field string
+	switch column {
+	case "name":
+		field = "j.name"
+	case "platform":
+		field = "j.platform"
+	case "dashboard":
+		field = "j.dashboard"
+	default:
+		return nil, newErrInvalidParam("column", column, "unknown column", "name", "platform", "dashboard")
+	}
+
+	now := time.Now().UTC()
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1-days)
+
+	results := &JobRuntimes{
+		Days: []string{},
+		Data: []*JobRuntimeRow{},
+	}
+	for i := 0; i < days; i++ {
+		results.Days = append(results.Days, start.AddDate(0, 0, i).Format("2006-01-02"))
+	}
+
+	query := `
+		SELECT ` + field + `, (b.timestamp - ?) / 86400000 AS day, AVG(b.duration), MAX(b.duration)
+		FROM builds b
+		JOIN jobs j ON j.id = b.job_id
+		WHERE b.duration IS NOT NULL AND b.timestamp >= ?`
+	if filter != "" {
+		jobIDs, err := db.findJobIDsByFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		if len(jobIDs) == 0 {
+			return results, nil
+		}
+		query += " AND j.id IN (" + sqlInt64List(jobIDs) + ")"
+	}
+	query += " GROUP BY 1, day"
+
+	rows, err := db.Query(query, start.Unix()*1000, start.Unix()*1000)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rowsByKey := map[string]*JobRuntimeRow{}
+	for rows.Next() {
+		var key string
+		var day int
+		var avg, max float64
+		if err := rows.Scan(&key, &day, &avg, &max); err != nil {
+			return nil, err
+		}
+		if day < 0 || day >= days {
+			continue
+		}
+
+		row, ok := rowsByKey[key]
+		if !ok {
+			row = &JobRuntimeRow{
+				Columns: []string{key},
+				Avg:     make([]*float64, days),
+				Max:     make([]*float64, days),
+			}
+			results.Data = append(results.Data, row)
+			rowsByKey[key] = row
+		}
+		row.Avg[day] = &avg
+		row.Max[day] = &max
+		if max >= threshold*timeout.Seconds() {
+			row.ApproachingTimeout = true
+		}
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ftsAvailable reports whether SQLite has FTS5, it's available only if the
+// sqlite3 driver is built with the sqlite_fts5 tag.
+func ftsAvailable(db *dbImpl) (bool, error) {
+	var used bool
+	err := db.QueryRow("select sqlite_compileoption_used('ENABLE_FTS5')").Scan(&used)
+	return used, err
+}
+
+// initFTS enables full-text search if the migration has created the index.
+// The triggers that maintain the index need FTS5, so a build without FTS5
+// cannot write to such a database.
+func (db *dbImpl) initFTS() error {
+	var exists int
+	row := db.QueryRow("select count(*) from sqlite_master where type = 'table' and name = 'tests_fts'")
+	if err := row.Scan(&exists); err != nil {
+		return err
+	}
+	if exists == 0 {
+		return nil
+	}
+
+	available, err := ftsAvailable(db)
+	if err != nil {
+		return err
+	}
+	if !available {
+		return fmt.Errorf("the database has a full-text index of tests, which needs a build with the sqlite_fts5 tag")
+	}
+
+	db.fts = true
+	return nil
+}
+
+func ftsQuery(q string) string {
+	var terms []string
+	for _, word := range strings.Fields(q) {
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+func likePattern(word string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + r.Replace(word) + "%"
+}
+
+func (db *dbImpl) SearchTests(q string, limit int) ([]string, error) {
+	results := []string{}
+	if strings.TrimSpace(q) == "" {
+		return results, nil
+	}
+
+	var query string
+	var params []interface{}
+	if db.fts {
+		query = "SELECT name FROM tests_fts WHERE tests_fts MATCH ? ORDER BY rank LIMIT ?"
+		params = append(params, ftsQuery(q), limit)
+	} else {
+		var conds []string
+		for _, word := range strings.Fields(q) {
+			conds = append(conds, `name LIKE ? ESCAPE '\'`)
+			params = append(params, likePattern(word))
+		}
+		query = "SELECT name FROM tests WHERE " + strings.Join(conds, " AND ") + " ORDER BY length(name) LIMIT ?"
+		params = append(params, limit)
+	}
+
+	rows, err := db.Query(query, params...)
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return results, err
+		}
+		results = append(results, name)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,51 @@
+package database
+
+type PassRateSeries struct {
+	Days      []string      `json:"days"`
+	Window    int           `json:"window"`
+	Values    []StatsValues `json:"values"`
+	PassRates []*float64    `json:"pass_rates"`
+}
+
+func (db *dbImpl) PassRateSeries(filter string, job string, testName string, days int, window int) (*PassRateSeries, error) {
+	timeline, err := db.Timeline("", filter, job, testName, days+window-1)
+	if err != nil {
+		return nil, err
+	}
+
+	daily := make([]StatsValues, days+window-1)
+	for _, row := range timeline.Data {
+		for i, v := range row.Values {
+			daily[i].Pass += v.Pass
+			daily[i].Flake += v.Flake
+			daily[i].Fail += v.Fail
+		}
+	}
+
+	series := &PassRateSeries{
+		Days:      timeline.Days[window-1:],
+		Window:    window,
+		Values:    make([]StatsValues, days),
+		PassRates: make([]*float64, days),
+	}
+	var sum StatsValues
+	for i, v := range daily {
+		sum.Pass += v.Pass
+		sum.Flake += v.Flake
+		sum.Fail += v.Fail
+		if i >= window {
+			sum.Pass -= daily[i-window].Pass
+			sum.Flake -= daily[i-window].Flake
+			sum.Fail -= daily[i-window].Fail
+		}
+		if i < window-1 {
+			continue
+		}
+		series.Values[i-window+1] = sum
+		if total := sum.Pass + sum.Flake + sum.Fail; total > 0 {
+			rate := float64(sum.Pass+sum.Flake) / float64(total)
+			series.PassRates[i-window+1] = &rate
+		}
+	}
+	return series, nil
+}
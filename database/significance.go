@@ -0,0 +1,61 @@
+package database
+
+import (
+	"math"
+)
+
+func logFactorial(n int) float64 {
+	v, _ := math.Lgamma(float64(n + 1))
+	return v
+}
+
+func hypergeometric(x, n, k, total int) float64 {
+	return math.Exp(logFactorial(k) - logFactorial(x) - logFactorial(k-x) +
+		logFactorial(total-k) - logFactorial(n-x) - logFactorial(total-k-n+x) -
+		logFactorial(total) + logFactorial(n) + logFactorial(total-n))
+}
+
+// fisherRegression returns the one-sided p-value of Fisher's exact test for
+// the hypothesis that the current pass rate is lower than the previous one.
+func fisherRegression(currPass, currFail, prevPass, prevFail int) float64 {
+	n := currPass + currFail
+	k := currPass + prevPass
+	total := n + prevPass + prevFail
+	if n == 0 || total == n {
+		return 1
+	}
+
+	minX := n - (total - k)
+	if minX < 0 {
+		minX = 0
+	}
+	p := 0.0
+	for x := minX; x <= currPass; x++ {
+		p += hypergeometric(x, n, k, total)
+	}
+	if p > 1 {
+		p = 1
+	}
+	return p
+}
+
+func (s *Stats) ComputeSignificance() {
+	for _, row := range s.Data {
+		if len(row.Values) < 2 {
+			continue
+		}
+		curr, prev := row.Values[0], row.Values[1]
+		p := fisherRegression(curr.Pass+curr.Flake, curr.Fail, prev.Pass+prev.Flake, prev.Fail)
+		row.PValue = &p
+	}
+}
+
+func (s *Stats) FilterSignificantRegressions(alpha float64) {
+	data := []*StatsRow{}
+	for _, row := range s.Data {
+		if row.PValue != nil && *row.PValue < alpha {
+			data = append(data, row)
+		}
+	}
+	s.Data = data
+}
@@ -0,0 +1,22 @@
+package database
+
+import (
+	"context"
+	"strings"
+)
+
+// DSNPath returns the path of the database file from a DSN like
+// ./results.db?_cache_size=-10000.
+func DSNPath(dsn string) string {
+	if i := strings.Index(dsn, "?"); i != -1 {
+		dsn = dsn[:i]
+	}
+	return strings.TrimPrefix(dsn, "file:")
+}
+
+// Snapshot writes a consistent copy of the database into a new file. Writers
+// are not blocked while the copy is made.
+func (db *DB) Snapshot(ctx context.Context, path string) error {
+	_, err := db.db.ExecContext(ctx, "VACUUM INTO ?", path)
+	return err
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"sort"
+	"time"
+
+	"github.com/dmage/ci-results/testgrid"
+)
+
+type FailureStreak struct {
+	Job       string `json:"job"`
+	Dashboard string `json:"dashboard"`
+	Test      string `json:"test"`
+	Current   int    `json:"current"`
+	Longest   int    `json:"longest"`
+	Since     int64  `json:"since"`
+	// Links are links to pages of the job, they are filled by the server.
+	Links map[string]string `json:"links,omitempty"`
+}
+
+func (db *dbImpl) FailureStreaks(filter string, days int, minCurrent int) ([]FailureStreak, error) {
+	results := []FailureStreak{}
+
+	query := `
+		SELECT j.name, j.dashboard, t.name, b.timestamp, tr.status
+		FROM test_results tr
+		JOIN builds b ON b.id = tr.build_id
+		JOIN jobs j ON j.id = b.job_id
+		JOIN test_names t ON t.id = tr.test_id
+		WHERE b.timestamp >= ? AND t.name != 'Overall' AND tr.test_id IN (
+			SELECT DISTINCT tr2.test_id FROM test_results tr2 JOIN builds b2 ON b2.id = tr2.build_id WHERE tr2.status IN (` + sqlStatusList(testgrid.CategoryFail) + `) AND b2.timestamp >= ?
+		)`
+	since := time.Now().AddDate(0, 0, -days).Unix() * 1000
+	if filter != "" {
+		jobIDs, err := db.findJobIDsByFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		if len(jobIDs) == 0 {
+			return results, nil
+		}
+		query += " AND j.id IN (" + sqlInt64List(jobIDs) + ")"
+	}
+	query += " ORDER BY b.job_id, tr.test_id, b.timestamp"
+
+	rows, err := db.Query(query, since, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var streak *FailureStreak
+	flush := func() {
+		if streak != nil && streak.Current >= minCurrent {
+			results = append(results, *streak)
+		}
+	}
+	for rows.Next() {
+		var job, dashboard, test string
+		var timestamp int64
+		var status testgrid.TestStatus
+		if err := rows.Scan(&job, &dashboard, &test, &timestamp, &status); err != nil {
+			return nil, err
+		}
+		if streak == nil || streak.Job != job || streak.Test != test {
+			flush()
+			streak = &FailureStreak{Job: job, Dashboard: dashboard, Test: test}
+		}
+		if status.Category() == testgrid.CategoryFail {
+			if streak.Current == 0 {
+				streak.Since = timestamp
+			}
+			streak.Current++
+			if streak.Current > streak.Longest {
+				streak.Longest = streak.Current
+			}
+		} else {
+			streak.Current = 0
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Current != results[j].Current {
+			return results[i].Current > results[j].Current
+		}
+		return results[i].Since < results[j].Since
+	})
+	return results, nil
+}
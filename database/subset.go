@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// ExportSubset writes the jobs that match the filter along with their builds
+// and test results into a new database at path.
+func (db *DB) ExportSubset(ctx context.Context, filter string, path string) (err error) {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+
+	out, err := Open(path)
+	if err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	jobsCond := ""
+	if filter != "" {
+		jobIDs, err := db.findJobIDsByFilter(filter)
+		if err != nil {
+			return err
+		}
+		jobsCond = "WHERE id IN (" + sqlInt64List(jobIDs) + ")"
+	}
+
+	conn, err := db.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "ATTACH DATABASE ? AS subset", path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, detachErr := conn.ExecContext(ctx, "DETACH DATABASE subset")
+		if err == nil {
+			err = detachErr
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	stmts := []string{
+		`INSERT INTO subset.jobs (id, name, dashboard, platform, mod, testtype, owner)
+			SELECT id, name, dashboard, platform, mod, testtype, owner FROM main.jobs ` + jobsCond,
+		`INSERT INTO subset.jobs_sippy_tags (job_id, tag)
+			SELECT job_id, tag FROM main.jobs_sippy_tags WHERE job_id IN (SELECT id FROM subset.jobs)`,
+		`INSERT INTO subset.job_tags (job_id, tag)
+			SELECT job_id, tag FROM main.job_tags WHERE job_id IN (SELECT id FROM subset.jobs)`,
+		`INSERT INTO subset.job_ciinfo_tags (job_id, tag)
+			SELECT job_id, tag FROM main.job_ciinfo_tags WHERE job_id IN (SELECT id FROM subset.jobs)`,
+		`INSERT INTO subset.job_variants (job_id, dimension, value)
+			SELECT job_id, dimension, value FROM main.job_variants WHERE job_id IN (SELECT id FROM subset.jobs)`,
+		`INSERT INTO subset.builds (id, job_id, number, timestamp, status, duration, failure)
+			SELECT id, job_id, number, timestamp, status, duration, failure FROM main.builds WHERE job_id IN (SELECT id FROM subset.jobs)`,
+		`INSERT INTO subset.test_results (build_id, test_id, status, duration, stale, message)
+			SELECT build_id, test_id, status, duration, stale, message FROM main.test_results WHERE build_id IN (SELECT id FROM subset.builds)`,
+		`INSERT INTO subset.tests (id, name, sig)
+			SELECT id, name, sig FROM main.tests WHERE id IN (SELECT DISTINCT test_id FROM subset.test_results)`,
+		`INSERT INTO subset.test_renames (old_name, new_name)
+			SELECT old_name, new_name FROM main.test_renames
+			WHERE new_name IN (SELECT name FROM subset.tests) OR old_name IN (SELECT name FROM subset.tests)`,
+		`INSERT INTO subset.test_bugs (test_id, tracker, bug_id, summary, status, url, updated)
+			SELECT test_id, tracker, bug_id, summary, status, url, updated FROM main.test_bugs WHERE test_id IN (SELECT id FROM subset.tests)`,
+		`INSERT INTO subset.annotations (id, build_id, test_id, note, author, created)
+			SELECT id, build_id, test_id, note, author, created FROM main.annotations
+			WHERE (build_id IS NULL OR build_id IN (SELECT id FROM subset.builds)) AND (test_id IS NULL OR test_id IN (SELECT id FROM subset.tests))`,
+	}
+	for _, stmt := range stmts {
+		_, err := tx.ExecContext(ctx, stmt)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("%s: %s", err, stmt)
+		}
+	}
+
+	return tx.Commit()
+}
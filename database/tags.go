@@ -0,0 +1,147 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const (
+	TagSourceSippy  = "sippy"
+	TagSourceCustom = "custom"
+	// TagSourceCIInfo is for tags derived from ci-operator configs, they are
+	// replaced by the indexer.
+	TagSourceCIInfo = "ciinfo"
+)
+
+var tagRe = regexp.MustCompile("^[a-z0-9.][a-z0-9.-]*$")
+
+type JobTag struct {
+	Job    string `json:"job"`
+	Tag    string `json:"tag"`
+	Source string `json:"source"`
+}
+
+func tagsTable(source string) (string, error) {
+	switch source {
+	case TagSourceSippy:
+		return "jobs_sippy_tags", nil
+	case TagSourceCustom:
+		return "job_tags", nil
+	case TagSourceCIInfo:
+		return "job_ciinfo_tags", nil
+	}
+	return "", fmt.Errorf("unknown tag source %q", source)
+}
+
+// JobTagsList returns tags of the job, or tags of all jobs if jobName is empty.
+func (db *dbImpl) JobTagsList(jobName string) ([]JobTag, error) {
+	query := `SELECT j.name, t.tag, t.source FROM (
+			SELECT job_id, tag, '` + TagSourceSippy + `' AS source FROM jobs_sippy_tags
+			UNION ALL
+			SELECT job_id, tag, '` + TagSourceCustom + `' AS source FROM job_tags
+			UNION ALL
+			SELECT job_id, tag, '` + TagSourceCIInfo + `' AS source FROM job_ciinfo_tags
+		) t JOIN jobs j ON j.id = t.job_id`
+	var params []interface{}
+	if jobName != "" {
+		if _, err := db.FindJob(jobName); err != nil {
+			return nil, err
+		}
+		query += " WHERE j.name = ?"
+		params = append(params, jobName)
+	}
+	query += " ORDER BY j.name, t.tag"
+
+	results := []JobTag{}
+	rows, err := db.Query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tag JobTag
+		if err := rows.Scan(&tag.Job, &tag.Tag, &tag.Source); err != nil {
+			return nil, err
+		}
+		results = append(results, tag)
+	}
+	return results, rows.Err()
+}
+
+// ValidateTag checks that the tag can be added to a job.
+func ValidateTag(tag string) error {
+	if !tagRe.MatchString(tag) {
+		return fmt.Errorf("invalid tag %q: tags may contain only lowercase letters, digits, dots and dashes", tag)
+	}
+	return nil
+}
+
+func (db *dbImpl) AddJobTag(jobName string, tag string, source string) error {
+	if err := ValidateTag(tag); err != nil {
+		return err
+	}
+	table, err := tagsTable(source)
+	if err != nil {
+		return err
+	}
+	jobID, err := db.FindJob(jobName)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("INSERT OR IGNORE INTO "+table+" (job_id, tag) VALUES (?, ?)", jobID, tag)
+	return err
+}
+
+func (db *dbImpl) RemoveJobTag(jobName string, tag string, source string) error {
+	table, err := tagsTable(source)
+	if err != nil {
+		return err
+	}
+	jobID, err := db.FindJob(jobName)
+	if err != nil {
+		return err
+	}
+	result, err := db.Exec("DELETE FROM "+table+" WHERE job_id = ? AND tag = ?", jobID, tag)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return newErrNotFound("job %s doesn't have %s tag %s", jobName, source, tag)
+	}
+	return nil
+}
+
+func (db *dbImpl) AllTags() ([]string, error) {
+	results := []string{}
+	rows, err := db.Query("SELECT DISTINCT tag FROM job_all_tags ORDER BY tag")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		results = append(results, tag)
+	}
+	return results, rows.Err()
+}
+
+// SetJobCIInfoTags replaces the tags of the job that are derived from
+// ci-operator configs.
+func (db *dbImpl) SetJobCIInfoTags(jobID int64, tags []string) error {
+	if _, err := db.Exec("DELETE FROM job_ciinfo_tags WHERE job_id = ?", jobID); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := db.Exec("INSERT OR IGNORE INTO job_ciinfo_tags (job_id, tag) VALUES (?, ?)", jobID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
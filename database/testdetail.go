@@ -0,0 +1,146 @@
+package database
+
+import (
+	"time"
+
+	"github.com/dmage/ci-results/testgrid"
+)
+
+type TestReliability struct {
+	Failures  int      `json:"failures"`
+	Recovered int      `json:"recovered"`
+	MTBFHours *float64 `json:"mtbf_hours"`
+	MTTRHours *float64 `json:"mttr_hours"`
+}
+
+type TestDetail struct {
+	Name        string          `json:"name"`
+	Sig         string          `json:"sig"`
+	FirstSeen   int64           `json:"first_seen"`
+	LastSeen    int64           `json:"last_seen"`
+	Values      StatsValues     `json:"values"`
+	Reliability TestReliability `json:"reliability"`
+	Bugs        []LinkedBug     `json:"bugs"`
+	// RecentFailures has the latest failed results, the latest first.
+	RecentFailures []TestFailure `json:"recent_failures"`
+	// Links are links to pages of the test, they are filled by the server.
+	Links map[string]string `json:"links,omitempty"`
+}
+
+const testDetailFailures = 10
+
+func meanHours(intervals []int64) *float64 {
+	if len(intervals) == 0 {
+		return nil
+	}
+	var sum int64
+	for _, i := range intervals {
+		sum += i
+	}
+	hours := float64(sum) / float64(len(intervals)) / 3600000
+	return &hours
+}
+
+func (db *dbImpl) TestDetail(testName string, filter string, days int) (*TestDetail, error) {
+	detail := &TestDetail{
+		Name: testName,
+	}
+
+	testIDs, err := db.findTestIDs(testName)
+	if err != nil {
+		return nil, err
+	}
+	// The ids share the current name, the sig is taken from the latest test.
+	row := db.QueryRow("SELECT name, sig FROM test_names WHERE id = ?", testIDs[len(testIDs)-1])
+	if err := row.Scan(&detail.Name, &detail.Sig); err != nil {
+		return nil, err
+	}
+
+	bugs, err := db.TestBugs(detail.Name)
+	if err != nil {
+		return nil, err
+	}
+	detail.Bugs = bugs
+
+	failures, err := db.RecentTestFailures(detail.Name, filter, days, testDetailFailures)
+	if err != nil {
+		return nil, err
+	}
+	detail.RecentFailures = failures
+
+	query := `
+		SELECT b.job_id, b.timestamp, tr.status
+		FROM test_results tr
+		JOIN builds b ON b.id = tr.build_id
+		WHERE tr.test_id IN (` + sqlInt64List(testIDs) + `) AND b.timestamp >= ?`
+	if filter != "" {
+		jobIDs, err := db.findJobIDsByFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		if len(jobIDs) == 0 {
+			return detail, nil
+		}
+		query += " AND b.job_id IN (" + sqlInt64List(jobIDs) + ")"
+	}
+	query += " ORDER BY b.job_id, b.timestamp"
+
+	rows, err := db.Query(query, time.Now().AddDate(0, 0, -days).Unix()*1000)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var betweenFailures, toRecovery []int64
+	lastJob := int64(-1)
+	var lastFailure, failingSince int64
+	for rows.Next() {
+		var jobID, timestamp int64
+		var status testgrid.TestStatus
+		if err := rows.Scan(&jobID, &timestamp, &status); err != nil {
+			return nil, err
+		}
+		if jobID != lastJob {
+			lastJob = jobID
+			lastFailure, failingSince = 0, 0
+		}
+
+		if detail.FirstSeen == 0 || timestamp < detail.FirstSeen {
+			detail.FirstSeen = timestamp
+		}
+		if timestamp > detail.LastSeen {
+			detail.LastSeen = timestamp
+		}
+
+		switch status.Category() {
+		case testgrid.CategoryPass, testgrid.CategoryFlake:
+			if status.Category() == testgrid.CategoryFlake {
+				detail.Values.Flake++
+			} else {
+				detail.Values.Pass++
+			}
+			if failingSince != 0 {
+				toRecovery = append(toRecovery, timestamp-failingSince)
+				detail.Reliability.Recovered++
+				failingSince = 0
+			}
+		case testgrid.CategoryFail:
+			detail.Values.Fail++
+			detail.Reliability.Failures++
+			if lastFailure != 0 {
+				betweenFailures = append(betweenFailures, timestamp-lastFailure)
+			}
+			lastFailure = timestamp
+			if failingSince == 0 {
+				failingSince = timestamp
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	detail.Reliability.MTBFHours = meanHours(betweenFailures)
+	detail.Reliability.MTTRHours = meanHours(toRecovery)
+	return detail, nil
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/dmage/ci-results/testgrid"
+)
+
+// TestResultRecord is a result of a test in a build.
+type TestResultRecord struct {
+	Job       string `json:"job"`
+	Dashboard string `json:"dashboard"`
+	Build     string `json:"build"`
+	Timestamp int64  `json:"timestamp"`
+	Test      string `json:"test"`
+	// Status is the category of the result: pass, flake, fail or infra.
+	Status   string   `json:"status"`
+	Duration *float64 `json:"duration,omitempty"`
+	Message  string   `json:"message,omitempty"`
+	// Tags are the tags of the job.
+	Tags []string `json:"tags"`
+}
+
+func (db *dbImpl) jobTagsByID(jobIDs []int64) (map[int64][]string, error) {
+	tags := make(map[int64][]string)
+	rows, err := db.Query("SELECT job_id, tag FROM job_all_tags WHERE job_id IN (" + sqlInt64List(jobIDs) + ") ORDER BY job_id, tag")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var jobID int64
+		var tag string
+		if err := rows.Scan(&jobID, &tag); err != nil {
+			return nil, err
+		}
+		tags[jobID] = append(tags[jobID], tag)
+	}
+	return tags, rows.Err()
+}
+
+// EachTestResult calls fn for every result of the builds of jobs that match
+// the filter and that started at or after since (in milliseconds). Results
+// are passed build by build, from the oldest build.
+func (db *dbImpl) EachTestResult(filter string, since int64, fn func(r *TestResultRecord) error) error {
+	jobIDs, err := db.findJobIDsByFilter(filter)
+	if err != nil {
+		return err
+	}
+	if len(jobIDs) == 0 {
+		return nil
+	}
+	tags, err := db.jobTagsByID(jobIDs)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`
+		SELECT j.id, j.name, j.dashboard, b.number, b.timestamp, t.name, tr.status, tr.duration, IFNULL(tr.message, '')
+		FROM builds b
+		JOIN jobs j ON j.id = b.job_id
+		JOIN test_results tr ON tr.build_id = b.id
+		JOIN test_names t ON t.id = tr.test_id
+		WHERE b.job_id IN (`+sqlInt64List(jobIDs)+`) AND b.timestamp >= ?
+		ORDER BY b.timestamp, b.id`, since)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var jobID int64
+		var status testgrid.TestStatus
+		var duration sql.NullFloat64
+		r := &TestResultRecord{}
+		if err := rows.Scan(&jobID, &r.Job, &r.Dashboard, &r.Build, &r.Timestamp, &r.Test, &status, &duration, &r.Message); err != nil {
+			return err
+		}
+		r.Status = status.Category().String()
+		if duration.Valid {
+			r.Duration = &duration.Float64
+		}
+		r.Tags = tags[jobID]
+		if r.Tags == nil {
+			r.Tags = []string{}
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"time"
+)
+
+type Timeline struct {
+	Days []string    `json:"days"`
+	Data []*StatsRow `json:"data"`
+}
+
+func (db *dbImpl) Timeline(columns string, filter string, job string, testName string, days int) (*Timeline, error) {
+	now := time.Now().UTC()
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1-days)
+
+	results := Timeline{
+		Days: []string{},
+		Data: []*StatsRow{},
+	}
+	for i := 0; i < days; i++ {
+		results.Days = append(results.Days, start.AddDate(0, 0, i).Format("2006-01-02"))
+	}
+	resultsByKey := map[string]*StatsRow{}
+
+	query, err := db.newStatsQuery(columns, filter, testName)
+	if err != nil {
+		return nil, err
+	}
+	if query == nil {
+		return &results, nil
+	}
+
+	if job != "" {
+		query.Where("j.name = ?", job)
+	}
+
+	var day, count int
+	query.Select("(b.timestamp - ?) / 86400000 AS day", &day, start.Unix()*1000)
+	query.Select("COUNT(*)", &count)
+	query.GroupBy("day")
+	query.Where("b.timestamp >= ?", start.Unix()*1000)
+
+	sql, params, scanParams := query.SQL()
+
+	rows, err := db.Query(sql, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(scanParams...)
+		if err != nil {
+			return nil, err
+		}
+		if day < 0 || day >= days {
+			continue
+		}
+
+		key, columnsValues := query.columns()
+
+		row, ok := resultsByKey[key]
+		if !ok {
+			row = &StatsRow{
+				Columns: columnsValues,
+				Values:  make([]StatsValues, days),
+			}
+			results.Data = append(results.Data, row)
+			resultsByKey[key] = row
+		}
+
+		query.add(row.Values[day:day+1], []*int{&count})
+	}
+	return &results, rows.Err()
+}
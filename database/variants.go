@@ -0,0 +1,68 @@
+package database
+
+import (
+	"sort"
+)
+
+type JobVariant struct {
+	Job       string `json:"job"`
+	Dimension string `json:"dimension"`
+	Value     string `json:"value"`
+}
+
+func (db *dbImpl) insertJobVariants(jobID int64, variants map[string]string) error {
+	dimensions := make([]string, 0, len(variants))
+	for dimension := range variants {
+		dimensions = append(dimensions, dimension)
+	}
+	sort.Strings(dimensions)
+	for _, dimension := range dimensions {
+		_, err := db.Exec("INSERT OR REPLACE INTO job_variants (job_id, dimension, value) VALUES (?, ?, ?)", jobID, dimension, variants[dimension])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetJobVariants replaces the variants of the job.
+func (db *dbImpl) SetJobVariants(jobName string, variants map[string]string) error {
+	jobID, err := db.FindJob(jobName)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec("DELETE FROM job_variants WHERE job_id = ?", jobID); err != nil {
+		return err
+	}
+	return db.insertJobVariants(jobID, variants)
+}
+
+// JobVariantsList returns variants of the job, or variants of all jobs if
+// jobName is empty.
+func (db *dbImpl) JobVariantsList(jobName string) ([]JobVariant, error) {
+	query := "SELECT j.name, v.dimension, v.value FROM job_variants v JOIN jobs j ON j.id = v.job_id"
+	var params []interface{}
+	if jobName != "" {
+		if _, err := db.FindJob(jobName); err != nil {
+			return nil, err
+		}
+		query += " WHERE j.name = ?"
+		params = append(params, jobName)
+	}
+	query += " ORDER BY j.name, v.dimension"
+
+	results := []JobVariant{}
+	rows, err := db.Query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v JobVariant
+		if err := rows.Scan(&v.Job, &v.Dimension, &v.Value); err != nil {
+			return nil, err
+		}
+		results = append(results, v)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"k8s.io/klog/v2"
+)
+
+// Begin is retried if the database is still locked by another process after
+// the busy timeout, for example by a long import.
+const (
+	writeRetries      = 8
+	writeRetryMaxWait = 2 * time.Second
+)
+
+type writeRequest struct {
+	fn     func(tx *Tx) error
+	result chan error
+}
+
+// Writer runs write transactions one at a time on a single goroutine, so
+// concurrent producers don't compete for the database lock.
+type Writer struct {
+	db    *DB
+	queue chan writeRequest
+	done  chan struct{}
+}
+
+// NewWriter starts a writer that accepts up to queueSize pending
+// transactions before Do blocks.
+func (db *DB) NewWriter(queueSize int) *Writer {
+	w := &Writer{
+		db:    db,
+		queue: make(chan writeRequest, queueSize),
+		done:  make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+	for req := range w.queue {
+		req.result <- w.db.Transaction(req.fn)
+	}
+}
+
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
+
+// retryBusy calls fn until it succeeds or fails with an error other than
+// a locked database.
+func retryBusy(fn func() error) error {
+	wait := 100 * time.Millisecond
+	for i := 0; ; i++ {
+		err := fn()
+		if err == nil || !isBusy(err) || i == writeRetries {
+			return err
+		}
+		klog.V(2).Infof("database is busy, retrying in %s: %s", wait, err)
+		time.Sleep(wait)
+		wait *= 2
+		if wait > writeRetryMaxWait {
+			wait = writeRetryMaxWait
+		}
+	}
+}
+
+// Transaction runs fn in a write transaction, which is committed if fn
+// succeeds.
+func (db *DB) Transaction(fn func(tx *Tx) error) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+	return fn(tx)
+}
+
+// Do runs fn in a transaction on the writer goroutine and waits for it to
+// finish. The transaction is committed if fn succeeds.
+func (w *Writer) Do(ctx context.Context, fn func(tx *Tx) error) error {
+	req := writeRequest{
+		fn:     fn,
+		result: make(chan error, 1),
+	}
+	select {
+	case w.queue <- req:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return <-req.result
+}
+
+// Close waits for the queued transactions and stops the writer.
+func (w *Writer) Close() {
+	close(w.queue)
+	<-w.done
+}
@@ -0,0 +1,16 @@
+package dbcmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func NewCmdDB() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "Work with the database directly",
+	}
+
+	cmd.AddCommand(NewCmdSQL())
+
+	return cmd
+}
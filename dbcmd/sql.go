@@ -0,0 +1,92 @@
+package dbcmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/output"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+type SQLOptions struct {
+	query  string
+	limit  int
+	output string
+
+	out io.Writer
+}
+
+func printTable(out io.Writer, result *database.QueryResult) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, strings.ToUpper(strings.Join(result.Columns, "\t")))
+	for _, row := range result.Rows {
+		fields := make([]string, len(row))
+		for i, v := range row {
+			if v == nil {
+				fields[i] = "NULL"
+			} else {
+				fields[i] = fmt.Sprint(v)
+			}
+		}
+		fmt.Fprintln(w, strings.Join(fields, "\t"))
+	}
+	return w.Flush()
+}
+
+func (opts *SQLOptions) Run(ctx context.Context) error {
+	if err := output.Validate(opts.output); err != nil {
+		return err
+	}
+
+	result, err := database.QueryReadOnly(ctx, database.DefaultOptions.DSN(database.DefaultDSN), opts.query, opts.limit)
+	if err != nil {
+		return err
+	}
+	if result.Truncated {
+		klog.Warningf("The result is truncated to %d rows", opts.limit)
+	}
+
+	return output.Print(opts.out, opts.output, result, func(out io.Writer) error {
+		return printTable(out, result)
+	})
+}
+
+func NewCmdSQL() *cobra.Command {
+	opts := &SQLOptions{
+		out: os.Stdout,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "sql QUERY",
+		Short: "Run a read-only SQL query",
+		Long: heredoc.Doc(`
+			Run an SQL query against the database and print the result.
+
+			The database is opened read-only with the query_only pragma, so the
+			query cannot modify it.
+		`),
+		Example: heredoc.Doc(`
+			ci-results db sql "SELECT dashboard, COUNT(*) FROM jobs GROUP BY dashboard"
+		`),
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.query = args[0]
+			err := opts.Run(context.Background())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().IntVar(&opts.limit, "limit", 1000, "Maximum number of rows to print.")
+	output.AddFlag(cmd, &opts.output)
+
+	return cmd
+}
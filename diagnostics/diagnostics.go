@@ -0,0 +1,34 @@
+// Package diagnostics serves runtime profiles and variables for debugging
+// performance problems.
+package diagnostics
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+
+	"k8s.io/klog/v2"
+)
+
+// Handler serves pprof profiles under /debug/pprof/ and expvar variables at
+// /debug/vars.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+// ListenAndServe serves Handler on addr in the background.
+func ListenAndServe(addr string) {
+	go func() {
+		klog.Infof("Serving diagnostics on %s", addr)
+		if err := http.ListenAndServe(addr, Handler()); err != nil {
+			klog.Errorf("unable to serve diagnostics: %s", err)
+		}
+	}()
+}
@@ -0,0 +1,121 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/output"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+type DiffOptions struct {
+	oldPath   string
+	newPath   string
+	days      int
+	threshold float64
+	minRuns   int
+	output    string
+
+	out io.Writer
+}
+
+func printNames(out io.Writer, title string, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "%s (%d):\n", title, len(names))
+	for _, name := range names {
+		fmt.Fprintf(out, "  %s\n", name)
+	}
+	fmt.Fprintln(out)
+}
+
+func printChanges(out io.Writer, title string, changes []database.RateChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	fmt.Fprintf(out, "%s (%d):\n", title, len(changes))
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "  NAME\tOLD\tNEW\tDELTA")
+	for _, c := range changes {
+		fmt.Fprintf(w, "  %s\t%.1f%% (%d)\t%.1f%% (%d)\t%+.1f\n", c.Name, 100*c.OldRate, c.OldRuns, 100*c.NewRate, c.NewRuns, 100*c.Delta)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintln(out)
+	return nil
+}
+
+func printDiff(out io.Writer, diff *database.SnapshotDiff) error {
+	printNames(out, "Jobs added", diff.JobsAdded)
+	printNames(out, "Jobs removed", diff.JobsRemoved)
+	printNames(out, "Tests added", diff.TestsAdded)
+	printNames(out, "Tests removed", diff.TestsRemoved)
+	if err := printChanges(out, "Job pass rate changes", diff.Jobs); err != nil {
+		return err
+	}
+	return printChanges(out, "Test pass rate changes", diff.Tests)
+}
+
+func (opts *DiffOptions) Run(ctx context.Context) error {
+	if err := output.Validate(opts.output); err != nil {
+		return err
+	}
+	for _, path := range []string{opts.oldPath, opts.newPath} {
+		if _, err := os.Stat(path); err != nil {
+			return err
+		}
+	}
+
+	diff, err := database.DiffSnapshots(ctx, opts.oldPath, opts.newPath, opts.days, opts.threshold/100, opts.minRuns)
+	if err != nil {
+		return fmt.Errorf("unable to compare databases: %w", err)
+	}
+
+	return output.Print(opts.out, opts.output, diff, func(out io.Writer) error {
+		return printDiff(out, diff)
+	})
+}
+
+func NewCmdDiff() *cobra.Command {
+	opts := &DiffOptions{
+		out: os.Stdout,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "diff OLD.db NEW.db",
+		Short: "Compare two database snapshots",
+		Long: heredoc.Doc(`
+			Report jobs and tests that were added or removed, and pass rates that
+			changed between two snapshots of the database.
+
+			Pass rates are computed over the last --days days before the latest
+			build in each snapshot. The snapshots are opened read-only.
+		`),
+		Example: heredoc.Doc(`
+			ci-results diff before.db results.db --threshold=10
+		`),
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.oldPath, opts.newPath = args[0], args[1]
+			err := opts.Run(context.Background())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().IntVar(&opts.days, "days", 7, "Number of days to compute pass rates for.")
+	cmd.Flags().Float64Var(&opts.threshold, "threshold", 5, "Minimal change of a pass rate to report, in percentage points.")
+	cmd.Flags().IntVar(&opts.minRuns, "min-runs", 5, "Minimal number of runs in both snapshots to report a pass rate change.")
+	output.AddFlag(cmd, &opts.output)
+
+	return cmd
+}
@@ -0,0 +1,118 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/output"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+type DoctorOptions struct {
+	staleDays int
+	fix       bool
+	output    string
+
+	out io.Writer
+}
+
+func (opts *DoctorOptions) fixFindings(db *database.DB, findings []database.Finding) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	for _, f := range findings {
+		if !f.Fixable() {
+			continue
+		}
+		if err := tx.Fix(f); err != nil {
+			return fmt.Errorf("unable to fix %s: %w", f.Check, err)
+		}
+		klog.Infof("Fixed %s: %s", f.Check, f.Problem)
+	}
+	return nil
+}
+
+func (opts *DoctorOptions) Run(ctx context.Context) (err error) {
+	db, err := database.OpenDefault()
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer func() {
+		closeErr := db.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	findings, err := db.Diagnose(opts.staleDays)
+	if err != nil {
+		return fmt.Errorf("unable to check database: %w", err)
+	}
+
+	err = output.Print(opts.out, opts.output, findings, func(out io.Writer) error {
+		if len(findings) == 0 {
+			fmt.Fprintln(out, "No problems found")
+		}
+		for _, f := range findings {
+			fmt.Fprintf(out, "[%s] %s\n", f.Check, f.Problem)
+			fmt.Fprintf(out, "  %s\n", f.Hint)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if opts.fix {
+		return opts.fixFindings(db, findings)
+	}
+	return nil
+}
+
+func NewCmdDoctor() *cobra.Command {
+	opts := &DoctorOptions{
+		out: os.Stdout,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the database for problems",
+		Long: heredoc.Doc(`
+			Check the database for schema drift, orphaned rows, tests that differ
+			only by whitespace, builds without test results and stale data.
+
+			With --fix, problems that can be fixed automatically are fixed.
+		`),
+		Example: heredoc.Doc(`
+			ci-results doctor
+			ci-results doctor --fix
+		`),
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().IntVar(&opts.staleDays, "stale-days", 2, "Report stale data if there are no builds in the given number of days.")
+	cmd.Flags().BoolVar(&opts.fix, "fix", false, "Fix problems that can be fixed automatically.")
+	output.AddFlag(cmd, &opts.output)
+
+	return cmd
+}
@@ -0,0 +1,234 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/completion"
+	"github.com/dmage/ci-results/database"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+type ElasticsearchOptions struct {
+	url          string
+	index        string
+	filter       string
+	days         int
+	allResults   bool
+	batchSize    int
+	username     string
+	passwordFile string
+	apiKeyFile   string
+
+	password string
+	apiKey   string
+}
+
+// esDocument is a test result as it is indexed.
+type esDocument struct {
+	*database.TestResultRecord
+	Time string `json:"@timestamp"`
+}
+
+// esDocumentID identifies the result, so results that are exported again
+// replace the old documents.
+func esDocumentID(r *database.TestResultRecord) string {
+	h := sha1.Sum([]byte(r.Job + "\x00" + r.Build + "\x00" + r.Test))
+	return hex.EncodeToString(h[:])
+}
+
+func readSecret(filename string) (string, error) {
+	if filename == "" {
+		return "", nil
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// bulk indexes the documents of the NDJSON body.
+func (opts *ElasticsearchOptions) bulk(ctx context.Context, body []byte) error {
+	u := strings.TrimSuffix(opts.url, "/") + "/_bulk"
+	req, err := http.NewRequestWithContext(ctx, "POST", u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if opts.apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+opts.apiKey)
+	} else if opts.username != "" {
+		req.SetBasicAuth(opts.username, opts.password)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("got unexpected http response from POST %s: %s", u, resp.Status)
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			ID    string          `json:"_id"`
+			Error json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if !result.Errors {
+		return nil
+	}
+	failed := 0
+	var first string
+	for _, item := range result.Items {
+		for _, action := range item {
+			if len(action.Error) == 0 {
+				continue
+			}
+			if failed == 0 {
+				first = fmt.Sprintf("%s: %s", action.ID, action.Error)
+			}
+			failed++
+		}
+	}
+	return fmt.Errorf("%d documents were not indexed, the first error is %s", failed, first)
+}
+
+func (opts *ElasticsearchOptions) Run(ctx context.Context) (err error) {
+	if opts.batchSize <= 0 {
+		return fmt.Errorf("--batch-size must be positive")
+	}
+	opts.password, err = readSecret(opts.passwordFile)
+	if err != nil {
+		return fmt.Errorf("unable to read password: %w", err)
+	}
+	opts.apiKey, err = readSecret(opts.apiKeyFile)
+	if err != nil {
+		return fmt.Errorf("unable to read API key: %w", err)
+	}
+
+	db, err := database.OpenDefault()
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer func() {
+		closeErr := db.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	pending, indexed := 0, 0
+	flush := func() error {
+		if pending == 0 {
+			return nil
+		}
+		if err := opts.bulk(ctx, buf.Bytes()); err != nil {
+			return err
+		}
+		indexed += pending
+		klog.V(2).Infof("Indexed %d test results", indexed)
+		buf.Reset()
+		pending = 0
+		return nil
+	}
+
+	since := time.Now().AddDate(0, 0, -opts.days)
+	err = db.EachTestResult(opts.filter, since.Unix()*1000, func(r *database.TestResultRecord) error {
+		if !opts.allResults && r.Status != "fail" && r.Status != "flake" {
+			return nil
+		}
+		action := map[string]map[string]string{
+			"index": {"_index": opts.index, "_id": esDocumentID(r)},
+		}
+		if err := enc.Encode(action); err != nil {
+			return err
+		}
+		doc := esDocument{
+			TestResultRecord: r,
+			Time:             time.Unix(0, r.Timestamp*int64(time.Millisecond)).UTC().Format(time.RFC3339),
+		}
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+		pending++
+		if pending >= opts.batchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return fmt.Errorf("unable to index test results: %w", err)
+	}
+
+	klog.Infof("Indexed %d test results into %s", indexed, opts.index)
+	return nil
+}
+
+func NewCmdElasticsearch() *cobra.Command {
+	opts := &ElasticsearchOptions{}
+
+	cmd := &cobra.Command{
+		Use:     "elasticsearch",
+		Aliases: []string{"opensearch"},
+		Short:   "Index test results into Elasticsearch or OpenSearch",
+		Long: heredoc.Doc(`
+			Index results of tests in recent builds into Elasticsearch or OpenSearch,
+			one document per test in a build. Documents have the job, its tags, the
+			build, the test, its status (pass, flake, fail or infra), duration and
+			failure message, so failures can be searched in Kibana.
+
+			Documents are identified by the job, the build and the test, so running
+			the command periodically with overlapping --days updates them instead of
+			adding duplicates. Only failed and flaky results are indexed unless
+			--all-results is given.
+		`),
+		Example: heredoc.Doc(`
+			ci-results export elasticsearch --url=http://localhost:9200 --days=1
+			ci-results export elasticsearch --url=https://es.example.com --api-key-file=key --filter=4.10
+		`),
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.url, "url", "", "URL of Elasticsearch or OpenSearch.")
+	cmd.Flags().StringVar(&opts.index, "index", "ci-results-test-results", "Index to write documents to.")
+	cmd.Flags().StringVar(&opts.filter, "filter", "", "Space separated list of tags, tags prefixed with - are excluded.")
+	cmd.Flags().IntVar(&opts.days, "days", 1, "Index results of builds that started in this many recent days.")
+	cmd.Flags().BoolVar(&opts.allResults, "all-results", false, "Index passed results too.")
+	cmd.Flags().IntVar(&opts.batchSize, "batch-size", 1000, "Number of documents per bulk request.")
+	cmd.Flags().StringVar(&opts.username, "username", "", "Username for basic authentication.")
+	cmd.Flags().StringVar(&opts.passwordFile, "password-file", "", "File with the password for basic authentication.")
+	cmd.Flags().StringVar(&opts.apiKeyFile, "api-key-file", "", "File with an Elasticsearch API key, used instead of basic authentication.")
+	cmd.MarkFlagRequired("url")
+
+	completion.RegisterFilterFlag(cmd)
+
+	return cmd
+}
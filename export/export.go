@@ -0,0 +1,20 @@
+package export
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func NewCmdExport() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export data from the database",
+	}
+
+	cmd.AddCommand(NewCmdElasticsearch())
+	cmd.AddCommand(NewCmdInfluxDB())
+	cmd.AddCommand(NewCmdSheets())
+	cmd.AddCommand(NewCmdSippy())
+	cmd.AddCommand(NewCmdSubset())
+
+	return cmd
+}
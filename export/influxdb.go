@@ -0,0 +1,217 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/completion"
+	"github.com/dmage/ci-results/database"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+type InfluxDBOptions struct {
+	url         string
+	tokenFile   string
+	measurement string
+	filter      string
+	days        int
+	interval    time.Duration
+
+	token string
+	out   io.Writer
+}
+
+var lineProtocolEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// writePoints writes a point in the line protocol for every row of the daily
+// stats that has runs. The first values are of yesterday.
+func writePoints(w io.Writer, measurement string, tag string, stats *database.Stats, today time.Time) {
+	for _, row := range stats.Data {
+		name := strings.Join(row.Columns, ",")
+		for i, v := range row.Values {
+			total := v.Pass + v.Flake + v.Fail
+			if total == 0 {
+				continue
+			}
+			day := today.AddDate(0, 0, -i-1)
+			fmt.Fprintf(w, "%s,%s=%s pass=%di,flake=%di,fail=%di,pass_rate=%s,flake_rate=%s,fail_rate=%s %d\n",
+				lineProtocolEscaper.Replace(measurement), tag, lineProtocolEscaper.Replace(name),
+				v.Pass, v.Flake, v.Fail,
+				strconv.FormatFloat(float64(v.Pass+v.Flake)/float64(total), 'f', -1, 64),
+				strconv.FormatFloat(float64(v.Flake)/float64(total), 'f', -1, 64),
+				strconv.FormatFloat(float64(v.Fail)/float64(total), 'f', -1, 64),
+				day.Unix(),
+			)
+		}
+	}
+}
+
+func (opts *InfluxDBOptions) points(db *database.DB, now time.Time) ([]byte, error) {
+	periods := strings.TrimSuffix(strings.Repeat("1,", opts.days), ",")
+	today := now.UTC().Truncate(24 * time.Hour)
+
+	var buf bytes.Buffer
+	for _, group := range []struct {
+		columns string
+		suffix  string
+		tag     string
+	}{
+		{"sippytags", "_variant", "variant"},
+		{"name", "_job", "job"},
+	} {
+		stats, err := db.BuildStatsWith(group.columns, opts.filter, periods, "", database.PeriodOptions{AlignDays: true})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get build stats: %w", err)
+		}
+		writePoints(&buf, opts.measurement+group.suffix, group.tag, stats, today)
+	}
+	return buf.Bytes(), nil
+}
+
+func (opts *InfluxDBOptions) write(ctx context.Context, data []byte) error {
+	if opts.url == "" {
+		_, err := opts.out.Write(data)
+		return err
+	}
+
+	u, err := url.Parse(opts.url)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	if q.Get("precision") == "" {
+		q.Set("precision", "s")
+		u.RawQuery = q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if opts.token != "" {
+		req.Header.Set("Authorization", "Token "+opts.token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("got unexpected http response from POST %s: %s", u, resp.Status)
+	}
+	return nil
+}
+
+func (opts *InfluxDBOptions) export(ctx context.Context, db *database.DB) error {
+	data, err := opts.points(db, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := opts.write(ctx, data); err != nil {
+		return fmt.Errorf("unable to write points: %w", err)
+	}
+	if opts.url != "" {
+		klog.Infof("Wrote %d points to %s", bytes.Count(data, []byte("\n")), opts.url)
+	}
+	return nil
+}
+
+func (opts *InfluxDBOptions) Run(ctx context.Context) (err error) {
+	if opts.days <= 0 {
+		return fmt.Errorf("--days must be positive")
+	}
+	opts.token, err = readSecret(opts.tokenFile)
+	if err != nil {
+		return fmt.Errorf("unable to read token: %w", err)
+	}
+
+	db, err := database.OpenDefault()
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer func() {
+		closeErr := db.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	if opts.interval == 0 {
+		return opts.export(ctx, db)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	for {
+		// Points of the same days are written again, so a failed export is
+		// retried on the next iteration.
+		if err := opts.export(ctx, db); err != nil {
+			klog.Errorf("Unable to export pass rates: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(opts.interval):
+		}
+	}
+}
+
+func NewCmdInfluxDB() *cobra.Command {
+	opts := &InfluxDBOptions{
+		out: os.Stdout,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "influxdb",
+		Short: "Write daily pass rates to InfluxDB",
+		Long: heredoc.Doc(`
+			Write daily numbers of passed, flaky and failed runs and their rates per
+			variant and per job in the InfluxDB line protocol, one point per day
+			with the timestamp of the start of the day (UTC). The current day is
+			not written until it is complete.
+
+			The points are posted to --url, which can be the write endpoint of
+			InfluxDB 1.x (/write?db=DB) or 2.x (/api/v2/write?org=ORG&bucket=BUCKET)
+			or any other endpoint that accepts the line protocol. Without --url, the
+			points are printed.
+
+			With --interval, the command keeps running and writes the points of the
+			recent days again after each interval, so late results are picked up.
+		`),
+		Example: heredoc.Doc(`
+			ci-results export influxdb --days=30
+			ci-results export influxdb --url="http://influxdb:8086/api/v2/write?org=ci&bucket=results" --token-file=token --interval=1h
+		`),
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.url, "url", "", "Write endpoint to post the points to.")
+	cmd.Flags().StringVar(&opts.tokenFile, "token-file", "", "File with an API token for the write endpoint.")
+	cmd.Flags().StringVar(&opts.measurement, "measurement", "ci_results", "Prefix of measurement names, points are written to PREFIX_variant and PREFIX_job.")
+	cmd.Flags().StringVar(&opts.filter, "filter", "", "Space separated list of tags, tags prefixed with - are excluded.")
+	cmd.Flags().IntVar(&opts.days, "days", 7, "Number of recent complete days to write points for.")
+	cmd.Flags().DurationVar(&opts.interval, "interval", 0, "Write the points periodically with this interval instead of once.")
+
+	completion.RegisterFilterFlag(cmd)
+
+	return cmd
+}
@@ -0,0 +1,223 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/completion"
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/googleauth"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+const DefaultSheetsURL = "https://sheets.googleapis.com"
+
+const sheetsScope = "https://www.googleapis.com/auth/spreadsheets"
+
+var spreadsheetURLRe = regexp.MustCompile(`/spreadsheets/d/([a-zA-Z0-9_-]+)`)
+
+type SheetsOptions struct {
+	columns     string
+	filter      string
+	periods     string
+	testName    string
+	alignDays   bool
+	spreadsheet string
+	sheet       string
+	credentials string
+	sheetsURL   string
+
+	token string
+}
+
+// sheetRows converts the stats into rows of cells with a header row.
+func sheetRows(columns string, periods string, stats *database.Stats) [][]interface{} {
+	var header []interface{}
+	for _, col := range strings.Split(columns, ",") {
+		header = append(header, col)
+	}
+	for i, p := range strings.Split(periods, ",") {
+		prefix := fmt.Sprintf("Period %d (%sd) ", i+1, p)
+		header = append(header, prefix+"pass rate", prefix+"pass", prefix+"flake", prefix+"fail")
+	}
+
+	rows := [][]interface{}{header}
+	for _, row := range stats.Data {
+		var cells []interface{}
+		for _, col := range row.Columns {
+			cells = append(cells, col)
+		}
+		for _, v := range row.Values {
+			var rate interface{} = ""
+			if total := v.Pass + v.Flake + v.Fail; total > 0 {
+				rate = float64(v.Pass+v.Flake) / float64(total)
+			}
+			cells = append(cells, rate, v.Pass, v.Flake, v.Fail)
+		}
+		rows = append(rows, cells)
+	}
+	return rows
+}
+
+func (opts *SheetsOptions) do(ctx context.Context, method string, path string, in interface{}, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	u := strings.TrimSuffix(opts.sheetsURL, "/") + "/v4/spreadsheets/" + url.PathEscape(opts.spreadsheet) + path
+	req, err := http.NewRequestWithContext(ctx, method, u, &body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", "Bearer "+opts.token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("got unexpected http response from %s %s: %s", method, u, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// ensureSheet adds the tab to the spreadsheet if it doesn't exist.
+func (opts *SheetsOptions) ensureSheet(ctx context.Context) error {
+	var spreadsheet struct {
+		Sheets []struct {
+			Properties struct {
+				Title string `json:"title"`
+			} `json:"properties"`
+		} `json:"sheets"`
+	}
+	if err := opts.do(ctx, "GET", "?fields=sheets.properties.title", nil, &spreadsheet); err != nil {
+		return err
+	}
+	for _, s := range spreadsheet.Sheets {
+		if s.Properties.Title == opts.sheet {
+			return nil
+		}
+	}
+
+	klog.Infof("Adding sheet %q", opts.sheet)
+	return opts.do(ctx, "POST", ":batchUpdate", map[string]interface{}{
+		"requests": []interface{}{
+			map[string]interface{}{
+				"addSheet": map[string]interface{}{
+					"properties": map[string]string{"title": opts.sheet},
+				},
+			},
+		},
+	}, nil)
+}
+
+func (opts *SheetsOptions) Run(ctx context.Context) (err error) {
+	if m := spreadsheetURLRe.FindStringSubmatch(opts.spreadsheet); m != nil {
+		opts.spreadsheet = m[1]
+	}
+
+	sa, err := googleauth.LoadServiceAccount(opts.credentials)
+	if err != nil {
+		return fmt.Errorf("unable to load credentials: %w", err)
+	}
+	opts.token, err = sa.Token(ctx, sheetsScope)
+	if err != nil {
+		return err
+	}
+
+	db, err := database.OpenDefault()
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer func() {
+		closeErr := db.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	stats, err := db.BuildStatsWith(opts.columns, opts.filter, opts.periods, opts.testName, database.PeriodOptions{AlignDays: opts.alignDays})
+	if err != nil {
+		return fmt.Errorf("unable to get build stats: %w", err)
+	}
+	rows := sheetRows(opts.columns, opts.periods, stats)
+
+	if err := opts.ensureSheet(ctx); err != nil {
+		return fmt.Errorf("unable to get spreadsheet %s: %w", opts.spreadsheet, err)
+	}
+	rng := "'" + strings.ReplaceAll(opts.sheet, "'", "''") + "'"
+	if err := opts.do(ctx, "POST", "/values/"+url.PathEscape(rng)+":clear", map[string]string{}, nil); err != nil {
+		return fmt.Errorf("unable to clear sheet %q: %w", opts.sheet, err)
+	}
+	err = opts.do(ctx, "PUT", "/values/"+url.PathEscape(rng)+"?valueInputOption=RAW", map[string]interface{}{
+		"range":          rng,
+		"majorDimension": "ROWS",
+		"values":         rows,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("unable to write sheet %q: %w", opts.sheet, err)
+	}
+
+	klog.Infof("Wrote %d rows to sheet %q of spreadsheet %s", len(rows)-1, opts.sheet, opts.spreadsheet)
+	return nil
+}
+
+func NewCmdSheets() *cobra.Command {
+	opts := &SheetsOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "sheets",
+		Short: "Write build statistics into a Google Sheet",
+		Long: heredoc.Doc(`
+			Compute the same statistics as ci-results query and write them into a
+			tab of a Google Sheet, replacing its content. The tab is added if it
+			doesn't exist.
+
+			The command authenticates as a service account using its JSON key. The
+			spreadsheet has to be shared with the email of the service account.
+		`),
+		Example: heredoc.Doc(`
+			ci-results export sheets --spreadsheet=1AbC... --sheet="4.10 jobs" --columns=name --filter=4.10 --credentials=sa.json
+		`),
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.columns, "columns", "sippytags", "Comma separated list of columns to group by (sippytags, name, dashboard, test, sig, owner, variant.DIMENSION).")
+	cmd.Flags().StringVar(&opts.filter, "filter", "", "Space separated list of tags, tags prefixed with - are excluded.")
+	cmd.Flags().StringVar(&opts.periods, "periods", "7,7", "Comma separated list of periods in days going back from now.")
+	cmd.Flags().StringVar(&opts.testName, "testname", "", "Compute statistics for the given test.")
+	cmd.Flags().BoolVar(&opts.alignDays, "align-days", false, "Align periods to calendar days, the current day is not included.")
+	cmd.Flags().StringVar(&opts.spreadsheet, "spreadsheet", "", "ID or URL of the spreadsheet.")
+	cmd.Flags().StringVar(&opts.sheet, "sheet", "ci-results", "Name of the tab to write to.")
+	cmd.Flags().StringVar(&opts.credentials, "credentials", "", "JSON key file of the service account.")
+	cmd.Flags().StringVar(&opts.sheetsURL, "sheets-url", DefaultSheetsURL, "Base URL of the Google Sheets API.")
+	cmd.MarkFlagRequired("spreadsheet")
+	cmd.MarkFlagRequired("credentials")
+
+	completion.RegisterFilterFlag(cmd)
+
+	return cmd
+}
@@ -0,0 +1,171 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/completion"
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/sippy"
+	"github.com/dmage/ci-results/testgrid"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+// VariantsFilename is the file with the variants of the exported jobs.
+const VariantsFilename = "variants.json"
+
+type SippyOptions struct {
+	filter string
+	days   int
+	out    string
+}
+
+func writeJSON(filename string, v interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, buf, 0644)
+}
+
+func jobSummary(dashboard string, results *testgrid.JobResults) testgrid.JobSummary {
+	summary := testgrid.JobSummary{
+		DashboardName: dashboard,
+		OverallStatus: testgrid.OverallStatusStale,
+	}
+	if len(results.Tests) == 0 {
+		return summary
+	}
+	// The first row is Overall.
+	passed, total := 0, 0
+	for _, s := range results.Tests[0].Statuses {
+		if s.Value == testgrid.TestStatusPass {
+			passed += s.Count
+		}
+		total += s.Count
+	}
+	summary.LastRunTimestamp = float64(results.Timestamps[0])
+	summary.LastUpdateTimestamp = float64(results.Timestamps[0])
+	summary.Status = fmt.Sprintf("%d of %d (%.1f%%) recent columns passed", passed, total, 100*float64(passed)/float64(total))
+	if results.Tests[0].Statuses[0].Value == testgrid.TestStatusPass {
+		summary.OverallStatus = testgrid.OverallStatusPassing
+		summary.LatestGreen = results.Changelists[0]
+	} else {
+		summary.OverallStatus = testgrid.OverallStatusFailing
+	}
+	return summary
+}
+
+func (opts *SippyOptions) Run(ctx context.Context) (err error) {
+	db, err := database.OpenDefault()
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer func() {
+		closeErr := db.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	if err := os.MkdirAll(opts.out, 0755); err != nil {
+		return err
+	}
+
+	jobs, err := db.ListJobs(opts.filter, opts.days)
+	if err != nil {
+		return err
+	}
+	tags, err := db.JobTagsList("")
+	if err != nil {
+		return err
+	}
+	jobVariants := map[string][]string{}
+	for _, t := range tags {
+		if t.Source == database.TagSourceSippy {
+			jobVariants[t.Job] = append(jobVariants[t.Job], t.Tag)
+		}
+	}
+
+	since := time.Now().AddDate(0, 0, -opts.days).Unix() * 1000
+	summaries := map[string]testgrid.DashboardSummary{}
+	variants := map[string][]string{}
+	for _, job := range jobs {
+		if job.Dashboard == "" {
+			klog.Warningf("Skipping job %s as it doesn't belong to a dashboard", job.Name)
+			continue
+		}
+		results, err := db.JobResults(job.Name, since)
+		if err != nil {
+			return fmt.Errorf("job %s: %w", job.Name, err)
+		}
+		if len(results.Changelists) == 0 {
+			continue
+		}
+		err = writeJSON(filepath.Join(opts.out, sippy.JobDetailsFilename(job.Dashboard, job.Name)), results)
+		if err != nil {
+			return err
+		}
+		if summaries[job.Dashboard] == nil {
+			summaries[job.Dashboard] = testgrid.DashboardSummary{}
+		}
+		summaries[job.Dashboard][job.Name] = jobSummary(job.Dashboard, results)
+		variants[job.Name] = append([]string{}, jobVariants[job.Name]...)
+	}
+
+	for dashboard, summary := range summaries {
+		if err := writeJSON(filepath.Join(opts.out, sippy.SummaryFilename(dashboard)), summary); err != nil {
+			return err
+		}
+	}
+	if err := writeJSON(filepath.Join(opts.out, VariantsFilename), variants); err != nil {
+		return err
+	}
+
+	klog.Infof("Exported %d jobs from %d dashboards to %s", len(variants), len(summaries), opts.out)
+	return nil
+}
+
+func NewCmdSippy() *cobra.Command {
+	opts := &SippyOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "sippy",
+		Short: "Export jobs and test results as Sippy's TestGrid data",
+		Long: heredoc.Doc(`
+			Write the results of the jobs that match the filter into a directory in
+			the format that Sippy loads TestGrid data from, so a Sippy instance can
+			be seeded from this database and its reports can be compared with ours.
+
+			Each dashboard gets a summary file and each job gets a table with the
+			results of its builds, named as Sippy names the downloaded TestGrid
+			responses. The variants of the jobs are written to variants.json.
+		`),
+		Example: heredoc.Doc(`
+			ci-results export sippy --filter=4.9 --out=sippy-data
+		`),
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.filter, "filter", "", "Space separated list of tags, tags prefixed with - are excluded.")
+	cmd.Flags().IntVar(&opts.days, "days", 14, "Export builds from the last N days.")
+	cmd.Flags().StringVar(&opts.out, "out", "", "Directory to write the data to.")
+	cmd.MarkFlagRequired("out")
+
+	completion.RegisterFilterFlag(cmd)
+
+	return cmd
+}
@@ -0,0 +1,69 @@
+package export
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/completion"
+	"github.com/dmage/ci-results/database"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+type SubsetOptions struct {
+	filter string
+	out    string
+}
+
+func (opts *SubsetOptions) Run(ctx context.Context) (err error) {
+	db, err := database.OpenDefault()
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer func() {
+		closeErr := db.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	err = db.ExportSubset(ctx, opts.filter, opts.out)
+	if err != nil {
+		return fmt.Errorf("unable to export subset: %w", err)
+	}
+
+	klog.Infof("Exported jobs matching %q to %s", opts.filter, opts.out)
+	return nil
+}
+
+func NewCmdSubset() *cobra.Command {
+	opts := &SubsetOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "subset",
+		Short: "Export jobs matching a filter into a new database",
+		Long: heredoc.Doc(`
+			Write the jobs that match the filter, their builds and test results into
+			a new SQLite database, so a slice of the data can be shared.
+		`),
+		Example: heredoc.Doc(`
+			ci-results export subset --filter="aws -upgrade" --out=aws.db
+		`),
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.filter, "filter", "", "Space separated list of tags, tags prefixed with - are excluded.")
+	cmd.Flags().StringVar(&opts.out, "out", "", "Path to the new database.")
+	cmd.MarkFlagRequired("out")
+
+	completion.RegisterFilterFlag(cmd)
+
+	return cmd
+}
@@ -0,0 +1,185 @@
+package gate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/completion"
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/output"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+// ExitFailed is the exit code when the thresholds aren't met.
+const ExitFailed = 2
+
+type GateOptions struct {
+	filter      string
+	testName    string
+	window      string
+	minPassRate float64
+	minRuns     int
+	perJob      bool
+	output      string
+
+	out io.Writer
+}
+
+type Check struct {
+	Name     string  `json:"name"`
+	Runs     int     `json:"runs"`
+	PassRate float64 `json:"pass_rate"`
+	Passed   bool    `json:"passed"`
+	Reason   string  `json:"reason,omitempty"`
+}
+
+type Result struct {
+	Passed bool    `json:"passed"`
+	Checks []Check `json:"checks"`
+}
+
+func parseDays(s string) (int, error) {
+	days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+	if err != nil || days <= 0 {
+		return 0, fmt.Errorf("invalid number of days %q", s)
+	}
+	return days, nil
+}
+
+func (opts *GateOptions) evaluate(stats *database.Stats) *Result {
+	result := &Result{
+		Passed: true,
+		Checks: []Check{},
+	}
+	for _, row := range stats.Data {
+		v := row.Values[0]
+		check := Check{
+			Name: strings.Join(row.Columns, " "),
+			Runs: v.Pass + v.Flake + v.Fail,
+		}
+		if check.Name == "" {
+			check.Name = "all jobs"
+		}
+		if check.Runs > 0 {
+			check.PassRate = 100 * float64(v.Pass+v.Flake) / float64(check.Runs)
+		}
+		switch {
+		case check.Runs < opts.minRuns:
+			check.Reason = fmt.Sprintf("%d runs, at least %d required", check.Runs, opts.minRuns)
+		case check.PassRate < opts.minPassRate:
+			check.Reason = fmt.Sprintf("pass rate %.1f%% is below %.1f%%", check.PassRate, opts.minPassRate)
+		default:
+			check.Passed = true
+		}
+		result.Passed = result.Passed && check.Passed
+		result.Checks = append(result.Checks, check)
+	}
+	if len(result.Checks) == 0 && opts.minRuns > 0 {
+		result.Passed = false
+		result.Checks = append(result.Checks, Check{
+			Name:   "all jobs",
+			Reason: "no runs match the filter",
+		})
+	}
+	return result
+}
+
+func printResult(out io.Writer, result *Result) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "RESULT\tNAME\tPASS RATE\tRUNS\tREASON")
+	for _, c := range result.Checks {
+		status := "PASS"
+		if !c.Passed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.1f%%\t%d\t%s\n", status, c.Name, c.PassRate, c.Runs, c.Reason)
+	}
+	return w.Flush()
+}
+
+func (opts *GateOptions) Run(ctx context.Context) (result *Result, err error) {
+	if err := output.Validate(opts.output); err != nil {
+		return nil, err
+	}
+	days, err := parseDays(opts.window)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := database.OpenDefault()
+	if err != nil {
+		return nil, fmt.Errorf("unable to open database: %w", err)
+	}
+	defer func() {
+		closeErr := db.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	columns := ""
+	if opts.perJob {
+		columns = "name"
+	}
+	stats, err := db.BuildStats(columns, opts.filter, strconv.Itoa(days), opts.testName)
+	if err != nil {
+		return nil, err
+	}
+
+	result = opts.evaluate(stats)
+	return result, output.Print(opts.out, opts.output, result, func(out io.Writer) error {
+		return printResult(out, result)
+	})
+}
+
+func NewCmdGate() *cobra.Command {
+	opts := &GateOptions{
+		out: os.Stdout,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "gate",
+		Short: "Check that pass rates meet thresholds",
+		Long: heredoc.Doc(`
+			Check the pass rate of the jobs that match the filter over the window
+			and exit with the code 2 if the thresholds aren't met, so release
+			pipelines can block promotion based on CI results.
+
+			With --per-job, every job has to meet the thresholds on its own.
+		`),
+		Example: heredoc.Doc(`
+			ci-results gate --filter="4.9 aws" --min-pass-rate=95 --window=7d
+			ci-results gate --filter=4.9 --testname="[sig-network] Services should serve a basic endpoint from pods" --min-pass-rate=99
+		`),
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			result, err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+			if !result.Passed {
+				klog.Flush()
+				os.Exit(ExitFailed)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.filter, "filter", "", "Space separated list of tags, tags prefixed with - are excluded.")
+	cmd.Flags().StringVar(&opts.testName, "testname", "", "Check the pass rate of the given test instead of builds.")
+	cmd.Flags().StringVar(&opts.window, "window", "7d", "Number of days to compute pass rates for.")
+	cmd.Flags().Float64Var(&opts.minPassRate, "min-pass-rate", 95, "Minimal pass rate in percent.")
+	cmd.Flags().IntVar(&opts.minRuns, "min-runs", 1, "Minimal number of runs, fewer runs fail the gate.")
+	cmd.Flags().BoolVar(&opts.perJob, "per-job", false, "Check every job separately.")
+	output.AddFlag(cmd, &opts.output)
+
+	completion.RegisterFilterFlag(cmd)
+
+	return cmd
+}
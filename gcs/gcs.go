@@ -0,0 +1,160 @@
+package gcs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/dmage/ci-results/googleauth"
+)
+
+const DefaultURL = "https://storage.googleapis.com"
+
+const (
+	metadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+	storageScope     = "https://www.googleapis.com/auth/devstorage.read_write"
+)
+
+// Client uploads and downloads objects of Google Cloud Storage using its JSON
+// API.
+type Client struct {
+	// URL is the base URL of the GCS API.
+	URL string
+	// TokenFile is a file with an OAuth access token.
+	TokenFile string
+	// CredentialsFile is a JSON key file of a service account. If neither
+	// TokenFile nor CredentialsFile is set, the token of the default service
+	// account is requested from the metadata server.
+	CredentialsFile string
+}
+
+// ParseURL splits a gs://bucket/object URL.
+func ParseURL(u string) (bucket string, object string, err error) {
+	path := strings.TrimPrefix(u, "gs://")
+	if path == u {
+		return "", "", fmt.Errorf("invalid GCS URL %q: expected gs://bucket/object", u)
+	}
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid GCS URL %q: expected gs://bucket/object", u)
+	}
+	return parts[0], parts[1], nil
+}
+
+func (c *Client) token(ctx context.Context) (string, error) {
+	if c.TokenFile != "" {
+		data, err := ioutil.ReadFile(c.TokenFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	if c.CredentialsFile != "" {
+		sa, err := googleauth.LoadServiceAccount(c.CredentialsFile)
+		if err != nil {
+			return "", err
+		}
+		return sa.Token(ctx, storageScope)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", metadataTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to get a token from the metadata server: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to get a token from the metadata server: %s", resp.Status)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, contentType string, body io.Reader) (*http.Response, error) {
+	token, err := c.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	base := c.URL
+	if base == "" {
+		base = DefaultURL
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(base, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	// Files would be sent with the chunked encoding otherwise.
+	if f, ok := body.(*os.File); ok {
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = fi.Size()
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("got unexpected http response from %s %s: %s", method, req.URL, resp.Status)
+	}
+	return resp, nil
+}
+
+// Upload writes the object at the gs://bucket/object URL.
+func (c *Client) Upload(ctx context.Context, u string, contentType string, body io.Reader) error {
+	bucket, object, err := ParseURL(u)
+	if err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("/upload/storage/v1/b/%s/o?uploadType=media&name=%s", url.PathEscape(bucket), url.QueryEscape(object))
+	resp, err := c.do(ctx, "POST", path, contentType, body)
+	if err != nil {
+		return fmt.Errorf("unable to upload %s: %w", u, err)
+	}
+	return resp.Body.Close()
+}
+
+// Download writes the content of the object at the gs://bucket/object URL
+// into w.
+func (c *Client) Download(ctx context.Context, u string, w io.Writer) error {
+	bucket, object, err := ParseURL(u)
+	if err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("/storage/v1/b/%s/o/%s?alt=media", url.PathEscape(bucket), url.PathEscape(object))
+	resp, err := c.do(ctx, "GET", path, "", nil)
+	if err != nil {
+		return fmt.Errorf("unable to download %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("unable to download %s: %w", u, err)
+	}
+	return nil
+}
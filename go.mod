@@ -4,10 +4,15 @@ go 1.16
 
 require (
 	github.com/MakeNowJust/heredoc/v2 v2.0.1
+	github.com/gdamore/tcell/v2 v2.4.1-0.20210905002822-f057f0a857a1
 	github.com/hashicorp/golang-lru v0.5.4
 	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/paulbellamy/ratecounter v0.2.0
+	github.com/rivo/tview v0.0.0-20220307222120-9994674d60a8
 	github.com/spf13/cobra v1.1.3
 	github.com/spf13/pflag v1.0.5
+	github.com/spf13/viper v1.7.0
+	google.golang.org/protobuf v1.26.0
+	gopkg.in/yaml.v2 v2.4.0
 	k8s.io/klog/v2 v2.9.0
 )
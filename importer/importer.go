@@ -0,0 +1,282 @@
+package importer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/ciinfo"
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/indexer"
+	"github.com/dmage/ci-results/sippy"
+	"github.com/dmage/ci-results/testgrid"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+type Test struct {
+	Name     string   `json:"name"`
+	Status   string   `json:"status"`
+	Duration *float64 `json:"duration,omitempty"`
+	// Message is the failure of the test.
+	Message string `json:"message,omitempty"`
+}
+
+type Build struct {
+	Job       string   `json:"job"`
+	Dashboard string   `json:"dashboard,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Number    string   `json:"number"`
+	Timestamp int64    `json:"timestamp"`
+	Status    string   `json:"status"`
+	Duration  *float64 `json:"duration,omitempty"`
+	Tests     []Test   `json:"tests"`
+}
+
+var testStatuses = map[string]testgrid.TestStatus{
+	"pass":            testgrid.TestStatusPass,
+	"pass-with-skips": testgrid.TestStatusPassWithSkips,
+	"flake":           testgrid.TestStatusFlaky,
+	"fail":            testgrid.TestStatusFail,
+}
+
+func (b *Build) validate() error {
+	if b.Job == "" {
+		return fmt.Errorf("job is required")
+	}
+	if b.Number == "" {
+		return fmt.Errorf("number is required")
+	}
+	if b.Timestamp <= 0 {
+		return fmt.Errorf("timestamp is required")
+	}
+	if b.Status != "success" && b.Status != "failure" {
+		return fmt.Errorf("status must be success or failure, got %q", b.Status)
+	}
+	for _, t := range b.Tests {
+		if t.Name == "" {
+			return fmt.Errorf("test name is required")
+		}
+		if _, ok := testStatuses[t.Status]; !ok {
+			return fmt.Errorf("test %q: unknown status %q", t.Name, t.Status)
+		}
+	}
+	return nil
+}
+
+func importBuild(tx *database.Tx, tagger *ciinfo.Tagger, variants *sippy.Variants, b *Build) error {
+	jobID, err := tx.FindJob(b.Job)
+	if database.IsNotFound(err) {
+		tags := indexer.JobTags(tagger, variants, nil, b.Dashboard, b.Job)
+		tags.Sippy = append(tags.Sippy, b.Tags...)
+		jobID, err = tx.InsertJob(b.Job, b.Dashboard, tags)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	status, failure := 1, ""
+	if b.Status == "failure" {
+		status, failure = 2, database.FailureTests
+	}
+	buildID, err := tx.UpsertBuild(jobID, b.Number, b.Timestamp, status, failure)
+	if err != nil {
+		return err
+	}
+	if b.Duration != nil {
+		if err := tx.SetBuildDuration(buildID, *b.Duration); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range b.Tests {
+		testID, err := tx.UpsertTest(t.Name)
+		if err != nil {
+			return err
+		}
+		err = tx.UpsertTestResult(buildID, testID, testStatuses[t.Status])
+		if err != nil {
+			return err
+		}
+		if t.Duration != nil {
+			if err := tx.SetTestResultDuration(buildID, testID, *t.Duration); err != nil {
+				return err
+			}
+		}
+		if t.Message != "" {
+			if err := tx.SetTestResultMessage(buildID, testID, t.Message); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// decodeBuilds reads either a JSON array of builds or newline-delimited JSON
+// objects and calls fn for each build.
+func decodeBuilds(r io.Reader, fn func(b *Build) error) error {
+	br := bufio.NewReader(r)
+	for {
+		c, err := br.Peek(1)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !strings.ContainsAny(string(c), " \t\r\n") {
+			break
+		}
+		br.ReadByte()
+	}
+
+	dec := json.NewDecoder(br)
+	dec.DisallowUnknownFields()
+
+	c, _ := br.Peek(1)
+	array := c[0] == '['
+	if array {
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	}
+
+	for n := 1; ; n++ {
+		if array && !dec.More() {
+			_, err := dec.Token()
+			return err
+		}
+		var b Build
+		if err := dec.Decode(&b); err == io.EOF && !array {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("build #%d: %w", n, err)
+		}
+		if err := b.validate(); err != nil {
+			return fmt.Errorf("build #%d: %w", n, err)
+		}
+		if err := fn(&b); err != nil {
+			return fmt.Errorf("build #%d (%s/%s): %w", n, b.Job, b.Number, err)
+		}
+	}
+}
+
+type ImportOptions struct {
+	files        []string
+	variantsFile string
+}
+
+func (opts *ImportOptions) Run(ctx context.Context) (err error) {
+	db, err := database.OpenDefault()
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer func() {
+		closeErr := db.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	variants := sippy.DefaultVariants
+	if opts.variantsFile != "" {
+		variants, err = sippy.LoadVariants(opts.variantsFile)
+		if err != nil {
+			return fmt.Errorf("unable to load variants: %w", err)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	tagger := ciinfo.NewTagger()
+	count := 0
+	for _, file := range opts.files {
+		var r io.Reader = os.Stdin
+		if file != "-" {
+			f, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+
+		err := decodeBuilds(r, func(b *Build) error {
+			count++
+			return importBuild(tx, tagger, variants, b)
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	klog.Infof("Imported %d builds", count)
+	return nil
+}
+
+func NewCmdImport() *cobra.Command {
+	opts := &ImportOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "import [FILE...]",
+		Short: "Import builds and test results from JSON",
+		Long: heredoc.Doc(`
+			Import builds and their test results produced by external pipelines.
+
+			The input is either a JSON array of builds or newline-delimited JSON with
+			one build per line. Each build has the following fields:
+
+			  job        name of the job (required)
+			  dashboard  name of the dashboard the job belongs to
+			  tags       list of extra tags for the job, used only for new jobs
+			  number     build number, unique within the job (required)
+			  timestamp  start time in milliseconds since the epoch (required)
+			  status     "success" or "failure" (required)
+			  duration   duration of the build in seconds
+			  tests      list of test results
+
+			Each test result has the following fields:
+
+			  name       name of the test (required)
+			  status     "pass", "pass-with-skips", "flake" or "fail" (required)
+			  duration   duration of the test in seconds
+			  message    failure message of the test
+
+			Builds that already exist in the database are not updated. The input is
+			read from the standard input if no files are given.
+		`),
+		Example: heredoc.Doc(`
+			echo '{"job":"my-job","number":"1","timestamp":1620000000000,"status":"success","tests":[{"name":"my-test","status":"pass"}]}' | ci-results import
+		`),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.files = args
+			if len(opts.files) == 0 {
+				opts.files = []string{"-"}
+			}
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.variantsFile, "variants", "", "YAML file with Sippy variant definitions to use instead of the built-in ones.")
+
+	return cmd
+}
@@ -0,0 +1,76 @@
+package indexer
+
+import (
+	"context"
+
+	"github.com/dmage/ci-results/bugs"
+	"github.com/dmage/ci-results/database"
+	"k8s.io/klog/v2"
+)
+
+type testBugs struct {
+	testName string
+	tracker  string
+	bugs     []database.LinkedBug
+}
+
+func linkBugs(ctx context.Context, db *database.DB, trackers []bugs.Tracker, limit int) (err error) {
+	tests, err := db.FailingTests(7, limit)
+	if err != nil {
+		return err
+	}
+
+	// The trackers are searched before the transaction is started, so that
+	// slow trackers don't hold the write lock of the database.
+	klog.Infof("Linking bugs for %d failing tests...", len(tests))
+	var results []testBugs
+	for _, testName := range tests {
+		for _, tracker := range trackers {
+			found, err := tracker.Search(ctx, testName)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				// The trackers are not essential, keep the data that we already have.
+				klog.Warningf("unable to search %s for %q: %s", tracker.Name(), testName, err)
+				continue
+			}
+
+			var linked []database.LinkedBug
+			for _, bug := range found {
+				linked = append(linked, database.LinkedBug{
+					Tracker: bug.Tracker,
+					ID:      bug.ID,
+					Summary: bug.Summary,
+					Status:  bug.Status,
+					URL:     bug.URL,
+				})
+			}
+			results = append(results, testBugs{
+				testName: testName,
+				tracker:  tracker.Name(),
+				bugs:     linked,
+			})
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	for _, r := range results {
+		err = tx.SetTestBugs(r.testName, r.tracker, r.bugs)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
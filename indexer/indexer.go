@@ -2,22 +2,41 @@ package indexer
 
 import (
 	"context"
+	"expvar"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/artifacts"
+	"github.com/dmage/ci-results/bugs"
 	"github.com/dmage/ci-results/ciinfo"
 	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/diagnostics"
+	"github.com/dmage/ci-results/gcs"
+	"github.com/dmage/ci-results/owners"
+	"github.com/dmage/ci-results/renames"
+	"github.com/dmage/ci-results/s3"
 	"github.com/dmage/ci-results/sippy"
 	"github.com/dmage/ci-results/testgrid"
+	"github.com/dmage/ci-results/version"
 	"github.com/paulbellamy/ratecounter"
 	"github.com/spf13/cobra"
 	"k8s.io/klog/v2"
 )
 
+// Progress of the indexer, available through --diagnostics-listen.
+var (
+	indexedBuilds      = expvar.NewInt("indexer_builds")
+	indexedTestResults = expvar.NewInt("indexer_test_results")
+)
+
 type workers struct {
 	groups sync.WaitGroup
 	mu     sync.Mutex
@@ -64,44 +83,56 @@ func (w *workers) Done() error {
 }
 
 type job struct {
-	Dashboard string
-	Name      string
+	Dashboard   string
+	Name        string
+	LatestGreen string
 }
 
 type build struct {
-	JobDashboard string
-	JobName      string
-	Number       string
-	Timestamp    int64
-	Tests        map[string]testgrid.TestStatus
+	Number    string
+	Timestamp int64
+	// Result is the result from finished.json, if it is known.
+	Result string
+
+	// The fields below are known when all tests of the job are read.
+	Overall testgrid.TestStatus
+	Running bool
+	// InstallFailed is set if a test that provisions the cluster failed.
+	InstallFailed bool
 }
 
-type jobResults struct {
-	Changelists []string
-	Timestamps  []int64
-	Tests       map[string][]testgrid.TestStatus
+// testResults has the results of a test in the builds of a job, statuses
+// are indexed like the builds.
+type testResults struct {
+	Name      string
+	Statuses  []testgrid.TestStatus
+	Durations map[int]float64
+	// Messages has the messages of failed and flaky results.
+	Messages map[int]string
+	Stale    bool
 }
 
-func unpackTestStatuses(tr []testgrid.TestResult) []testgrid.TestStatus {
-	var result []testgrid.TestStatus
-	for _, r := range tr {
-		for i := 0; i < r.Count; i++ {
-			result = append(result, r.Value)
-		}
-	}
-	return result
+// jobPart is a part of the results of a job that a fetcher sends to the
+// writer while the job is decoded. The first part has the builds of the job,
+// the following parts have the results of one test each, and the last part
+// has the builds with their statuses.
+type jobPart struct {
+	Job    job
+	Builds []build
+	Test   *testResults
+	Done   bool
+	// Aborted is set on the last part if the job could not be read to the
+	// end.
+	Aborted bool
 }
 
-func unpackJobResults(packedResults *testgrid.JobResults) jobResults {
-	results := jobResults{
-		Changelists: packedResults.Changelists,
-		Timestamps:  packedResults.Timestamps,
-		Tests:       make(map[string][]testgrid.TestStatus),
-	}
-	for _, test := range packedResults.Tests {
-		results.Tests[test.Name] = unpackTestStatuses(test.Statuses)
+// isStale reports whether the test has no results in the most recent
+// columns. Nothing is stale if the job has fewer columns.
+func isStale(results *testgrid.JobResults, test *testgrid.Test, columns int) bool {
+	if columns <= 0 || len(results.Changelists) < columns {
+		return false
 	}
-	return results
+	return !test.HasRecentResults(columns)
 }
 
 type regexpTagger struct {
@@ -221,9 +252,32 @@ var neverStable = map[string]bool{
 	"release-openshift-origin-installer-e2e-aws-sdn-network-stress-4.9":                              true,
 }
 
-func jobTags(t *ciinfo.Tagger, dashboard string, jobName string) database.JobTags {
-	tags := sippy.IdentifyVariants(jobName)
-	tags = append(tags, t.GetTags(jobName)...)
+// TagRule adds Tag to jobs whose names match Regexp.
+type TagRule struct {
+	Regexp *regexp.Regexp
+	Tag    string
+}
+
+// ParseTagRule parses a rule in the form REGEXP=TAG.
+func ParseTagRule(s string) (TagRule, error) {
+	i := strings.LastIndex(s, "=")
+	if i == -1 {
+		return TagRule{}, fmt.Errorf("invalid tag rule %q: expected REGEXP=TAG", s)
+	}
+	re, err := regexp.Compile(s[:i])
+	if err != nil {
+		return TagRule{}, fmt.Errorf("invalid tag rule %q: %w", s, err)
+	}
+	return TagRule{Regexp: re, Tag: s[i+1:]}, nil
+}
+
+func JobTags(t *ciinfo.Tagger, variants *sippy.Variants, rules []TagRule, dashboard string, jobName string) database.JobTags {
+	tags := variants.Identify(jobName)
+	for _, rule := range rules {
+		if rule.Regexp.MatchString(jobName) {
+			tags = append(tags, rule.Tag)
+		}
+	}
 	if strings.Contains(dashboard, "4.8") {
 		tags = append(tags, "4.8")
 	}
@@ -238,13 +292,539 @@ func jobTags(t *ciinfo.Tagger, dashboard string, jobName string) database.JobTag
 		Mod:      getTag(jobName, mods, "none"),
 		TestType: getTag(jobName, testTypes, "other"),
 		Sippy:    tags,
+		CIInfo:   t.GetTags(jobName),
+		Variants: VariantsMap(variants.IdentifyDimensions(jobName)),
+	}
+}
+
+// VariantsMap converts variant values to the form stored in the database.
+func VariantsMap(values []sippy.VariantValue) map[string]string {
+	m := make(map[string]string, len(values))
+	for _, v := range values {
+		m[v.Dimension] = v.Value
+	}
+	return m
+}
+
+// installTests are steps that fail when the cluster cannot be provisioned.
+var installTests = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)install.* container test$`),
+	regexp.MustCompile(`(?i)(^|\] )cluster install`),
+	regexp.MustCompile(`(?i)infrastructure should work`),
+	regexp.MustCompile(`(?i)pre phase`),
+}
+
+// buildStatus returns the status and the failure type of the build. The
+// result from finished.json is preferred, the Overall test is used if the
+// result is unknown.
+func buildStatus(build build) (status int, failure string) {
+	switch build.Result {
+	case artifacts.ResultSuccess:
+		return 1, ""
+	case artifacts.ResultFailure:
+		return 2, classifyFailure(build)
+	case artifacts.ResultAborted, artifacts.ResultError:
+		return 2, database.FailureInfra
+	}
+
+	switch build.Overall.Category() {
+	case testgrid.CategoryFail:
+		return 2, classifyFailure(build)
+	case testgrid.CategoryInfra:
+		return 2, database.FailureInfra
 	}
+	return 1, "" // Success
+}
+
+// buildResult returns the authoritative result of the build if it is known.
+// The latest green build from the dashboard summary has passed, results of
+// other builds newer than lastBuild are read from their finished.json.
+func (opts *IndexerOptions) buildResult(job job, build build, lastBuild int64) string {
+	if build.Number == job.LatestGreen {
+		return artifacts.ResultSuccess
+	}
+	if opts.artifacts == nil || build.Timestamp <= lastBuild {
+		return ""
+	}
+	finished, err := opts.artifacts.Finished(job.Name, build.Number)
+	if err != nil {
+		klog.Warningf("unable to get the result of build %s of %s, using the Overall test: %s", build.Number, job.Name, err)
+		return ""
+	}
+	if finished == nil {
+		return ""
+	}
+	return finished.Result
+}
+
+func isInstallTest(testName string) bool {
+	for _, re := range installTests {
+		if re.MatchString(testName) {
+			return true
+		}
+	}
+	return false
+}
+
+func classifyFailure(build build) string {
+	if build.InstallFailed {
+		return database.FailureInstall
+	}
+	return database.FailureTests
 }
 
 type IndexerOptions struct {
+	dashboards       []string
+	dashboardGroups  []string
+	dashboardRegexp  string
+	skipUnchanged    bool
+	incrementalCols  int
+	staleColumns     int
+	releaseConfigs   []string
+	ciinfoResolver   *ciinfo.Resolver
+	configOrg        string
+	configRepos      []string
+	configBranches   []string
+	variantsFile     string
+	ownersFile       string
+	renamesFile      string
+	preloadTestsMiB  int64
+	diagnosticsAddr  string
+	tagRules         []string
+	testgridOpts     testgrid.ClientOptions
+	testgridState    string
+	testgridFixtures string
+	artifactsURL     string
+	artifacts        *artifacts.Client
+
+	linkBugs      bool
+	linkBugsLimit int
+	bugzillaURL   string
+	jiraURL       string
+	jiraTokenFile string
+
+	snapshotUpload string
+	gcs            gcs.Client
+	s3             s3.Client
+}
+
+// runErrors collects errors of the dashboards, jobs and builds that are
+// skipped, so one of them doesn't fail the whole run.
+type runErrors struct {
+	mu   sync.Mutex
+	errs []database.IndexRunError
+}
+
+func (re *runErrors) add(e database.IndexRunError, err error) {
+	switch {
+	case e.Build != "":
+		klog.Errorf("unable to index build %s of %s: %s", e.Build, e.Job, err)
+	case e.Job != "":
+		klog.Errorf("unable to index job %s: %s", e.Job, err)
+	default:
+		klog.Errorf("unable to index dashboard %s: %s", e.Dashboard, err)
+	}
+	e.Error = err.Error()
+	re.mu.Lock()
+	defer re.mu.Unlock()
+	re.errs = append(re.errs, e)
+}
+
+func (re *runErrors) list() []database.IndexRunError {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+	return append([]database.IndexRunError(nil), re.errs...)
+}
+
+// jobState is what the writer knows about a job that is being written.
+type jobState struct {
+	jobID    int64
+	buildIDs []int64
+	// inserted marks the builds that are new in this run.
+	inserted []bool
+	staleIDs []int64
+	err      error
+}
+
+// buildWriter stores the results of jobs in the database as they are decoded.
+type buildWriter struct {
+	tx           *database.Tx
+	tagger       *ciinfo.Tagger
+	variants     *sippy.Variants
+	tagRules     []TagRule
+	staleColumns int
+	counter      *ratecounter.RateCounter
+	runErrs      *runErrors
+
+	// ciinfo tags of known jobs are refreshed once per run.
+	refreshed map[int64]bool
+	jobs      map[job]*jobState
+	// failed is the number of jobs that could not be written completely.
+	failed int
+}
+
+// write stores the part. Each part gets a savepoint, so a bad part doesn't
+// break the rest of the batch, the rest of its job is skipped and the builds
+// that the job has added are removed. Only errors of the transaction are
+// returned.
+func (bw *buildWriter) write(part jobPart) error {
+	state, ok := bw.jobs[part.Job]
+	if !ok {
+		state = &jobState{}
+		bw.jobs[part.Job] = state
+	}
+	if part.Done {
+		delete(bw.jobs, part.Job)
+	}
+
+	if state.err == nil && !part.Aborted {
+		if err := bw.tx.Savepoint("part"); err != nil {
+			return err
+		}
+		var err error
+		switch {
+		case part.Done:
+			err = bw.finish(state, part)
+		case part.Test != nil:
+			err = bw.writeTest(state, *part.Test)
+		default:
+			err = bw.start(state, part)
+		}
+		if err != nil {
+			bw.runErrs.add(database.IndexRunError{Dashboard: part.Job.Dashboard, Job: part.Job.Name}, err)
+			state.err = err
+			if err := bw.tx.RollbackTo("part"); err != nil {
+				return err
+			}
+		} else if err := bw.tx.Release("part"); err != nil {
+			return err
+		}
+	}
+
+	if part.Done && (state.err != nil || part.Aborted) {
+		bw.failed++
+		return bw.abort(state)
+	}
+	return nil
+}
+
+func (bw *buildWriter) start(state *jobState, part jobPart) error {
+	tx := bw.tx
+	job := part.Job
+
+	jobID, err := tx.FindJob(job.Name)
+	if database.IsNotFound(err) {
+		jobID, err = tx.InsertJob(job.Name, job.Dashboard, JobTags(bw.tagger, bw.variants, bw.tagRules, job.Dashboard, job.Name))
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else if !bw.refreshed[jobID] && bw.tagger.Len() > 0 {
+		err = tx.SetJobCIInfoTags(jobID, bw.tagger.GetTags(job.Name))
+		if err != nil {
+			return err
+		}
+	}
+	bw.refreshed[jobID] = true
+	state.jobID = jobID
+
+	// The statuses of new builds are set when all their results are known.
+	// The ids are kept only if all builds are stored, as the ids of builds
+	// that are rolled back can be reused.
+	buildIDs := make([]int64, len(part.Builds))
+	inserted := make([]bool, len(part.Builds))
+	for i, build := range part.Builds {
+		buildIDs[i], inserted[i], err = tx.InsertBuild(jobID, build.Number, build.Timestamp, 0, "")
+		if err != nil {
+			return err
+		}
+	}
+	state.buildIDs = buildIDs
+	state.inserted = inserted
+	return nil
+}
+
+func (bw *buildWriter) writeTest(state *jobState, test testResults) error {
+	tx := bw.tx
+
+	testID, err := tx.UpsertTest(test.Name)
+	if err != nil {
+		return err
+	}
+	if test.Stale {
+		state.staleIDs = append(state.staleIDs, testID)
+	}
+
+	n := 0
+	for i, status := range test.Statuses {
+		if status == testgrid.TestStatusNoResult {
+			continue
+		}
+		buildID := state.buildIDs[i]
+		n++
+
+		err = tx.UpsertTestResult(buildID, testID, status)
+		if err != nil {
+			return err
+		}
+
+		if message, ok := test.Messages[i]; ok {
+			err = tx.SetTestResultMessage(buildID, testID, message)
+			if err != nil {
+				return err
+			}
+		}
+
+		if duration, ok := test.Durations[i]; ok {
+			err = tx.SetTestResultDuration(buildID, testID, duration)
+			if err != nil {
+				return err
+			}
+			if test.Name == "Overall" {
+				err = tx.SetBuildDuration(buildID, duration)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	bw.counter.Incr(int64(n))
+	indexedTestResults.Add(int64(n))
+	return nil
+}
+
+// finish sets the statuses of the new builds. Builds that are still running
+// are removed, they are indexed when they are finished.
+func (bw *buildWriter) finish(state *jobState, part jobPart) error {
+	tx := bw.tx
+	for i, build := range part.Builds {
+		buildID := state.buildIDs[i]
+		if build.Result == "" && build.Running {
+			if state.inserted[i] {
+				if err := tx.DeleteBuild(buildID); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if state.inserted[i] {
+			status, failure := buildStatus(build)
+			if err := tx.SetBuildStatus(buildID, status, failure); err != nil {
+				return err
+			}
+		}
+
+		if bw.staleColumns > 0 {
+			if err := tx.SetStaleTests(buildID, state.staleIDs); err != nil {
+				return err
+			}
+		}
+		indexedBuilds.Add(1)
+	}
+	return nil
+}
+
+// abort removes the builds that the job has added, so that partially written
+// builds don't get into statistics.
+func (bw *buildWriter) abort(state *jobState) error {
+	for i, buildID := range state.buildIDs {
+		if !state.inserted[i] {
+			continue
+		}
+		if err := bw.tx.DeleteBuild(buildID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unpackTest returns the results of the test in the builds and adds them to
+// the statuses of the builds.
+func unpackTest(results *testgrid.JobResults, test *testgrid.Test, builds []build, staleColumns int) *testResults {
+	t := &testResults{
+		Name:      test.Name,
+		Statuses:  make([]testgrid.TestStatus, len(builds)),
+		Durations: make(map[int]float64),
+		Messages:  make(map[int]string),
+		Stale:     isStale(results, test, staleColumns),
+	}
+	install := isInstallTest(test.Name)
+	for cols := results.TestColumns(test); cols.Next(); {
+		i := cols.Index()
+		status := cols.Status(0)
+		if status == testgrid.TestStatusNoResult {
+			continue
+		}
+		t.Statuses[i] = status
+
+		b := &builds[i]
+		if test.Name == "Overall" {
+			b.Overall = status
+		}
+		if status == testgrid.TestStatusRunning {
+			b.Running = true
+		}
+		if c := status.Category(); c == testgrid.CategoryFail || c == testgrid.CategoryFlake {
+			if install && c == testgrid.CategoryFail {
+				b.InstallFailed = true
+			}
+			if msg := cols.Message(0); msg != "" {
+				t.Messages[i] = msg
+			}
+		}
+		if minutes, ok := cols.Metric(0, testgrid.MetricTestDuration); ok {
+			t.Durations[i] = minutes * 60
+		}
+	}
+	return t
+}
+
+func (opts *IndexerOptions) trackers() ([]bugs.Tracker, error) {
+	var trackers []bugs.Tracker
+	if opts.bugzillaURL != "" {
+		trackers = append(trackers, &bugs.Bugzilla{URL: opts.bugzillaURL})
+	}
+	if opts.jiraURL != "" {
+		jira := &bugs.Jira{URL: opts.jiraURL}
+		if opts.jiraTokenFile != "" {
+			token, err := ioutil.ReadFile(opts.jiraTokenFile)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read jira token: %w", err)
+			}
+			jira.Token = strings.TrimSpace(string(token))
+		}
+		trackers = append(trackers, jira)
+	}
+	return trackers, nil
+}
+
+func (opts *IndexerOptions) testgridClient() (testgrid.Interface, error) {
+	if opts.testgridFixtures != "" {
+		return testgrid.NewFakeFromDir(opts.testgridFixtures)
+	}
+
+	tgOpts := opts.testgridOpts
+	tgOpts.UserAgent = "ci-results/" + version.Version
+	tg, err := testgrid.NewClient(tgOpts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.testgridState != "" {
+		tg.StateURL, err = testgrid.ParseURL(opts.testgridState)
+		if err != nil {
+			return nil, fmt.Errorf("invalid testgrid state url: %w", err)
+		}
+	}
+	return tg, nil
+}
+
+// resolveDashboards returns the dashboards from --dashboards followed by the
+// dashboards from --dashboard-groups and the discovered dashboards that match
+// --dashboard-regexp.
+func (opts *IndexerOptions) resolveDashboards(tg testgrid.Interface) ([]string, error) {
+	var dashboards []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			dashboards = append(dashboards, name)
+		}
+	}
+
+	for _, d := range opts.dashboards {
+		add(d)
+	}
+
+	for _, group := range opts.dashboardGroups {
+		list, err := tg.GetDashboardGroup(group)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get dashboard group %s: %w", group, err)
+		}
+		for _, d := range list {
+			add(d.Name)
+		}
+	}
+
+	if opts.dashboardRegexp != "" {
+		re, err := regexp.Compile(opts.dashboardRegexp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dashboard regexp: %w", err)
+		}
+		list, err := tg.ListDashboards()
+		if err != nil {
+			return nil, fmt.Errorf("unable to list dashboards: %w", err)
+		}
+		for _, d := range list {
+			if re.MatchString(d.Name) {
+				add(d.Name)
+			}
+		}
+	}
+
+	klog.V(1).Infof("indexing %d dashboards", len(dashboards))
+	return dashboards, nil
+}
+
+type uploader interface {
+	Upload(ctx context.Context, u string, contentType string, body io.Reader) error
+}
+
+// snapshotUploader returns the client for the location of --snapshot-upload.
+func (opts *IndexerOptions) snapshotUploader() (uploader, error) {
+	switch {
+	case strings.HasPrefix(opts.snapshotUpload, "gs://"):
+		_, _, err := gcs.ParseURL(opts.snapshotUpload)
+		return &opts.gcs, err
+	case strings.HasPrefix(opts.snapshotUpload, "s3://"):
+		_, _, err := s3.ParseURL(opts.snapshotUpload)
+		return &opts.s3, err
+	}
+	return nil, fmt.Errorf("unsupported location %q: expected gs://bucket/path or s3://bucket/path", opts.snapshotUpload)
+}
+
+// uploadSnapshot uploads a consistent copy of the database to GCS or S3. The
+// copy is made next to the database, as it can be too big for the temporary
+// directory.
+func (opts *IndexerOptions) uploadSnapshot(ctx context.Context, db *database.DB) error {
+	storage, err := opts.snapshotUploader()
+	if err != nil {
+		return err
+	}
+
+	dir, err := ioutil.TempDir(filepath.Dir(database.DSNPath(database.DefaultDSN)), ".snapshot-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	klog.Info("Taking a snapshot of the database...")
+	path := filepath.Join(dir, "results.db")
+	if err := db.Snapshot(ctx, path); err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := storage.Upload(ctx, opts.snapshotUpload, "application/vnd.sqlite3", f); err != nil {
+		return err
+	}
+	klog.Infof("Uploaded the snapshot to %s", opts.snapshotUpload)
+	return nil
 }
 
 func (opts *IndexerOptions) Run(ctx context.Context) (err error) {
+	if opts.snapshotUpload != "" {
+		if _, err := opts.snapshotUploader(); err != nil {
+			return fmt.Errorf("--snapshot-upload: %w", err)
+		}
+	}
+
 	db, err := database.OpenDefault()
 	if err != nil {
 		return fmt.Errorf("unable to open database: %w", err)
@@ -256,47 +836,150 @@ func (opts *IndexerOptions) Run(ctx context.Context) (err error) {
 		}
 	}()
 
+	// The snapshot is taken after the run is recorded, so it includes the
+	// record.
+	defer func() {
+		if err != nil || opts.snapshotUpload == "" {
+			return
+		}
+		if uploadErr := opts.uploadSnapshot(ctx, db); uploadErr != nil {
+			err = fmt.Errorf("unable to upload the database snapshot: %w", uploadErr)
+		}
+	}()
+
+	runID, err := db.StartIndexRun(version.Version)
+	if err != nil {
+		return fmt.Errorf("unable to record the index run: %w", err)
+	}
+	var runErrs runErrors
+	defer func() {
+		status := database.IndexRunSucceeded
+		errs := runErrs.list()
+		if err != nil {
+			status = database.IndexRunFailed
+			errs = append(errs, database.IndexRunError{Error: err.Error()})
+		} else if len(errs) > 0 {
+			status = database.IndexRunPartial
+			klog.Warningf("Index run %d skipped %d dashboards, jobs or builds, see /api/index-runs/%d/errors", runID, len(errs), runID)
+		}
+		if finishErr := db.FinishIndexRun(runID, status, errs); finishErr != nil && err == nil {
+			err = fmt.Errorf("unable to record the index run: %w", finishErr)
+		}
+	}()
+
+	if opts.artifactsURL != "" {
+		opts.artifacts = artifacts.NewClient(opts.artifactsURL)
+	}
+
+	if opts.diagnosticsAddr != "" {
+		diagnostics.ListenAndServe(opts.diagnosticsAddr)
+	}
+
+	// Renames are applied before results are stored, so new results get the
+	// new names.
+	if opts.renamesFile != "" {
+		r, err := renames.Load(opts.renamesFile)
+		if err != nil {
+			return fmt.Errorf("unable to load test renames: %w", err)
+		}
+		if err := renames.Apply(db, r); err != nil {
+			return fmt.Errorf("unable to update test renames: %w", err)
+		}
+	}
+
+	if opts.preloadTestsMiB > 0 {
+		if _, err := db.PreloadTests(opts.preloadTestsMiB << 20); err != nil {
+			return fmt.Errorf("unable to preload tests: %w", err)
+		}
+	}
+
+	tg, err := opts.testgridClient()
+	if err != nil {
+		return err
+	}
+
+	dashboards, err := opts.resolveDashboards(tg)
+	if err != nil {
+		return err
+	}
+
 	var w workers
 	jobsCh := make(chan job, 100)
-	buildsCh := make(chan build, 1000)
+	partsCh := make(chan jobPart, 1000)
+
+	var tagRules []TagRule
+	for _, r := range opts.tagRules {
+		rule, err := ParseTagRule(r)
+		if err != nil {
+			return err
+		}
+		tagRules = append(tagRules, rule)
+	}
+
+	variants := sippy.DefaultVariants
+	if opts.variantsFile != "" {
+		variants, err = sippy.LoadVariants(opts.variantsFile)
+		if err != nil {
+			return fmt.Errorf("unable to load variants: %w", err)
+		}
+	}
+
+	var jobOwners *owners.Owners
+	if opts.ownersFile != "" {
+		jobOwners, err = owners.Load(opts.ownersFile)
+		if err != nil {
+			return fmt.Errorf("unable to load owners: %w", err)
+		}
+	}
 
 	tagger := ciinfo.NewTagger()
-	for _, variant := range []string{
-		"ci-4.8",
-		"ci-4.8-upgrade-from-stable-4.7",
-		"ci-4.8-upgrade-from-from-stable-4.7-from-stable-4.6",
-		"nightly-4.8",
-		"nightly-4.8-upgrade-from-stable-4.7",
-		"ci-4.9",
-		"ci-4.9-upgrade-from-stable-4.8",
-		"ci-4.9-upgrade-from-stable-4.8-from-stable-4.7",
-		"nightly-4.9",
-		"nightly-4.9-upgrade-from-stable-4.8",
-		"nightly-4.9-upgrade-from-stable-4.7",
-	} {
-		cfg, err := ciinfo.DownloadConfig("openshift", "release", "master", variant)
+	if opts.ciinfoResolver.ReleaseRepo != "" {
+		tagger.Registry, err = ciinfo.LoadRegistry(filepath.Join(opts.ciinfoResolver.ReleaseRepo, "ci-operator", "step-registry"))
+		if err != nil {
+			return fmt.Errorf("unable to load step registry: %w", err)
+		}
+	}
+	for _, variant := range opts.releaseConfigs {
+		cfg, err := opts.ciinfoResolver.DownloadConfig("openshift", "release", "master", variant)
 		if err != nil {
 			klog.Fatal(err)
 		}
 		tagger.AddConfig(cfg)
 	}
+	if opts.ciinfoResolver.ReleaseRepo != "" {
+		configs, err := opts.ciinfoResolver.DownloadAll(opts.configOrg, opts.configRepos, opts.configBranches)
+		if err != nil {
+			return err
+		}
+		for _, cfg := range configs {
+			tagger.AddConfig(cfg)
+		}
+	}
+
+	lastBuilds, err := db.LastBuildTimestamps()
+	if err != nil {
+		return err
+	}
 
+	summaries := make(map[string]testgrid.JobSummary)
 	w.spawn(1, func() error {
-		for _, dashboard := range []string{
-			"redhat-openshift-ocp-release-4.8-blocking",
-			"redhat-openshift-ocp-release-4.8-informing",
-			"redhat-openshift-ocp-release-4.9-blocking",
-			"redhat-openshift-ocp-release-4.9-informing",
-		} {
-			summary, err := testgrid.GetDashboardSummary(dashboard)
+		for _, dashboard := range dashboards {
+			summary, err := tg.GetDashboardSummary(dashboard)
 			if err != nil {
-				return err
+				runErrs.add(database.IndexRunError{Dashboard: dashboard}, err)
+				continue
 			}
 
-			for jobName := range summary {
+			for jobName, jobSummary := range summary {
+				summaries[jobName] = jobSummary
+				if last, ok := lastBuilds[jobName]; opts.skipUnchanged && ok && jobSummary.LastRunTimestamp != 0 && last >= jobSummary.LastRun() {
+					klog.V(2).Infof("skipping unchanged job %s", jobName)
+					continue
+				}
 				jobsCh <- job{
-					Dashboard: dashboard,
-					Name:      jobName,
+					Dashboard:   dashboard,
+					Name:        jobName,
+					LatestGreen: jobSummary.LatestGreen,
 				}
 			}
 		}
@@ -308,32 +991,54 @@ func (opts *IndexerOptions) Run(ctx context.Context) (err error) {
 
 	w.spawn(5, func() error {
 		for job := range jobsCh {
-			packedResults, err := testgrid.GetJobResults(job.Dashboard, job.Name)
-			if err != nil {
-				return err
+			columns := 0
+			if _, ok := lastBuilds[job.Name]; ok {
+				columns = opts.incrementalCols
 			}
-			results := unpackJobResults(packedResults)
-			for i, id := range results.Changelists {
-				build := build{
-					JobDashboard: job.Dashboard,
-					JobName:      job.Name,
-					Number:       id,
-					Timestamp:    results.Timestamps[i],
-					Tests:        make(map[string]testgrid.TestStatus),
+			// Tests are sent to the writer as they are decoded, only the
+			// builds of the job are kept in memory.
+			var builds []build
+			started := false
+			start := func(results *testgrid.JobResults) {
+				if started {
+					return
 				}
-				for testName, statuses := range results.Tests {
-					status := statuses[i]
-					if status == testgrid.TestStatusNoResult {
-						continue
+				started = true
+				for i, number := range results.Changelists {
+					b := build{
+						Number:    number,
+						Timestamp: results.Timestamps[i],
 					}
-					build.Tests[testName] = status
+					b.Result = opts.buildResult(job, b, lastBuilds[job.Name])
+					builds = append(builds, b)
+				}
+				if len(builds) > 0 {
+					partsCh <- jobPart{Job: job, Builds: append([]build(nil), builds...)}
 				}
-				buildsCh <- build
+			}
+			results, err := tg.StreamJobResults(job.Dashboard, job.Name, columns, func(results *testgrid.JobResults, test *testgrid.Test) error {
+				start(results)
+				if len(builds) == 0 {
+					return nil
+				}
+				partsCh <- jobPart{Job: job, Test: unpackTest(results, test, builds, opts.staleColumns)}
+				return nil
+			})
+			if err != nil {
+				runErrs.add(database.IndexRunError{Dashboard: job.Dashboard, Job: job.Name}, err)
+				if len(builds) > 0 {
+					partsCh <- jobPart{Job: job, Done: true, Aborted: true}
+				}
+				continue
+			}
+			start(results)
+			if len(builds) > 0 {
+				partsCh <- jobPart{Job: job, Builds: builds, Done: true}
 			}
 		}
 		return nil
 	}, func() error {
-		close(buildsCh)
+		close(partsCh)
 		return nil
 	})
 
@@ -350,73 +1055,130 @@ func (opts *IndexerOptions) Run(ctx context.Context) (err error) {
 			return err
 		}
 		defer func() {
-			commitErr := tx.Commit()
-			if err == nil {
-				err = commitErr
+			if err != nil {
+				tx.Rollback()
+				return
 			}
+			err = tx.Commit()
 		}()
 
-		for build := range buildsCh {
-			running := false
-			for _, status := range build.Tests {
-				if status == testgrid.TestStatusRunning {
-					running = true
-					break
-				}
-			}
-			if running {
-				continue
-			}
-
-			buildStatus := 1 // Success
-			if build.Tests["Overall"] == testgrid.TestStatusFail {
-				buildStatus = 2
-			}
-
-			jobID, err := tx.FindJob(build.JobName)
-			if database.IsNotFound(err) {
-				jobID, err = tx.InsertJob(build.JobName, build.JobDashboard, jobTags(tagger, build.JobDashboard, build.JobName))
-				if err != nil {
-					return err
-				}
-			} else if err != nil {
-				return err
-			}
-
-			buildID, err := tx.UpsertBuild(jobID, build.Number, build.Timestamp, buildStatus)
-			if err != nil {
+		bw := &buildWriter{
+			tx:           tx,
+			tagger:       tagger,
+			variants:     variants,
+			tagRules:     tagRules,
+			staleColumns: opts.staleColumns,
+			counter:      counter,
+			runErrs:      &runErrs,
+			refreshed:    make(map[int64]bool),
+			jobs:         make(map[job]*jobState),
+		}
+		for part := range partsCh {
+			if err := bw.write(part); err != nil {
 				return err
 			}
-
-			for testName, status := range build.Tests {
-				testID, err := tx.UpsertTest(testName)
-				if err != nil {
-					return err
-				}
-
-				err = tx.UpsertTestResult(buildID, testID, status)
-				if err != nil {
-					return err
-				}
-				counter.Incr(1)
-			}
+		}
+		if bw.failed > 0 {
+			klog.Warningf("Skipped %d jobs that could not be indexed", bw.failed)
 		}
 		return nil
 	}, func() error {
 		return nil
 	})
 
-	return w.Done()
+	if err := w.Done(); err != nil {
+		return err
+	}
+
+	if err := updateNeverGreenTags(db, summaries); err != nil {
+		return err
+	}
+
+	if jobOwners != nil {
+		if err := owners.Apply(db, jobOwners); err != nil {
+			return fmt.Errorf("unable to update owners: %w", err)
+		}
+	}
+
+	if err := updateScores(db); err != nil {
+		return err
+	}
+
+	if opts.linkBugs {
+		trackers, err := opts.trackers()
+		if err != nil {
+			return err
+		}
+		if err := linkBugs(ctx, db, trackers, opts.linkBugsLimit); err != nil {
+			return fmt.Errorf("unable to link bugs: %w", err)
+		}
+	}
+
+	return nil
+}
+
+const neverGreenTag = "never-green"
+
+// updateNeverGreenTags adds the never-green tag to jobs that have not passed
+// on TestGrid and removes it from jobs that have.
+func updateNeverGreenTags(db *database.DB, summaries map[string]testgrid.JobSummary) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	for jobName, summary := range summaries {
+		if summary.NeverGreen() {
+			err = tx.AddJobTag(jobName, neverGreenTag, database.TagSourceCustom)
+		} else {
+			err = tx.RemoveJobTag(jobName, neverGreenTag, database.TagSourceCustom)
+		}
+		if err != nil && !database.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func updateScores(db *database.DB) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	klog.Info("Updating flakiness scores...")
+	return tx.UpdateFlakinessScores(time.Now())
 }
 
 func NewCmdIndexer() *cobra.Command {
-	opts := &IndexerOptions{}
+	opts := &IndexerOptions{
+		ciinfoResolver: ciinfo.NewResolver(),
+	}
 
 	cmd := &cobra.Command{
 		Use:   "indexer",
 		Short: "Gather data from TestGrid",
 		Long: heredoc.Doc(`
 			Collect test results from TestGrid and store them into the database.
+
+			Use --skip-unchanged to avoid fetching jobs that have no new runs since
+			the previous run of the indexer. This makes frequent runs cheaper, but
+			changes to the results of builds that are already indexed are picked up
+			only when the job has a new run.
 		`),
 		Args: cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
@@ -427,5 +1189,67 @@ func NewCmdIndexer() *cobra.Command {
 		},
 	}
 
+	cmd.Flags().StringSliceVar(&opts.dashboards, "dashboards", []string{
+		"redhat-openshift-ocp-release-4.8-blocking",
+		"redhat-openshift-ocp-release-4.8-informing",
+		"redhat-openshift-ocp-release-4.9-blocking",
+		"redhat-openshift-ocp-release-4.9-informing",
+	}, "TestGrid dashboards to collect jobs from.")
+	cmd.Flags().BoolVar(&opts.skipUnchanged, "skip-unchanged", false, "Skip jobs that have no runs after the latest indexed build. Results that TestGrid updates for builds that are already indexed are not collected for the skipped jobs.")
+	cmd.Flags().StringSliceVar(&opts.dashboardGroups, "dashboard-groups", nil, "TestGrid dashboard groups to collect jobs from all their dashboards.")
+	cmd.Flags().IntVar(&opts.incrementalCols, "incremental-columns", 0, "Fetch only this many recent columns for jobs that are already indexed, 0 to fetch all columns.")
+	cmd.Flags().IntVar(&opts.staleColumns, "stale-columns", 0, "Mark results of tests that have no results in this many recent columns as stale, stale results are excluded from statistics.")
+	cmd.Flags().BoolVar(&opts.testgridOpts.HideStaleTests, "hide-stale-tests", false, "Don't collect tests that TestGrid considers stale.")
+	cmd.Flags().StringVar(&opts.dashboardRegexp, "dashboard-regexp", "", "Also collect jobs from all TestGrid dashboards with matching names.")
+	cmd.Flags().StringVar(&opts.testgridOpts.BaseURL, "testgrid-url", testgrid.DefaultURL, "Base URL of the TestGrid instance.")
+	cmd.Flags().StringVar(&opts.testgridOpts.Proxy, "testgrid-proxy", "", "Proxy URL for TestGrid requests, by default the proxy is taken from the environment.")
+	cmd.Flags().DurationVar(&opts.testgridOpts.Timeout, "testgrid-timeout", 2*time.Minute, "Timeout for a single TestGrid request.")
+	cmd.Flags().IntVar(&opts.testgridOpts.Retries, "testgrid-retries", 3, "Number of retries for failed TestGrid requests.")
+	cmd.Flags().DurationVar(&opts.testgridOpts.RetryWait, "testgrid-retry-wait", 5*time.Second, "Delay before the first retry of a TestGrid request, doubled after each retry.")
+	cmd.Flags().StringVar(&opts.testgridOpts.CacheDir, "testgrid-cache-dir", "", "Directory to cache TestGrid responses in, responses are revalidated using ETags.")
+	cmd.Flags().DurationVar(&opts.testgridOpts.CacheTTL, "testgrid-cache-ttl", 0, "Use cached TestGrid responses without revalidation if they are younger than this.")
+	cmd.Flags().StringVar(&opts.artifactsURL, "artifacts-url", "", "Location of job artifacts (e.g. "+artifacts.DefaultURL+") to read results of new builds from their finished.json, by default results are taken from the Overall test.")
+	cmd.Flags().StringVar(&opts.testgridFixtures, "testgrid-fixtures", "", "Directory with TestGrid responses to use instead of TestGrid, for development.")
+	cmd.Flags().StringVar(&opts.testgridState, "testgrid-state-url", "", "Location of TestGrid grid states (e.g. https://storage.googleapis.com/k8s-testgrid/tabs), if set, grids are downloaded in the protobuf format.")
+	cmd.Flags().StringSliceVar(&opts.releaseConfigs, "release-configs", []string{
+		"ci-4.8",
+		"ci-4.8-upgrade-from-stable-4.7",
+		"ci-4.8-upgrade-from-from-stable-4.7-from-stable-4.6",
+		"nightly-4.8",
+		"nightly-4.8-upgrade-from-stable-4.7",
+		"ci-4.9",
+		"ci-4.9-upgrade-from-stable-4.8",
+		"ci-4.9-upgrade-from-stable-4.8-from-stable-4.7",
+		"nightly-4.9",
+		"nightly-4.9-upgrade-from-stable-4.8",
+		"nightly-4.9-upgrade-from-stable-4.7",
+	}, "Variants of openshift/release configs to get job steps from.")
+	cmd.Flags().StringVar(&opts.ciinfoResolver.URL, "configresolver-url", opts.ciinfoResolver.URL, "URL of the configresolver to get ci-operator configs from.")
+	cmd.Flags().StringVar(&opts.ciinfoResolver.CacheDir, "configresolver-cache-dir", "", "Directory to cache ci-operator configs in.")
+	cmd.Flags().DurationVar(&opts.ciinfoResolver.CacheTTL, "configresolver-cache-ttl", 24*time.Hour, "Use cached ci-operator configs without asking the configresolver if they are younger than this.")
+	cmd.Flags().StringVar(&opts.ciinfoResolver.ReleaseRepo, "release-repo", "", "Checkout of openshift/release to get the list of ci-operator configs and the step registry from, all matching configs are downloaded.")
+	cmd.Flags().BoolVar(&opts.ciinfoResolver.Local, "release-repo-local", false, "Read ci-operator configs from the checkout given by --release-repo instead of the configresolver.")
+	cmd.Flags().StringVar(&opts.configOrg, "release-repo-org", "openshift", "Organization whose configs are downloaded when --release-repo is set.")
+	cmd.Flags().StringSliceVar(&opts.configRepos, "release-repo-repos", []string{"*"}, "Patterns of repositories whose configs are downloaded when --release-repo is set.")
+	cmd.Flags().StringSliceVar(&opts.configBranches, "release-repo-branches", []string{"master", "main", "release-4.8", "release-4.9"}, "Patterns of branches whose configs are downloaded when --release-repo is set.")
+	cmd.Flags().BoolVar(&opts.ciinfoResolver.Offline, "configresolver-offline", false, "Use only cached ci-operator configs, requires --configresolver-cache-dir.")
+	cmd.Flags().StringVar(&opts.variantsFile, "variants", "", "YAML file with Sippy variant definitions to use instead of the built-in ones.")
+	cmd.Flags().StringVar(&opts.ownersFile, "owners", "", "YAML file that maps job names to teams, jobs get the owner.TEAM tag.")
+	cmd.Flags().StringVar(&opts.renamesFile, "test-renames", "", "YAML file that maps old test names to new ones, results of the old names are stored and reported under the new names.")
+	cmd.Flags().StringVar(&opts.snapshotUpload, "snapshot-upload", "", "GCS or S3 location (gs://bucket/path or s3://bucket/path) to upload a snapshot of the database to after each successful run, for servers started with --snapshot-download.")
+	cmd.Flags().StringVar(&opts.gcs.CredentialsFile, "gcs-credentials", "", "JSON key file of a service account to access GCS, the metadata server is used by default.")
+	cmd.Flags().StringVar(&opts.gcs.URL, "gcs-url", gcs.DefaultURL, "Base URL of the GCS API.")
+	cmd.Flags().StringVar(&opts.s3.CredentialsFile, "s3-credentials", "", "AWS shared credentials file to access S3, the profile is taken from AWS_PROFILE. By default the credentials are taken from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.")
+	cmd.Flags().StringVar(&opts.s3.Region, "s3-region", "", "Region of the S3 bucket, AWS_REGION or "+s3.DefaultRegion+" by default.")
+	cmd.Flags().StringVar(&opts.s3.URL, "s3-url", "", "Endpoint of an S3-compatible storage, e.g. MinIO, by default the AWS endpoint of the region is used.")
+	cmd.Flags().StringVar(&opts.diagnosticsAddr, "diagnostics-listen", "", "Address to serve pprof profiles and expvar variables on while indexing, e.g. localhost:6060.")
+	cmd.Flags().Int64Var(&opts.preloadTestsMiB, "preload-tests-memory", 0, "Load ids of all tests into memory before indexing if they fit into this many MiB, 0 to disable.")
+	cmd.Flags().StringArrayVar(&opts.tagRules, "tag-rule", nil, "Rule in the form REGEXP=TAG to add TAG to new jobs with matching names.")
+	cmd.Flags().BoolVar(&opts.linkBugs, "link-bugs", opts.linkBugs, "Search bug trackers for the most failing tests.")
+	cmd.Flags().IntVar(&opts.linkBugsLimit, "link-bugs-limit", 100, "Number of the most failing tests to search bugs for.")
+	cmd.Flags().StringVar(&opts.bugzillaURL, "bugzilla-url", "https://bugzilla.redhat.com", "Bugzilla to search bugs in, empty to disable.")
+	cmd.Flags().StringVar(&opts.jiraURL, "jira-url", "https://issues.redhat.com", "Jira to search issues in, empty to disable.")
+	cmd.Flags().StringVar(&opts.jiraTokenFile, "jira-token-file", "", "File with a personal access token for Jira.")
+
 	return cmd
 }
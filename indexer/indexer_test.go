@@ -0,0 +1,176 @@
+package indexer
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dmage/ci-results/ciinfo"
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/database/databasetest"
+	"github.com/dmage/ci-results/sippy"
+	"github.com/dmage/ci-results/testgrid"
+	"github.com/paulbellamy/ratecounter"
+)
+
+func TestRunWithFixtures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.db")
+	defaultDSN := database.DefaultDSN
+	database.DefaultDSN = path + "?_journal_mode=WAL"
+	t.Cleanup(func() {
+		database.DefaultDSN = defaultDSN
+	})
+
+	opts := &IndexerOptions{
+		dashboards:       []string{"redhat-openshift-ocp-release-4.9-informing"},
+		skipUnchanged:    true,
+		ciinfoResolver:   ciinfo.NewResolver(),
+		testgridFixtures: "testdata/testgrid",
+	}
+	// The second run skips the unchanged job and must not change the results.
+	for i := 0; i < 2; i++ {
+		if err := opts.Run(context.Background()); err != nil {
+			t.Fatalf("run %d: %v", i+1, err)
+		}
+	}
+
+	db, err := database.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	const jobName = "periodic-ci-openshift-release-master-nightly-4.9-e2e-aws"
+	testCases := []struct {
+		name     string
+		filter   string
+		testName string
+		want     map[string]database.StatsValues
+	}{
+		{
+			name:   "builds",
+			filter: "aws 4.9",
+			want: map[string]database.StatsValues{
+				jobName: {Pass: 2, Fail: 1, FailTests: 1},
+			},
+		},
+		{
+			name:   "excluded by filter",
+			filter: "-aws",
+			want:   map[string]database.StatsValues{},
+		},
+		{
+			name:     "failed test",
+			testName: "[sig-network] Services should serve endpoints",
+			want: map[string]database.StatsValues{
+				jobName: {Pass: 2, Fail: 1},
+			},
+		},
+		{
+			name:     "flaky test",
+			testName: "[sig-storage] Volumes should mount",
+			want: map[string]database.StatsValues{
+				jobName: {Pass: 2, Flake: 1},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stats, err := db.BuildStats("name", tc.filter, "100000", tc.testName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]database.StatsValues{}
+			for _, row := range stats.Data {
+				got[row.Columns[0]] = row.Values[0]
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %d rows %+v, want %+v", len(got), got, tc.want)
+			}
+			for name, want := range tc.want {
+				if got[name] != want {
+					t.Errorf("%s: got %+v, want %+v", name, got[name], want)
+				}
+			}
+		})
+	}
+
+	failures, err := db.RecentTestFailures("[sig-network] Services should serve endpoints", "", 100000, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 1 || failures[0].Build != "1002" || failures[0].Message != "timed out waiting for endpoints" {
+		t.Errorf("got failures %+v, want the failure of build 1002 with its message", failures)
+	}
+}
+
+// TestBuildWriterRemovesUnfinishedBuilds checks that builds are not left in
+// the database when the results of their job cannot be read to the end or
+// when they are still running.
+func TestBuildWriterRemovesUnfinishedBuilds(t *testing.T) {
+	db := databasetest.Open(t)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	bw := &buildWriter{
+		tx:        tx,
+		tagger:    ciinfo.NewTagger(),
+		variants:  sippy.DefaultVariants,
+		counter:   ratecounter.NewRateCounter(time.Second),
+		runErrs:   &runErrors{},
+		refreshed: make(map[int64]bool),
+		jobs:      make(map[job]*jobState),
+	}
+
+	aborted := job{Dashboard: "dashboard", Name: "job-aborted"}
+	running := job{Dashboard: "dashboard", Name: "job-running"}
+	builds := []build{{Number: "2", Timestamp: 2000}, {Number: "1", Timestamp: 1000}}
+	parts := []jobPart{
+		{Job: aborted, Builds: builds},
+		{Job: running, Builds: builds},
+		{Job: aborted, Test: &testResults{Name: "Overall", Statuses: []testgrid.TestStatus{testgrid.TestStatusPass, testgrid.TestStatusPass}}},
+		{Job: running, Test: &testResults{Name: "Overall", Statuses: []testgrid.TestStatus{testgrid.TestStatusRunning, testgrid.TestStatusFail}}},
+		{Job: aborted, Done: true, Aborted: true},
+		{Job: running, Done: true, Builds: []build{
+			{Number: "2", Timestamp: 2000, Overall: testgrid.TestStatusRunning, Running: true},
+			{Number: "1", Timestamp: 1000, Overall: testgrid.TestStatusFail},
+		}},
+	}
+	for _, part := range parts {
+		if err := bw.write(part); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(bw.jobs) != 0 {
+		t.Errorf("got %d jobs in progress, want none", len(bw.jobs))
+	}
+
+	testCases := []struct {
+		job    job
+		number string
+		want   bool
+	}{
+		{job: aborted, number: "2", want: false},
+		{job: aborted, number: "1", want: false},
+		{job: running, number: "2", want: false},
+		{job: running, number: "1", want: true},
+	}
+	for _, tc := range testCases {
+		jobID, err := tx.FindJob(tc.job.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// InsertBuild reports whether the build was missing.
+		_, inserted, err := tx.InsertBuild(jobID, tc.number, 0, 1, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists := !inserted; exists != tc.want {
+			t.Errorf("build %s of %s: got exists=%t, want %t", tc.number, tc.job.Name, exists, tc.want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package issues
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const DefaultGitHubURL = "https://api.github.com"
+
+// GitHub files issues in a GitHub repository.
+type GitHub struct {
+	// URL is the base URL of the GitHub API.
+	URL string
+	// Repo is the repository in the owner/name form.
+	Repo   string
+	Token  string
+	Labels []string
+}
+
+func (g *GitHub) Name() string {
+	return "github"
+}
+
+type githubIssue struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	State   string `json:"state"`
+}
+
+func (i githubIssue) issue() *Issue {
+	return &Issue{
+		Key:  strconv.Itoa(i.Number),
+		URL:  i.HTMLURL,
+		Open: i.State == "open",
+	}
+}
+
+func (g *GitHub) do(ctx context.Context, method string, path string, in interface{}, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	u := strings.TrimSuffix(g.URL, "/") + "/repos/" + g.Repo + path
+	req, err := http.NewRequestWithContext(ctx, method, u, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("got unexpected http response from %s %s: %s", method, u, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (g *GitHub) Get(ctx context.Context, key string) (*Issue, error) {
+	var issue githubIssue
+	if err := g.do(ctx, "GET", "/issues/"+key, nil, &issue); err != nil {
+		return nil, err
+	}
+	return issue.issue(), nil
+}
+
+func (g *GitHub) Create(ctx context.Context, title string, body string) (*Issue, error) {
+	labels := g.Labels
+	if labels == nil {
+		labels = []string{}
+	}
+	in := map[string]interface{}{
+		"title":  title,
+		"body":   body,
+		"labels": labels,
+	}
+	var issue githubIssue
+	if err := g.do(ctx, "POST", "/issues", in, &issue); err != nil {
+		return nil, err
+	}
+	return issue.issue(), nil
+}
+
+func (g *GitHub) Comment(ctx context.Context, key string, body string) error {
+	return g.do(ctx, "POST", "/issues/"+key+"/comments", map[string]string{"body": body}, nil)
+}
+
+// Render formats the description in Markdown.
+func (g *GitHub) Render(d *Description) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "The pass rate of `%s` has been below its %d-day baseline for %d days in a row.\n\n", d.Test, d.BaselineDays, len(d.Days))
+	fmt.Fprintf(&b, "| Day | Pass rate | Runs | Failures |\n|---|---|---|---|\n")
+	for _, day := range d.Days {
+		v := day.Stats
+		fmt.Fprintf(&b, "| %s | %s | %d | %d |\n", day.Day, formatRate(v), v.Pass+v.Flake+v.Fail, v.Fail)
+	}
+	v := d.Baseline
+	fmt.Fprintf(&b, "| baseline | %s | %d | %d |\n", formatRate(v), v.Pass+v.Flake+v.Fail, v.Fail)
+	if len(d.Variants) > 0 {
+		fmt.Fprintf(&b, "\nAffected variants: %s\n", strings.Join(d.Variants, ", "))
+	}
+	if len(d.Jobs) > 0 {
+		fmt.Fprintf(&b, "\nFailing jobs:\n")
+		for _, job := range d.Jobs {
+			fmt.Fprintf(&b, "- [%s](%s): %d of %d runs failed\n", job.Name, job.URL, job.Failures, job.Runs)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,412 @@
+package issues
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/completion"
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/output"
+	"github.com/dmage/ci-results/testgrid"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+// Issue is an issue in a tracker.
+type Issue struct {
+	Key  string
+	URL  string
+	Open bool
+}
+
+// Tracker is an issue tracker in which regressions are filed.
+type Tracker interface {
+	Name() string
+	// Render formats the description in the markup of the tracker.
+	Render(d *Description) string
+	Get(ctx context.Context, key string) (*Issue, error)
+	Create(ctx context.Context, title string, body string) (*Issue, error)
+	Comment(ctx context.Context, key string, body string) error
+}
+
+// Reopener is implemented by trackers in which closed issues are reopened
+// when the test regresses again, instead of filing new issues.
+type Reopener interface {
+	Reopen(ctx context.Context, key string) error
+}
+
+// Actions that are taken for regressions.
+const (
+	ActionCreated  = "created"
+	ActionUpdated  = "updated"
+	ActionReopened = "reopened"
+	ActionSkipped  = "skipped"
+)
+
+type DayStats struct {
+	Day   string
+	Stats database.StatsValues
+}
+
+type FailingJob struct {
+	Name     string
+	URL      string
+	Runs     int
+	Failures int
+}
+
+// Description has the details of a regression that go into its issue.
+type Description struct {
+	Test         string
+	BaselineDays int
+	// Days are the regressed days, the latest day first.
+	Days     []DayStats
+	Baseline database.StatsValues
+	Variants []string
+	Jobs     []FailingJob
+}
+
+type Result struct {
+	Test    string `json:"test"`
+	Tracker string `json:"tracker"`
+	Action  string `json:"action"`
+	Issue   string `json:"issue,omitempty"`
+}
+
+type IssuesOptions struct {
+	filter         string
+	days           int
+	baselineDays   int
+	threshold      float64
+	minRuns        int
+	limit          int
+	updateInterval time.Duration
+	dryRun         bool
+	testgridURL    string
+	output         string
+
+	githubURL       string
+	githubRepo      string
+	githubTokenFile string
+	githubLabels    []string
+
+	jiraURL              string
+	jiraProject          string
+	jiraIssueType        string
+	jiraTokenFile        string
+	jiraLabels           []string
+	jiraReopenTransition string
+	jiraUpdateInterval   time.Duration
+
+	out io.Writer
+}
+
+func readToken(filename string) (string, error) {
+	token, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+func (opts *IssuesOptions) trackers() ([]Tracker, error) {
+	var trackers []Tracker
+	if opts.githubRepo != "" {
+		github := &GitHub{
+			URL:    opts.githubURL,
+			Repo:   opts.githubRepo,
+			Labels: opts.githubLabels,
+		}
+		if opts.githubTokenFile != "" {
+			token, err := readToken(opts.githubTokenFile)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read github token: %w", err)
+			}
+			github.Token = token
+		}
+		trackers = append(trackers, github)
+	}
+	if opts.jiraProject != "" {
+		jira := &Jira{
+			URL:              opts.jiraURL,
+			Project:          opts.jiraProject,
+			IssueType:        opts.jiraIssueType,
+			Labels:           opts.jiraLabels,
+			ReopenTransition: opts.jiraReopenTransition,
+		}
+		if opts.jiraTokenFile != "" {
+			token, err := readToken(opts.jiraTokenFile)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read jira token: %w", err)
+			}
+			jira.Token = token
+		}
+		trackers = append(trackers, jira)
+	}
+	if len(trackers) == 0 {
+		return nil, fmt.Errorf("no issue tracker is configured, use --github-repo or --jira-project")
+	}
+	return trackers, nil
+}
+
+// updateIntervalOf returns the minimal time between updates of an issue in
+// the tracker. Jira issues get weekly snapshots of the stats.
+func (opts *IssuesOptions) updateIntervalOf(tracker Tracker) time.Duration {
+	if _, ok := tracker.(*Jira); ok {
+		return opts.jiraUpdateInterval
+	}
+	return opts.updateInterval
+}
+
+func formatRate(v database.StatsValues) string {
+	total := v.Pass + v.Flake + v.Fail
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(v.Pass+v.Flake)/float64(total))
+}
+
+// describe collects daily stats of the regression and the variants and jobs
+// in which the test fails.
+func (opts *IssuesOptions) describe(db *database.DB, reg database.SustainedRegression) (*Description, error) {
+	popts := database.PeriodOptions{AlignDays: true}
+	variants, err := db.BuildStatsWith("sippytags", opts.filter, strconv.Itoa(opts.days), reg.Test, popts)
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := db.BuildStatsWith("dashboard,name", opts.filter, strconv.Itoa(opts.days), reg.Test, popts)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Description{
+		Test:         reg.Test,
+		BaselineDays: opts.baselineDays,
+		Baseline:     reg.Baseline,
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	for i, v := range reg.Days {
+		d.Days = append(d.Days, DayStats{
+			Day:   today.AddDate(0, 0, -i-1).Format("2006-01-02"),
+			Stats: v,
+		})
+	}
+	for _, row := range variants.Data {
+		if row.Values[0].Fail > 0 {
+			d.Variants = append(d.Variants, row.Columns[0])
+		}
+	}
+	sort.Strings(d.Variants)
+	for _, row := range jobs.Data {
+		v := row.Values[0]
+		if v.Fail == 0 {
+			continue
+		}
+		dashboard, job := row.Columns[0], row.Columns[1]
+		d.Jobs = append(d.Jobs, FailingJob{
+			Name:     job,
+			URL:      strings.TrimSuffix(opts.testgridURL, "/") + "/" + dashboard + "#" + job,
+			Runs:     v.Pass + v.Flake + v.Fail,
+			Failures: v.Fail,
+		})
+	}
+	sort.SliceStable(d.Jobs, func(i, j int) bool {
+		return d.Jobs[i].Failures > d.Jobs[j].Failures
+	})
+	return d, nil
+}
+
+// file creates an issue for the regression, or comments on the issue that
+// has been filed before. Issues are updated at most once per update
+// interval. If the previous issue is closed, it is reopened if the tracker
+// supports it, otherwise a new issue is created.
+func (opts *IssuesOptions) file(ctx context.Context, db *database.DB, tracker Tracker, reg database.SustainedRegression) (Result, error) {
+	result := Result{
+		Test:    reg.Test,
+		Tracker: tracker.Name(),
+	}
+
+	issue, err := db.TestIssue(reg.Test, tracker.Name())
+	if err != nil && !database.IsNotFound(err) {
+		return result, err
+	}
+	if issue != nil {
+		result.Issue = issue.URL
+		if time.Since(time.Unix(0, issue.Updated*int64(time.Millisecond))) < opts.updateIntervalOf(tracker) {
+			result.Action = ActionSkipped
+			return result, nil
+		}
+	}
+
+	d, err := opts.describe(db, reg)
+	if err != nil {
+		return result, err
+	}
+	body := tracker.Render(d)
+
+	if issue != nil {
+		if opts.dryRun {
+			result.Action = ActionUpdated
+			return result, nil
+		}
+		current, err := tracker.Get(ctx, issue.Key)
+		if err != nil {
+			return result, err
+		}
+		if current.Open {
+			if err := tracker.Comment(ctx, issue.Key, body); err != nil {
+				return result, err
+			}
+			result.Action = ActionUpdated
+			return result, db.TouchTestIssue(reg.Test, tracker.Name())
+		}
+		if reopener, ok := tracker.(Reopener); ok {
+			if err := reopener.Reopen(ctx, issue.Key); err != nil {
+				return result, err
+			}
+			if err := tracker.Comment(ctx, issue.Key, body); err != nil {
+				return result, err
+			}
+			result.Action = ActionReopened
+			return result, db.TouchTestIssue(reg.Test, tracker.Name())
+		}
+		klog.V(2).Infof("The issue %s for %s is closed, filing a new one", issue.URL, reg.Test)
+	}
+
+	result.Action = ActionCreated
+	result.Issue = ""
+	if opts.dryRun {
+		return result, nil
+	}
+	created, err := tracker.Create(ctx, "Sustained regression: "+reg.Test, body)
+	if err != nil {
+		return result, err
+	}
+	result.Issue = created.URL
+	return result, db.SetTestIssue(reg.Test, tracker.Name(), created.Key, created.URL)
+}
+
+func printResults(out io.Writer, results []Result) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "TRACKER\tACTION\tTEST\tISSUE")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Tracker, r.Action, r.Test, r.Issue)
+	}
+	return w.Flush()
+}
+
+func (opts *IssuesOptions) Run(ctx context.Context) (err error) {
+	if err := output.Validate(opts.output); err != nil {
+		return err
+	}
+	if opts.days <= 0 || opts.baselineDays <= 0 {
+		return fmt.Errorf("--days and --baseline-days must be positive")
+	}
+	trackers, err := opts.trackers()
+	if err != nil {
+		return err
+	}
+
+	db, err := database.OpenDefault()
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer func() {
+		closeErr := db.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	regressions, err := db.SustainedRegressions(opts.filter, opts.days, opts.baselineDays, opts.threshold/100, opts.minRuns)
+	if err != nil {
+		return fmt.Errorf("unable to find regressions: %w", err)
+	}
+	if len(regressions) > opts.limit {
+		klog.Warningf("Found %d regressions, only %d of them are filed", len(regressions), opts.limit)
+		regressions = regressions[:opts.limit]
+	}
+
+	results := []Result{}
+	for _, reg := range regressions {
+		for _, tracker := range trackers {
+			result, err := opts.file(ctx, db, tracker, reg)
+			if err != nil {
+				return fmt.Errorf("unable to file a %s issue for %s: %w", tracker.Name(), reg.Test, err)
+			}
+			results = append(results, result)
+		}
+	}
+
+	return output.Print(opts.out, opts.output, results, func(out io.Writer) error {
+		return printResults(out, results)
+	})
+}
+
+func NewCmdIssues() *cobra.Command {
+	opts := &IssuesOptions{
+		out: os.Stdout,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "issues",
+		Short: "File issues for sustained regressions",
+		Long: heredoc.Doc(`
+			Find tests whose pass rate has been below their baseline for several
+			days in a row and file issues for them.
+
+			Issues are filed in GitHub and Jira. An issue is filed once per test
+			and tracker. While the regression lasts, the issue gets a comment with
+			the latest stats: daily for GitHub and weekly for Jira by default. If
+			the issue is closed and the test regresses again, the Jira issue is
+			reopened, and a new GitHub issue is filed.
+		`),
+		Example: heredoc.Doc(`
+			ci-results issues --filter=4.10 --github-repo=openshift/ci-regressions --github-token-file=token --dry-run
+			ci-results issues --days=3 --baseline-days=14 --threshold=10 --github-repo=openshift/ci-regressions --github-label=regression
+			ci-results issues --jira-project=TRT --jira-token-file=jira-token
+		`),
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.filter, "filter", "", "Space separated list of tags, tags prefixed with - are excluded.")
+	cmd.Flags().IntVar(&opts.days, "days", 3, "Number of consecutive days the test has to be regressed.")
+	cmd.Flags().IntVar(&opts.baselineDays, "baseline-days", 14, "Number of days before the regression that the pass rate is compared with.")
+	cmd.Flags().Float64Var(&opts.threshold, "threshold", 10, "Minimal drop of the daily pass rate below the baseline, in percentage points.")
+	cmd.Flags().IntVar(&opts.minRuns, "min-runs", 5, "Minimal number of runs per day and in the baseline.")
+	cmd.Flags().IntVar(&opts.limit, "limit", 10, "Maximum number of regressions to file issues for.")
+	cmd.Flags().DurationVar(&opts.updateInterval, "update-interval", 24*time.Hour, "Minimal time between updates of a GitHub issue.")
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "Show what would be filed without changing issues.")
+	cmd.Flags().StringVar(&opts.testgridURL, "testgrid-url", testgrid.DefaultURL, "TestGrid instance to link jobs to.")
+	cmd.Flags().StringVar(&opts.githubURL, "github-url", DefaultGitHubURL, "Base URL of the GitHub API.")
+	cmd.Flags().StringVar(&opts.githubRepo, "github-repo", "", "GitHub repository to file issues in, in the owner/name form.")
+	cmd.Flags().StringVar(&opts.githubTokenFile, "github-token-file", "", "File with a GitHub token that can create issues.")
+	cmd.Flags().StringSliceVar(&opts.githubLabels, "github-label", nil, "Labels for the new GitHub issues.")
+	cmd.Flags().StringVar(&opts.jiraURL, "jira-url", "https://issues.redhat.com", "Jira to file issues in.")
+	cmd.Flags().StringVar(&opts.jiraProject, "jira-project", "", "Key of the Jira project to file issues in.")
+	cmd.Flags().StringVar(&opts.jiraIssueType, "jira-issue-type", "Bug", "Type of the new Jira issues.")
+	cmd.Flags().StringVar(&opts.jiraTokenFile, "jira-token-file", "", "File with a personal access token for Jira.")
+	cmd.Flags().StringSliceVar(&opts.jiraLabels, "jira-label", nil, "Labels for the new Jira issues.")
+	cmd.Flags().StringVar(&opts.jiraReopenTransition, "jira-reopen-transition", "Reopen", "Name of the Jira transition that reopens closed issues.")
+	cmd.Flags().DurationVar(&opts.jiraUpdateInterval, "jira-update-interval", 7*24*time.Hour, "Minimal time between stats snapshots in a Jira issue.")
+	output.AddFlag(cmd, &opts.output)
+
+	completion.RegisterFilterFlag(cmd)
+
+	return cmd
+}
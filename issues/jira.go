@@ -0,0 +1,160 @@
+package issues
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Jira files issues in a Jira project.
+type Jira struct {
+	URL       string
+	Project   string
+	IssueType string
+	Token     string
+	Labels    []string
+	// ReopenTransition is the name of the transition that reopens closed
+	// issues.
+	ReopenTransition string
+}
+
+func (j *Jira) Name() string {
+	return "jira"
+}
+
+func (j *Jira) do(ctx context.Context, method string, path string, in interface{}, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	u := strings.TrimSuffix(j.URL, "/") + "/rest/api/2" + path
+	req, err := http.NewRequestWithContext(ctx, method, u, &body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if j.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+j.Token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("got unexpected http response from %s %s: %s", method, u, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (j *Jira) browseURL(key string) string {
+	return strings.TrimSuffix(j.URL, "/") + "/browse/" + key
+}
+
+func (j *Jira) Get(ctx context.Context, key string) (*Issue, error) {
+	var issue struct {
+		Fields struct {
+			Status struct {
+				StatusCategory struct {
+					Key string `json:"key"`
+				} `json:"statusCategory"`
+			} `json:"status"`
+		} `json:"fields"`
+	}
+	if err := j.do(ctx, "GET", "/issue/"+key+"?fields=status", nil, &issue); err != nil {
+		return nil, err
+	}
+	return &Issue{
+		Key:  key,
+		URL:  j.browseURL(key),
+		Open: issue.Fields.Status.StatusCategory.Key != "done",
+	}, nil
+}
+
+func (j *Jira) Create(ctx context.Context, title string, body string) (*Issue, error) {
+	labels := j.Labels
+	if labels == nil {
+		labels = []string{}
+	}
+	in := map[string]interface{}{
+		"fields": map[string]interface{}{
+			"project":     map[string]string{"key": j.Project},
+			"issuetype":   map[string]string{"name": j.IssueType},
+			"summary":     title,
+			"description": body,
+			"labels":      labels,
+		},
+	}
+	var created struct {
+		Key string `json:"key"`
+	}
+	if err := j.do(ctx, "POST", "/issue", in, &created); err != nil {
+		return nil, err
+	}
+	return &Issue{
+		Key:  created.Key,
+		URL:  j.browseURL(created.Key),
+		Open: true,
+	}, nil
+}
+
+func (j *Jira) Comment(ctx context.Context, key string, body string) error {
+	return j.do(ctx, "POST", "/issue/"+key+"/comment", map[string]string{"body": body}, nil)
+}
+
+// Reopen applies the reopen transition to the issue. Transitions are
+// configured per workflow, so the transition is looked up by its name.
+func (j *Jira) Reopen(ctx context.Context, key string) error {
+	var list struct {
+		Transitions []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"transitions"`
+	}
+	if err := j.do(ctx, "GET", "/issue/"+key+"/transitions", nil, &list); err != nil {
+		return err
+	}
+	for _, t := range list.Transitions {
+		if strings.EqualFold(t.Name, j.ReopenTransition) {
+			in := map[string]interface{}{
+				"transition": map[string]string{"id": t.ID},
+			}
+			return j.do(ctx, "POST", "/issue/"+key+"/transitions", in, nil)
+		}
+	}
+	return fmt.Errorf("issue %s has no transition %q", key, j.ReopenTransition)
+}
+
+// Render formats the description in the Jira wiki markup.
+func (j *Jira) Render(d *Description) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "The pass rate of {{%s}} has been below its %d-day baseline for %d days in a row.\n\n", d.Test, d.BaselineDays, len(d.Days))
+	fmt.Fprintf(&b, "||Day||Pass rate||Runs||Failures||\n")
+	for _, day := range d.Days {
+		v := day.Stats
+		fmt.Fprintf(&b, "|%s|%s|%d|%d|\n", day.Day, formatRate(v), v.Pass+v.Flake+v.Fail, v.Fail)
+	}
+	v := d.Baseline
+	fmt.Fprintf(&b, "|baseline|%s|%d|%d|\n", formatRate(v), v.Pass+v.Flake+v.Fail, v.Fail)
+	if len(d.Variants) > 0 {
+		fmt.Fprintf(&b, "\nAffected variants: %s\n", strings.Join(d.Variants, ", "))
+	}
+	if len(d.Jobs) > 0 {
+		fmt.Fprintf(&b, "\nFailing jobs:\n")
+		for _, job := range d.Jobs {
+			fmt.Fprintf(&b, "* [%s|%s]: %d of %d runs failed\n", job.Name, job.URL, job.Failures, job.Runs)
+		}
+	}
+	return b.String()
+}
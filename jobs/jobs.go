@@ -0,0 +1,119 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/client"
+	"github.com/dmage/ci-results/completion"
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/output"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+type ListOptions struct {
+	filter string
+	days   int
+	server string
+	output string
+
+	out io.Writer
+}
+
+func printTable(out io.Writer, days int, jobs []database.JobInfo) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "NAME\tTAGS\tLAST BUILD\tSTATUS\tPASS RATE (%dd)\n", days)
+	for _, job := range jobs {
+		lastBuild, passRate := "-", "-"
+		if job.LastBuild != nil {
+			lastBuild = time.Unix(*job.LastBuild/1000, 0).UTC().Format("2006-01-02 15:04")
+		}
+		if job.RecentPassRate != nil {
+			passRate = fmt.Sprintf("%.1f%% (%d)", 100*(*job.RecentPassRate), job.RecentBuilds)
+		}
+		status := job.LastBuildStatus
+		if status == "" {
+			status = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", job.Name, strings.Join(job.Tags, ","), lastBuild, status, passRate)
+	}
+	return w.Flush()
+}
+
+func (opts *ListOptions) listJobs(ctx context.Context) (jobs []database.JobInfo, err error) {
+	if opts.server != "" {
+		return client.New(opts.server).ListJobs(ctx, opts.filter, opts.days)
+	}
+
+	db, err := database.OpenDefault()
+	if err != nil {
+		return nil, fmt.Errorf("unable to open database: %w", err)
+	}
+	defer func() {
+		closeErr := db.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	return db.ListJobs(opts.filter, opts.days)
+}
+
+func (opts *ListOptions) Run(ctx context.Context) error {
+	jobs, err := opts.listJobs(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to list jobs: %w", err)
+	}
+
+	return output.Print(opts.out, opts.output, jobs, func(out io.Writer) error {
+		return printTable(out, opts.days, jobs)
+	})
+}
+
+func NewCmdList() *cobra.Command {
+	opts := &ListOptions{
+		out: os.Stdout,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List jobs with their tags and recent results",
+		Example: heredoc.Doc(`
+			ci-results jobs list --filter="aws -upgrade"
+		`),
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.filter, "filter", "", "Space separated list of tags, tags prefixed with - are excluded.")
+	cmd.Flags().IntVar(&opts.days, "days", 7, "Number of days to compute the pass rate for.")
+	cmd.Flags().StringVar(&opts.server, "server", "", "URL of a ci-results server to get data from instead of the local database.")
+	output.AddFlag(cmd, &opts.output)
+
+	completion.RegisterFilterFlag(cmd)
+
+	return cmd
+}
+
+func NewCmdJobs() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "jobs",
+		Short: "Inspect jobs in the database",
+	}
+
+	cmd.AddCommand(NewCmdList())
+
+	return cmd
+}
@@ -0,0 +1,200 @@
+// Package kube publishes CI health as custom resources through the
+// Kubernetes API.
+package kube
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// fieldManager owns the fields that the client applies.
+const fieldManager = "ci-results"
+
+// Config is the location of the Kubernetes API and the credentials for it.
+type Config struct {
+	URL string
+	// TokenFile is a file with a bearer token, it is read for every
+	// request as the token of a service account is rotated.
+	TokenFile string
+	// CAFile is a file with certificates of the API server.
+	CAFile    string
+	Namespace string
+}
+
+// InClusterConfig returns the config of the service account of the pod.
+func InClusterConfig() (*Config, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a cluster: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	namespace, err := ioutil.ReadFile(serviceAccountDir + "/namespace")
+	if err != nil {
+		return nil, err
+	}
+	return &Config{
+		URL:       "https://" + net.JoinHostPort(host, port),
+		TokenFile: serviceAccountDir + "/token",
+		CAFile:    serviceAccountDir + "/ca.crt",
+		Namespace: strings.TrimSpace(string(namespace)),
+	}, nil
+}
+
+// APIError is an unsuccessful response of the API.
+type APIError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+	// Message is the reason from the Status object of the response.
+	Message string
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%s %s: %s: %s", e.Method, e.URL, e.Status, e.Message)
+	}
+	return fmt.Sprintf("got unexpected http response from %s %s: %s", e.Method, e.URL, e.Status)
+}
+
+// IsNotFound returns true if the object doesn't exist.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// Client is a minimal client of the Kubernetes API for objects of a
+// namespace.
+type Client struct {
+	config     Config
+	httpClient *http.Client
+}
+
+func NewClient(config *Config) (*Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.CAFile != "" {
+		ca, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", config.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return &Client{
+		config: *config,
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   30 * time.Second,
+		},
+	}, nil
+}
+
+// ResourcePath returns the path of the resource of the API group in the
+// namespace of the client.
+func (c *Client) ResourcePath(groupVersion, resource string) string {
+	return "/apis/" + groupVersion + "/namespaces/" + url.PathEscape(c.config.Namespace) + "/" + resource
+}
+
+func (c *Client) Namespace() string {
+	return c.config.Namespace
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, contentType string, in interface{}, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	u := strings.TrimSuffix(c.config.URL, "/") + path
+	req, err := http.NewRequestWithContext(ctx, method, u, &body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.config.TokenFile != "" {
+		token, err := ioutil.ReadFile(c.config.TokenFile)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		apiErr := &APIError{
+			Method:     method,
+			URL:        u,
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+		}
+		// The API returns a Status object with the reason.
+		var status struct {
+			Message string `json:"message"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&status) == nil {
+			apiErr.Message = status.Message
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Apply creates or updates the object at the path using server-side apply.
+func (c *Client) Apply(ctx context.Context, path string, obj interface{}) error {
+	q := url.Values{
+		"fieldManager": {fieldManager},
+		"force":        {"true"},
+	}
+	return c.do(ctx, "PATCH", path+"?"+q.Encode(), "application/apply-patch+yaml", obj, nil)
+}
+
+// List returns the names of the objects at the path that have the labels.
+func (c *Client) List(ctx context.Context, path string, labelSelector string) ([]string, error) {
+	var list struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+		} `json:"items"`
+	}
+	if err := c.do(ctx, "GET", path+"?labelSelector="+url.QueryEscape(labelSelector), "", nil, &list); err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, item := range list.Items {
+		names = append(names, item.Metadata.Name)
+	}
+	return names, nil
+}
+
+// Delete deletes the object at the path.
+func (c *Client) Delete(ctx context.Context, path string) error {
+	return c.do(ctx, "DELETE", path, "", nil, nil)
+}
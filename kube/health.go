@@ -0,0 +1,349 @@
+package kube
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dmage/ci-results/alerts"
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/links"
+	"k8s.io/klog/v2"
+)
+
+// GroupVersion is the API group and version of the custom resources.
+const GroupVersion = "ci-results.dmage.github.io/v1alpha1"
+
+const (
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedBy      = "ci-results"
+)
+
+// Thresholds of sustained regressions, the same as the defaults of
+// ci-results issues.
+const (
+	regressionDays         = 3
+	regressionBaselineDays = 14
+	regressionThreshold    = 0.1
+	regressionMinRuns      = 5
+)
+
+type objectMeta struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+type object struct {
+	APIVersion string      `json:"apiVersion"`
+	Kind       string      `json:"kind"`
+	Metadata   objectMeta  `json:"metadata"`
+	Spec       interface{} `json:"spec,omitempty"`
+	Status     interface{} `json:"status,omitempty"`
+}
+
+// AlertStatus is an active alert about a job or a test.
+type AlertStatus struct {
+	Name     string `json:"name"`
+	State    string `json:"state"`
+	Severity string `json:"severity,omitempty"`
+	Variant  string `json:"variant,omitempty"`
+	Summary  string `json:"summary,omitempty"`
+}
+
+type JobHealthSpec struct {
+	Job       string `json:"job"`
+	Dashboard string `json:"dashboard"`
+}
+
+type JobHealthStatus struct {
+	PassRate        *float64          `json:"passRate,omitempty"`
+	RecentBuilds    int               `json:"recentBuilds"`
+	LastBuildTime   string            `json:"lastBuildTime,omitempty"`
+	LastBuildStatus string            `json:"lastBuildStatus,omitempty"`
+	Alerts          []AlertStatus     `json:"alerts,omitempty"`
+	Links           map[string]string `json:"links,omitempty"`
+	LastUpdateTime  string            `json:"lastUpdateTime"`
+}
+
+type TestHealthSpec struct {
+	Test string `json:"test"`
+}
+
+type TestHealthStatus struct {
+	PassRate         *float64          `json:"passRate,omitempty"`
+	Runs             int               `json:"runs"`
+	Failures         int               `json:"failures"`
+	Regressed        bool              `json:"regressed"`
+	BaselinePassRate *float64          `json:"baselinePassRate,omitempty"`
+	Alerts           []AlertStatus     `json:"alerts,omitempty"`
+	Links            map[string]string `json:"links,omitempty"`
+	LastUpdateTime   string            `json:"lastUpdateTime"`
+}
+
+var invalidLabelCharsRe = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// maxNameLength is the maximum length of names of objects.
+const maxNameLength = 253
+
+// sanitizeName converts s into a DNS-1123 subdomain: dot-separated labels of
+// lower case alphanumeric characters and '-' that start and end with an
+// alphanumeric character. The result is empty if s has no such characters.
+func sanitizeName(s string) string {
+	var labels []string
+	for _, label := range strings.Split(strings.ToLower(s), ".") {
+		label = strings.Trim(invalidLabelCharsRe.ReplaceAllString(label, "-"), "-")
+		if label != "" {
+			labels = append(labels, label)
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// objectName converts s into a valid name of an object that starts with the
+// prefix. Names that have to be changed get a hash suffix, so they stay
+// unique.
+func objectName(prefix, s string) string {
+	name := sanitizeName(s)
+	if name != "" && name == s && len(prefix)+len(name) <= maxNameLength {
+		return prefix + name
+	}
+	h := sha1.Sum([]byte(s))
+	suffix := hex.EncodeToString(h[:6])
+	if max := maxNameLength - len(prefix) - len(suffix) - 1; len(name) > max {
+		// The cut may leave a label that ends with '-' or an empty label.
+		name = sanitizeName(name[:max])
+	}
+	if name == "" {
+		return prefix + suffix
+	}
+	return prefix + name + "-" + suffix
+}
+
+// Publisher writes JobHealth resources for jobs and TestHealth resources for
+// tests that are regressed or have active alerts.
+type Publisher struct {
+	client *Client
+	db     *database.DB
+	alerts *alerts.Engine
+	links  *links.Builder
+
+	// Filter selects the jobs.
+	Filter string
+	// Days is the number of recent days for pass rates.
+	Days int
+}
+
+// NewPublisher returns a publisher. Alerts are optional.
+func NewPublisher(client *Client, db *database.DB, alertsEngine *alerts.Engine, lb *links.Builder) *Publisher {
+	return &Publisher{
+		client: client,
+		db:     db,
+		alerts: alertsEngine,
+		links:  lb,
+		Days:   7,
+	}
+}
+
+func passRate(v database.StatsValues) *float64 {
+	total := v.Pass + v.Flake + v.Fail
+	if total == 0 {
+		return nil
+	}
+	rate := float64(v.Pass+v.Flake) / float64(total)
+	return &rate
+}
+
+func alertStatus(a alerts.ActiveAlert) AlertStatus {
+	return AlertStatus{
+		Name:     a.Labels["alertname"],
+		State:    a.State,
+		Severity: a.Labels["severity"],
+		Variant:  a.Labels["variant"],
+		Summary:  a.Annotations["summary"],
+	}
+}
+
+// apply writes the object and then its status, which is a subresource.
+func (p *Publisher) apply(ctx context.Context, resource string, obj object) error {
+	path := p.client.ResourcePath(GroupVersion, resource) + "/" + obj.Metadata.Name
+	status := obj.Status
+	obj.Status = nil
+	if err := p.client.Apply(ctx, path, obj); err != nil {
+		return err
+	}
+	obj.Spec, obj.Status = nil, status
+	return p.client.Apply(ctx, path+"/status", obj)
+}
+
+// prune deletes the objects of the resource that are not kept.
+func (p *Publisher) prune(ctx context.Context, resource string, keep map[string]bool) error {
+	path := p.client.ResourcePath(GroupVersion, resource)
+	names, err := p.client.List(ctx, path, managedByLabel+"="+managedBy)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if keep[name] {
+			continue
+		}
+		klog.V(2).Infof("Deleting %s %s", resource, name)
+		if err := p.client.Delete(ctx, path+"/"+name); err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Publisher) objectMeta(name string) objectMeta {
+	return objectMeta{
+		Name:      name,
+		Namespace: p.client.Namespace(),
+		Labels:    map[string]string{managedByLabel: managedBy},
+	}
+}
+
+// Publish writes the resources and deletes the resources of jobs and tests
+// that are no longer reported.
+func (p *Publisher) Publish(ctx context.Context, now time.Time) error {
+	updated := now.UTC().Format(time.RFC3339)
+
+	var active []alerts.ActiveAlert
+	if p.alerts != nil {
+		active = p.alerts.Alerts()
+	}
+	jobAlerts := map[string][]AlertStatus{}
+	testAlerts := map[string][]AlertStatus{}
+	for _, a := range active {
+		if job := a.Labels["job"]; job != "" {
+			jobAlerts[job] = append(jobAlerts[job], alertStatus(a))
+		}
+		if test := a.Labels["test"]; test != "" {
+			testAlerts[test] = append(testAlerts[test], alertStatus(a))
+		}
+	}
+
+	jobs, err := p.db.ListJobs(p.Filter, p.Days)
+	if err != nil {
+		return fmt.Errorf("unable to list jobs: %w", err)
+	}
+	regressions, err := p.db.SustainedRegressions(p.Filter, regressionDays, regressionBaselineDays, regressionThreshold, regressionMinRuns)
+	if err != nil {
+		return fmt.Errorf("unable to find regressions: %w", err)
+	}
+
+	failed := 0
+	var firstErr error
+	fail := func(kind, name string, err error) {
+		klog.V(2).Infof("Unable to publish %s %s: %v", kind, name, err)
+		if failed == 0 {
+			firstErr = fmt.Errorf("%s %s: %w", kind, name, err)
+		}
+		failed++
+	}
+
+	jobNames := map[string]bool{}
+	for _, job := range jobs {
+		status := JobHealthStatus{
+			PassRate:        job.RecentPassRate,
+			RecentBuilds:    job.RecentBuilds,
+			LastBuildStatus: job.LastBuildStatus,
+			Alerts:          jobAlerts[job.Name],
+			Links:           p.links.Job(job.Dashboard, job.Name),
+			LastUpdateTime:  updated,
+		}
+		if job.LastBuild != nil {
+			status.LastBuildTime = time.Unix(0, *job.LastBuild*int64(time.Millisecond)).UTC().Format(time.RFC3339)
+		}
+		name := objectName("", job.Name)
+		jobNames[name] = true
+		err := p.apply(ctx, "jobhealths", object{
+			APIVersion: GroupVersion,
+			Kind:       "JobHealth",
+			Metadata:   p.objectMeta(name),
+			Spec:       JobHealthSpec{Job: job.Name, Dashboard: job.Dashboard},
+			Status:     status,
+		})
+		if err != nil {
+			fail("JobHealth", name, err)
+		}
+	}
+
+	tests := map[string]*TestHealthStatus{}
+	for _, reg := range regressions {
+		baseline := reg.BaselinePassRate
+		tests[reg.Test] = &TestHealthStatus{
+			Regressed:        true,
+			BaselinePassRate: &baseline,
+		}
+	}
+	for test := range testAlerts {
+		if tests[test] == nil {
+			tests[test] = &TestHealthStatus{}
+		}
+	}
+	release := links.FilterRelease(p.Filter)
+	testNames := map[string]bool{}
+	for test, status := range tests {
+		detail, err := p.db.TestDetail(test, p.Filter, p.Days)
+		if database.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("unable to get test %s: %w", test, err)
+		}
+		status.PassRate = passRate(detail.Values)
+		status.Runs = detail.Values.Pass + detail.Values.Flake + detail.Values.Fail
+		status.Failures = detail.Values.Fail
+		status.Alerts = testAlerts[test]
+		status.Links = p.links.Test(release, test)
+		status.LastUpdateTime = updated
+
+		name := objectName("test-", test)
+		testNames[name] = true
+		err = p.apply(ctx, "testhealths", object{
+			APIVersion: GroupVersion,
+			Kind:       "TestHealth",
+			Metadata:   p.objectMeta(name),
+			Spec:       TestHealthSpec{Test: test},
+			Status:     status,
+		})
+		if err != nil {
+			fail("TestHealth", name, err)
+		}
+	}
+
+	// Objects of jobs and tests that failed to be published are kept, so
+	// pruning is safe.
+	if err := p.prune(ctx, "jobhealths", jobNames); err != nil {
+		return fmt.Errorf("unable to delete stale JobHealth resources: %w", err)
+	}
+	if err := p.prune(ctx, "testhealths", testNames); err != nil {
+		return fmt.Errorf("unable to delete stale TestHealth resources: %w", err)
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("%d resources were not published, the first error is %w", failed, firstErr)
+	}
+	klog.V(2).Infof("Published %d JobHealth and %d TestHealth resources", len(jobNames), len(testNames))
+	return nil
+}
+
+// Run publishes the resources every interval until the context is done.
+func (p *Publisher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := p.Publish(ctx, time.Now()); err != nil {
+			klog.Errorf("Unable to publish health resources: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
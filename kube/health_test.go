@@ -0,0 +1,64 @@
+package kube
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var dns1123SubdomainRe = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+func TestObjectName(t *testing.T) {
+	testCases := []struct {
+		name   string
+		prefix string
+		s      string
+		want   string
+	}{
+		{
+			name: "valid name",
+			s:    "periodic-ci-openshift-release-master-nightly-4.9-e2e-aws",
+			want: "periodic-ci-openshift-release-master-nightly-4.9-e2e-aws",
+		},
+		{
+			name:   "test name",
+			prefix: "test-",
+			s:      "[sig-network] Services should serve endpoints",
+		},
+		{name: "empty", s: ""},
+		{name: "only dots", s: "..."},
+		{name: "only dashes", s: "---"},
+		{name: "dashes at label edges", s: "-a-.-b-"},
+		{name: "empty label", s: "a..b"},
+		{name: "punctuation next to dots", s: "job [4.9].(aws)"},
+		{name: "upper case", s: "Job.AWS"},
+		{name: "non-ASCII", s: "日本.テスト"},
+		{name: "long name", s: strings.Repeat("a", 300)},
+		{name: "long name with dots", s: strings.Repeat("a.", 200)},
+		{name: "cut at a dash", s: strings.Repeat("a", 239) + "-------b"},
+		{name: "cut at a dot", prefix: "test-", s: strings.Repeat("a", 234) + ".-.b"},
+		{name: "long name with prefix", prefix: "test-", s: strings.Repeat("a", 253)},
+	}
+	seen := map[string]string{}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := objectName(tc.prefix, tc.s)
+			if tc.want != "" && got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+			if !strings.HasPrefix(got, tc.prefix) {
+				t.Errorf("%q doesn't start with %q", got, tc.prefix)
+			}
+			if len(got) > maxNameLength {
+				t.Errorf("%q is longer than %d characters", got, maxNameLength)
+			}
+			if !dns1123SubdomainRe.MatchString(got) {
+				t.Errorf("%q is not a DNS-1123 subdomain", got)
+			}
+			if other, ok := seen[got]; ok {
+				t.Errorf("%q and %q have the same name %q", tc.s, other, got)
+			}
+			seen[got] = tc.s
+		})
+	}
+}
@@ -0,0 +1,231 @@
+// Package links builds URLs of the pages where jobs and their builds can be
+// inspected: Spyglass and job history in Prow, TestGrid tabs, artifacts in
+// GCS, and Sippy.
+package links
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dmage/ci-results/artifacts"
+	"github.com/dmage/ci-results/testgrid"
+	"github.com/spf13/cobra"
+)
+
+const (
+	DefaultProwURL  = "https://prow.ci.openshift.org"
+	DefaultSippyURL = "https://sippy.dptools.openshift.org"
+)
+
+const gcsPublicURL = "https://storage.googleapis.com/"
+
+// Builder builds links for the configured instances of Prow, TestGrid and
+// the artifacts storage.
+type Builder struct {
+	ProwURL      string
+	TestGridURL  string
+	ArtifactsURL string
+	// SippyURL is the Sippy instance, there are no links to Sippy if it
+	// is empty.
+	SippyURL string
+}
+
+var releaseRe = regexp.MustCompile(`^\d+\.\d+$`)
+
+// FilterRelease returns the release that the filter selects, or an empty
+// string if it selects no single release.
+func FilterRelease(filter string) string {
+	release := ""
+	for _, tag := range strings.Fields(filter) {
+		if releaseRe.MatchString(tag) {
+			if release != "" && release != tag {
+				return ""
+			}
+			release = tag
+		}
+	}
+	return release
+}
+
+var jobReleaseRe = regexp.MustCompile(`\b(\d+)\.(\d+)\b`)
+
+// jobRelease returns the latest release in the job name, upgrade jobs
+// belong to the release they upgrade to.
+func jobRelease(jobName string) string {
+	release := ""
+	var major, minor int
+	for _, m := range jobReleaseRe.FindAllStringSubmatch(jobName, -1) {
+		x, _ := strconv.Atoi(m[1])
+		y, _ := strconv.Atoi(m[2])
+		if release == "" || x > major || (x == major && y > minor) {
+			release, major, minor = m[0], x, y
+		}
+	}
+	return release
+}
+
+// Default is the builder for OpenShift CI.
+var Default = &Builder{
+	ProwURL:      DefaultProwURL,
+	TestGridURL:  testgrid.DefaultURL,
+	ArtifactsURL: artifacts.DefaultURL,
+	SippyURL:     DefaultSippyURL,
+}
+
+// AddFlags adds flags to configure the builder and sets the defaults.
+func AddFlags(cmd *cobra.Command, b *Builder) {
+	cmd.Flags().StringVar(&b.ProwURL, "prow-url", DefaultProwURL, "Prow instance that links to builds and job histories point to.")
+	cmd.Flags().StringVar(&b.TestGridURL, "testgrid-url", testgrid.DefaultURL, "TestGrid instance that links to job tabs point to.")
+	cmd.Flags().StringVar(&b.ArtifactsURL, "artifacts-url", artifacts.DefaultURL, "Location of job artifacts that links to build logs and must-gather archives point to.")
+	cmd.Flags().StringVar(&b.SippyURL, "sippy-url", DefaultSippyURL, "Sippy instance that links to jobs, tests and variants point to, empty to omit them.")
+}
+
+// gcsPath returns the bucket and the prefix of the artifacts, or an empty
+// string if the artifacts are not in public GCS, in which case Prow pages
+// cannot be linked.
+func (b *Builder) gcsPath() string {
+	if !strings.HasPrefix(b.ArtifactsURL, gcsPublicURL) {
+		return ""
+	}
+	return strings.Trim(strings.TrimPrefix(b.ArtifactsURL, gcsPublicURL), "/")
+}
+
+// TestGridTab returns the URL of the tab of the job on its dashboard.
+func (b *Builder) TestGridTab(dashboard, jobName string) string {
+	if dashboard == "" {
+		return ""
+	}
+	return strings.TrimSuffix(b.TestGridURL, "/") + "/" + url.PathEscape(dashboard) + "#" + url.PathEscape(jobName)
+}
+
+// JobHistory returns the URL of the Prow page with the latest builds of the
+// job.
+func (b *Builder) JobHistory(jobName string) string {
+	path := b.gcsPath()
+	if path == "" {
+		return ""
+	}
+	return strings.TrimSuffix(b.ProwURL, "/") + "/job-history/gs/" + path + "/" + url.PathEscape(jobName)
+}
+
+// Spyglass returns the URL of the Prow page of the build.
+func (b *Builder) Spyglass(jobName, number string) string {
+	path := b.gcsPath()
+	if path == "" {
+		return ""
+	}
+	return strings.TrimSuffix(b.ProwURL, "/") + "/view/gs/" + path + "/" + url.PathEscape(jobName) + "/" + url.PathEscape(number)
+}
+
+// BuildLog returns the URL of the log of the build.
+func (b *Builder) BuildLog(jobName, number string) string {
+	return artifacts.BuildURL(b.ArtifactsURL, jobName, number) + "/build-log.txt"
+}
+
+// MustGather returns the URL of the must-gather archive of the build. The
+// archive is stored under the ci-operator target of the job, so there is no
+// link if the target is unknown.
+func (b *Builder) MustGather(jobName, number, target string) string {
+	if target == "" {
+		return ""
+	}
+	return artifacts.BuildURL(b.ArtifactsURL, jobName, number) + "/artifacts/" + url.PathEscape(target) + "/gather-must-gather/artifacts/must-gather.tar"
+}
+
+// sippyFilter returns the filter of a Sippy table with a single condition.
+func sippyFilter(column, operator, value string) string {
+	type item struct {
+		ColumnField   string `json:"columnField"`
+		OperatorValue string `json:"operatorValue"`
+		Value         string `json:"value"`
+	}
+	data, _ := json.Marshal(map[string][]item{
+		"items": {{ColumnField: column, OperatorValue: operator, Value: value}},
+	})
+	return string(data)
+}
+
+// sippy returns the URL of the Sippy page /sippy-ng/PAGE/RELEASE/SUBPAGE.
+func (b *Builder) sippy(page, release, subpage string, query url.Values) string {
+	if b.SippyURL == "" || release == "" {
+		return ""
+	}
+	u := strings.TrimSuffix(b.SippyURL, "/") + "/sippy-ng/" + page + "/" + url.PathEscape(release)
+	if subpage != "" {
+		u += "/" + subpage
+	}
+	return u + "?" + query.Encode()
+}
+
+// SippyJob returns the URL of the Sippy page with the runs of the job in
+// the release.
+func (b *Builder) SippyJob(release, jobName string) string {
+	return b.sippy("jobs", release, "analysis", url.Values{
+		"filters": {sippyFilter("name", "equals", jobName)},
+	})
+}
+
+// SippyTest returns the URL of the Sippy analysis of the test in the
+// release.
+func (b *Builder) SippyTest(release, testName string) string {
+	return b.sippy("tests", release, "analysis", url.Values{
+		"test": {testName},
+	})
+}
+
+// SippyVariant returns the URL of the Sippy page with the jobs of the
+// variant in the release.
+func (b *Builder) SippyVariant(release, variant string) string {
+	return b.sippy("jobs", release, "", url.Values{
+		"filters": {sippyFilter("variants", "contains", variant)},
+	})
+}
+
+func set(links map[string]string, key, value string) {
+	if value != "" {
+		links[key] = value
+	}
+}
+
+// Job returns the links of the job that can be built.
+func (b *Builder) Job(dashboard, jobName string) map[string]string {
+	links := map[string]string{}
+	set(links, "testgrid", b.TestGridTab(dashboard, jobName))
+	set(links, "job_history", b.JobHistory(jobName))
+	set(links, "sippy", b.SippyJob(jobRelease(jobName), jobName))
+	return links
+}
+
+// Test returns the links of the test in the release.
+func (b *Builder) Test(release, testName string) map[string]string {
+	links := map[string]string{}
+	set(links, "sippy", b.SippyTest(release, testName))
+	return links
+}
+
+// Variant returns the links of the variant in the release. Sippy tags of
+// releases are not variants in Sippy.
+func (b *Builder) Variant(release, variant string) map[string]string {
+	links := map[string]string{}
+	if !releaseRe.MatchString(variant) {
+		set(links, "sippy", b.SippyVariant(release, variant))
+	}
+	return links
+}
+
+// Build returns the links of the job and of the build. The dashboard and the
+// target may be empty if they are unknown. Without the number, only the links
+// of the job are returned.
+func (b *Builder) Build(dashboard, jobName, number, target string) map[string]string {
+	links := b.Job(dashboard, jobName)
+	if number == "" {
+		return links
+	}
+	set(links, "spyglass", b.Spyglass(jobName, number))
+	set(links, "build_log", b.BuildLog(jobName, number))
+	set(links, "must_gather", b.MustGather(jobName, number, target))
+	return links
+}
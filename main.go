@@ -5,21 +5,102 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/alerts"
+	"github.com/dmage/ci-results/annotate"
+	"github.com/dmage/ci-results/completion"
+	"github.com/dmage/ci-results/config"
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/dbcmd"
+	"github.com/dmage/ci-results/diff"
+	"github.com/dmage/ci-results/doctor"
+	"github.com/dmage/ci-results/export"
+	"github.com/dmage/ci-results/gate"
+	"github.com/dmage/ci-results/importer"
 	"github.com/dmage/ci-results/indexer"
+	"github.com/dmage/ci-results/issues"
+	"github.com/dmage/ci-results/jobs"
+	"github.com/dmage/ci-results/migrate"
+	"github.com/dmage/ci-results/prune"
+	"github.com/dmage/ci-results/query"
+	"github.com/dmage/ci-results/report"
 	"github.com/dmage/ci-results/server"
+	"github.com/dmage/ci-results/tags"
+	"github.com/dmage/ci-results/testhistory"
+	"github.com/dmage/ci-results/variants"
+	"github.com/dmage/ci-results/version"
+	"github.com/dmage/ci-results/watch"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"k8s.io/klog/v2"
 )
 
 func NewCmd() *cobra.Command {
+	var configFile string
+
 	cmd := &cobra.Command{
 		Use:   "ci-results",
 		Short: "CI results provides analytics over CI results",
+		Long: heredoc.Doc(`
+			CI results provides analytics over CI results.
+
+			Flags can be set in a YAML config file. Flags of the root command are
+			top-level keys, flags of subcommands are nested under their names:
+
+			  db: /data/results.db
+			  indexer:
+			    dashboards:
+			    - redhat-openshift-ocp-release-4.9-blocking
+			    tag-rule:
+			    - -ovn=ovn
+			  server:
+			    listen: :8080
+			    default-periods: 7,7
+			  export:
+			    subset:
+			      filter: aws
+
+			Flags given on the command line take precedence over the config file.
+		`),
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+			return config.Load(cmd, configFile)
+		},
 	}
 
+	cmd.PersistentFlags().StringVar(&configFile, "config", "", "Path to the config file (default $HOME/"+config.DefaultFile+").")
+	cmd.PersistentFlags().StringVar(&database.DefaultDSN, "db", database.DefaultDSN, "Data source name of the SQLite database.")
+	cmd.PersistentFlags().DurationVar(&database.DefaultOptions.BusyTimeout, "db-busy-timeout", 0, "How long to wait for a locked database, e.g. 5s.")
+	cmd.PersistentFlags().IntVar(&database.DefaultOptions.CacheSize, "db-cache-size", 0, "SQLite page cache size in KiB, overrides _cache_size in --db.")
+	cmd.PersistentFlags().Int64Var(&database.DefaultOptions.MmapSize, "db-mmap-size", 0, "Maximum number of bytes of the database to access using memory-mapped I/O.")
+	cmd.PersistentFlags().StringVar(&database.DefaultOptions.Synchronous, "db-synchronous", "", "SQLite synchronous level (OFF, NORMAL, FULL or EXTRA).")
+	cmd.PersistentFlags().IntVar(&database.DefaultOptions.MaxOpenConns, "db-max-open-conns", 0, "Maximum number of open database connections, 0 for no limit.")
+	cmd.PersistentFlags().BoolVar(&database.DetectLeaks, "detect-db-leaks", false, "Fail if database rows or transactions are left open, for debugging.")
+	cmd.PersistentFlags().BoolVar(&database.AutoMigrate, "auto-migrate", true, "Apply pending database migrations when the database is opened.")
+
+	cmd.AddCommand(alerts.NewCmdAlerts())
+	cmd.AddCommand(annotate.NewCmdAnnotate())
+	cmd.AddCommand(completion.NewCmdCompletion())
+	cmd.AddCommand(dbcmd.NewCmdDB())
+	cmd.AddCommand(diff.NewCmdDiff())
+	cmd.AddCommand(doctor.NewCmdDoctor())
+	cmd.AddCommand(export.NewCmdExport())
+	cmd.AddCommand(gate.NewCmdGate())
+	cmd.AddCommand(importer.NewCmdImport())
 	cmd.AddCommand(indexer.NewCmdIndexer())
+	cmd.AddCommand(issues.NewCmdIssues())
+	cmd.AddCommand(jobs.NewCmdJobs())
+	cmd.AddCommand(migrate.NewCmdMigrate())
+	cmd.AddCommand(prune.NewCmdPrune())
+	cmd.AddCommand(query.NewCmdQuery())
+	cmd.AddCommand(report.NewCmdReport())
 	cmd.AddCommand(server.NewCmdServer())
+	cmd.AddCommand(tags.NewCmdTags())
+	cmd.AddCommand(testhistory.NewCmdTestHistory())
+	cmd.AddCommand(variants.NewCmdVariants())
+	cmd.AddCommand(version.NewCmdVersion())
+	cmd.AddCommand(watch.NewCmdWatch())
 
 	return cmd
 }
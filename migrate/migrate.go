@@ -0,0 +1,194 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/output"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+func withMigrator(fn func(m *database.Migrator) error) (err error) {
+	m, err := database.NewMigrator(database.DefaultOptions.DSN(database.DefaultDSN))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := m.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	return fn(m)
+}
+
+type StatusOptions struct {
+	output string
+
+	out io.Writer
+}
+
+func (opts *StatusOptions) Run(ctx context.Context) error {
+	return withMigrator(func(m *database.Migrator) error {
+		version, err := m.Version()
+		if err != nil {
+			return err
+		}
+		status, err := m.Status()
+		if err != nil {
+			return err
+		}
+
+		result := struct {
+			Version    int                        `json:"version"`
+			Latest     int                        `json:"latest"`
+			Migrations []database.MigrationStatus `json:"migrations"`
+		}{
+			Version:    version,
+			Latest:     m.Latest(),
+			Migrations: status,
+		}
+		return output.Print(opts.out, opts.output, result, func(out io.Writer) error {
+			fmt.Fprintf(out, "Current version: %d\n", version)
+			fmt.Fprintf(out, "Latest version: %d\n\n", m.Latest())
+
+			w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+			for _, s := range status {
+				state := "pending"
+				if s.Applied {
+					state = "applied"
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, state)
+			}
+			return w.Flush()
+		})
+	})
+}
+
+type UpOptions struct {
+	to int
+}
+
+func (opts *UpOptions) Run(ctx context.Context) error {
+	return withMigrator(func(m *database.Migrator) error {
+		applied, err := m.Up(opts.to)
+		for _, s := range applied {
+			klog.Infof("Applied migration %d: %s", s.Version, s.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			klog.Info("No pending migrations")
+		}
+		return nil
+	})
+}
+
+type DownOptions struct {
+	steps int
+}
+
+func (opts *DownOptions) Run(ctx context.Context) error {
+	return withMigrator(func(m *database.Migrator) error {
+		reverted, err := m.Down(opts.steps)
+		for _, s := range reverted {
+			klog.Infof("Reverted migration %d: %s", s.Version, s.Name)
+		}
+		return err
+	})
+}
+
+func NewCmdStatus() *cobra.Command {
+	opts := &StatusOptions{
+		out: os.Stdout,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Print the schema version and pending migrations",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	output.AddFlag(cmd, &opts.output)
+
+	return cmd
+}
+
+func NewCmdUp() *cobra.Command {
+	opts := &UpOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "up",
+		Short: "Apply pending migrations",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().IntVar(&opts.to, "to", 0, "Schema version to migrate to (default latest).")
+
+	return cmd
+}
+
+func NewCmdDown() *cobra.Command {
+	opts := &DownOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "down",
+		Short: "Revert the latest applied migrations",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().IntVar(&opts.steps, "steps", 1, "Number of migrations to revert.")
+
+	return cmd
+}
+
+func NewCmdMigrate() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Manage the database schema",
+		Long: heredoc.Doc(`
+			Manage the database schema version.
+
+			By default pending migrations are applied whenever the database is
+			opened. Run commands with --auto-migrate=false to disable this and
+			apply migrations explicitly with "ci-results migrate up".
+		`),
+		Example: heredoc.Doc(`
+			ci-results migrate status
+			ci-results migrate up
+			ci-results migrate down --steps=2
+		`),
+	}
+
+	cmd.AddCommand(NewCmdDown())
+	cmd.AddCommand(NewCmdStatus())
+	cmd.AddCommand(NewCmdUp())
+
+	return cmd
+}
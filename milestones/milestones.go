@@ -0,0 +1,76 @@
+package milestones
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const dateLayout = "2006-01-02"
+
+type Milestone struct {
+	Name string `yaml:"name" json:"name"`
+	// Date is either a date (2006-01-02) in UTC or a time in RFC 3339.
+	Date string `yaml:"date" json:"date"`
+}
+
+// Milestones are named points in time, like release GA dates, that periods
+// can be anchored to.
+type Milestones struct {
+	Milestones []Milestone `yaml:"milestones"`
+
+	times map[string]time.Time
+}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(dateLayout, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func Parse(data []byte) (*Milestones, error) {
+	var m Milestones
+	if err := yaml.UnmarshalStrict(data, &m); err != nil {
+		return nil, err
+	}
+	m.times = make(map[string]time.Time)
+	for i, milestone := range m.Milestones {
+		if milestone.Name == "" {
+			return nil, fmt.Errorf("milestone #%d: name is required", i+1)
+		}
+		if _, ok := m.times[milestone.Name]; ok {
+			return nil, fmt.Errorf("milestone %s: duplicate name", milestone.Name)
+		}
+		t, err := parseTime(milestone.Date)
+		if err != nil {
+			return nil, fmt.Errorf("milestone %s: invalid date %q", milestone.Name, milestone.Date)
+		}
+		m.times[milestone.Name] = t
+	}
+	return &m, nil
+}
+
+func Load(filename string) (*Milestones, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	m, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return m, nil
+}
+
+// Get returns the time of the milestone.
+func (m *Milestones) Get(name string) (time.Time, error) {
+	if m != nil {
+		if t, ok := m.times[name]; ok {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown milestone %q", name)
+}
@@ -0,0 +1,110 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	Table = "table"
+	JSON  = "json"
+	YAML  = "yaml"
+)
+
+// AddFlag adds the -o/--output flag to the command.
+func AddFlag(cmd *cobra.Command, format *string) {
+	cmd.Flags().StringVarP(format, "output", "o", Table, "Output format (table, json, yaml).")
+	cmd.RegisterFlagCompletionFunc("output", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{Table, JSON, YAML}, cobra.ShellCompDirectiveNoFileComp
+	})
+}
+
+// Validate returns an error if the format is unknown, so that commands can
+// fail before doing any work.
+func Validate(format string) error {
+	switch format {
+	case Table, JSON, YAML:
+		return nil
+	}
+	return fmt.Errorf("unknown output format %s", format)
+}
+
+// Print writes v in the given format. The table format is produced by
+// printTable.
+func Print(out io.Writer, format string, v interface{}, printTable func(out io.Writer) error) error {
+	switch format {
+	case Table:
+		return printTable(out)
+	case JSON:
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case YAML:
+		// Go through JSON to use the same field names as in the JSON output.
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		dec := json.NewDecoder(bytes.NewReader(buf))
+		dec.UseNumber()
+		obj, err := decodeOrdered(dec)
+		if err != nil {
+			return err
+		}
+		buf, err = yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(buf)
+		return err
+	}
+	return Validate(format)
+}
+
+// decodeOrdered decodes a JSON value and keeps the order of object keys.
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		obj := yaml.MapSlice{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, yaml.MapItem{Key: key, Value: value})
+		}
+		_, err := dec.Token()
+		return obj, err
+	case json.Delim('['):
+		arr := []interface{}{}
+		for dec.More() {
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		_, err := dec.Token()
+		return arr, err
+	}
+	if n, ok := tok.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			return i, nil
+		}
+		return n.Float64()
+	}
+	return tok, nil
+}
@@ -0,0 +1,92 @@
+package owners
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	"github.com/dmage/ci-results/database"
+	"gopkg.in/yaml.v2"
+	"k8s.io/klog/v2"
+)
+
+var teamRe = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]*$`)
+
+type Rule struct {
+	Team  string `yaml:"team"`
+	Regex string `yaml:"regex"`
+
+	re *regexp.Regexp
+}
+
+// Owners maps jobs to teams that are responsible for them. Rules are checked
+// in order and the first matching rule wins.
+type Owners struct {
+	Owners []Rule `yaml:"owners"`
+}
+
+func Parse(data []byte) (*Owners, error) {
+	var o Owners
+	if err := yaml.UnmarshalStrict(data, &o); err != nil {
+		return nil, err
+	}
+	for i := range o.Owners {
+		rule := &o.Owners[i]
+		if !teamRe.MatchString(rule.Team) {
+			return nil, fmt.Errorf("rule #%d: invalid team %q", i+1, rule.Team)
+		}
+		re, err := regexp.Compile(rule.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("rule #%d: %w", i+1, err)
+		}
+		rule.re = re
+	}
+	return &o, nil
+}
+
+func Load(filename string) (*Owners, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	o, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return o, nil
+}
+
+// Owner returns the team that owns the job, or an empty string.
+func (o *Owners) Owner(jobName string) string {
+	for _, rule := range o.Owners {
+		if rule.re.MatchString(jobName) {
+			return rule.Team
+		}
+	}
+	return ""
+}
+
+// Map returns owners of the jobs keyed by the job name.
+func (o *Owners) Map(jobNames []string) map[string]string {
+	m := make(map[string]string)
+	for _, name := range jobNames {
+		if owner := o.Owner(name); owner != "" {
+			m[name] = owner
+		}
+	}
+	return m
+}
+
+// Apply sets owners of all jobs in the database.
+func Apply(db *database.DB, o *Owners) error {
+	names, err := db.JobNames()
+	if err != nil {
+		return err
+	}
+	n, err := db.SetJobOwners(o.Map(names))
+	if err != nil {
+		return err
+	}
+	klog.Infof("Updated owners of %d jobs", n)
+	return nil
+}
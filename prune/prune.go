@@ -0,0 +1,136 @@
+package prune
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/completion"
+	"github.com/dmage/ci-results/database"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+type PruneOptions struct {
+	out io.Writer
+
+	filter          string
+	olderThan       int
+	keepBuilds      int
+	dropUnusedTests bool
+	dryRun          bool
+}
+
+func printResult(out io.Writer, result *database.PruneResult) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "JOB\tBUILDS\tTEST RESULTS")
+	for _, job := range result.Jobs {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", job.Name, job.Builds, job.TestResults)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(result.Tests) > 0 {
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "TESTS")
+		for _, name := range result.Tests {
+			fmt.Fprintln(out, name)
+		}
+	}
+	return nil
+}
+
+func (opts *PruneOptions) Run(ctx context.Context) (err error) {
+	db, err := database.OpenDefault()
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer func() {
+		closeErr := db.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	policy := database.PrunePolicy{
+		Filter:          opts.filter,
+		KeepBuilds:      opts.keepBuilds,
+		DropUnusedTests: opts.dropUnusedTests,
+	}
+	if opts.olderThan > 0 {
+		policy.OlderThan = time.Now().AddDate(0, 0, -opts.olderThan).Unix() * 1000
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	result, err := tx.Prune(policy, opts.dryRun)
+	if err != nil {
+		return fmt.Errorf("unable to prune database: %w", err)
+	}
+
+	builds := 0
+	for _, job := range result.Jobs {
+		builds += job.Builds
+	}
+	if opts.dryRun {
+		klog.Infof("Would delete %d builds and %d tests", builds, len(result.Tests))
+	} else {
+		klog.Infof("Deleted %d builds and %d tests", builds, len(result.Tests))
+	}
+
+	return printResult(opts.out, result)
+}
+
+func NewCmdPrune() *cobra.Command {
+	opts := &PruneOptions{
+		out: os.Stdout,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Delete old builds and unused tests from the local database",
+		Long: heredoc.Doc(`
+			Delete builds and tests according to the given policies.
+
+			A build is deleted if it is older than --older-than days or if it is
+			not among the last --keep-builds builds of its job. With
+			--drop-unused-tests, tests that have no results left are deleted too.
+		`),
+		Example: heredoc.Doc(`
+			ci-results prune --keep-builds=100 --drop-unused-tests --dry-run
+			ci-results prune --older-than=90 --filter=aws
+		`),
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.filter, "filter", "", "Space separated list of tags, tags prefixed with - are excluded.")
+	cmd.Flags().IntVar(&opts.olderThan, "older-than", 0, "Delete builds older than the given number of days.")
+	cmd.Flags().IntVar(&opts.keepBuilds, "keep-builds", 0, "Keep only the given number of latest builds per job.")
+	cmd.Flags().BoolVar(&opts.dropUnusedTests, "drop-unused-tests", false, "Delete tests that have no results.")
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "Only print what would be deleted.")
+
+	completion.RegisterFilterFlag(cmd)
+
+	return cmd
+}
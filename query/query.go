@@ -0,0 +1,189 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/client"
+	"github.com/dmage/ci-results/completion"
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/milestones"
+	"github.com/dmage/ci-results/output"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+type QueryOptions struct {
+	columns  string
+	filter   string
+	periods  string
+	testName string
+	server   string
+	output   string
+
+	anchor         string
+	milestonesFile string
+	at             string
+	alignDays      bool
+	timezone       string
+
+	out io.Writer
+}
+
+func passRate(v database.StatsValues) string {
+	total := v.Pass + v.Flake + v.Fail
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(v.Pass+v.Flake)/float64(total))
+}
+
+func printTable(out io.Writer, columns string, periods string, stats *database.Stats) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+
+	var header []string
+	for _, col := range strings.Split(columns, ",") {
+		header = append(header, strings.ToUpper(col))
+	}
+	for i, p := range strings.Split(periods, ",") {
+		header = append(header, fmt.Sprintf("PERIOD %d (%sd)", i+1, p), "PASS/FLAKE/FAIL")
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+
+	for _, row := range stats.Data {
+		fields := append([]string{}, row.Columns...)
+		for _, v := range row.Values {
+			fields = append(fields, passRate(v), fmt.Sprintf("%d/%d/%d", v.Pass, v.Flake, v.Fail))
+		}
+		fmt.Fprintln(w, strings.Join(fields, "\t"))
+	}
+
+	return w.Flush()
+}
+
+func (opts *QueryOptions) buildStats(ctx context.Context) (stats *database.Stats, err error) {
+	if opts.server != "" {
+		extra := url.Values{}
+		if opts.anchor != "" {
+			extra.Set("anchor", opts.anchor)
+		}
+		if opts.at != "" {
+			extra.Set("at", opts.at)
+		}
+		if opts.alignDays {
+			extra.Set("align", "day")
+		}
+		if opts.timezone != "" {
+			extra.Set("tz", opts.timezone)
+		}
+		return client.New(opts.server).BuildStats(ctx, opts.columns, opts.filter, opts.periods, opts.testName, extra)
+	}
+
+	popts := database.PeriodOptions{
+		AlignDays: opts.alignDays,
+	}
+	if opts.anchor != "" {
+		if opts.milestonesFile == "" {
+			return nil, fmt.Errorf("--anchor requires --milestones")
+		}
+		m, err := milestones.Load(opts.milestonesFile)
+		if err != nil {
+			return nil, err
+		}
+		popts.Ref, err = m.Get(opts.anchor)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.at != "" {
+		if opts.anchor != "" {
+			return nil, fmt.Errorf("--at and --anchor are mutually exclusive")
+		}
+		popts.Ref, err = database.ParseRefTime(opts.at)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.timezone != "" {
+		popts.Location, err = time.LoadLocation(opts.timezone)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := database.OpenDefault()
+	if err != nil {
+		return nil, fmt.Errorf("unable to open database: %w", err)
+	}
+	defer func() {
+		closeErr := db.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	return db.BuildStatsWith(opts.columns, opts.filter, opts.periods, opts.testName, popts)
+}
+
+func (opts *QueryOptions) Run(ctx context.Context) error {
+	stats, err := opts.buildStats(ctx)
+	if err != nil {
+		return err
+	}
+
+	return output.Print(opts.out, opts.output, stats, func(out io.Writer) error {
+		return printTable(out, opts.columns, opts.periods, stats)
+	})
+}
+
+func NewCmdQuery() *cobra.Command {
+	opts := &QueryOptions{
+		out: os.Stdout,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "query",
+		Short: "Query build statistics",
+		Long: heredoc.Doc(`
+			Compute the same statistics as the /api/builds endpoint directly from
+			the local database, without starting the HTTP server.
+
+			With --server the statistics are fetched from a running server instead.
+		`),
+		Example: heredoc.Doc(`
+			ci-results query --columns=name --filter="aws -upgrade" --periods=7,7
+			ci-results query --milestones=milestones.yaml --anchor=4.9-ga --periods=+14,14
+			ci-results query --at=2021-09-01T00:00:00Z --periods=7
+		`),
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.columns, "columns", "sippytags", "Comma separated list of columns to group by (sippytags, name, dashboard, test, sig, owner, variant.DIMENSION).")
+	cmd.Flags().StringVar(&opts.filter, "filter", "", "Space separated list of tags, tags prefixed with - are excluded.")
+	cmd.Flags().StringVar(&opts.periods, "periods", "7,7", "Comma separated list of periods in days going back from now or the anchor, periods prefixed with + go forward from the anchor.")
+	cmd.Flags().StringVar(&opts.anchor, "anchor", "", "Name of the milestone to anchor the periods to instead of now.")
+	cmd.Flags().StringVar(&opts.at, "at", "", "Reference time (RFC 3339 or Unix seconds) to use instead of now, so the query can be reproduced later.")
+	cmd.Flags().BoolVar(&opts.alignDays, "align-days", false, "Align periods to calendar days, the current day is not included.")
+	cmd.Flags().StringVar(&opts.timezone, "timezone", "", "Timezone of calendar days for --align-days, UTC by default.")
+	cmd.Flags().StringVar(&opts.milestonesFile, "milestones", "", "YAML file with named milestones, not needed with --server.")
+	cmd.Flags().StringVar(&opts.testName, "testname", "", "Compute statistics for the given test.")
+	cmd.Flags().StringVar(&opts.server, "server", "", "URL of a ci-results server to get data from instead of the local database.")
+	output.AddFlag(cmd, &opts.output)
+
+	completion.RegisterFilterFlag(cmd)
+
+	return cmd
+}
@@ -0,0 +1,102 @@
+package releasecontroller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+const DefaultHost = "amd64.ocp.releases.ci.openshift.org"
+
+type Tag struct {
+	Name        string `json:"name"`
+	Phase       string `json:"phase"`
+	PullSpec    string `json:"pullSpec"`
+	DownloadURL string `json:"downloadURL"`
+}
+
+type ReleaseStream struct {
+	Name string `json:"name"`
+	Tags []Tag  `json:"tags"`
+}
+
+type JobResult struct {
+	State string `json:"state"`
+	URL   string `json:"url"`
+}
+
+type Results struct {
+	BlockingJobs  map[string]JobResult `json:"blockingJobs"`
+	InformingJobs map[string]JobResult `json:"informingJobs"`
+}
+
+type Release struct {
+	Name    string  `json:"name"`
+	Phase   string  `json:"phase"`
+	Results Results `json:"results"`
+}
+
+func releaseStreamURL(host, stream string) *url.URL {
+	return &url.URL{
+		Scheme: "https",
+		Host:   host,
+		Path:   fmt.Sprintf("/api/v1/releasestream/%s/tags", url.PathEscape(stream)),
+	}
+}
+
+func releaseURL(host, stream, tag string) *url.URL {
+	return &url.URL{
+		Scheme: "https",
+		Host:   host,
+		Path:   fmt.Sprintf("/api/v1/releasestream/%s/release/%s", url.PathEscape(stream), url.PathEscape(tag)),
+	}
+}
+
+func getJSON(u string, v interface{}) error {
+	resp, err := http.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("got unexpected http response from %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func GetReleaseStream(host, stream string) (*ReleaseStream, error) {
+	u := releaseStreamURL(host, stream).String()
+	klog.V(2).Infof("downloading release stream %s from %s...", stream, u)
+	var rs ReleaseStream
+	err := getJSON(u, &rs)
+	return &rs, err
+}
+
+func GetRelease(host, stream, tag string) (*Release, error) {
+	u := releaseURL(host, stream, tag).String()
+	klog.V(2).Infof("downloading release %s from %s...", tag, u)
+	var release Release
+	err := getJSON(u, &release)
+	return &release, err
+}
+
+// ParseProwURL extracts the job name and the build number from a Prow URL
+// like https://prow.ci.openshift.org/view/gs/origin-ci-test/logs/<job>/<number>.
+func ParseProwURL(u string) (jobName string, number string, ok bool) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "", "", false
+	}
+	p := strings.TrimSuffix(parsed.Path, "/")
+	number = path.Base(p)
+	jobName = path.Base(path.Dir(p))
+	if number == "." || number == "/" || jobName == "." || jobName == "/" {
+		return "", "", false
+	}
+	return jobName, number, true
+}
@@ -0,0 +1,95 @@
+package renames
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/dmage/ci-results/database"
+	"gopkg.in/yaml.v2"
+	"k8s.io/klog/v2"
+)
+
+type Rename struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// Renames maps old test names to new ones, so the history of a test is kept
+// when it is renamed. A test can be renamed several times, the old names are
+// mapped to the latest one.
+type Renames struct {
+	Renames []Rename `yaml:"renames"`
+
+	m map[string]string
+}
+
+func Parse(data []byte) (*Renames, error) {
+	var r Renames
+	if err := yaml.UnmarshalStrict(data, &r); err != nil {
+		return nil, err
+	}
+	r.m = make(map[string]string)
+	for i, rename := range r.Renames {
+		if rename.From == "" || rename.To == "" {
+			return nil, fmt.Errorf("rename #%d: from and to must be set", i+1)
+		}
+		if rename.From == rename.To {
+			return nil, fmt.Errorf("rename #%d: test %q is renamed to itself", i+1, rename.From)
+		}
+		if _, ok := r.m[rename.From]; ok {
+			return nil, fmt.Errorf("rename #%d: test %q is renamed more than once", i+1, rename.From)
+		}
+		r.m[rename.From] = rename.To
+	}
+	for from := range r.m {
+		to, err := r.resolve(from)
+		if err != nil {
+			return nil, err
+		}
+		r.m[from] = to
+	}
+	return &r, nil
+}
+
+// resolve follows the chain of renames that starts with the test.
+func (r *Renames) resolve(name string) (string, error) {
+	seen := map[string]bool{name: true}
+	for {
+		to, ok := r.m[name]
+		if !ok {
+			return name, nil
+		}
+		if seen[to] {
+			return "", fmt.Errorf("test %q is renamed in a cycle", to)
+		}
+		seen[to] = true
+		name = to
+	}
+}
+
+func Load(filename string) (*Renames, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	r, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return r, nil
+}
+
+// Map returns the latest names of the tests keyed by their old names.
+func (r *Renames) Map() map[string]string {
+	return r.m
+}
+
+// Apply stores the renames in the database.
+func Apply(db *database.DB, r *Renames) error {
+	n, err := db.SetTestRenames(r.Map())
+	if err != nil {
+		return err
+	}
+	klog.Infof("Updated %d test renames", n)
+	return nil
+}
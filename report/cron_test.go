@@ -0,0 +1,116 @@
+package report
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	testCases := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{expr: "0 9 * * 1"},
+		{expr: "*/15 * * * *"},
+		{expr: "0,30 8-18 * * 1-5"},
+		{expr: "0 0 1 */3 *"},
+		{expr: "30 6 * * 7"},
+		{expr: "@daily"},
+		{expr: "@weekly"},
+		{expr: "", wantErr: true},
+		{expr: "* * * *", wantErr: true},
+		{expr: "* * * * * *", wantErr: true},
+		{expr: "@yearly", wantErr: true},
+		{expr: "60 * * * *", wantErr: true},
+		{expr: "* 24 * * *", wantErr: true},
+		{expr: "* * 0 * *", wantErr: true},
+		{expr: "* * * 13 *", wantErr: true},
+		{expr: "* * * * 8", wantErr: true},
+		{expr: "*/0 * * * *", wantErr: true},
+		{expr: "5-1 * * * *", wantErr: true},
+		{expr: "1,,2 * * * *", wantErr: true},
+		{expr: "mon * * * *", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			_, err := ParseSchedule(tc.expr)
+			if tc.wantErr && err == nil {
+				t.Error("expected an error")
+			}
+			if !tc.wantErr && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	date := func(s string) time.Time {
+		t.Helper()
+		v, err := time.Parse("2006-01-02 15:04:05", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	testCases := []struct {
+		name string
+		expr string
+		now  string
+		want string
+	}{
+		{name: "next Monday", expr: "0 9 * * 1", now: "2021-07-03 10:00:00", want: "2021-07-05 09:00:00"},
+		{name: "step", expr: "*/15 * * * *", now: "2021-07-03 10:07:30", want: "2021-07-03 10:15:00"},
+		{name: "strictly after", expr: "@daily", now: "2021-07-03 00:00:00", want: "2021-07-04 00:00:00"},
+		{name: "next year", expr: "0 0 1 * *", now: "2021-12-15 12:00:00", want: "2022-01-01 00:00:00"},
+		{name: "day of month or day of week", expr: "0 0 13 * 5", now: "2021-07-07 12:00:00", want: "2021-07-09 00:00:00"},
+		{name: "Sunday as 7", expr: "30 6 * * 7", now: "2021-07-03 12:00:00", want: "2021-07-04 06:30:00"},
+		{name: "weekdays", expr: "0 12 * * 1-5", now: "2021-07-02 13:00:00", want: "2021-07-05 12:00:00"},
+		{name: "leap day", expr: "0 0 29 2 *", now: "2021-03-01 00:00:00", want: "2024-02-29 00:00:00"},
+		{name: "never", expr: "0 0 30 2 *", now: "2021-07-03 00:00:00"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := ParseSchedule(tc.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := s.Next(date(tc.now))
+			if tc.want == "" {
+				if !got.IsZero() {
+					t.Errorf("got %s, want no runs", got)
+				}
+				return
+			}
+			if want := date(tc.want); !got.Equal(want) {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestValidateConfigs(t *testing.T) {
+	valid := Config{Name: "weekly", Schedule: "0 9 * * 1", Publish: []string{"/tmp/weekly.html"}}
+	testCases := []struct {
+		name    string
+		reports []Config
+		wantErr bool
+	}{
+		{name: "valid", reports: []Config{valid}},
+		{name: "invalid schedule", reports: []Config{{Name: "weekly", Schedule: "0 9 * * monday", Publish: []string{"/tmp/weekly.html"}}}, wantErr: true},
+		{name: "no schedule", reports: []Config{{Name: "weekly", Publish: []string{"/tmp/weekly.html"}}}, wantErr: true},
+		{name: "duplicate names", reports: []Config{valid, valid}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateConfigs(tc.reports)
+			if tc.wantErr && err == nil {
+				t.Error("expected an error")
+			}
+			if !tc.wantErr && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package report
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/completion"
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/links"
+	"github.com/dmage/ci-results/output"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+//go:embed templates
+var templates embed.FS
+
+type Regression struct {
+	Columns      []string              `json:"columns"`
+	Current      database.StatsValues  `json:"current"`
+	Previous     database.StatsValues  `json:"previous"`
+	CurrentRate  float64               `json:"current_rate"`
+	PreviousRate float64               `json:"previous_rate"`
+	Delta        float64               `json:"delta"`
+	PValue       *float64              `json:"pvalue,omitempty"`
+	Annotations  []database.Annotation `json:"annotations,omitempty"`
+	Links        map[string]string     `json:"links,omitempty"`
+}
+
+type Report struct {
+	Generated     time.Time                 `json:"generated"`
+	Filter        string                    `json:"filter"`
+	Regressions   []Regression              `json:"regressions"`
+	FlakiestTests []database.FlakinessScore `json:"flakiest_tests"`
+	VariantHealth []database.HealthScore    `json:"variant_health"`
+	Annotations   []database.Annotation     `json:"annotations"`
+}
+
+func passRate(v database.StatsValues) float64 {
+	total := v.Pass + v.Flake + v.Fail
+	if total == 0 {
+		return 0
+	}
+	return float64(v.Pass+v.Flake) / float64(total)
+}
+
+func Build(db *database.DB, filter string, limit int, lb *links.Builder) (*Report, error) {
+	report := &Report{
+		Generated: time.Now(),
+		Filter:    filter,
+	}
+
+	stats, err := db.BuildStats("name", filter, "7,7", "")
+	if err != nil {
+		return nil, fmt.Errorf("unable to get build stats: %w", err)
+	}
+	stats.ComputeSignificance()
+	for _, row := range stats.Data {
+		curr, prev := row.Values[0], row.Values[1]
+		if curr.Pass+curr.Flake+curr.Fail == 0 || prev.Pass+prev.Flake+prev.Fail == 0 {
+			continue
+		}
+		r := Regression{
+			Columns:      row.Columns,
+			Current:      curr,
+			Previous:     prev,
+			CurrentRate:  passRate(curr),
+			PreviousRate: passRate(prev),
+			PValue:       row.PValue,
+			Annotations:  row.Annotations,
+		}
+		r.Delta = r.CurrentRate - r.PreviousRate
+		if r.Delta < 0 {
+			report.Regressions = append(report.Regressions, r)
+		}
+	}
+	sort.Slice(report.Regressions, func(i, j int) bool {
+		return report.Regressions[i].Delta < report.Regressions[j].Delta
+	})
+	if len(report.Regressions) > limit {
+		report.Regressions = report.Regressions[:limit]
+	}
+
+	jobs, err := db.ListJobs(filter, 7)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get jobs: %w", err)
+	}
+	dashboards := make(map[string]string, len(jobs))
+	for _, job := range jobs {
+		dashboards[job.Name] = job.Dashboard
+	}
+	for i := range report.Regressions {
+		name := report.Regressions[i].Columns[0]
+		if dashboard, ok := dashboards[name]; ok {
+			report.Regressions[i].Links = lb.Job(dashboard, name)
+		}
+	}
+
+	report.FlakiestTests, err = db.FlakinessScores("tests", "score", limit)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get flakiness scores: %w", err)
+	}
+
+	report.VariantHealth, err = db.HealthScores("sippytags", filter, 7, database.HealthWeights{Pass: 1, Flake: 1, Streak: 1, Freshness: 1})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get health scores: %w", err)
+	}
+
+	release := links.FilterRelease(filter)
+	for i, s := range report.FlakiestTests {
+		report.FlakiestTests[i].Links = lb.Test(release, s.Name)
+	}
+	for i, s := range report.VariantHealth {
+		report.VariantHealth[i].Links = lb.Variant(release, s.Columns[0])
+	}
+
+	report.Annotations, err = db.ListAnnotations(database.AnnotationFilter{
+		Since: report.Generated.AddDate(0, 0, -7).Unix() * 1000,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get annotations: %w", err)
+	}
+	for i, a := range report.Annotations {
+		if a.Job != "" {
+			report.Annotations[i].Links = lb.Build(a.Dashboard, a.Job, a.Build, "")
+		}
+	}
+
+	return report, nil
+}
+
+var funcs = map[string]interface{}{
+	"percent": func(v float64) string {
+		return fmt.Sprintf("%.1f%%", 100*v)
+	},
+	"pvalue": func(p *float64) string {
+		if p == nil {
+			return ""
+		}
+		return fmt.Sprintf("%.3f", *p)
+	},
+	"join": strings.Join,
+}
+
+type template interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+func loadTemplate(name string, html bool) (template, error) {
+	var content []byte
+	var err error
+	if name == "" {
+		if html {
+			content, err = templates.ReadFile("templates/weekly.html.tmpl")
+		} else {
+			content, err = templates.ReadFile("templates/weekly.md.tmpl")
+		}
+	} else {
+		content, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if html {
+		return htmltemplate.New(filepath.Base(name)).Funcs(funcs).Parse(string(content))
+	}
+	return texttemplate.New(filepath.Base(name)).Funcs(funcs).Parse(string(content))
+}
+
+type ReportOptions struct {
+	template string
+	out      string
+	format   string
+	filter   string
+	limit    int
+	output   string
+	links    links.Builder
+}
+
+func (opts *ReportOptions) Run(ctx context.Context) (err error) {
+	if err := output.Validate(opts.output); err != nil {
+		return err
+	}
+
+	format := opts.format
+	if format == "" {
+		format = "markdown"
+		if ext := filepath.Ext(opts.out); ext == ".html" || ext == ".htm" {
+			format = "html"
+		}
+	}
+	if format != "html" && format != "markdown" {
+		return fmt.Errorf("unknown format %s", format)
+	}
+
+	tmpl, err := loadTemplate(opts.template, format == "html")
+	if err != nil {
+		return fmt.Errorf("unable to load template: %w", err)
+	}
+
+	db, err := database.OpenDefault()
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer func() {
+		closeErr := db.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	report, err := Build(db, opts.filter, opts.limit, &opts.links)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if opts.out != "" && opts.out != "-" {
+		f, err := os.Create(opts.out)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			closeErr := f.Close()
+			if err == nil {
+				err = closeErr
+			}
+		}()
+		out = f
+	}
+
+	return output.Print(out, opts.output, report, func(out io.Writer) error {
+		return tmpl.Execute(out, report)
+	})
+}
+
+func NewCmdReport() *cobra.Command {
+	opts := &ReportOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "report",
+		Short: "Generate a report from the database",
+		Long: heredoc.Doc(`
+			Render a report with the top regressions, the flakiest tests and the
+			health of variants. The report is rendered using the built-in template
+			unless a custom Go template is provided.
+		`),
+		Example: heredoc.Doc(`
+			ci-results report --out=report.html
+			ci-results report --template=weekly.tmpl --format=markdown
+			ci-results report -o json | jq '.regressions[0]'
+		`),
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.template, "template", "", "Go template to render the report with.")
+	cmd.Flags().StringVar(&opts.out, "out", "-", "File to write the report to.")
+	cmd.Flags().StringVar(&opts.format, "format", "", "Report format (html, markdown), guessed from --out by default.")
+	cmd.Flags().StringVar(&opts.filter, "filter", "", "Space separated list of tags, tags prefixed with - are excluded.")
+	cmd.Flags().IntVar(&opts.limit, "limit", 20, "Number of entries in each section of the report.")
+	links.AddFlags(cmd, &opts.links)
+	output.AddFlag(cmd, &opts.output)
+
+	completion.RegisterFilterFlag(cmd)
+
+	return cmd
+}
@@ -0,0 +1,237 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmage/ci-results/config"
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/gcs"
+	"github.com/dmage/ci-results/links"
+	"github.com/dmage/ci-results/output"
+	"k8s.io/klog/v2"
+)
+
+// Config is a report that is rendered and published on a schedule. It is
+// read from the reports section of the config file.
+type Config struct {
+	Name     string `mapstructure:"name"`
+	Schedule string `mapstructure:"schedule"`
+	Filter   string `mapstructure:"filter"`
+	Limit    int    `mapstructure:"limit"`
+	// Format is html, markdown or json.
+	Format   string `mapstructure:"format"`
+	Template string `mapstructure:"template"`
+	// Publish is a list of destinations: local paths, gs://bucket/object
+	// URLs or http(s) webhooks that the report is POSTed to. {date} in
+	// destinations is replaced with the date of the run.
+	Publish []string `mapstructure:"publish"`
+
+	schedule *Schedule
+}
+
+var contentTypes = map[string]string{
+	"html":     "text/html; charset=utf-8",
+	"markdown": "text/markdown; charset=utf-8",
+	"json":     "application/json",
+}
+
+func (c *Config) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	var err error
+	c.schedule, err = ParseSchedule(c.Schedule)
+	if err != nil {
+		return err
+	}
+	if c.Limit == 0 {
+		c.Limit = 20
+	}
+	if c.Format == "" {
+		c.Format = "html"
+	}
+	if _, ok := contentTypes[c.Format]; !ok {
+		return fmt.Errorf("unknown format %s", c.Format)
+	}
+	if len(c.Publish) == 0 {
+		return fmt.Errorf("no destinations to publish to")
+	}
+	for _, dest := range c.Publish {
+		if strings.HasPrefix(dest, "gs://") {
+			if _, _, err := gcs.ParseURL(dest); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Render writes the report in the format (html, markdown or json). The
+// built-in template is used unless a custom one is given.
+func Render(w io.Writer, report *Report, format string, template string) error {
+	if format == "json" {
+		return output.Print(w, output.JSON, report, nil)
+	}
+	if format != "html" && format != "markdown" {
+		return fmt.Errorf("unknown format %s", format)
+	}
+	tmpl, err := loadTemplate(template, format == "html")
+	if err != nil {
+		return fmt.Errorf("unable to load template: %w", err)
+	}
+	return tmpl.Execute(w, report)
+}
+
+// Scheduler renders and publishes reports on their schedules and records
+// their runs in the database.
+type Scheduler struct {
+	db      *database.DB
+	reports []Config
+	gcs     *gcs.Client
+	links   *links.Builder
+}
+
+func validateConfigs(reports []Config) error {
+	seen := make(map[string]bool)
+	for i := range reports {
+		if err := reports[i].validate(); err != nil {
+			return fmt.Errorf("report #%d: %w", i+1, err)
+		}
+		if seen[reports[i].Name] {
+			return fmt.Errorf("report #%d: duplicate name %q", i+1, reports[i].Name)
+		}
+		seen[reports[i].Name] = true
+	}
+	return nil
+}
+
+// LoadConfigs reads the reports section of the config file. The reports are
+// validated right away, so an invalid schedule is reported before the server
+// starts rather than when the scheduler is created.
+func LoadConfigs() ([]Config, error) {
+	var reports []Config
+	if err := config.UnmarshalKey("reports", &reports); err != nil {
+		return nil, err
+	}
+	if err := validateConfigs(reports); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+func NewScheduler(db *database.DB, reports []Config, gcsClient *gcs.Client, lb *links.Builder) (*Scheduler, error) {
+	if err := validateConfigs(reports); err != nil {
+		return nil, err
+	}
+	return &Scheduler{
+		db:      db,
+		reports: reports,
+		gcs:     gcsClient,
+		links:   lb,
+	}, nil
+}
+
+// Run publishes the reports on their schedules until the context is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := range s.reports {
+		c := &s.reports[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				next := c.schedule.Next(time.Now())
+				if next.IsZero() {
+					klog.Warningf("Report %s has no upcoming runs", c.Name)
+					return
+				}
+				klog.V(2).Infof("Next run of report %s is at %s", c.Name, next)
+				timer := time.NewTimer(time.Until(next))
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+				if err := s.run(ctx, c, next); err != nil {
+					klog.Errorf("Unable to publish report %s: %v", c.Name, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) run(ctx context.Context, c *Config, now time.Time) (err error) {
+	id, err := s.db.StartReportRun(c.Name)
+	if err != nil {
+		return fmt.Errorf("unable to record the run: %w", err)
+	}
+	defer func() {
+		status, msg := database.ReportRunSucceeded, ""
+		if err != nil {
+			status, msg = database.ReportRunFailed, err.Error()
+		}
+		if finishErr := s.db.FinishReportRun(id, status, msg); finishErr != nil && err == nil {
+			err = fmt.Errorf("unable to record the run: %w", finishErr)
+		}
+	}()
+
+	report, err := Build(s.db, c.Filter, c.Limit, s.links)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := Render(&buf, report, c.Format, c.Template); err != nil {
+		return err
+	}
+
+	var errs []string
+	for _, dest := range c.Publish {
+		dest = strings.ReplaceAll(dest, "{date}", now.Format("2006-01-02"))
+		if err := s.publish(ctx, dest, contentTypes[c.Format], buf.Bytes()); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", dest, err))
+			continue
+		}
+		klog.Infof("Published report %s to %s", c.Name, dest)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("unable to publish: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (s *Scheduler) publish(ctx context.Context, dest string, contentType string, data []byte) error {
+	switch {
+	case strings.HasPrefix(dest, "gs://"):
+		return s.gcs.Upload(ctx, dest, contentType, bytes.NewReader(data))
+	case strings.HasPrefix(dest, "http://"), strings.HasPrefix(dest, "https://"):
+		req, err := http.NewRequestWithContext(ctx, "POST", dest, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", contentType)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("got unexpected http response: %s", resp.Status)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(dest, data, 0644)
+}
@@ -0,0 +1,301 @@
+// Package s3 uploads and downloads objects of Amazon S3 and S3-compatible
+// storages.
+package s3
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const DefaultRegion = "us-east-1"
+
+// unsignedPayload is used instead of the hash of uploaded bodies, so that
+// files are not read twice. The body is protected by TLS.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// emptyPayloadHash is the SHA-256 hash of an empty body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// Client uploads and downloads objects using the S3 REST API. Requests are
+// signed with AWS Signature Version 4. Objects are uploaded with a single
+// request, so they can't be bigger than 5 GiB.
+type Client struct {
+	// URL is the endpoint of an S3-compatible storage, objects are
+	// addressed as URL/bucket/key. If URL is empty, the AWS endpoint of the
+	// region is used.
+	URL string
+	// Region is the region of the buckets, AWS_REGION or DefaultRegion if
+	// empty.
+	Region string
+	// CredentialsFile is an AWS shared credentials file, the profile is
+	// taken from AWS_PROFILE. If CredentialsFile is not set, the credentials
+	// are taken from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+	// AWS_SESSION_TOKEN.
+	CredentialsFile string
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+type credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// ParseURL splits a s3://bucket/key URL.
+func ParseURL(u string) (bucket string, key string, err error) {
+	path := strings.TrimPrefix(u, "s3://")
+	if path == u {
+		return "", "", fmt.Errorf("invalid S3 URL %q: expected s3://bucket/key", u)
+	}
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid S3 URL %q: expected s3://bucket/key", u)
+	}
+	return parts[0], parts[1], nil
+}
+
+func (c *Client) region() string {
+	if c.Region != "" {
+		return c.Region
+	}
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	return DefaultRegion
+}
+
+func (c *Client) credentials() (credentials, error) {
+	if c.CredentialsFile == "" {
+		creds := credentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+		if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+			return creds, fmt.Errorf("no S3 credentials: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set")
+		}
+		return creds, nil
+	}
+
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	f, err := os.Open(c.CredentialsFile)
+	if err != nil {
+		return credentials{}, err
+	}
+	defer f.Close()
+	creds, err := parseCredentials(f, profile)
+	if err != nil {
+		return creds, fmt.Errorf("%s: %w", c.CredentialsFile, err)
+	}
+	return creds, nil
+}
+
+// parseCredentials reads the profile from a shared credentials file, which
+// is an INI file with a section per profile.
+func parseCredentials(r io.Reader, profile string) (credentials, error) {
+	var creds credentials
+	section := ""
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i == -1 {
+			continue
+		}
+		value := strings.TrimSpace(line[i+1:])
+		switch strings.TrimSpace(line[:i]) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = value
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = value
+		case "aws_session_token":
+			creds.SessionToken = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return creds, err
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return creds, fmt.Errorf("profile %s has no aws_access_key_id or aws_secret_access_key", profile)
+	}
+	return creds, nil
+}
+
+// escapePath escapes the path as S3 expects in signed requests: everything
+// except unreserved characters and slashes is percent-encoded.
+func escapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~/", c) != -1 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// objectURL returns the URL of the object. AWS buckets are addressed by
+// their host names, other storages by their paths.
+func (c *Client) objectURL(bucket, key string) string {
+	if c.URL != "" {
+		return strings.TrimSuffix(c.URL, "/") + "/" + escapePath(bucket+"/"+key)
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, c.region(), escapePath(key))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// sign adds the Authorization header to the request. All headers that are
+// set on the request are signed.
+func sign(req *http.Request, creds credentials, region string, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{
+		"host": req.URL.Host,
+	}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func (c *Client) do(ctx context.Context, method string, u string, contentType string, body io.Reader) (*http.Response, error) {
+	creds, err := c.credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	bucket, key, err := ParseURL(u)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.objectURL(bucket, key), body)
+	if err != nil {
+		return nil, err
+	}
+	// S3 doesn't accept the chunked encoding.
+	if f, ok := body.(*os.File); ok {
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = fi.Size()
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	payloadHash := emptyPayloadHash
+	if body != nil {
+		payloadHash = unsignedPayload
+	}
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+	sign(req, creds, c.region(), payloadHash, now())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		// The body has an XML document with the reason.
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("got unexpected http response from %s %s: %s: %s", method, req.URL, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// Upload writes the object at the s3://bucket/key URL.
+func (c *Client) Upload(ctx context.Context, u string, contentType string, body io.Reader) error {
+	resp, err := c.do(ctx, "PUT", u, contentType, body)
+	if err != nil {
+		return fmt.Errorf("unable to upload %s: %w", u, err)
+	}
+	return resp.Body.Close()
+}
+
+// Download writes the content of the object at the s3://bucket/key URL into
+// w.
+func (c *Client) Download(ctx context.Context, u string, w io.Writer) error {
+	resp, err := c.do(ctx, "GET", u, "", nil)
+	if err != nil {
+		return fmt.Errorf("unable to download %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("unable to download %s: %w", u, err)
+	}
+	return nil
+}
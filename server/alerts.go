@@ -0,0 +1,30 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dmage/ci-results/alerts"
+)
+
+// ServeAlerts lists the pending and firing alerts of the alert rules.
+func (opts *ServerOptions) ServeAlerts(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	switch state {
+	case "", alerts.StatePending, alerts.StateFiring:
+	default:
+		http.Error(w, "400 bad request: state must be pending or firing", 400)
+		return
+	}
+
+	active := []alerts.ActiveAlert{}
+	if opts.alerts != nil {
+		for _, a := range opts.alerts.Alerts() {
+			if state == "" || a.State == state {
+				active = append(active, a)
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(active)
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dmage/ci-results/database"
+	"k8s.io/klog/v2"
+)
+
+// maxAnnotationSize limits the size of the request body of POST
+// /api/annotations.
+const maxAnnotationSize = 64 * 1024
+
+func (opts *ServerOptions) annotationLinks(a *database.Annotation) {
+	if a.Job != "" {
+		a.Links = opts.links.Build(a.Dashboard, a.Job, a.Build, "")
+	}
+}
+
+// ServeAnnotations lists annotations, adds (POST) the annotation from the
+// request body or removes (DELETE) the annotation given in the id parameter.
+func (opts *ServerOptions) ServeAnnotations(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		opts.listAnnotations(w, r)
+	case http.MethodPost:
+		if opts.authorize(w, r) {
+			opts.addAnnotation(w, r)
+		}
+	case http.MethodDelete:
+		if opts.authorize(w, r) {
+			opts.removeAnnotation(w, r)
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "405 method not allowed", 405)
+	}
+}
+
+func (opts *ServerOptions) listAnnotations(w http.ResponseWriter, r *http.Request) {
+	days, err := queryInt(r, "days", 0, 0, 3650)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	filter := database.AnnotationFilter{
+		Job:   r.URL.Query().Get("job"),
+		Build: r.URL.Query().Get("build"),
+		Test:  r.URL.Query().Get("test"),
+	}
+	if days != 0 {
+		filter.Since = time.Now().AddDate(0, 0, -days).Unix() * 1000
+	}
+
+	annotations, err := opts.db.ListAnnotations(filter)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	for i := range annotations {
+		opts.annotationLinks(&annotations[i])
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(annotations)
+}
+
+// addAnnotation adds the annotation from the request body, it has the same
+// fields as the annotations in the list: job and build, test, note and
+// author.
+func (opts *ServerOptions) addAnnotation(w http.ResponseWriter, r *http.Request) {
+	var req database.Annotation
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAnnotationSize)).Decode(&req); err != nil {
+		http.Error(w, "400 bad request: invalid annotation: "+err.Error(), 400)
+		return
+	}
+
+	var id int64
+	err := opts.writer.Do(r.Context(), func(tx *database.Tx) (err error) {
+		id, err = tx.AddAnnotation(req.Job, req.Build, req.Test, req.Note, req.Author)
+		return err
+	})
+	if database.IsNotFound(err) {
+		http.Error(w, "404 not found: "+err.Error(), 404)
+		return
+	} else if err != nil {
+		serveError(w, err)
+		return
+	}
+	klog.Infof("POST annotation %d", id)
+
+	annotation, err := opts.db.GetAnnotation(id)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	opts.annotationLinks(&annotation)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(annotation)
+}
+
+func (opts *ServerOptions) removeAnnotation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "400 bad request: id is required", 400)
+		return
+	}
+
+	err = opts.writer.Do(r.Context(), func(tx *database.Tx) error {
+		return tx.RemoveAnnotation(id)
+	})
+	if database.IsNotFound(err) {
+		http.Error(w, "404 not found: "+err.Error(), 404)
+		return
+	} else if err != nil {
+		serveError(w, err)
+		return
+	}
+	klog.Infof("DELETE annotation %d", id)
+	w.WriteHeader(http.StatusNoContent)
+}
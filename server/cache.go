@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/dmage/ci-results/database"
+	lru "github.com/hashicorp/golang-lru"
+	"k8s.io/klog/v2"
+)
+
+type statsCacheEntry struct {
+	stats   *database.Stats
+	version int64
+	created time.Time
+}
+
+// statsCache keeps results of BuildStats until the database changes or they
+// get older than the TTL. Results of relative periods shift with time, so the
+// TTL bounds how stale they can be.
+type statsCache struct {
+	version *database.DataVersion
+	ttl     time.Duration
+	cache   *lru.Cache
+}
+
+func newStatsCache(ctx context.Context, db *database.DB, size int, ttl time.Duration) (*statsCache, error) {
+	version, err := db.DataVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cache, err := lru.New(size)
+	if err != nil {
+		version.Close()
+		return nil, err
+	}
+	return &statsCache{
+		version: version,
+		ttl:     ttl,
+		cache:   cache,
+	}, nil
+}
+
+func (c *statsCache) Close() error {
+	if c == nil {
+		return nil
+	}
+	return c.version.Close()
+}
+
+func statsCacheKey(parts ...string) string {
+	return strings.Join(parts, "\x00")
+}
+
+// get returns the cached result for the key or stores the result of compute.
+// The result may be shared, only its fields can be replaced.
+func (c *statsCache) get(ctx context.Context, key string, compute func() (*database.Stats, error)) (*database.Stats, error) {
+	if c == nil {
+		return compute()
+	}
+
+	version, err := c.version.Get(ctx)
+	if err != nil {
+		klog.Warningf("unable to get the data version, bypassing the stats cache: %s", err)
+		return compute()
+	}
+
+	if obj, ok := c.cache.Get(key); ok {
+		entry := obj.(statsCacheEntry)
+		if entry.version == version && time.Since(entry.created) < c.ttl {
+			stats := *entry.stats
+			return &stats, nil
+		}
+	}
+
+	stats, err := compute()
+	if err != nil {
+		return nil, err
+	}
+	c.cache.Add(key, statsCacheEntry{
+		stats:   stats,
+		version: version,
+		created: time.Now(),
+	})
+	copied := *stats
+	return &copied, nil
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/dmage/ci-results/database"
+)
+
+// ServeIndexRuns lists the latest runs of the indexer.
+func (opts *ServerOptions) ServeIndexRuns(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit", 20, 1, 1000)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	runs, err := opts.db.IndexRuns(limit)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
+
+// ServeIndexRunErrors lists the dashboards, jobs and builds that the run has
+// skipped.
+func (opts *ServerOptions) ServeIndexRunErrors(w http.ResponseWriter, r *http.Request, runID string) {
+	id, err := strconv.ParseInt(runID, 10, 64)
+	if err != nil {
+		http.Error(w, "400 bad request: invalid index run id "+strconv.Quote(runID), 400)
+		return
+	}
+
+	errs, err := opts.db.IndexRunErrors(id)
+	if database.IsNotFound(err) {
+		http.Error(w, "404 not found: "+err.Error(), 404)
+		return
+	} else if err != nil {
+		serveError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(errs)
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/releasecontroller"
+	"k8s.io/klog/v2"
+)
+
+const (
+	blockingJobWeight  = 1.0
+	informingJobWeight = 0.2
+
+	// A failure of a test that passes at least this often is a regression.
+	regressionPassRate = 0.9
+)
+
+type PayloadJob struct {
+	Name        string                  `json:"name"`
+	Job         string                  `json:"job"`
+	Number      string                  `json:"number"`
+	State       string                  `json:"state"`
+	Blocking    bool                    `json:"blocking"`
+	FailedTests []database.BuildFailure `json:"failed_tests"`
+	Score       float64                 `json:"score"`
+	Links       map[string]string       `json:"links,omitempty"`
+}
+
+type PayloadRisk struct {
+	Tag            string       `json:"tag"`
+	Phase          string       `json:"phase"`
+	Score          float64      `json:"score"`
+	RegressedTests int          `json:"regressed_tests"`
+	Jobs           []PayloadJob `json:"jobs"`
+}
+
+func (opts *ServerOptions) payloadJobs(jobs map[string]releasecontroller.JobResult, blocking bool, risk *PayloadRisk) error {
+	weight := informingJobWeight
+	if blocking {
+		weight = blockingJobWeight
+	}
+
+	for name, result := range jobs {
+		job := PayloadJob{
+			Name:        name,
+			State:       result.State,
+			Blocking:    blocking,
+			FailedTests: []database.BuildFailure{},
+		}
+		jobName, number, ok := releasecontroller.ParseProwURL(result.URL)
+		if ok {
+			job.Job, job.Number = jobName, number
+			job.Links = opts.links.Build("", jobName, number, "")
+			failures, err := opts.db.BuildFailedTests(jobName, number, 7)
+			if err != nil && !database.IsNotFound(err) {
+				return err
+			}
+			for _, f := range failures {
+				if f.PassRate == nil {
+					continue
+				}
+				job.Score += weight * *f.PassRate
+				if blocking && *f.PassRate >= regressionPassRate {
+					risk.RegressedTests++
+				}
+			}
+			if failures != nil {
+				job.FailedTests = failures
+			}
+		}
+		risk.Score += job.Score
+		risk.Jobs = append(risk.Jobs, job)
+	}
+	return nil
+}
+
+func (opts *ServerOptions) ServePayloadRisk(w http.ResponseWriter, r *http.Request) {
+	stream := r.URL.Query().Get("stream")
+	if stream == "" {
+		http.Error(w, "400 bad request: stream is required", 400)
+		return
+	}
+
+	limit, err := queryInt(r, "limit", 5, 1, 50)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	rs, err := releasecontroller.GetReleaseStream(opts.releaseControllerHost, stream)
+	if err != nil {
+		klog.Info(err)
+		http.Error(w, "502 bad gateway", 502)
+		return
+	}
+
+	payloads := []PayloadRisk{}
+	for i, tag := range rs.Tags {
+		if i >= limit {
+			break
+		}
+		release, err := releasecontroller.GetRelease(opts.releaseControllerHost, stream, tag.Name)
+		if err != nil {
+			klog.Info(err)
+			http.Error(w, "502 bad gateway", 502)
+			return
+		}
+
+		risk := PayloadRisk{
+			Tag:   tag.Name,
+			Phase: tag.Phase,
+			Jobs:  []PayloadJob{},
+		}
+		if err := opts.payloadJobs(release.Results.BlockingJobs, true, &risk); err != nil {
+			serveError(w, err)
+			return
+		}
+		if err := opts.payloadJobs(release.Results.InformingJobs, false, &risk); err != nil {
+			serveError(w, err)
+			return
+		}
+		sort.Slice(risk.Jobs, func(i, j int) bool {
+			return risk.Jobs[i].Score > risk.Jobs[j].Score
+		})
+		payloads = append(payloads, risk)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payloads)
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dmage/ci-results/database"
+)
+
+// addFailureLinks sets links to pages, logs and artifacts of the failed
+// builds.
+func (opts *ServerOptions) addFailureLinks(failures []database.TestFailure) {
+	for i := range failures {
+		f := &failures[i]
+		f.Links = opts.links.Build(f.Dashboard, f.Job, f.Build, f.Target)
+	}
+}
+
+type regression struct {
+	database.SustainedRegression
+	RecentFailures []database.TestFailure `json:"recent_failures"`
+	Links          map[string]string      `json:"links,omitempty"`
+}
+
+// ServeRegressions lists tests whose pass rate has been below their baseline
+// for several days with their latest failures.
+func (opts *ServerOptions) ServeRegressions(w http.ResponseWriter, r *http.Request) {
+	filter := r.URL.Query().Get("filter")
+
+	days, err := queryInt(r, "days", 3, 1, 90)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	baselineDays, err := queryInt(r, "baseline", 14, 1, 365)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	threshold, err := queryFloat(r, "threshold", 10, 0, 100)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	minRuns, err := queryInt(r, "minruns", 5, 1, 10000)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	failures, err := queryInt(r, "failures", 5, 0, 100)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	regressions, err := opts.db.SustainedRegressions(filter, days, baselineDays, threshold/100, minRuns)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	release := queryRelease(r)
+	result := []regression{}
+	for _, reg := range regressions {
+		recent := []database.TestFailure{}
+		if failures > 0 {
+			// The current day is not a part of the regressed days, but its
+			// failures are likely to be the most interesting ones.
+			recent, err = opts.db.RecentTestFailures(reg.Test, filter, days+1, failures)
+			if err != nil {
+				serveError(w, err)
+				return
+			}
+			opts.addFailureLinks(recent)
+		}
+		result = append(result, regression{
+			SustainedRegression: reg,
+			RecentFailures:      recent,
+			Links:               opts.links.Test(release, reg.Test),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
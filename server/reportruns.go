@@ -0,0 +1,23 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ServeReportRuns lists the latest runs of scheduled reports.
+func (opts *ServerOptions) ServeReportRuns(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit", 20, 1, 1000)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	runs, err := opts.db.ReportRuns(r.URL.Query().Get("name"), limit)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
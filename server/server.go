@@ -4,18 +4,112 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/alerts"
 	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/diagnostics"
+	"github.com/dmage/ci-results/gcs"
+	"github.com/dmage/ci-results/kube"
+	"github.com/dmage/ci-results/links"
+	"github.com/dmage/ci-results/milestones"
+	"github.com/dmage/ci-results/owners"
+	"github.com/dmage/ci-results/releasecontroller"
+	"github.com/dmage/ci-results/renames"
+	"github.com/dmage/ci-results/report"
+	"github.com/dmage/ci-results/s3"
+	"github.com/dmage/ci-results/version"
 	"github.com/spf13/cobra"
 	"k8s.io/klog/v2"
 )
 
 type ServerOptions struct {
-	db *database.DB
+	listen                string
+	defaultPeriods        string
+	releaseControllerHost string
+	tokenFile             string
+	parallelPeriods       int
+	statsCacheSize        int
+	statsCacheTTL         time.Duration
+	statsCache            *statsCache
+	writer                *database.Writer
+	diagnostics           bool
+	ownersFile            string
+	renamesFile           string
+	milestonesFile        string
+	alertRulesFile        string
+	alertInterval         time.Duration
+	alertmanagerURL       string
+	pagerDutyURL          string
+	pagerDutyKeyFile      string
+	pagerDutySeverity     string
+	gcsTokenFile          string
+	gcsCredentials        string
+	gcsURL                string
+	s3                    s3.Client
+	snapshotDownload      string
+	links                 links.Builder
+	kubeInterval          time.Duration
+	kubeFilter            string
+	kubeNamespace         string
+	kubeAPIURL            string
+	kubeTokenFile         string
+
+	alerts     *alerts.Engine
+	db         *database.DB
+	tokens     []string
+	milestones *milestones.Milestones
+}
+
+func queryInt(r *http.Request, name string, def int, min int, max int) (int, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < min || v > max {
+		return 0, database.InvalidParam(name, s, fmt.Sprintf("must be a number between %d and %d", min, max))
+	}
+	return v, nil
+}
+
+// queryRelease returns the release that links to Sippy point to: the release
+// parameter or the release that the filter selects.
+func queryRelease(r *http.Request) string {
+	if release := r.URL.Query().Get("release"); release != "" {
+		return release
+	}
+	return links.FilterRelease(r.URL.Query().Get("filter"))
+}
+
+func queryFloat(r *http.Request, name string, def float64, min float64, max float64) (float64, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < min || v > max {
+		return 0, database.InvalidParam(name, s, fmt.Sprintf("must be a number between %g and %g", min, max))
+	}
+	return v, nil
+}
+
+// serveError replies with 400 if the request has invalid parameters, and
+// with 500 otherwise.
+func serveError(w http.ResponseWriter, err error) {
+	if database.IsInvalidParam(err) {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+	klog.Info(err)
+	http.Error(w, "500 internal server error", 500)
 }
 
 func (opts *ServerOptions) ServeBuilds(w http.ResponseWriter, r *http.Request) {
@@ -28,44 +122,726 @@ func (opts *ServerOptions) ServeBuilds(w http.ResponseWriter, r *http.Request) {
 
 	periods := r.URL.Query().Get("periods")
 	if periods == "" {
-		periods = "7,7"
+		periods = opts.defaultPeriods
 	}
 
 	testname := r.URL.Query().Get("testname")
 
-	stats, err := opts.db.BuildStats(columns, filter, periods, testname)
+	var popts database.PeriodOptions
+	if name := r.URL.Query().Get("anchor"); name != "" {
+		var err error
+		popts.Ref, err = opts.milestones.Get(name)
+		if err != nil {
+			http.Error(w, "400 bad request: "+err.Error(), 400)
+			return
+		}
+	}
+	if at := r.URL.Query().Get("at"); at != "" {
+		if !popts.Ref.IsZero() {
+			http.Error(w, "400 bad request: at and anchor are mutually exclusive", 400)
+			return
+		}
+		var err error
+		popts.Ref, err = database.ParseRefTime(at)
+		if err != nil {
+			http.Error(w, "400 bad request: "+err.Error(), 400)
+			return
+		}
+	}
+	switch align := r.URL.Query().Get("align"); align {
+	case "":
+	case "day":
+		popts.AlignDays = true
+	default:
+		http.Error(w, "400 bad request: align must be day", 400)
+		return
+	}
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		var err error
+		popts.Location, err = time.LoadLocation(tz)
+		if err != nil {
+			http.Error(w, "400 bad request: "+err.Error(), 400)
+			return
+		}
+	}
+
+	significance, err := queryFloat(r, "significance", 0, 0, 1)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	bucket := r.URL.Query().Get("bucket")
+
+	buckets, err := queryInt(r, "buckets", 7, 1, 365)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	var key string
+	if bucket != "" {
+		key = statsCacheKey("bucket", columns, filter, testname, bucket, strconv.Itoa(buckets))
+	} else {
+		key = statsCacheKey("periods", columns, filter, testname, periods, popts.String())
+	}
+	stats, err := opts.statsCache.get(r.Context(), key, func() (*database.Stats, error) {
+		var stats *database.Stats
+		var err error
+		if bucket != "" {
+			stats, err = opts.db.BuildStatsByBucket(columns, filter, bucket, buckets, testname)
+		} else {
+			stats, err = opts.db.BuildStatsWith(columns, filter, periods, testname, popts)
+		}
+		if err != nil {
+			return nil, err
+		}
+		stats.ComputeSignificance()
+		return stats, nil
+	})
 	if err != nil {
-		klog.Info(err)
-		http.Error(w, "500 internal server error", 500)
+		serveError(w, err)
 		return
 	}
-	r.Header.Add("Content-Type", "application/json")
+	if significance != 0 {
+		stats.FilterSignificantRegressions(significance)
+	}
+	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
 }
 
+func (opts *ServerOptions) ServeTimeline(w http.ResponseWriter, r *http.Request) {
+	columns := r.URL.Query().Get("columns")
+	if columns == "" {
+		columns = "name"
+	}
+
+	filter := r.URL.Query().Get("filter")
+	job := r.URL.Query().Get("job")
+	testname := r.URL.Query().Get("testname")
+
+	days, err := queryInt(r, "days", 14, 1, 365)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	timeline, err := opts.db.Timeline(columns, filter, job, testname, days)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(timeline)
+}
+
+func (opts *ServerOptions) ServePassRateSeries(w http.ResponseWriter, r *http.Request) {
+	filter := r.URL.Query().Get("filter")
+	job := r.URL.Query().Get("job")
+	testname := r.URL.Query().Get("testname")
+
+	days, err := queryInt(r, "days", 30, 1, 365)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	window, err := queryInt(r, "window", 7, 1, 90)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	series, err := opts.db.PassRateSeries(filter, job, testname, days, window)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(series)
+}
+
+func (opts *ServerOptions) ServeAnomalies(w http.ResponseWriter, r *http.Request) {
+	columns := r.URL.Query().Get("columns")
+	if columns == "" {
+		columns = "name"
+	}
+
+	filter := r.URL.Query().Get("filter")
+
+	recent, err := queryInt(r, "recent", 2, 1, 30)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	baseline, err := queryInt(r, "baseline", 14, 1, 365)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	threshold, err := queryFloat(r, "threshold", 3, 0, math.MaxFloat64)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	minRuns, err := queryInt(r, "minruns", 3, 1, math.MaxInt32)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	anomalies, err := opts.db.Anomalies(columns, filter, recent, baseline, threshold, minRuns)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(anomalies)
+}
+
+func (opts *ServerOptions) ServeCorrelatedFailures(w http.ResponseWriter, r *http.Request) {
+	filter := r.URL.Query().Get("filter")
+
+	days, err := queryInt(r, "days", 7, 1, 90)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	minCount, err := queryInt(r, "mincount", 3, 1, math.MaxInt32)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	minJaccard, err := queryFloat(r, "minjaccard", 0.8, 0, 1)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	correlated, err := opts.db.CorrelatedFailures(filter, days, minCount, minJaccard)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(correlated)
+}
+
+func (opts *ServerOptions) ServeNewTests(w http.ResponseWriter, r *http.Request) {
+	filter := r.URL.Query().Get("filter")
+
+	days, err := queryInt(r, "days", 7, 1, 365)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	tests, err := opts.db.NewTests(filter, days)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tests)
+}
+
+func (opts *ServerOptions) ServeDisappearedTests(w http.ResponseWriter, r *http.Request) {
+	filter := r.URL.Query().Get("filter")
+
+	recent, err := queryInt(r, "recent", 3, 1, 90)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	prior, err := queryInt(r, "prior", 7, 1, 365)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	similarity, err := queryFloat(r, "similarity", 0.6, 0, 1)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	tests, err := opts.db.DisappearedTests(filter, recent, prior, similarity)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tests)
+}
+
+func (opts *ServerOptions) ServeTestDurations(w http.ResponseWriter, r *http.Request) {
+	filter := r.URL.Query().Get("filter")
+	testname := r.URL.Query().Get("testname")
+
+	days, err := queryInt(r, "days", 7, 1, 365)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	durations, err := opts.db.TestDurations(filter, testname, days)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(durations)
+}
+
+func (opts *ServerOptions) ServeDurationIncreases(w http.ResponseWriter, r *http.Request) {
+	filter := r.URL.Query().Get("filter")
+
+	limit, err := queryInt(r, "limit", 50, 1, 10000)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	increases, err := opts.db.DurationIncreases(filter, limit)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(increases)
+}
+
+func (opts *ServerOptions) ServeJobRuntimes(w http.ResponseWriter, r *http.Request) {
+	column := r.URL.Query().Get("column")
+	if column == "" {
+		column = "name"
+	}
+
+	filter := r.URL.Query().Get("filter")
+
+	days, err := queryInt(r, "days", 14, 1, 365)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	timeout, err := queryInt(r, "timeout", 240, 1, 24*60)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	threshold, err := queryFloat(r, "threshold", 0.9, 0, 1)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	runtimes, err := opts.db.JobRuntimes(column, filter, days, time.Duration(timeout)*time.Minute, threshold)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runtimes)
+}
+
+func (opts *ServerOptions) ServeReleaseComparison(w http.ResponseWriter, r *http.Request) {
+	by := r.URL.Query().Get("by")
+	if by == "" {
+		by = "job"
+	}
+
+	releases := strings.Split(r.URL.Query().Get("releases"), ",")
+	if len(releases) < 2 {
+		http.Error(w, "400 bad request: releases must be a comma separated list of at least two releases", 400)
+		return
+	}
+
+	filter := r.URL.Query().Get("filter")
+	testname := r.URL.Query().Get("testname")
+
+	days, err := queryInt(r, "days", 7, 1, 365)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	comparison, err := opts.db.ReleaseComparison(by, releases, days, filter, testname)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comparison)
+}
+
+func (opts *ServerOptions) ServeNeverStable(w http.ResponseWriter, r *http.Request) {
+	filter := r.URL.Query().Get("filter")
+
+	days, err := queryInt(r, "days", 14, 1, 365)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	jobs, err := opts.db.NeverStableJobs(filter, days)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	for i := range jobs {
+		jobs[i].Links = opts.links.Job(jobs[i].Dashboard, jobs[i].Name)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+func (opts *ServerOptions) ServeHealthScores(w http.ResponseWriter, r *http.Request) {
+	columns := r.URL.Query().Get("columns")
+	if columns == "" {
+		columns = "sippytags"
+	}
+
+	filter := r.URL.Query().Get("filter")
+
+	days, err := queryInt(r, "days", 7, 1, 365)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	var weights database.HealthWeights
+	for _, weight := range []struct {
+		name  string
+		value *float64
+	}{
+		{"weight_pass", &weights.Pass},
+		{"weight_flake", &weights.Flake},
+		{"weight_streak", &weights.Streak},
+		{"weight_freshness", &weights.Freshness},
+	} {
+		*weight.value, err = queryFloat(r, weight.name, 1, 0, math.MaxFloat64)
+		if err != nil {
+			http.Error(w, "400 bad request: "+err.Error(), 400)
+			return
+		}
+	}
+
+	scores, err := opts.db.HealthScores(columns, filter, days, weights)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	release := queryRelease(r)
+	for i, s := range scores {
+		switch columns {
+		case "sippytags":
+			scores[i].Links = opts.links.Variant(release, s.Columns[0])
+		case "name":
+			scores[i].Links = opts.links.Job("", s.Columns[0])
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scores)
+}
+
+func (opts *ServerOptions) ServeTestDetail(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "400 bad request: name is required", 400)
+		return
+	}
+
+	filter := r.URL.Query().Get("filter")
+
+	days, err := queryInt(r, "days", 30, 1, 365)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	detail, err := opts.db.TestDetail(name, filter, days)
+	if database.IsNotFound(err) {
+		http.Error(w, "404 page not found", 404)
+		return
+	} else if err != nil {
+		serveError(w, err)
+		return
+	}
+	opts.addFailureLinks(detail.RecentFailures)
+	detail.Links = opts.links.Test(queryRelease(r), detail.Name)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
+
+func (opts *ServerOptions) ServeStreaks(w http.ResponseWriter, r *http.Request) {
+	filter := r.URL.Query().Get("filter")
+
+	days, err := queryInt(r, "days", 14, 1, 365)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	min, err := queryInt(r, "min", 3, 1, math.MaxInt32)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	streaks, err := opts.db.FailureStreaks(filter, days, min)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	for i := range streaks {
+		streaks[i].Links = opts.links.Job(streaks[i].Dashboard, streaks[i].Job)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(streaks)
+}
+
+func (opts *ServerOptions) ServeJobs(w http.ResponseWriter, r *http.Request) {
+	filter := r.URL.Query().Get("filter")
+
+	days, err := queryInt(r, "days", 7, 1, 365)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	jobs, err := opts.db.ListJobs(filter, days)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	for i := range jobs {
+		jobs[i].Links = opts.links.Job(jobs[i].Dashboard, jobs[i].Name)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+func (opts *ServerOptions) ServeMilestones(w http.ResponseWriter, r *http.Request) {
+	list := []milestones.Milestone{}
+	if opts.milestones != nil {
+		list = opts.milestones.Milestones
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+func (opts *ServerOptions) ServeVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(version.Get())
+}
+
 func (opts *ServerOptions) ServeListTests(w http.ResponseWriter, r *http.Request) {
 	tests, err := opts.db.ListTests()
 	if err != nil {
-		klog.Info(err)
-		http.Error(w, "500 internal server error", 500)
+		serveError(w, err)
 		return
 	}
-	r.Header.Add("Content-Type", "application/json")
+	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(tests)
 }
 
+func (opts *ServerOptions) ServeSearchTests(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+
+	limit, err := queryInt(r, "limit", 20, 1, 1000)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	tests, err := opts.db.SearchTests(q, limit)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tests)
+}
+
+func (opts *ServerOptions) ServeFlakiness(w http.ResponseWriter, r *http.Request) {
+	kind := r.URL.Query().Get("kind")
+	if kind == "" {
+		kind = "tests"
+	}
+
+	sort := r.URL.Query().Get("sort")
+	if sort == "" {
+		sort = "score"
+	}
+
+	limit, err := queryInt(r, "limit", 100, 1, 10000)
+	if err != nil {
+		http.Error(w, "400 bad request: "+err.Error(), 400)
+		return
+	}
+
+	scores, err := opts.db.FlakinessScores(kind, sort, limit)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	release := queryRelease(r)
+	for i, s := range scores {
+		if kind == "jobs" {
+			scores[i].Links = opts.links.Job("", s.Name)
+		} else {
+			scores[i].Links = opts.links.Test(release, s.Name)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scores)
+}
+
 func (opts *ServerOptions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch r.URL.Path {
 	case "/api/builds":
 		opts.ServeBuilds(w, r)
+	case "/api/timeline":
+		opts.ServeTimeline(w, r)
+	case "/api/pass-rate-series":
+		opts.ServePassRateSeries(w, r)
+	case "/api/anomalies":
+		opts.ServeAnomalies(w, r)
+	case "/api/correlated-failures":
+		opts.ServeCorrelatedFailures(w, r)
+	case "/api/new-tests":
+		opts.ServeNewTests(w, r)
+	case "/api/disappeared-tests":
+		opts.ServeDisappearedTests(w, r)
+	case "/api/test-durations":
+		opts.ServeTestDurations(w, r)
+	case "/api/duration-increases":
+		opts.ServeDurationIncreases(w, r)
+	case "/api/job-runtimes":
+		opts.ServeJobRuntimes(w, r)
+	case "/api/release-comparison":
+		opts.ServeReleaseComparison(w, r)
+	case "/api/never-stable":
+		opts.ServeNeverStable(w, r)
+	case "/api/payload-risk":
+		opts.ServePayloadRisk(w, r)
+	case "/api/health-scores":
+		opts.ServeHealthScores(w, r)
+	case "/api/test":
+		opts.ServeTestDetail(w, r)
+	case "/api/regressions":
+		opts.ServeRegressions(w, r)
+	case "/api/streaks":
+		opts.ServeStreaks(w, r)
+	case "/api/annotations":
+		opts.ServeAnnotations(w, r)
+	case "/api/jobs":
+		opts.ServeJobs(w, r)
+	case "/api/milestones":
+		opts.ServeMilestones(w, r)
+	case "/api/version":
+		opts.ServeVersion(w, r)
 	case "/api/list-tests":
 		opts.ServeListTests(w, r)
+	case "/api/search-tests":
+		opts.ServeSearchTests(w, r)
+	case "/api/flakiness":
+		opts.ServeFlakiness(w, r)
+	case "/api/index-runs":
+		opts.ServeIndexRuns(w, r)
+	case "/api/alerts":
+		opts.ServeAlerts(w, r)
+	case "/api/report-runs":
+		opts.ServeReportRuns(w, r)
 	default:
+		if opts.diagnostics && strings.HasPrefix(r.URL.Path, "/debug/") {
+			diagnostics.Handler().ServeHTTP(w, r)
+			return
+		}
+		if job := strings.TrimPrefix(r.URL.Path, "/api/jobs/"); job != r.URL.Path && strings.HasSuffix(job, "/tags") {
+			opts.ServeJobTags(w, r, strings.TrimSuffix(job, "/tags"))
+			return
+		}
+		if run := strings.TrimPrefix(r.URL.Path, "/api/index-runs/"); run != r.URL.Path && strings.HasSuffix(run, "/errors") {
+			opts.ServeIndexRunErrors(w, r, strings.TrimSuffix(run, "/errors"))
+			return
+		}
 		http.NotFound(w, r)
 	}
 }
 
+type downloader interface {
+	Download(ctx context.Context, u string, w io.Writer) error
+}
+
+// downloadSnapshot replaces the database file with the snapshot from GCS or
+// S3.
+func (opts *ServerOptions) downloadSnapshot(ctx context.Context, gcsClient *gcs.Client) (err error) {
+	var storage downloader
+	switch {
+	case strings.HasPrefix(opts.snapshotDownload, "gs://"):
+		storage = gcsClient
+	case strings.HasPrefix(opts.snapshotDownload, "s3://"):
+		storage = &opts.s3
+	default:
+		return fmt.Errorf("unsupported location %q: expected gs://bucket/path or s3://bucket/path", opts.snapshotDownload)
+	}
+
+	path := database.DSNPath(database.DefaultDSN)
+	klog.Infof("Downloading the database snapshot from %s...", opts.snapshotDownload)
+
+	tmp := path + ".download"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp)
+		}
+	}()
+	if err := storage.Download(ctx, opts.snapshotDownload, f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// The journal of the old database must not be applied to the snapshot.
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(path + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(tmp, path)
+}
+
 func (opts *ServerOptions) Run(ctx context.Context) (err error) {
+	reports, err := report.LoadConfigs()
+	if err != nil {
+		return fmt.Errorf("unable to load reports: %w", err)
+	}
+
+	gcsClient := &gcs.Client{
+		URL:             opts.gcsURL,
+		TokenFile:       opts.gcsTokenFile,
+		CredentialsFile: opts.gcsCredentials,
+	}
+	if opts.snapshotDownload != "" {
+		if err := opts.downloadSnapshot(ctx, gcsClient); err != nil {
+			return fmt.Errorf("unable to download the database snapshot: %w", err)
+		}
+	}
+
 	db, err := database.OpenDefault()
 	if err != nil {
 		return fmt.Errorf("unable to open database: %w", err)
@@ -78,14 +854,113 @@ func (opts *ServerOptions) Run(ctx context.Context) (err error) {
 	}()
 
 	opts.db = db
+	db.SetParallelPeriods(opts.parallelPeriods)
+	opts.writer = db.NewWriter(64)
+	defer opts.writer.Close()
+
+	if opts.statsCacheSize > 0 {
+		opts.statsCache, err = newStatsCache(ctx, db, opts.statsCacheSize, opts.statsCacheTTL)
+		if err != nil {
+			return fmt.Errorf("unable to create the stats cache: %w", err)
+		}
+		defer opts.statsCache.Close()
+	}
+
+	if opts.ownersFile != "" {
+		o, err := owners.Load(opts.ownersFile)
+		if err != nil {
+			return fmt.Errorf("unable to load owners: %w", err)
+		}
+		if err := owners.Apply(db, o); err != nil {
+			return fmt.Errorf("unable to update owners: %w", err)
+		}
+	}
+
+	if opts.renamesFile != "" {
+		r, err := renames.Load(opts.renamesFile)
+		if err != nil {
+			return fmt.Errorf("unable to load test renames: %w", err)
+		}
+		if err := renames.Apply(db, r); err != nil {
+			return fmt.Errorf("unable to update test renames: %w", err)
+		}
+	}
+
+	if opts.milestonesFile != "" {
+		opts.milestones, err = milestones.Load(opts.milestonesFile)
+		if err != nil {
+			return fmt.Errorf("unable to load milestones: %w", err)
+		}
+	}
+
+	if opts.alertRulesFile != "" {
+		rules, err := alerts.LoadRules(opts.alertRulesFile)
+		if err != nil {
+			return fmt.Errorf("unable to load alert rules: %w", err)
+		}
+		var notifiers []alerts.Notifier
+		if opts.alertmanagerURL != "" {
+			notifiers = append(notifiers, &alerts.Alertmanager{URL: opts.alertmanagerURL})
+		}
+		if opts.pagerDutyKeyFile != "" {
+			pd, err := alerts.NewPagerDuty(opts.pagerDutyURL, opts.pagerDutyKeyFile, opts.pagerDutySeverity)
+			if err != nil {
+				return err
+			}
+			notifiers = append(notifiers, pd)
+		}
+		opts.alerts = alerts.NewEngine(db, rules, notifiers)
+		go opts.alerts.Run(ctx, opts.alertInterval)
+	}
+
+	if opts.kubeInterval > 0 {
+		kubeConfig := &kube.Config{
+			URL:       opts.kubeAPIURL,
+			TokenFile: opts.kubeTokenFile,
+		}
+		if opts.kubeAPIURL == "" {
+			kubeConfig, err = kube.InClusterConfig()
+			if err != nil {
+				return fmt.Errorf("unable to get the Kubernetes config: %w", err)
+			}
+		}
+		if opts.kubeNamespace != "" {
+			kubeConfig.Namespace = opts.kubeNamespace
+		}
+		if kubeConfig.Namespace == "" {
+			return fmt.Errorf("--kube-namespace is required outside of a cluster")
+		}
+		kubeClient, err := kube.NewClient(kubeConfig)
+		if err != nil {
+			return fmt.Errorf("unable to create the Kubernetes client: %w", err)
+		}
+		publisher := kube.NewPublisher(kubeClient, db, opts.alerts, &opts.links)
+		publisher.Filter = opts.kubeFilter
+		go publisher.Run(ctx, opts.kubeInterval)
+	}
+
+	if len(reports) > 0 {
+		scheduler, err := report.NewScheduler(db, reports, gcsClient, &opts.links)
+		if err != nil {
+			return fmt.Errorf("unable to load reports: %w", err)
+		}
+		go scheduler.Run(ctx)
+	}
+
+	if opts.tokenFile != "" {
+		opts.tokens, err = loadTokens(opts.tokenFile)
+		if err != nil {
+			return fmt.Errorf("unable to load tokens: %w", err)
+		}
+	}
 
 	go func() {
 		time.Sleep(3 * time.Hour)
 		os.Exit(0) // Let's get restarted and get new data from TestGrid
 	}()
 
-	klog.Info("Starting the API server... http://localhost:8001")
-	return http.ListenAndServe(":8001", opts)
+	klog.Infof("Starting the API server on %s...", opts.listen)
+	return http.ListenAndServe(opts.listen, opts)
 }
 
 func NewCmdServer() *cobra.Command {
@@ -96,6 +971,40 @@ func NewCmdServer() *cobra.Command {
 		Short: "Serve analytics API for CI data",
 		Long: heredoc.Doc(`
 			Start an HTTP server with analytical API for CI data.
+
+			Requests that change data, like POST and DELETE /api/jobs/JOB/tags?tag=TAG
+			or /api/annotations, need a bearer token from the file given by
+			--token-file.
+
+			With --snapshot-download, the database is replaced on start with the
+			snapshot that the indexer has uploaded with --snapshot-upload, so servers
+			in other clusters can serve the same data without running the indexer.
+			Snapshots are stored in Google Cloud Storage or in S3.
+
+			With --alert-rules, the server evaluates the rules every --alert-interval
+			and lists pending and firing alerts at /api/alerts. An alert fires when
+			its condition has held for the "for" duration of the rule. Firing and
+			resolved alerts are sent to --alertmanager-url and, if their severity is
+			at least --pagerduty-severity, to PagerDuty.
+
+			With --kube-publish-interval, the server keeps JobHealth resources for
+			jobs and TestHealth resources for regressed and alerting tests up to date
+			in its namespace (see manifests/crds.yaml), so other controllers can
+			consume CI health through the Kubernetes API.
+
+			Reports listed in the reports section of the config file are rendered
+			and published on their cron schedules, their runs are listed at
+			/api/report-runs:
+
+			  reports:
+			  - name: weekly
+			    schedule: 0 9 * * 1
+			    filter: "4.10"
+			    format: html
+			    publish:
+			    - /srv/reports/weekly-{date}.html
+			    - gs://bucket/reports/weekly.html
+			    - https://hooks.example.com/reports
 		`),
 		Args: cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
@@ -106,5 +1015,36 @@ func NewCmdServer() *cobra.Command {
 		},
 	}
 
+	cmd.Flags().StringVar(&opts.listen, "listen", ":8001", "Address to listen on.")
+	cmd.Flags().StringVar(&opts.defaultPeriods, "default-periods", "7,7", "Periods to use when a request doesn't specify them.")
+	cmd.Flags().StringVar(&opts.releaseControllerHost, "release-controller", releasecontroller.DefaultHost, "Host of the release controller to get payloads from.")
+	cmd.Flags().StringVar(&opts.milestonesFile, "milestones", "", "YAML file with named milestones that periods can be anchored to with the anchor parameter.")
+	cmd.Flags().StringVar(&opts.ownersFile, "owners", "", "YAML file that maps job names to teams, applied to the database on start.")
+	cmd.Flags().StringVar(&opts.renamesFile, "test-renames", "", "YAML file that maps old test names to new ones, applied to the database on start.")
+	cmd.Flags().StringVar(&opts.alertRulesFile, "alert-rules", "", "YAML file with alert rules to evaluate periodically, active alerts are listed at /api/alerts.")
+	cmd.Flags().DurationVar(&opts.alertInterval, "alert-interval", 5*time.Minute, "How often to evaluate the alert rules.")
+	cmd.Flags().StringVar(&opts.alertmanagerURL, "alertmanager-url", "", "Alertmanager to send firing and resolved alerts to.")
+	cmd.Flags().StringVar(&opts.pagerDutyKeyFile, "pagerduty-routing-key-file", "", "File with the integration key of a PagerDuty service to send firing and resolved alerts to.")
+	cmd.Flags().StringVar(&opts.pagerDutySeverity, "pagerduty-severity", alerts.SeverityCritical, "Lowest severity of alerts that are sent to PagerDuty (warning, critical).")
+	cmd.Flags().StringVar(&opts.pagerDutyURL, "pagerduty-url", alerts.DefaultPagerDutyURL, "PagerDuty Events API v2 endpoint.")
+	cmd.Flags().StringVar(&opts.snapshotDownload, "snapshot-download", "", "GCS or S3 location (gs://bucket/path or s3://bucket/path) of a database snapshot uploaded by the indexer with --snapshot-upload, downloaded over the database on start.")
+	cmd.Flags().StringVar(&opts.gcsTokenFile, "gcs-token-file", "", "File with an OAuth access token to access GCS.")
+	cmd.Flags().StringVar(&opts.gcsCredentials, "gcs-credentials", "", "JSON key file of a service account to access GCS, the metadata server is used by default.")
+	cmd.Flags().StringVar(&opts.gcsURL, "gcs-url", gcs.DefaultURL, "Base URL of the GCS API.")
+	cmd.Flags().StringVar(&opts.s3.CredentialsFile, "s3-credentials", "", "AWS shared credentials file to access S3, the profile is taken from AWS_PROFILE. By default the credentials are taken from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.")
+	cmd.Flags().StringVar(&opts.s3.Region, "s3-region", "", "Region of the S3 bucket, AWS_REGION or "+s3.DefaultRegion+" by default.")
+	cmd.Flags().StringVar(&opts.s3.URL, "s3-url", "", "Endpoint of an S3-compatible storage, e.g. MinIO, by default the AWS endpoint of the region is used.")
+	links.AddFlags(cmd, &opts.links)
+	cmd.Flags().DurationVar(&opts.kubeInterval, "kube-publish-interval", 0, "How often to write JobHealth and TestHealth custom resources to the Kubernetes API, 0 to disable.")
+	cmd.Flags().StringVar(&opts.kubeFilter, "kube-filter", "", "Space separated list of tags that selects jobs for the custom resources, tags prefixed with - are excluded.")
+	cmd.Flags().StringVar(&opts.kubeNamespace, "kube-namespace", "", "Namespace for the custom resources, the namespace of the pod by default.")
+	cmd.Flags().StringVar(&opts.kubeAPIURL, "kube-api-url", "", "URL of the Kubernetes API when the server runs outside of a cluster.")
+	cmd.Flags().StringVar(&opts.kubeTokenFile, "kube-token-file", "", "File with a bearer token for --kube-api-url.")
+	cmd.Flags().IntVar(&opts.parallelPeriods, "parallel-periods", 3, "Compute statistics with a separate concurrent query per period if a request has at least this many periods, 0 to disable.")
+	cmd.Flags().IntVar(&opts.statsCacheSize, "stats-cache-size", 256, "Number of build statistics results to cache until the database changes, 0 to disable.")
+	cmd.Flags().DurationVar(&opts.statsCacheTTL, "stats-cache-ttl", 5*time.Minute, "Maximum age of cached build statistics.")
+	cmd.Flags().BoolVar(&opts.diagnostics, "diagnostics", false, "Serve pprof profiles under /debug/pprof/ and expvar variables at /debug/vars.")
+	cmd.Flags().StringVar(&opts.tokenFile, "token-file", "", "File with bearer tokens that allow changes through the API, one per line.")
+
 	return cmd
 }
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/database/databasetest"
+)
+
+// TestInvalidParams checks the API contract for invalid query parameters:
+// they are rejected with 400, and the response names the parameter and the
+// accepted values.
+func TestInvalidParams(t *testing.T) {
+	opts := &ServerOptions{
+		db:             databasetest.Open(t),
+		defaultPeriods: "7,7",
+	}
+
+	testCases := []struct {
+		name  string
+		url   string
+		param string
+		want  []string
+	}{
+		{
+			name:  "unknown column",
+			url:   "/api/builds?columns=name,color",
+			param: "columns",
+			want:  []string{"sippytags", "name", "dashboard", "test", "sig", "owner", "variant.DIMENSION"},
+		},
+		{
+			name:  "negative period",
+			url:   "/api/builds?periods=7,-7",
+			param: "periods",
+			want:  []string{"N", "+N"},
+		},
+		{
+			name:  "non-numeric period",
+			url:   "/api/builds?periods=week",
+			param: "periods",
+			want:  []string{"N", "+N"},
+		},
+		{
+			name:  "filter term with control characters",
+			url:   "/api/builds?filter=aws+%01",
+			param: "filter",
+			want:  []string{"TAG", "-TAG"},
+		},
+		{
+			name:  "unknown bucket",
+			url:   "/api/builds?bucket=month",
+			param: "bucket",
+			want:  []string{"day", "week"},
+		},
+		{
+			name:  "unparsable reference time",
+			url:   "/api/builds?at=yesterday",
+			param: "timestamp",
+			want:  []string{"RFC 3339", "Unix seconds"},
+		},
+		{
+			name:  "unknown health column",
+			url:   "/api/health-scores?columns=color",
+			param: "columns",
+			want:  []string{"name", "sippytags", "owner", "variant.DIMENSION"},
+		},
+		{
+			name:  "unknown runtime column",
+			url:   "/api/job-runtimes?column=color",
+			param: "column",
+			want:  []string{"name", "platform", "dashboard"},
+		},
+		{
+			name:  "unknown flakiness kind",
+			url:   "/api/flakiness?kind=builds",
+			param: "kind",
+			want:  []string{"tests", "jobs"},
+		},
+		{
+			name:  "unknown comparison",
+			url:   "/api/release-comparison?releases=4.8,4.9&by=variant",
+			param: "by",
+			want:  []string{"job", "test"},
+		},
+		{
+			name:  "regressions without runs",
+			url:   "/api/regressions?minruns=0",
+			param: "minruns",
+		},
+		{
+			name:  "non-numeric baseline",
+			url:   "/api/regressions?baseline=month",
+			param: "baseline",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			opts.ServeHTTP(w, httptest.NewRequest("GET", tc.url, nil))
+
+			body := w.Body.String()
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusBadRequest, body)
+			}
+			if !strings.Contains(body, "invalid "+tc.param+" ") {
+				t.Errorf("response doesn't name the parameter %s: %s", tc.param, body)
+			}
+			if tc.want != nil && !strings.Contains(body, "(accepted: "+strings.Join(tc.want, ", ")+")") {
+				t.Errorf("response doesn't list the accepted values %v: %s", tc.want, body)
+			}
+		})
+	}
+}
+
+func TestContentType(t *testing.T) {
+	opts := &ServerOptions{
+		db:             databasetest.Open(t),
+		defaultPeriods: "7,7",
+	}
+
+	for _, url := range []string{
+		"/api/builds",
+		"/api/timeline",
+		"/api/jobs",
+		"/api/version",
+	} {
+		t.Run(url, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			opts.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+			if got := w.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("got Content-Type %q, want application/json", got)
+			}
+		})
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	db := databasetest.Open(t)
+	err := db.Transaction(func(tx *database.Tx) error {
+		jobID, err := tx.InsertJob("job-aws", "dashboard", database.JobTags{})
+		if err != nil {
+			return err
+		}
+		_, err = tx.UpsertBuild(jobID, "1", time.Now().Unix()*1000, 2, database.FailureTests)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := db.NewWriter(1)
+	t.Cleanup(writer.Close)
+	opts := &ServerOptions{
+		db:     db,
+		writer: writer,
+		tokens: []string{"secret"},
+	}
+
+	do := func(method, url, token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		opts.ServeHTTP(w, r)
+		return w
+	}
+
+	const annotation = `{"job": "job-aws", "build": "1", "note": "infra outage", "author": "alice"}`
+	if w := do("POST", "/api/annotations", "", annotation); w.Code != http.StatusUnauthorized {
+		t.Errorf("POST without a token: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := do("POST", "/api/annotations", "wrong", annotation); w.Code != http.StatusUnauthorized {
+		t.Errorf("POST with a wrong token: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	w := do("POST", "/api/annotations", "secret", annotation)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST: got status %d, want %d: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+	var created database.Annotation
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == 0 || created.Job != "job-aws" || created.Build != "1" || created.Note != "infra outage" || created.Author != "alice" {
+		t.Errorf("POST: got %+v, want the created annotation", created)
+	}
+
+	badRequests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{name: "invalid JSON", body: `{"job":`, code: http.StatusBadRequest},
+		{name: "empty note", body: `{"job": "job-aws", "build": "1"}`, code: http.StatusBadRequest},
+		{name: "job without build", body: `{"job": "job-aws", "note": "infra outage"}`, code: http.StatusBadRequest},
+		{name: "unknown build", body: `{"job": "job-aws", "build": "2", "note": "infra outage"}`, code: http.StatusNotFound},
+	}
+	for _, tc := range badRequests {
+		if w := do("POST", "/api/annotations", "secret", tc.body); w.Code != tc.code {
+			t.Errorf("POST %s: got status %d, want %d: %s", tc.name, w.Code, tc.code, w.Body.String())
+		}
+	}
+
+	w = do("GET", "/api/annotations?job=job-aws", "", "")
+	var list []database.Annotation
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != created.ID {
+		t.Errorf("GET: got %+v, want the created annotation", list)
+	}
+
+	deleteURL := fmt.Sprintf("/api/annotations?id=%d", created.ID)
+	if w := do("DELETE", deleteURL, "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("DELETE without a token: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := do("DELETE", "/api/annotations", "secret", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("DELETE without an id: got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := do("DELETE", deleteURL, "secret", ""); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE: got status %d, want %d: %s", w.Code, http.StatusNoContent, w.Body.String())
+	}
+	if w := do("DELETE", deleteURL, "secret", ""); w.Code != http.StatusNotFound {
+		t.Errorf("DELETE of a removed annotation: got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := do("PUT", "/api/annotations", "secret", annotation); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("PUT: got status %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+
+	opts.tokens = nil
+	if w := do("POST", "/api/annotations", "secret", annotation); w.Code != http.StatusForbidden {
+		t.Errorf("POST without --token-file: got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/dmage/ci-results/database"
+	"k8s.io/klog/v2"
+)
+
+// loadTokens reads bearer tokens from a file, one per line. Empty lines and
+// lines starting with # are ignored.
+func loadTokens(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var tokens []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens = append(tokens, line)
+	}
+	return tokens, scanner.Err()
+}
+
+// authorize checks the bearer token of the request and writes an error if
+// the request is not allowed to change data.
+func (opts *ServerOptions) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if len(opts.tokens) == 0 {
+		http.Error(w, "403 forbidden: changes are disabled, start the server with --token-file", 403)
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	for _, t := range opts.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return true
+		}
+	}
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	http.Error(w, "401 unauthorized", 401)
+	return false
+}
+
+// ServeJobTags lists custom tags of a job, adds (POST) or removes (DELETE)
+// the tag given in the tag parameter.
+func (opts *ServerOptions) ServeJobTags(w http.ResponseWriter, r *http.Request, jobName string) {
+	tag := r.URL.Query().Get("tag")
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodDelete:
+		if !opts.authorize(w, r) {
+			return
+		}
+		if tag == "" {
+			http.Error(w, "400 bad request: tag is required", 400)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "405 method not allowed", 405)
+		return
+	}
+
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		if err := database.ValidateTag(tag); err != nil {
+			http.Error(w, "400 bad request: "+err.Error(), 400)
+			return
+		}
+		err = opts.writer.Do(r.Context(), func(tx *database.Tx) error {
+			return tx.AddJobTag(jobName, tag, database.TagSourceCustom)
+		})
+	case http.MethodDelete:
+		err = opts.writer.Do(r.Context(), func(tx *database.Tx) error {
+			return tx.RemoveJobTag(jobName, tag, database.TagSourceCustom)
+		})
+	}
+	if database.IsNotFound(err) {
+		http.Error(w, "404 not found: "+err.Error(), 404)
+		return
+	} else if err != nil {
+		serveError(w, err)
+		return
+	}
+	if r.Method != http.MethodGet {
+		klog.Infof("%s tag %s of job %s", r.Method, tag, jobName)
+	}
+
+	tags, err := opts.db.JobTagsList(jobName)
+	if database.IsNotFound(err) {
+		http.Error(w, "404 not found: "+err.Error(), 404)
+		return
+	} else if err != nil {
+		serveError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
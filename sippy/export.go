@@ -0,0 +1,32 @@
+package sippy
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// TestGridURL is the TestGrid instance that Sippy downloads data from.
+const TestGridURL = "https://testgrid.k8s.io"
+
+// storageFilename returns the name of the file in which Sippy stores the
+// response for the URL when it downloads data from TestGrid.
+func storageFilename(u string) string {
+	return `"` + strings.ReplaceAll(u, "/", "-") + `"`
+}
+
+// SummaryFilename returns the name of the file from which Sippy's TestGrid
+// loader reads the summary of the dashboard.
+func SummaryFilename(dashboard string) string {
+	return storageFilename(fmt.Sprintf("%s/%s/summary", TestGridURL, dashboard))
+}
+
+// JobDetailsFilename returns the name of the file from which Sippy's TestGrid
+// loader reads the results of the job.
+func JobDetailsFilename(dashboard, jobName string) string {
+	query := url.Values{
+		"grid": {"old"},
+		"tab":  {jobName},
+	}
+	return storageFilename(fmt.Sprintf("%s/%s/table?%s", TestGridURL, dashboard, query.Encode()))
+}
@@ -0,0 +1,265 @@
+package sippy
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+)
+
+// UpstreamVariantsURL is the Sippy source file with the variant definitions.
+const UpstreamVariantsURL = "https://raw.githubusercontent.com/openshift/sippy/master/pkg/testidentification/ocp_variants.go"
+
+// regexpVars returns the string literals of package-level variables that are
+// initialized with regexp.MustCompile.
+func regexpVars(f *ast.File) map[string]string {
+	result := make(map[string]string)
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, name := range vs.Names {
+				if i >= len(vs.Values) {
+					break
+				}
+				call, ok := vs.Values[i].(*ast.CallExpr)
+				if !ok || len(call.Args) != 1 {
+					continue
+				}
+				sel, ok := call.Fun.(*ast.SelectorExpr)
+				if !ok || sel.Sel.Name != "MustCompile" {
+					continue
+				}
+				lit, ok := call.Args[0].(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					continue
+				}
+				if s, err := strconv.Unquote(lit.Value); err == nil {
+					result[name.Name] = s
+				}
+			}
+		}
+	}
+	return result
+}
+
+// matchedVar returns the name of the variable X in conditions like
+// X.MatchString(jobName).
+func matchedVar(cond ast.Expr) string {
+	call, ok := cond.(*ast.CallExpr)
+	if !ok {
+		return ""
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "MatchString" {
+		return ""
+	}
+	ident, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return ""
+	}
+	return ident.Name
+}
+
+// appendedNames returns the string literals that are appended to a slice in
+// the block and whether the block returns.
+func appendedNames(block *ast.BlockStmt) (names []string, returns bool) {
+	ast.Inspect(block, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ReturnStmt:
+			returns = true
+		case *ast.CallExpr:
+			if ident, ok := n.Fun.(*ast.Ident); ok && ident.Name == "append" {
+				for _, arg := range n.Args[1:] {
+					if lit, ok := arg.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+						if s, err := strconv.Unquote(lit.Value); err == nil {
+							names = append(names, s)
+						}
+					}
+				}
+			}
+		}
+		return true
+	})
+	return names, returns
+}
+
+// returnedName returns the first string literal from return statements in the
+// block, it is used to find the variant for unknown jobs.
+func returnedName(block *ast.BlockStmt) (name string) {
+	ast.Inspect(block, func(n ast.Node) bool {
+		ret, ok := n.(*ast.ReturnStmt)
+		if !ok || name != "" {
+			return name == ""
+		}
+		ast.Inspect(ret, func(n ast.Node) bool {
+			if lit, ok := n.(*ast.BasicLit); ok && lit.Kind == token.STRING && name == "" {
+				name, _ = strconv.Unquote(lit.Value)
+			}
+			return name == ""
+		})
+		return false
+	})
+	return name
+}
+
+// ParseUpstreamVariants extracts variant definitions from the Go source of
+// Sippy's IdentifyVariants. Branches of if-else chains take precedence over
+// the following branches.
+func ParseUpstreamVariants(src []byte) (*Variants, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	regexps := regexpVars(f)
+
+	var fn *ast.FuncDecl
+	for _, decl := range f.Decls {
+		if d, ok := decl.(*ast.FuncDecl); ok && d.Name.Name == "IdentifyVariants" && d.Body != nil {
+			fn = d
+		}
+	}
+	if fn == nil {
+		return nil, fmt.Errorf("function IdentifyVariants is not found")
+	}
+
+	v := &Variants{}
+	var walk func(ifStmt *ast.IfStmt, earlier []string) error
+	walk = func(ifStmt *ast.IfStmt, earlier []string) error {
+		varName := matchedVar(ifStmt.Cond)
+		if varName == "" {
+			return nil
+		}
+		regex, ok := regexps[varName]
+		if !ok {
+			return fmt.Errorf("%s: regexp %s is not found", fset.Position(ifStmt.Pos()), varName)
+		}
+		names, returns := appendedNames(ifStmt.Body)
+		for _, name := range names {
+			v.Variants = append(v.Variants, Variant{
+				Name:   name,
+				Regex:  regex,
+				Only:   returns,
+				Unless: append([]string(nil), earlier...),
+			})
+		}
+		if next, ok := ifStmt.Else.(*ast.IfStmt); ok {
+			return walk(next, append(earlier, names...))
+		}
+		return nil
+	}
+	for _, stmt := range fn.Body.List {
+		ifStmt, ok := stmt.(*ast.IfStmt)
+		if !ok {
+			continue
+		}
+		if matchedVar(ifStmt.Cond) == "" {
+			if name := returnedName(ifStmt.Body); name != "" {
+				v.Unknown = name
+			}
+			continue
+		}
+		if err := walk(ifStmt, nil); err != nil {
+			return nil, err
+		}
+	}
+	if len(v.Variants) == 0 {
+		return nil, fmt.Errorf("no variant definitions are found")
+	}
+
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return ParseVariants(data)
+}
+
+type VariantChange struct {
+	Name     string   `json:"name"`
+	Change   string   `json:"change"`
+	Local    *Variant `json:"local,omitempty"`
+	Upstream *Variant `json:"upstream,omitempty"`
+}
+
+func sameVariant(a, b Variant) bool {
+	return a.Regex == b.Regex && a.Only == b.Only && (len(a.Unless) == 0 && len(b.Unless) == 0 || reflect.DeepEqual(a.Unless, b.Unless))
+}
+
+// foldRules returns a copy of the definitions where the rules are expressed
+// with "only" and "unless" as Sippy has them. Precedence that goes against the
+// order of the definitions can't be expressed and is ignored.
+func foldRules(v *Variants) *Variants {
+	folded := *v
+	folded.Variants = make([]Variant, len(v.Variants))
+	index := make(map[string]int)
+	for i, def := range v.Variants {
+		def.Unless = append([]string(nil), def.Unless...)
+		folded.Variants[i] = def
+		index[def.Name] = i
+	}
+	addUnless := func(name, other string) {
+		def := &folded.Variants[index[name]]
+		if index[other] >= index[name] {
+			return
+		}
+		for _, u := range def.Unless {
+			if u == other {
+				return
+			}
+		}
+		def.Unless = append(def.Unless, other)
+	}
+	for _, rule := range v.Rules {
+		for i, name := range rule.Exclusive {
+			for _, other := range rule.Exclusive[:i] {
+				addUnless(name, other)
+			}
+		}
+		for _, name := range rule.Suppress {
+			if name == SuppressAll {
+				folded.Variants[index[rule.Variant]].Only = true
+				continue
+			}
+			addUnless(name, rule.Variant)
+		}
+	}
+	return &folded
+}
+
+// DiffVariants returns the definitions that are added, removed or changed
+// upstream compared to the local definitions.
+func DiffVariants(local, upstream *Variants) []VariantChange {
+	changes := []VariantChange{}
+	local = foldRules(local)
+	localByName := make(map[string]*Variant)
+	for i := range local.Variants {
+		localByName[local.Variants[i].Name] = &local.Variants[i]
+	}
+	upstreamByName := make(map[string]bool)
+	for i := range upstream.Variants {
+		u := &upstream.Variants[i]
+		upstreamByName[u.Name] = true
+		l, ok := localByName[u.Name]
+		if !ok {
+			changes = append(changes, VariantChange{Name: u.Name, Change: "added", Upstream: u})
+		} else if !sameVariant(*l, *u) {
+			changes = append(changes, VariantChange{Name: u.Name, Change: "changed", Local: l, Upstream: u})
+		}
+	}
+	for i := range local.Variants {
+		l := &local.Variants[i]
+		if !upstreamByName[l.Name] {
+			changes = append(changes, VariantChange{Name: l.Name, Change: "removed", Local: l})
+		}
+	}
+	return changes
+}
@@ -1,116 +1,284 @@
 package sippy
 
 import (
+	_ "embed"
+	"fmt"
+	"io/ioutil"
 	"regexp"
 
+	"gopkg.in/yaml.v2"
 	"k8s.io/klog/v2"
 )
 
-var (
-	// variant regexes
-	awsRegex   = regexp.MustCompile(`(?i)-aws`)
-	azureRegex = regexp.MustCompile(`(?i)-azure`)
-	fipsRegex  = regexp.MustCompile(`(?i)-fips`)
-	metalRegex = regexp.MustCompile(`(?i)-metal`)
-	// metal-assisted jobs do not have a trailing -version segment
-	metalAssistedRegex = regexp.MustCompile(`(?i)-metal-assisted`)
-	// metal-ipi jobs do not have a trailing -version segment
-	metalIPIRegex = regexp.MustCompile(`(?i)-metal-ipi`)
-	// 3.11 gcp jobs don't have a trailing -version segment
-	gcpRegex       = regexp.MustCompile(`(?i)-gcp`)
-	openstackRegex = regexp.MustCompile(`(?i)-openstack`)
-	osdRegex       = regexp.MustCompile(`(?i)-osd`)
-	ovirtRegex     = regexp.MustCompile(`(?i)-ovirt`)
-	ovnRegex       = regexp.MustCompile(`(?i)-ovn`)
-	// proxy jobs do not have a trailing -version segment
-	proxyRegex   = regexp.MustCompile(`(?i)-proxy`)
-	promoteRegex = regexp.MustCompile(`(?i)^promote-`)
-	ppc64leRegex = regexp.MustCompile(`(?i)-ppc64le`)
-	rtRegex      = regexp.MustCompile(`(?i)-rt`)
-	s390xRegex   = regexp.MustCompile(`(?i)-s390x`)
-	serialRegex  = regexp.MustCompile(`(?i)-serial`)
-	upgradeRegex = regexp.MustCompile(`(?i)-upgrade`)
-	// some vsphere jobs do not have a trailing -version segment
-	vsphereRegex    = regexp.MustCompile(`(?i)-vsphere`)
-	vsphereUPIRegex = regexp.MustCompile(`(?i)-vsphere-upi`)
-)
+// defaultVariantsYAML is a copy of the variants from Sippy.
+//
+//go:embed variants.yaml
+var defaultVariantsYAML []byte
 
-func IdentifyVariants(jobName string) []string {
-	variants := []string{}
+// DefaultVariants are the built-in variant definitions.
+var DefaultVariants = mustParseVariants(defaultVariantsYAML)
 
-	// if it's a promotion job, it can't be a part of any other variant aggregation
-	if promoteRegex.MatchString(jobName) {
-		variants = append(variants, "promote")
-		return variants
-	}
+type Variant struct {
+	Name  string `yaml:"name" json:"name"`
+	Regex string `yaml:"regex" json:"regex"`
+	// Only means that jobs with this variant can't be a part of any other
+	// variant aggregation.
+	Only bool `yaml:"only,omitempty" json:"only,omitempty"`
+	// Unless lists variants that take precedence over this variant.
+	Unless []string `yaml:"unless,omitempty" json:"unless,omitempty"`
 
-	if awsRegex.MatchString(jobName) {
-		variants = append(variants, "aws")
-	}
-	if azureRegex.MatchString(jobName) {
-		variants = append(variants, "azure")
-	}
-	if gcpRegex.MatchString(jobName) {
-		variants = append(variants, "gcp")
+	re *regexp.Regexp
+}
+
+// DimensionValue is a value of a dimension and the regular expression for jobs
+// that have this value.
+type DimensionValue struct {
+	Value string `yaml:"value" json:"value"`
+	Regex string `yaml:"regex" json:"regex"`
+
+	re *regexp.Regexp
+}
+
+// Dimension is an independent axis of variants, for example network or
+// architecture. A job gets the first value that matches its name, or the
+// default value if none of them match.
+type Dimension struct {
+	Name    string           `yaml:"name" json:"name"`
+	Default string           `yaml:"default,omitempty" json:"default,omitempty"`
+	Values  []DimensionValue `yaml:"values" json:"values"`
+}
+
+// VariantValue is the value of a dimension for a job.
+type VariantValue struct {
+	Dimension string `json:"dimension"`
+	Value     string `json:"value"`
+}
+
+func (v VariantValue) String() string {
+	return v.Dimension + "." + v.Value
+}
+
+// SuppressAll can be used in Rule.Suppress to suppress all other variants.
+const SuppressAll = "*"
+
+// Rule restricts combinations of matched variants. A rule either lists
+// mutually exclusive variants, of which a job keeps only the first matched
+// one, or suppresses other variants when the job has Variant.
+type Rule struct {
+	Exclusive []string `yaml:"exclusive,omitempty" json:"exclusive,omitempty"`
+	Variant   string   `yaml:"variant,omitempty" json:"variant,omitempty"`
+	Suppress  []string `yaml:"suppress,omitempty" json:"suppress,omitempty"`
+}
+
+type Variants struct {
+	// Unknown is the variant for jobs that don't match any definition.
+	Unknown    string      `yaml:"unknown"`
+	Variants   []Variant   `yaml:"variants"`
+	Rules      []Rule      `yaml:"rules,omitempty"`
+	Dimensions []Dimension `yaml:"dimensions,omitempty"`
+}
+
+var dimensionNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+func ParseVariants(data []byte) (*Variants, error) {
+	var v Variants
+	if err := yaml.UnmarshalStrict(data, &v); err != nil {
+		return nil, err
 	}
-	if openstackRegex.MatchString(jobName) {
-		variants = append(variants, "openstack")
+
+	seen := make(map[string]bool)
+	for i := range v.Variants {
+		def := &v.Variants[i]
+		if def.Name == "" {
+			return nil, fmt.Errorf("variant #%d: name is required", i+1)
+		}
+		if seen[def.Name] {
+			return nil, fmt.Errorf("variant %s: duplicate name", def.Name)
+		}
+		for _, name := range def.Unless {
+			if !seen[name] {
+				return nil, fmt.Errorf("variant %s: unless refers to %s, which is not defined before it", def.Name, name)
+			}
+		}
+		seen[def.Name] = true
+
+		re, err := regexp.Compile(def.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("variant %s: %w", def.Name, err)
+		}
+		def.re = re
 	}
 
-	if osdRegex.MatchString(jobName) {
-		variants = append(variants, "osd")
+	for i, rule := range v.Rules {
+		if err := rule.validate(seen); err != nil {
+			return nil, fmt.Errorf("rule #%d: %w", i+1, err)
+		}
 	}
 
-	// Without support for negative lookbacks in the native
-	// regexp library, it's easiest to differentiate these
-	// three by seeing if it's metal-assisted or metal-ipi, and then fall through
-	// to check if it's UPI metal.
-	if metalAssistedRegex.MatchString(jobName) {
-		variants = append(variants, "metal-assisted")
-	} else if metalIPIRegex.MatchString(jobName) {
-		variants = append(variants, "metal-ipi")
-	} else if metalRegex.MatchString(jobName) {
-		variants = append(variants, "metal-upi")
+	dimensions := make(map[string]bool)
+	for i := range v.Dimensions {
+		dim := &v.Dimensions[i]
+		if !dimensionNameRe.MatchString(dim.Name) {
+			return nil, fmt.Errorf("dimension #%d: invalid name %q", i+1, dim.Name)
+		}
+		if dimensions[dim.Name] {
+			return nil, fmt.Errorf("dimension %s: duplicate name", dim.Name)
+		}
+		dimensions[dim.Name] = true
+		if dim.Default != "" && !dimensionNameRe.MatchString(dim.Default) {
+			return nil, fmt.Errorf("dimension %s: invalid default value %q", dim.Name, dim.Default)
+		}
+		for j := range dim.Values {
+			val := &dim.Values[j]
+			if !dimensionNameRe.MatchString(val.Value) {
+				return nil, fmt.Errorf("dimension %s: invalid value %q", dim.Name, val.Value)
+			}
+			re, err := regexp.Compile(val.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("dimension %s: value %s: %w", dim.Name, val.Value, err)
+			}
+			val.re = re
+		}
 	}
+	return &v, nil
+}
 
-	if ovirtRegex.MatchString(jobName) {
-		variants = append(variants, "ovirt")
+func (r Rule) validate(defined map[string]bool) error {
+	var names []string
+	switch {
+	case len(r.Exclusive) > 0 && (r.Variant != "" || len(r.Suppress) > 0):
+		return fmt.Errorf("exclusive can't be combined with variant and suppress")
+	case len(r.Exclusive) > 0:
+		if len(r.Exclusive) < 2 {
+			return fmt.Errorf("exclusive needs at least two variants")
+		}
+		names = r.Exclusive
+	case r.Variant != "":
+		if len(r.Suppress) == 0 {
+			return fmt.Errorf("variant %s: suppress is required", r.Variant)
+		}
+		names = append([]string{r.Variant}, r.Suppress...)
+		if len(r.Suppress) == 1 && r.Suppress[0] == SuppressAll {
+			names = names[:1]
+		}
+	default:
+		return fmt.Errorf("either exclusive or variant is required")
 	}
-	if vsphereUPIRegex.MatchString(jobName) {
-		variants = append(variants, "vsphere-upi")
-	} else if vsphereRegex.MatchString(jobName) {
-		variants = append(variants, "vsphere-ipi")
+	for _, name := range names {
+		if !defined[name] {
+			return fmt.Errorf("unknown variant %s", name)
+		}
 	}
+	return nil
+}
 
-	if upgradeRegex.MatchString(jobName) {
-		variants = append(variants, "upgrade")
+// apply removes the variants that the rule rejects.
+func (r Rule) apply(variants []string) []string {
+	has := make(map[string]bool, len(variants))
+	for _, name := range variants {
+		has[name] = true
 	}
-	if serialRegex.MatchString(jobName) {
-		variants = append(variants, "serial")
+
+	drop := make(map[string]bool)
+	if len(r.Exclusive) > 0 {
+		kept := false
+		for _, name := range r.Exclusive {
+			if has[name] {
+				drop[name] = kept
+				kept = true
+			}
+		}
+	} else if has[r.Variant] {
+		for _, name := range r.Suppress {
+			if name == SuppressAll {
+				return []string{r.Variant}
+			}
+			drop[name] = true
+		}
 	}
-	if ovnRegex.MatchString(jobName) {
-		variants = append(variants, "ovn")
+
+	result := variants[:0:0]
+	for _, name := range variants {
+		if !drop[name] {
+			result = append(result, name)
+		}
 	}
-	if fipsRegex.MatchString(jobName) {
-		variants = append(variants, "fips")
+	return result
+}
+
+func LoadVariants(filename string) (*Variants, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
 	}
-	if ppc64leRegex.MatchString(jobName) {
-		variants = append(variants, "ppc64le")
+	v, err := ParseVariants(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
 	}
-	if s390xRegex.MatchString(jobName) {
-		variants = append(variants, "s390x")
+	return v, nil
+}
+
+func mustParseVariants(data []byte) *Variants {
+	v, err := ParseVariants(data)
+	if err != nil {
+		panic(err)
 	}
-	if rtRegex.MatchString(jobName) {
-		variants = append(variants, "realtime")
+	return v
+}
+
+func (v *Variants) Identify(jobName string) []string {
+	variants := []string{}
+	matched := make(map[string]bool)
+
+definitions:
+	for _, def := range v.Variants {
+		if !def.re.MatchString(jobName) {
+			continue
+		}
+		for _, name := range def.Unless {
+			if matched[name] {
+				continue definitions
+			}
+		}
+		if def.Only {
+			return []string{def.Name}
+		}
+		matched[def.Name] = true
+		variants = append(variants, def.Name)
 	}
-	if proxyRegex.MatchString(jobName) {
-		variants = append(variants, "proxy")
+
+	for _, rule := range v.Rules {
+		variants = rule.apply(variants)
 	}
 
-	if len(variants) == 0 {
+	if len(variants) == 0 && v.Unknown != "" {
 		klog.V(2).Infof("unknown variant for job: %s\n", jobName)
-		return []string{"unknown-variant"}
+		return []string{v.Unknown}
 	}
 
 	return variants
 }
+
+// IdentifyDimensions returns the values of the dimensions for the job in the
+// order the dimensions are defined. Dimensions without a matching value and
+// without a default are omitted.
+func (v *Variants) IdentifyDimensions(jobName string) []VariantValue {
+	var values []VariantValue
+	for _, dim := range v.Dimensions {
+		value := dim.Default
+		for _, val := range dim.Values {
+			if val.re.MatchString(jobName) {
+				value = val.Value
+				break
+			}
+		}
+		if value != "" {
+			values = append(values, VariantValue{Dimension: dim.Name, Value: value})
+		}
+	}
+	return values
+}
+
+func IdentifyVariants(jobName string) []string {
+	return DefaultVariants.Identify(jobName)
+}
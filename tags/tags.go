@@ -0,0 +1,180 @@
+package tags
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/completion"
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/output"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+func withDB(fn func(db *database.DB) error) (err error) {
+	db, err := database.OpenDefault()
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer func() {
+		closeErr := db.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	return fn(db)
+}
+
+func source(sippy bool) string {
+	if sippy {
+		return database.TagSourceSippy
+	}
+	return database.TagSourceCustom
+}
+
+type ListOptions struct {
+	out io.Writer
+
+	job    string
+	output string
+}
+
+func (opts *ListOptions) Run(ctx context.Context) error {
+	return withDB(func(db *database.DB) error {
+		tags, err := db.JobTagsList(opts.job)
+		if err != nil {
+			return err
+		}
+
+		return output.Print(opts.out, opts.output, tags, func(out io.Writer) error {
+			w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(w, "JOB\tTAG\tSOURCE")
+			for _, t := range tags {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", t.Job, t.Tag, t.Source)
+			}
+			return w.Flush()
+		})
+	})
+}
+
+type ChangeOptions struct {
+	job   string
+	sippy bool
+}
+
+func NewCmdList() *cobra.Command {
+	opts := &ListOptions{
+		out: os.Stdout,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List tags of jobs",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.job, "job", "", "Show only tags of the given job.")
+	output.AddFlag(cmd, &opts.output)
+	completion.RegisterJobFlag(cmd)
+
+	return cmd
+}
+
+func NewCmdAdd() *cobra.Command {
+	opts := &ChangeOptions{}
+
+	cmd := &cobra.Command{
+		Use:               "add TAG...",
+		Short:             "Add tags to a job",
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: completion.Tags,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := withDB(func(db *database.DB) error {
+				for _, tag := range args {
+					if err := db.AddJobTag(opts.job, tag, source(opts.sippy)); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.job, "job", "", "Name of the job.")
+	cmd.Flags().BoolVar(&opts.sippy, "sippy", false, "Add the tags to the Sippy tags instead of the custom tags.")
+	cmd.MarkFlagRequired("job")
+	completion.RegisterJobFlag(cmd)
+
+	return cmd
+}
+
+func NewCmdRemove() *cobra.Command {
+	opts := &ChangeOptions{}
+
+	cmd := &cobra.Command{
+		Use:               "remove TAG...",
+		Short:             "Remove tags from a job",
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: completion.Tags,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := withDB(func(db *database.DB) error {
+				for _, tag := range args {
+					if err := db.RemoveJobTag(opts.job, tag, source(opts.sippy)); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.job, "job", "", "Name of the job.")
+	cmd.Flags().BoolVar(&opts.sippy, "sippy", false, "Remove the tags from the Sippy tags instead of the custom tags.")
+	cmd.MarkFlagRequired("job")
+	completion.RegisterJobFlag(cmd)
+
+	return cmd
+}
+
+func NewCmdTags() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tags",
+		Short: "Manage job tags",
+		Long: heredoc.Doc(`
+			Manage tags of jobs.
+
+			Sippy tags are assigned by the indexer when a job is seen for the first
+			time. Ciinfo tags (x-platform-*, x-test-*, ...) are derived from
+			ci-operator configs and refreshed by the indexer. Custom tags are labels
+			like watchlist that are managed only by these commands. All kinds of
+			tags can be used in filters.
+		`),
+		Example: heredoc.Doc(`
+			ci-results tags list --job=periodic-ci-openshift-release-master-nightly-4.9-e2e-aws
+			ci-results tags add --job=periodic-ci-openshift-release-master-nightly-4.9-e2e-aws watchlist
+			ci-results tags remove --job=periodic-ci-openshift-release-master-nightly-4.9-e2e-aws watchlist
+		`),
+	}
+
+	cmd.AddCommand(NewCmdAdd())
+	cmd.AddCommand(NewCmdList())
+	cmd.AddCommand(NewCmdRemove())
+
+	return cmd
+}
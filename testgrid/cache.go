@@ -0,0 +1,125 @@
+package testgrid
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// cache stores responses on disk keyed by URL, so that they can be
+// revalidated using ETag and Last-Modified.
+type cache struct {
+	dir string
+	ttl time.Duration
+}
+
+type cacheEntry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Stored       time.Time `json:"stored"`
+
+	body []byte
+}
+
+func (c *cache) path(u string) string {
+	sum := sha256.Sum256([]byte(u))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+func (c *cache) load(u string) *cacheEntry {
+	p := c.path(u)
+	meta, err := ioutil.ReadFile(p + ".json")
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		klog.Warningf("unable to read cache entry for %s: %v", u, err)
+		return nil
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(meta, &entry); err != nil || entry.URL != u {
+		return nil
+	}
+	entry.body, err = ioutil.ReadFile(p + ".body")
+	if err != nil {
+		return nil
+	}
+	return &entry
+}
+
+func (e *cacheEntry) fresh(ttl time.Duration) bool {
+	return ttl > 0 && time.Since(e.Stored) < ttl
+}
+
+func (e *cacheEntry) setConditionalHeaders(req *http.Request) {
+	if e.ETag != "" {
+		req.Header.Set("If-None-Match", e.ETag)
+	}
+	if e.LastModified != "" {
+		req.Header.Set("If-Modified-Since", e.LastModified)
+	}
+}
+
+func writeFileAtomic(name string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+func (c *cache) store(u string, resp *http.Response, body []byte) {
+	entry := cacheEntry{
+		URL:          u,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Stored:       time.Now(),
+	}
+	if entry.ETag == "" && entry.LastModified == "" && c.ttl == 0 {
+		return
+	}
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		klog.Warningf("unable to store cache entry for %s: %v", u, err)
+		return
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		klog.Warningf("unable to store cache entry for %s: %v", u, err)
+		return
+	}
+	p := c.path(u)
+	if err := writeFileAtomic(p+".body", body); err != nil {
+		klog.Warningf("unable to store cache entry for %s: %v", u, err)
+		return
+	}
+	if err := writeFileAtomic(p+".json", meta); err != nil {
+		klog.Warningf("unable to store cache entry for %s: %v", u, err)
+	}
+}
+
+// touch marks the entry as revalidated.
+func (c *cache) touch(entry *cacheEntry) {
+	entry.Stored = time.Now()
+	meta, err := json.Marshal(entry)
+	if err == nil {
+		err = writeFileAtomic(c.path(entry.URL)+".json", meta)
+	}
+	if err != nil {
+		klog.Warningf("unable to update cache entry for %s: %v", entry.URL, err)
+	}
+}
@@ -0,0 +1,285 @@
+package testgrid
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const DefaultURL = "https://testgrid.k8s.io"
+
+type ClientOptions struct {
+	// BaseURL is the URL of the TestGrid instance, DefaultURL if empty.
+	BaseURL string
+	// Proxy is the URL of the proxy, if empty, the proxy is taken from the
+	// environment.
+	Proxy string
+	// Timeout limits the time of a single request including reading the body.
+	Timeout time.Duration
+	// Retries is the number of times a request is retried after a network
+	// error or a 429 or 5xx response.
+	Retries int
+	// RetryWait is the delay before the first retry, it doubles after each
+	// attempt.
+	RetryWait time.Duration
+	UserAgent string
+	// HideStaleTests asks TestGrid to omit tests that have no recent results.
+	HideStaleTests bool
+	// CacheDir is the directory for cached responses, the cache is disabled
+	// if it is empty.
+	CacheDir string
+	// CacheTTL is the time during which cached responses are used without
+	// revalidation.
+	CacheTTL time.Duration
+}
+
+// Client downloads data from a TestGrid instance.
+type Client struct {
+	BaseURL *url.URL
+	// StateURL is the location of the grid states, if it is set, the grids are
+	// downloaded as protobuf messages and the table endpoint is used only as a
+	// fallback.
+	StateURL   *url.URL
+	HTTPClient *http.Client
+	Retries    int
+	RetryWait  time.Duration
+	UserAgent  string
+
+	hideStaleTests bool
+	cache          *cache
+}
+
+// ParseURL parses an absolute URL without a trailing slash.
+func ParseURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSuffix(rawURL, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("%q: scheme and host are required", rawURL)
+	}
+	return u, nil
+}
+
+func NewClient(opts ClientOptions) (*Client, error) {
+	baseURL := opts.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultURL
+	}
+	u, err := ParseURL(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid testgrid url: %w", err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.Proxy != "" {
+		proxyURL, err := url.Parse(opts.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	userAgent := opts.UserAgent
+	if userAgent == "" {
+		userAgent = "ci-results"
+	}
+
+	var c *cache
+	if opts.CacheDir != "" {
+		c = &cache{
+			dir: opts.CacheDir,
+			ttl: opts.CacheTTL,
+		}
+	}
+
+	return &Client{
+		BaseURL: u,
+		HTTPClient: &http.Client{
+			Transport: transport,
+			Timeout:   opts.Timeout,
+		},
+		Retries:   opts.Retries,
+		RetryWait: opts.RetryWait,
+		UserAgent: userAgent,
+
+		hideStaleTests: opts.HideStaleTests,
+		cache:          c,
+	}, nil
+}
+
+func retryable(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// get fetches u and reads the whole body, so that the timeout covers
+// downloading of the data.
+func (c *Client) get(u string) ([]byte, error) {
+	wait := c.RetryWait
+	for attempt := 0; ; attempt++ {
+		body, retry, err := c.tryGet(u)
+		if err == nil || !retry || attempt >= c.Retries {
+			return body, err
+		}
+		klog.V(1).Infof("retrying in %s: %v", wait, err)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+func (c *Client) newRequest(u string) (*http.Request, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.UserAgent)
+	return req, nil
+}
+
+func (c *Client) tryGet(u string) (body []byte, retry bool, err error) {
+	var cached *cacheEntry
+	if c.cache != nil {
+		cached = c.cache.load(u)
+		if cached != nil && cached.fresh(c.cache.ttl) {
+			klog.V(3).Infof("using cached response for %s", u)
+			return cached.body, false, nil
+		}
+	}
+
+	req, err := c.newRequest(u)
+	if err != nil {
+		return nil, false, err
+	}
+	if cached != nil {
+		cached.setConditionalHeaders(req)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		klog.V(3).Infof("cached response for %s is not modified", u)
+		c.cache.touch(cached)
+		return cached.body, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil, retryable(resp), fmt.Errorf("got unexpected http response from %s: %s", u, resp.Status)
+	}
+
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, fmt.Errorf("unable to read response from %s: %w", u, err)
+	}
+	if c.cache != nil {
+		c.cache.store(u, resp, body)
+	}
+	return body, false, nil
+}
+
+func (c *Client) getJSON(u string, v interface{}) error {
+	body, err := c.get(u)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("unable to decode response from %s: %w", u, err)
+	}
+	return nil
+}
+
+// noRetryError is returned by decode functions of getStream if the request
+// must not be retried even if the response cannot be read, e.g. because the
+// decoded data has already been used.
+type noRetryError struct {
+	err error
+}
+
+func (e noRetryError) Error() string {
+	return e.err.Error()
+}
+
+func (e noRetryError) Unwrap() error {
+	return e.err
+}
+
+// readErrorReader remembers the error of the underlying reader, so that
+// network errors can be told apart from malformed data.
+type readErrorReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *readErrorReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// getStream fetches u and passes the body to decode as it is downloaded,
+// so that the body is never kept in memory as a whole. Responses are
+// buffered only if they have to be cached.
+func (c *Client) getStream(u string, decode func(r io.Reader) error) error {
+	if c.cache != nil {
+		body, err := c.get(u)
+		if err != nil {
+			return err
+		}
+		if err := decode(bytes.NewReader(body)); err != nil {
+			return fmt.Errorf("unable to decode response from %s: %w", u, err)
+		}
+		return nil
+	}
+
+	wait := c.RetryWait
+	for attempt := 0; ; attempt++ {
+		retry, err := c.tryGetStream(u, decode)
+		if err == nil || !retry || attempt >= c.Retries {
+			return err
+		}
+		klog.V(1).Infof("retrying in %s: %v", wait, err)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+func (c *Client) tryGetStream(u string, decode func(r io.Reader) error) (retry bool, err error) {
+	req, err := c.newRequest(u)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, resp.Body)
+		return retryable(resp), fmt.Errorf("got unexpected http response from %s: %s", u, resp.Status)
+	}
+
+	body := &readErrorReader{r: resp.Body}
+	err = decode(body)
+	if body.err != nil {
+		var noRetry noRetryError
+		return !errors.As(err, &noRetry), fmt.Errorf("unable to read response from %s: %w", u, body.err)
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to decode response from %s: %w", u, err)
+	}
+	return false, nil
+}
@@ -0,0 +1,130 @@
+package testgrid
+
+type statusCursor struct {
+	run  int
+	left int
+}
+
+// Columns iterates over the columns of the table, newest first, without
+// expanding the run-length encoded statuses of all tests at once.
+type Columns struct {
+	results *JobResults
+	col     int
+	cursors []statusCursor
+}
+
+// Columns returns an iterator over the columns of the table.
+func (r *JobResults) Columns() *Columns {
+	cursors := make([]statusCursor, len(r.Tests))
+	for i := range cursors {
+		cursors[i] = statusCursor{run: -1, left: 1}
+	}
+	return &Columns{
+		results: r,
+		col:     -1,
+		cursors: cursors,
+	}
+}
+
+// TestColumns returns an iterator over the columns of the table that has only
+// the test, e.g. a test passed by StreamJobResults.
+func (r *JobResults) TestColumns(test *Test) *Columns {
+	table := &JobResults{
+		Query:       r.Query,
+		Changelists: r.Changelists,
+		Timestamps:  r.Timestamps,
+		Tests:       []Test{*test},
+	}
+	return table.Columns()
+}
+
+// Next advances to the next column, it returns false when there are no more
+// columns.
+func (c *Columns) Next() bool {
+	if c.col+1 >= len(c.results.Changelists) {
+		return false
+	}
+	c.col++
+	for i, t := range c.results.Tests {
+		cur := &c.cursors[i]
+		cur.left--
+		for cur.left <= 0 && cur.run+1 < len(t.Statuses) {
+			cur.run++
+			cur.left = t.Statuses[cur.run].Count
+		}
+	}
+	return true
+}
+
+// Index returns the index of the current column.
+func (c *Columns) Index() int {
+	return c.col
+}
+
+// Changelist returns the build number of the current column.
+func (c *Columns) Changelist() string {
+	return c.results.Changelists[c.col]
+}
+
+// Timestamp returns the start time of the current column in milliseconds.
+func (c *Columns) Timestamp() int64 {
+	return c.results.Timestamps[c.col]
+}
+
+// Status returns the status of the i-th test in the current column.
+func (c *Columns) Status(i int) TestStatus {
+	cur := c.cursors[i]
+	if cur.run < 0 || cur.left <= 0 {
+		return TestStatusNoResult
+	}
+	return c.results.Tests[i].Statuses[cur.run].Value
+}
+
+// Message returns the message of the i-th test in the current column, e.g.
+// the failure of the test.
+func (c *Columns) Message(i int) string {
+	messages := c.results.Tests[i].Messages
+	if c.col >= len(messages) {
+		return ""
+	}
+	return messages[c.col]
+}
+
+// Metric returns the value of the metric of the i-th test in the current
+// column.
+func (c *Columns) Metric(i int, name string) (float64, bool) {
+	t := &c.results.Tests[i]
+	if values, ok := t.Metrics[name]; ok {
+		v, ok := values[c.col]
+		return v, ok
+	}
+	// Later graphs take precedence, as they do in Test.Metric.
+	var value float64
+	found := false
+	for _, g := range t.Graphs {
+		for k, metric := range g.Metric {
+			if metric != name || k >= len(g.Values) || c.col >= len(g.Values[k]) {
+				continue
+			}
+			if v := g.Values[k][c.col]; v != nil {
+				value, found = *v, true
+			}
+		}
+	}
+	return value, found
+}
+
+// HasRecentResults reports whether the test has any result in the n most recent
+// columns.
+func (t Test) HasRecentResults(n int) bool {
+	for _, s := range t.Statuses {
+		if n <= 0 {
+			break
+		}
+		if s.Value != TestStatusNoResult && s.Count > 0 {
+			return true
+		}
+		n -= s.Count
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package testgrid
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Interface is the part of the TestGrid API that is used by the indexer.
+type Interface interface {
+	ListDashboards() ([]Dashboard, error)
+	GetDashboardGroup(group string) ([]Dashboard, error)
+	GetDashboardSummary(dashboard string) (DashboardSummary, error)
+	StreamJobResults(dashboard, jobName string, columns int, fn func(results *JobResults, test *Test) error) (*JobResults, error)
+}
+
+var _ Interface = &Client{}
+var _ Interface = &Fake{}
+
+// Fake serves TestGrid data from memory.
+type Fake struct {
+	Dashboards []Dashboard
+	Groups     map[string][]Dashboard
+	Summaries  map[string]DashboardSummary
+	// Results are keyed by dashboard and job name.
+	Results map[string]map[string]*JobResults
+}
+
+func readJSON(name string, v interface{}) error {
+	buf, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(buf, v); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// NewFakeFromDir loads fixtures from dir, which has the layout:
+//
+//	dashboards.json           response of ListDashboards
+//	groups/GROUP.json         response of GetDashboardGroup
+//	DASHBOARD/summary.json    response of GetDashboardSummary
+//	DASHBOARD/JOB.json        response of StreamJobResults
+//
+// The JSON files have the same format as the TestGrid responses.
+func NewFakeFromDir(dir string) (*Fake, error) {
+	f := &Fake{
+		Groups:    make(map[string][]Dashboard),
+		Summaries: make(map[string]DashboardSummary),
+		Results:   make(map[string]map[string]*JobResults),
+	}
+
+	var list dashboardList
+	err := readJSON(filepath.Join(dir, "dashboards.json"), &list)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	f.Dashboards = list.Dashboards
+
+	groups, err := filepath.Glob(filepath.Join(dir, "groups", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range groups {
+		var list dashboardList
+		if err := readJSON(name, &list); err != nil {
+			return nil, err
+		}
+		f.Groups[strings.TrimSuffix(filepath.Base(name), ".json")] = list.Dashboards
+	}
+
+	summaries, err := filepath.Glob(filepath.Join(dir, "*", "summary.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range summaries {
+		dashboard := filepath.Base(filepath.Dir(name))
+		if dashboard == "groups" {
+			continue
+		}
+
+		var summary DashboardSummary
+		if err := readJSON(name, &summary); err != nil {
+			return nil, err
+		}
+		f.Summaries[dashboard] = summary
+		f.Results[dashboard] = make(map[string]*JobResults)
+
+		for jobName := range summary {
+			var results JobResults
+			err := readJSON(filepath.Join(dir, dashboard, jobName+".json"), &results)
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			f.Results[dashboard][jobName] = &results
+		}
+	}
+
+	return f, nil
+}
+
+func (f *Fake) ListDashboards() ([]Dashboard, error) {
+	return f.Dashboards, nil
+}
+
+func (f *Fake) GetDashboardGroup(group string) ([]Dashboard, error) {
+	dashboards, ok := f.Groups[group]
+	if !ok {
+		return nil, fmt.Errorf("dashboard group %s not found", group)
+	}
+	return dashboards, nil
+}
+
+func (f *Fake) GetDashboardSummary(dashboard string) (DashboardSummary, error) {
+	summary, ok := f.Summaries[dashboard]
+	if !ok {
+		return nil, fmt.Errorf("dashboard %s not found", dashboard)
+	}
+	return summary, nil
+}
+
+func (f *Fake) StreamJobResults(dashboard, jobName string, columns int, fn func(results *JobResults, test *Test) error) (*JobResults, error) {
+	results, ok := f.Results[dashboard][jobName]
+	if !ok {
+		return nil, fmt.Errorf("job %s not found on dashboard %s", jobName, dashboard)
+	}
+	// The results go through the decoder of the table endpoint, and callers
+	// get copies that they may modify.
+	buf, err := json.Marshal(results)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJobResults(bytes.NewReader(buf), columns, fn)
+}
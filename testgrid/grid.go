@@ -0,0 +1,330 @@
+package testgrid
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/url"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"k8s.io/klog/v2"
+)
+
+// Grid is the state of a tab as it is stored by the TestGrid updater.
+//
+// https://github.com/GoogleCloudPlatform/testgrid/blob/master/pb/state/state.proto
+type Grid struct {
+	Columns []Column
+	Rows    []Row
+}
+
+type Column struct {
+	Build   string
+	Name    string
+	Started float64 // milliseconds
+	Extra   []string
+}
+
+type Metric struct {
+	Name string
+	// Indices is a list of pairs of a column index and a number of
+	// consecutive columns that have values.
+	Indices []int32
+	Values  []float64
+}
+
+// Sparse returns the values of the metric keyed by column index.
+func (m Metric) Sparse() map[int]float64 {
+	result := make(map[int]float64)
+	v := 0
+	for i := 0; i+1 < len(m.Indices); i += 2 {
+		for col := int(m.Indices[i]); col < int(m.Indices[i]+m.Indices[i+1]) && v < len(m.Values); col++ {
+			result[col] = m.Values[v]
+			v++
+		}
+	}
+	return result
+}
+
+type Row struct {
+	Name string
+	ID   string
+	// Results is a run-length encoded list of pairs of a status and a number
+	// of columns with this status.
+	Results    []int32
+	CellIDs    []string
+	Messages   []string
+	Metrics    []Metric
+	Icons      []string
+	Properties []map[string]string
+}
+
+type field struct {
+	num   protowire.Number
+	typ   protowire.Type
+	value uint64
+	bytes []byte
+}
+
+func parseFields(b []byte, fn func(f field) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		f := field{num: num, typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.value, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			f.value, n = protowire.ConsumeFixed64(b)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(b)
+			f.value = uint64(v)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if err := fn(f); err != nil {
+			return fmt.Errorf("field %d: %w", num, err)
+		}
+	}
+	return nil
+}
+
+// appendInt32s handles both packed and unpacked repeated int32 fields.
+func appendInt32s(s []int32, f field) ([]int32, error) {
+	if f.typ == protowire.VarintType {
+		return append(s, int32(f.value)), nil
+	}
+	b := f.bytes
+	for len(b) > 0 {
+		v, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		s = append(s, int32(v))
+		b = b[n:]
+	}
+	return s, nil
+}
+
+// appendDoubles handles both packed and unpacked repeated double fields.
+func appendDoubles(s []float64, f field) ([]float64, error) {
+	if f.typ == protowire.Fixed64Type {
+		return append(s, math.Float64frombits(f.value)), nil
+	}
+	b := f.bytes
+	for len(b) > 0 {
+		v, n := protowire.ConsumeFixed64(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		s = append(s, math.Float64frombits(v))
+		b = b[n:]
+	}
+	return s, nil
+}
+
+func decodeColumn(b []byte) (c Column, err error) {
+	err = parseFields(b, func(f field) error {
+		switch f.num {
+		case 1:
+			c.Build = string(f.bytes)
+		case 2:
+			c.Name = string(f.bytes)
+		case 3:
+			c.Started = math.Float64frombits(f.value)
+		case 4:
+			c.Extra = append(c.Extra, string(f.bytes))
+		}
+		return nil
+	})
+	return c, err
+}
+
+func decodeMetric(b []byte) (m Metric, err error) {
+	err = parseFields(b, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			m.Name = string(f.bytes)
+		case 2:
+			m.Indices, err = appendInt32s(m.Indices, f)
+		case 3:
+			m.Values, err = appendDoubles(m.Values, f)
+		}
+		return err
+	})
+	return m, err
+}
+
+func decodeProperty(b []byte) (map[string]string, error) {
+	p := make(map[string]string)
+	err := parseFields(b, func(f field) error {
+		if f.num != 1 {
+			return nil
+		}
+		var key, value string
+		err := parseFields(f.bytes, func(f field) error {
+			switch f.num {
+			case 1:
+				key = string(f.bytes)
+			case 2:
+				value = string(f.bytes)
+			}
+			return nil
+		})
+		p[key] = value
+		return err
+	})
+	return p, err
+}
+
+func decodeRow(b []byte) (r Row, err error) {
+	err = parseFields(b, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			r.Name = string(f.bytes)
+		case 2:
+			r.ID = string(f.bytes)
+		case 3:
+			r.Results, err = appendInt32s(r.Results, f)
+		case 4:
+			r.CellIDs = append(r.CellIDs, string(f.bytes))
+		case 5:
+			r.Messages = append(r.Messages, string(f.bytes))
+		case 8:
+			var m Metric
+			m, err = decodeMetric(f.bytes)
+			r.Metrics = append(r.Metrics, m)
+		case 9:
+			r.Icons = append(r.Icons, string(f.bytes))
+		case 13:
+			var p map[string]string
+			p, err = decodeProperty(f.bytes)
+			r.Properties = append(r.Properties, p)
+		}
+		return err
+	})
+	return r, err
+}
+
+// DecodeGrid decodes a serialized state.Grid message.
+func DecodeGrid(b []byte) (*Grid, error) {
+	var g Grid
+	err := parseFields(b, func(f field) error {
+		switch f.num {
+		case 1:
+			c, err := decodeColumn(f.bytes)
+			if err != nil {
+				return err
+			}
+			g.Columns = append(g.Columns, c)
+		case 2:
+			r, err := decodeRow(f.bytes)
+			if err != nil {
+				return err
+			}
+			g.Rows = append(g.Rows, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode grid: %w", err)
+	}
+	return &g, nil
+}
+
+// JobResults converts the grid into the format of the table endpoint.
+func (g *Grid) JobResults() *JobResults {
+	results := &JobResults{
+		Changelists: []string{},
+		Tests:       []Test{},
+		Timestamps:  []int64{},
+	}
+	for _, c := range g.Columns {
+		results.Changelists = append(results.Changelists, c.Build)
+		results.Timestamps = append(results.Timestamps, int64(c.Started))
+	}
+	for _, r := range g.Rows {
+		t := Test{
+			Name:         r.Name,
+			OriginalName: r.ID,
+			ShortTexts:   r.Icons,
+			Properties:   r.Properties,
+		}
+		for i := 0; i+1 < len(r.Results); i += 2 {
+			t.Statuses = append(t.Statuses, TestResult{
+				Value: TestStatus(r.Results[i]),
+				Count: int(r.Results[i+1]),
+			})
+		}
+		// The grid has messages only for cells with results, the table has
+		// a message for every column.
+		if len(r.Messages) > 0 {
+			t.Messages = make([]string, 0, len(g.Columns))
+			next := 0
+			for _, s := range t.Statuses {
+				for j := 0; j < s.Count; j++ {
+					msg := ""
+					if s.Value != TestStatusNoResult && next < len(r.Messages) {
+						msg = r.Messages[next]
+						next++
+					}
+					t.Messages = append(t.Messages, msg)
+				}
+			}
+		}
+		if len(r.Metrics) > 0 {
+			t.Metrics = make(map[string]map[int]float64)
+			for _, m := range r.Metrics {
+				t.Metrics[m.Name] = m.Sparse()
+			}
+		}
+		results.Tests = append(results.Tests, t)
+	}
+	return results
+}
+
+func (c *Client) gridURL(dashboard, jobName string) *url.URL {
+	u := *c.StateURL
+	u.Path += fmt.Sprintf("/%s/%s", url.PathEscape(dashboard), url.PathEscape(jobName))
+	return &u
+}
+
+// GetGrid downloads the zlib-compressed grid state of the tab from StateURL.
+func (c *Client) GetGrid(dashboard, jobName string) (*Grid, error) {
+	if c.StateURL == nil {
+		return nil, fmt.Errorf("state url is not configured")
+	}
+
+	u := c.gridURL(dashboard, jobName).String()
+	klog.V(2).Infof("downloading grid state from %s...", u)
+	body, err := c.get(u)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := zlib.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decompress grid from %s: %w", u, err)
+	}
+	defer r.Close()
+
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decompress grid from %s: %w", u, err)
+	}
+	return DecodeGrid(buf)
+}
@@ -3,8 +3,10 @@ package testgrid
 import (
 	"encoding/json"
 	"fmt"
-	"net/http"
+	"io"
 	"net/url"
+	"regexp"
+	"strconv"
 
 	"k8s.io/klog/v2"
 )
@@ -13,14 +15,82 @@ type TestStatus int
 
 // https://github.com/GoogleCloudPlatform/testgrid/blob/b52feda0e27a01ddc9eca16fe17e6b29c8193b7c/pb/test_status/test_status.proto
 const (
-	TestStatusNoResult      TestStatus = 0
-	TestStatusPass          TestStatus = 1
-	TestStatusPassWithSkips TestStatus = 3
-	TestStatusRunning       TestStatus = 4
-	TestStatusFail          TestStatus = 12
-	TestStatusFlaky         TestStatus = 13
+	TestStatusNoResult         TestStatus = 0
+	TestStatusPass             TestStatus = 1
+	TestStatusPassWithErrors   TestStatus = 2
+	TestStatusPassWithSkips    TestStatus = 3
+	TestStatusRunning          TestStatus = 4
+	TestStatusCategorizedAbort TestStatus = 5
+	TestStatusUnknown          TestStatus = 6
+	TestStatusCancel           TestStatus = 7
+	TestStatusBlocked          TestStatus = 8
+	TestStatusTimedOut         TestStatus = 9
+	TestStatusCategorizedFail  TestStatus = 10
+	TestStatusBuildFail        TestStatus = 11
+	TestStatusFail             TestStatus = 12
+	TestStatusFlaky            TestStatus = 13
+	TestStatusToolFail         TestStatus = 14
+	TestStatusBuildPassed      TestStatus = 15
 )
 
+// Category is the bucket in which a test status is counted.
+type Category int
+
+const (
+	// CategoryNone is for statuses without a result.
+	CategoryNone Category = iota
+	CategoryPass
+	CategoryFlake
+	CategoryFail
+	// CategoryInfra is for runs that didn't produce a result because of
+	// problems with the infrastructure.
+	CategoryInfra
+)
+
+var statusCategories = map[TestStatus]Category{
+	TestStatusPass:             CategoryPass,
+	TestStatusPassWithErrors:   CategoryPass,
+	TestStatusPassWithSkips:    CategoryPass,
+	TestStatusBuildPassed:      CategoryPass,
+	TestStatusFlaky:            CategoryFlake,
+	TestStatusFail:             CategoryFail,
+	TestStatusCategorizedFail:  CategoryFail,
+	TestStatusTimedOut:         CategoryFail,
+	TestStatusBuildFail:        CategoryFail,
+	TestStatusCategorizedAbort: CategoryInfra,
+	TestStatusUnknown:          CategoryInfra,
+	TestStatusCancel:           CategoryInfra,
+	TestStatusBlocked:          CategoryInfra,
+	TestStatusToolFail:         CategoryInfra,
+}
+
+func (s TestStatus) Category() Category {
+	return statusCategories[s]
+}
+
+var categoryNames = map[Category]string{
+	CategoryNone:  "none",
+	CategoryPass:  "pass",
+	CategoryFlake: "flake",
+	CategoryFail:  "fail",
+	CategoryInfra: "infra",
+}
+
+func (c Category) String() string {
+	return categoryNames[c]
+}
+
+// Statuses returns the statuses that belong to the category.
+func (c Category) Statuses() []TestStatus {
+	var result []TestStatus
+	for s := TestStatusNoResult; s <= TestStatusBuildPassed; s++ {
+		if s.Category() == c {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
 type TestResult struct {
 	Count int        `json:"count"`
 	Value TestStatus `json:"value"`
@@ -33,6 +103,42 @@ type Test struct {
 	ShortTexts   []string     `json:"short-texts"`
 	Statuses     []TestResult `json:"statuses"`
 	Target       string       `json:"target"`
+	Graphs       []Graph      `json:"graphs"`
+
+	// Properties and Metrics are available only from the grid state.
+	Properties []map[string]string        `json:"-"`
+	Metrics    map[string]map[int]float64 `json:"-"`
+}
+
+// MetricTestDuration is the name of the metric with test durations in minutes.
+const MetricTestDuration = "test-duration-minutes"
+
+// Graph has values of metrics for each column of the table, missing values
+// are nulls.
+type Graph struct {
+	Metric []string     `json:"metric"`
+	Values [][]*float64 `json:"values"`
+}
+
+// Metric returns the values of the metric keyed by column index.
+func (t Test) Metric(name string) map[int]float64 {
+	if values, ok := t.Metrics[name]; ok {
+		return values
+	}
+	result := make(map[int]float64)
+	for _, g := range t.Graphs {
+		for i, metric := range g.Metric {
+			if metric != name || i >= len(g.Values) {
+				continue
+			}
+			for col, v := range g.Values[i] {
+				if v != nil {
+					result[col] = *v
+				}
+			}
+		}
+	}
+	return result
 }
 
 type JobResults struct {
@@ -42,55 +148,337 @@ type JobResults struct {
 	Timestamps  []int64  `json:"timestamps"`
 }
 
-type JobSummary struct {
+func truncateStatuses(statuses []TestResult, n int) []TestResult {
+	var result []TestResult
+	for _, s := range statuses {
+		if n <= 0 {
+			break
+		}
+		if s.Count > n {
+			s.Count = n
+		}
+		result = append(result, s)
+		n -= s.Count
+	}
+	return result
 }
 
-type DashboardSummary map[string]JobSummary
-
-func dashboardSummaryURL(dashboard string) *url.URL {
-	return &url.URL{
-		Scheme: "https",
-		Host:   "testgrid.k8s.io",
-		Path:   fmt.Sprintf("/%s/summary", url.PathEscape(dashboard)),
+// truncate keeps only the n most recent columns of the test.
+func (t *Test) truncate(n int) {
+	t.Statuses = truncateStatuses(t.Statuses, n)
+	if len(t.Messages) > n {
+		t.Messages = t.Messages[:n]
+	}
+	for _, g := range t.Graphs {
+		for j := range g.Values {
+			if len(g.Values[j]) > n {
+				g.Values[j] = g.Values[j][:n]
+			}
+		}
+	}
+	for _, values := range t.Metrics {
+		for col := range values {
+			if col >= n {
+				delete(values, col)
+			}
+		}
 	}
 }
 
-func jobResultsURL(dashboard, jobName string) *url.URL {
-	return &url.URL{
-		Scheme: "https",
-		Host:   "testgrid.k8s.io",
-		Path:   fmt.Sprintf("/%s/table", url.PathEscape(dashboard)),
-		RawQuery: url.Values{
-			"tab":              {jobName},
-			"show-stale-tests": {""},
-		}.Encode(),
+// Truncate keeps only the n most recent columns, n <= 0 keeps all columns.
+func (r *JobResults) Truncate(n int) {
+	if n <= 0 || len(r.Changelists) <= n {
+		return
+	}
+	r.Changelists = r.Changelists[:n]
+	r.Timestamps = r.Timestamps[:n]
+	for i := range r.Tests {
+		r.Tests[i].truncate(n)
 	}
 }
 
-func GetDashboardSummary(dashboard string) (DashboardSummary, error) {
-	u := dashboardSummaryURL(dashboard).String()
-	klog.V(2).Infof("downloading summary for %s from %s...", dashboard, u)
-	resp, err := http.Get(u)
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
 	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("expected %s, got %v", delim, tok)
+	}
+	return nil
+}
+
+// decodeJobResults decodes the table and passes its tests to fn one at a
+// time, each test is truncated to the n most recent columns as soon as it is
+// read, so that neither the response nor columns beyond n are kept in memory.
+// fn gets the results without tests, tests are buffered only if they precede
+// changelists and timestamps in the response. n <= 0 keeps all columns.
+func decodeJobResults(r io.Reader, n int, fn func(results *JobResults, test *Test) error) (*JobResults, error) {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
+	d := &testsDecoder{n: n, fn: fn}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch tok {
+		case "query":
+			err = dec.Decode(&d.results.Query)
+		case "changelists":
+			err = dec.Decode(&d.results.Changelists)
+			d.changelists = true
+		case "timestamps":
+			err = dec.Decode(&d.results.Timestamps)
+			d.timestamps = true
+		case "tests":
+			err = d.decodeTests(dec)
+		default:
+			var skipped json.RawMessage
+			err = dec.Decode(&skipped)
+		}
+		if err == nil && d.changelists && d.timestamps {
+			err = d.flush()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", tok, err)
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, err
+	}
+	if err := d.flush(); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return &d.results, nil
+}
+
+type testsDecoder struct {
+	n  int
+	fn func(results *JobResults, test *Test) error
+
+	results     JobResults
+	changelists bool
+	timestamps  bool
+	ready       bool
+	// pending has the tests that are read before the columns are known.
+	pending []Test
+}
+
+// flush passes the pending tests to fn, the columns are truncated before the
+// first test is passed.
+func (d *testsDecoder) flush() error {
+	if !d.ready {
+		d.results.Truncate(d.n)
+		d.ready = true
+	}
+	for i := range d.pending {
+		if err := d.fn(&d.results, &d.pending[i]); err != nil {
+			return err
+		}
+	}
+	d.pending = nil
+	return nil
+}
 
+func (d *testsDecoder) decodeTests(dec *json.Decoder) error {
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok == nil {
+		return nil
+	} else if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("expected [, got %v", tok)
+	}
+	for dec.More() {
+		var t Test
+		if err := dec.Decode(&t); err != nil {
+			return err
+		}
+		if d.n > 0 {
+			t.truncate(d.n)
+		}
+		if !d.ready {
+			d.pending = append(d.pending, t)
+			continue
+		}
+		if err := d.fn(&d.results, &t); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, ']')
+}
+
+const (
+	OverallStatusPassing = "PASSING"
+	OverallStatusFailing = "FAILING"
+	OverallStatusFlaky   = "FLAKY"
+	OverallStatusStale   = "STALE"
+)
+
+type JobSummary struct {
+	Alert               string  `json:"alert"`
+	LastRunTimestamp    float64 `json:"last_run_timestamp"`
+	LastUpdateTimestamp float64 `json:"last_update_timestamp"`
+	LatestGreen         string  `json:"latest_green"`
+	OverallStatus       string  `json:"overall_status"`
+	Status              string  `json:"status"`
+	DashboardName       string  `json:"dashboard_name"`
+}
+
+var recentColumnsRe = regexp.MustCompile(`^(\d+) of (\d+) .*recent columns passed`)
+
+// LastRun returns the start time of the latest run in milliseconds. TestGrid
+// reports it in seconds or in milliseconds depending on the version.
+func (s JobSummary) LastRun() int64 {
+	if s.LastRunTimestamp < 1e11 {
+		return int64(s.LastRunTimestamp * 1000)
+	}
+	return int64(s.LastRunTimestamp)
+}
+
+// RecentColumns returns the number of passed and total recent columns parsed
+// from the status line, ok is false if the status has an unexpected format.
+func (s JobSummary) RecentColumns() (passed int, total int, ok bool) {
+	m := recentColumnsRe.FindStringSubmatch(s.Status)
+	if m == nil {
+		return 0, 0, false
+	}
+	passed, _ = strconv.Atoi(m[1])
+	total, _ = strconv.Atoi(m[2])
+	return passed, total, true
+}
+
+// NeverGreen reports whether the job has not passed in any column that
+// TestGrid keeps.
+func (s JobSummary) NeverGreen() bool {
+	if s.LatestGreen != "" {
+		return false
+	}
+	passed, total, ok := s.RecentColumns()
+	return ok && total > 0 && passed == 0
+}
+
+type DashboardSummary map[string]JobSummary
+
+type Dashboard struct {
+	Name               string `json:"name"`
+	Link               string `json:"link"`
+	DashboardGroupName string `json:"dashboard_group_name"`
+}
+
+type dashboardList struct {
+	Dashboards []Dashboard `json:"dashboards"`
+}
+
+func (c *Client) dashboardSummaryURL(dashboard string) *url.URL {
+	u := *c.BaseURL
+	u.Path += fmt.Sprintf("/%s/summary", url.PathEscape(dashboard))
+	return &u
+}
+
+func (c *Client) jobResultsURL(dashboard, jobName string, columns int) *url.URL {
+	u := *c.BaseURL
+	u.Path += fmt.Sprintf("/%s/table", url.PathEscape(dashboard))
+	query := url.Values{
+		"tab":           {jobName},
+		"graph-metrics": {MetricTestDuration},
+	}
+	if !c.hideStaleTests {
+		query.Set("show-stale-tests", "")
+	}
+	if columns > 0 {
+		query.Set("width", strconv.Itoa(columns))
+	}
+	u.RawQuery = query.Encode()
+	return &u
+}
+
+func (c *Client) dashboardsURL() *url.URL {
+	u := *c.BaseURL
+	u.Path += "/api/v1/dashboards"
+	return &u
+}
+
+func (c *Client) dashboardGroupURL(group string) *url.URL {
+	u := *c.BaseURL
+	u.Path += fmt.Sprintf("/api/v1/dashboard-groups/%s", url.PathEscape(group))
+	return &u
+}
+
+func (c *Client) GetDashboardSummary(dashboard string) (DashboardSummary, error) {
+	u := c.dashboardSummaryURL(dashboard).String()
+	klog.V(2).Infof("downloading summary for %s from %s...", dashboard, u)
 	var summary DashboardSummary
-	err = json.NewDecoder(resp.Body).Decode(&summary)
+	err := c.getJSON(u, &summary)
 	return summary, err
 }
 
-func GetJobResults(dashboard, jobName string) (*JobResults, error) {
-	u := jobResultsURL(dashboard, jobName).String()
+// StreamJobResults passes the tests of the job to fn one at a time for the
+// most recent columns, or for all columns if columns is 0. fn gets the results
+// of the job without tests, they are returned when all tests are passed.
+func (c *Client) StreamJobResults(dashboard, jobName string, columns int, fn func(results *JobResults, test *Test) error) (*JobResults, error) {
+	if c.StateURL != nil {
+		grid, err := c.GetGrid(dashboard, jobName)
+		if err == nil {
+			results := grid.JobResults()
+			results.Truncate(columns)
+			tests := results.Tests
+			results.Tests = nil
+			for i := range tests {
+				if err := fn(results, &tests[i]); err != nil {
+					return nil, err
+				}
+			}
+			return results, nil
+		}
+		klog.Warningf("unable to get grid for %s/%s, falling back to the table endpoint: %v", dashboard, jobName, err)
+	}
+
+	u := c.jobResultsURL(dashboard, jobName, columns).String()
 	klog.V(2).Infof("downloading job results from %s...", u)
-	resp, err := http.Get(u)
+	// Older TestGrid versions ignore the width parameter, so the table is
+	// truncated while it is decoded.
+	var results *JobResults
+	err := c.getStream(u, func(r io.Reader) (err error) {
+		passed := false
+		results, err = decodeJobResults(r, columns, func(results *JobResults, test *Test) error {
+			passed = true
+			return fn(results, test)
+		})
+		if err != nil && passed {
+			// A retry would pass the tests to fn again.
+			return noRetryError{err: err}
+		}
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return results, nil
+}
 
-	var results JobResults
-	err = json.NewDecoder(resp.Body).Decode(&results)
-	return &results, err
+// ListDashboards returns all dashboards of the TestGrid instance.
+func (c *Client) ListDashboards() ([]Dashboard, error) {
+	u := c.dashboardsURL().String()
+	klog.V(2).Infof("downloading list of dashboards from %s...", u)
+	var list dashboardList
+	err := c.getJSON(u, &list)
+	return list.Dashboards, err
+}
+
+// GetDashboardGroup returns the dashboards that belong to the dashboard group.
+func (c *Client) GetDashboardGroup(group string) ([]Dashboard, error) {
+	u := c.dashboardGroupURL(group).String()
+	klog.V(2).Infof("downloading dashboard group %s from %s...", group, u)
+	var list dashboardList
+	err := c.getJSON(u, &list)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list.Dashboards {
+		list.Dashboards[i].DashboardGroupName = group
+	}
+	return list.Dashboards, nil
 }
@@ -0,0 +1,118 @@
+package testgrid
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeJobResults(t *testing.T) {
+	const test1 = `{"name": "test1", "messages": ["a", "b", "c"], "statuses": [{"count": 3, "value": 12}]}`
+	const test2 = `{"name": "test2", "messages": ["", "", ""], "statuses": [{"count": 1, "value": 1}, {"count": 2, "value": 0}]}`
+
+	testCases := []struct {
+		name string
+		body string
+	}{
+		{
+			name: "columns before tests",
+			body: `{"query": "q", "changelists": ["3", "2", "1"], "timestamps": [3000, 2000, 1000], "tests": [` + test1 + `, ` + test2 + `]}`,
+		},
+		{
+			name: "columns after tests",
+			body: `{"query": "q", "tests": [` + test1 + `, ` + test2 + `], "changelists": ["3", "2", "1"], "timestamps": [3000, 2000, 1000]}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var names []string
+			results, err := decodeJobResults(strings.NewReader(tc.body), 2, func(results *JobResults, test *Test) error {
+				if !reflect.DeepEqual(results.Changelists, []string{"3", "2"}) || !reflect.DeepEqual(results.Timestamps, []int64{3000, 2000}) {
+					t.Errorf("%s: got columns %v %v, want the 2 most recent columns", test.Name, results.Changelists, results.Timestamps)
+				}
+				count := 0
+				for _, s := range test.Statuses {
+					count += s.Count
+				}
+				if len(test.Messages) != 2 || count != 2 {
+					t.Errorf("%s: got %+v, want the test truncated to 2 columns", test.Name, test)
+				}
+				names = append(names, test.Name)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(names, []string{"test1", "test2"}) {
+				t.Errorf("got tests %v, want [test1 test2]", names)
+			}
+			if results.Query != "q" || len(results.Changelists) != 2 || results.Tests != nil {
+				t.Errorf("got results %+v, want the truncated results without tests", results)
+			}
+		})
+	}
+}
+
+// TestDecodeJobResultsStreams checks that tests are passed on before the rest
+// of the response is read.
+func TestDecodeJobResultsStreams(t *testing.T) {
+	r, w := io.Pipe()
+	passed := make(chan string, 2)
+	go func() {
+		io.WriteString(w, `{"changelists": ["1"], "timestamps": [1000], "tests": [{"name": "test1", "statuses": [{"count": 1, "value": 1}]}, `)
+		select {
+		case <-passed:
+		case <-time.After(5 * time.Second):
+		}
+		io.WriteString(w, `{"name": "test2", "statuses": [{"count": 1, "value": 1}]}]}`)
+		w.Close()
+	}()
+
+	var names []string
+	_, err := decodeJobResults(r, 0, func(results *JobResults, test *Test) error {
+		if len(names) == 0 && test.Name == "test1" {
+			passed <- test.Name
+		}
+		names = append(names, test.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"test1", "test2"}) {
+		t.Errorf("got tests %v, want [test1 test2]", names)
+	}
+	select {
+	case <-passed:
+		t.Error("test1 wasn't passed before test2 was sent")
+	default:
+	}
+}
+
+func TestTestColumns(t *testing.T) {
+	results := &JobResults{
+		Changelists: []string{"3", "2", "1"},
+		Timestamps:  []int64{3000, 2000, 1000},
+	}
+	test := &Test{
+		Name:     "test",
+		Messages: []string{"", "failed", ""},
+		Statuses: []TestResult{{Count: 1, Value: TestStatusPass}, {Count: 1, Value: TestStatusFail}},
+	}
+
+	var got []TestStatus
+	var messages []string
+	for cols := results.TestColumns(test); cols.Next(); {
+		got = append(got, cols.Status(0))
+		messages = append(messages, cols.Message(0))
+	}
+	want := []TestStatus{TestStatusPass, TestStatusFail, TestStatusNoResult}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got statuses %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(messages, []string{"", "failed", ""}) {
+		t.Errorf("got messages %q, want the failure in the second column", messages)
+	}
+}
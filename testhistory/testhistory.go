@@ -0,0 +1,172 @@
+package testhistory
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/client"
+	"github.com/dmage/ci-results/completion"
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/output"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+type TestHistoryOptions struct {
+	testName string
+	filter   string
+	last     string
+	server   string
+	output   string
+
+	out io.Writer
+}
+
+func parseDays(s string) (int, error) {
+	days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+	if err != nil || days <= 0 {
+		return 0, fmt.Errorf("invalid number of days %q", s)
+	}
+	return days, nil
+}
+
+func symbol(v database.StatsValues) string {
+	switch {
+	case v.Pass+v.Flake+v.Fail == 0:
+		return "."
+	case v.Fail == 0 && v.Flake == 0:
+		return "+"
+	case v.Pass == 0 && v.Flake == 0:
+		return "x"
+	}
+	return "~"
+}
+
+func printHistory(out io.Writer, timeline *database.Timeline) error {
+	type jobHistory struct {
+		name    string
+		symbols string
+		total   database.StatsValues
+	}
+	var jobs []jobHistory
+	for _, row := range timeline.Data {
+		h := jobHistory{name: row.Columns[0]}
+		for _, v := range row.Values {
+			h.symbols += symbol(v)
+			h.total.Pass += v.Pass
+			h.total.Flake += v.Flake
+			h.total.Fail += v.Fail
+		}
+		jobs = append(jobs, h)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].total.Fail != jobs[j].total.Fail {
+			return jobs[i].total.Fail > jobs[j].total.Fail
+		}
+		return jobs[i].name < jobs[j].name
+	})
+
+	affected := 0
+	for _, h := range jobs {
+		if h.total.Fail > 0 || h.total.Flake > 0 {
+			affected++
+		}
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	days := timeline.Days
+	if len(days) > 0 {
+		fmt.Fprintf(w, "JOB\t%s..%s\tPASS/FLAKE/FAIL\n", days[0][5:], days[len(days)-1][5:])
+	}
+	for _, h := range jobs {
+		fmt.Fprintf(w, "%s\t%s\t%d/%d/%d\n", h.name, h.symbols, h.total.Pass, h.total.Flake, h.total.Fail)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "\n%d of %d jobs affected (+ passed, ~ mixed or flaky, x failed, . no runs)\n", affected, len(jobs))
+	return nil
+}
+
+func (opts *TestHistoryOptions) timeline(ctx context.Context, days int) (timeline *database.Timeline, err error) {
+	if opts.server != "" {
+		return client.New(opts.server).Timeline(ctx, "name", opts.filter, "", opts.testName, days)
+	}
+
+	db, err := database.OpenDefault()
+	if err != nil {
+		return nil, fmt.Errorf("unable to open database: %w", err)
+	}
+	defer func() {
+		closeErr := db.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	if _, err := db.FindTest(opts.testName); err != nil {
+		return nil, err
+	}
+
+	return db.Timeline("name", opts.filter, "", opts.testName, days)
+}
+
+func (opts *TestHistoryOptions) Run(ctx context.Context) error {
+	days, err := parseDays(opts.last)
+	if err != nil {
+		return err
+	}
+
+	timeline, err := opts.timeline(ctx, days)
+	if err != nil {
+		return fmt.Errorf("unable to get test history: %w", err)
+	}
+
+	return output.Print(opts.out, opts.output, timeline, func(out io.Writer) error {
+		return printHistory(out, timeline)
+	})
+}
+
+func NewCmdTestHistory() *cobra.Command {
+	opts := &TestHistoryOptions{
+		out: os.Stdout,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "test-history TESTNAME",
+		Short: "Print the daily history of a test per job",
+		Long: heredoc.Doc(`
+			Print one line per job with a status symbol for each day, so the
+			history of a test can be triaged from the terminal.
+		`),
+		Example: heredoc.Doc(`
+			ci-results test-history "[sig-network] Services should serve a basic endpoint from pods" --filter=aws --last=30d
+		`),
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completion.Tests,
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.testName = args[0]
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.filter, "filter", "", "Space separated list of tags, tags prefixed with - are excluded.")
+	cmd.Flags().StringVar(&opts.last, "last", "14d", "Number of days to show.")
+	cmd.Flags().StringVar(&opts.server, "server", "", "URL of a ci-results server to get data from instead of the local database.")
+	output.AddFlag(cmd, &opts.output)
+
+	completion.RegisterFilterFlag(cmd)
+
+	return cmd
+}
@@ -0,0 +1,164 @@
+package variants
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/completion"
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/indexer"
+	"github.com/dmage/ci-results/output"
+	"github.com/dmage/ci-results/sippy"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+type ApplyOptions struct {
+	variantsFile string
+	job          string
+}
+
+func (opts *ApplyOptions) Run(ctx context.Context) (err error) {
+	variants := sippy.DefaultVariants
+	if opts.variantsFile != "" {
+		variants, err = sippy.LoadVariants(opts.variantsFile)
+		if err != nil {
+			return fmt.Errorf("unable to load variants: %w", err)
+		}
+	}
+
+	db, err := database.OpenDefault()
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer func() {
+		closeErr := db.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	jobs := []string{opts.job}
+	if opts.job == "" {
+		jobs, err = db.JobNames()
+		if err != nil {
+			return err
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	for _, job := range jobs {
+		values := indexer.VariantsMap(variants.IdentifyDimensions(job))
+		if err := tx.SetJobVariants(job, values); err != nil {
+			return fmt.Errorf("job %s: %w", job, err)
+		}
+	}
+	klog.Infof("Updated variants of %d jobs", len(jobs))
+	return nil
+}
+
+func NewCmdApply() *cobra.Command {
+	opts := &ApplyOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Recompute variant dimensions of jobs",
+		Long: heredoc.Doc(`
+			Identify the values of the variant dimensions (network, arch, topology,
+			installer, ...) for jobs in the database and store them.
+
+			The indexer stores the dimensions when it sees a job for the first time,
+			so this command is needed after the definitions are changed.
+		`),
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.variantsFile, "variants", "", "YAML file with variant definitions to use instead of the built-in ones.")
+	cmd.Flags().StringVar(&opts.job, "job", "", "Update only this job.")
+	completion.RegisterJobFlag(cmd)
+
+	return cmd
+}
+
+type ListOptions struct {
+	out io.Writer
+
+	job    string
+	output string
+}
+
+func (opts *ListOptions) Run(ctx context.Context) (err error) {
+	if err := output.Validate(opts.output); err != nil {
+		return err
+	}
+
+	db, err := database.OpenDefault()
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer func() {
+		closeErr := db.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	variants, err := db.JobVariantsList(opts.job)
+	if err != nil {
+		return err
+	}
+
+	return output.Print(opts.out, opts.output, variants, func(out io.Writer) error {
+		w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "JOB\tDIMENSION\tVALUE")
+		for _, v := range variants {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", v.Job, v.Dimension, v.Value)
+		}
+		return w.Flush()
+	})
+}
+
+func NewCmdList() *cobra.Command {
+	opts := &ListOptions{
+		out: os.Stdout,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List variant dimensions of jobs",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.job, "job", "", "Show only variants of this job.")
+	output.AddFlag(cmd, &opts.output)
+	completion.RegisterJobFlag(cmd)
+
+	return cmd
+}
@@ -0,0 +1,161 @@
+package variants
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/output"
+	"github.com/dmage/ci-results/sippy"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+	"k8s.io/klog/v2"
+)
+
+// ExitDiverged is the exit code when --check finds divergences.
+const ExitDiverged = 2
+
+type SyncOptions struct {
+	source       string
+	variantsFile string
+	writeFile    string
+	output       string
+
+	out io.Writer
+}
+
+func readSource(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return ioutil.ReadFile(source)
+	}
+	resp, err := http.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got unexpected http response from %s: %s", source, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func describe(v *sippy.Variant) string {
+	if v == nil {
+		return "-"
+	}
+	s := v.Regex
+	if v.Only {
+		s += " only"
+	}
+	if len(v.Unless) > 0 {
+		s += " unless " + strings.Join(v.Unless, ",")
+	}
+	return s
+}
+
+func printTable(out io.Writer, changes []sippy.VariantChange) error {
+	if len(changes) == 0 {
+		_, err := fmt.Fprintln(out, "The variant definitions are up to date.")
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tCHANGE\tLOCAL\tUPSTREAM")
+	for _, c := range changes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Name, c.Change, describe(c.Local), describe(c.Upstream))
+	}
+	return w.Flush()
+}
+
+func (opts *SyncOptions) Run(ctx context.Context) ([]sippy.VariantChange, error) {
+	if err := output.Validate(opts.output); err != nil {
+		return nil, err
+	}
+
+	local := sippy.DefaultVariants
+	if opts.variantsFile != "" {
+		var err error
+		local, err = sippy.LoadVariants(opts.variantsFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load variants: %w", err)
+		}
+	}
+
+	src, err := readSource(opts.source)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get upstream variants: %w", err)
+	}
+	upstream, err := sippy.ParseUpstreamVariants(src)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse upstream variants from %s: %w", opts.source, err)
+	}
+
+	changes := sippy.DiffVariants(local, upstream)
+
+	if opts.writeFile != "" {
+		// Sippy has no dimensions, keep the local ones.
+		upstream.Dimensions = local.Dimensions
+		data, err := yaml.Marshal(upstream)
+		if err != nil {
+			return nil, err
+		}
+		header := fmt.Sprintf("# Generated by ci-results variants sync from %s\n", opts.source)
+		if err := ioutil.WriteFile(opts.writeFile, append([]byte(header), data...), 0644); err != nil {
+			return nil, err
+		}
+		klog.Infof("Wrote %d variant definitions to %s", len(upstream.Variants), opts.writeFile)
+	}
+
+	return changes, output.Print(opts.out, opts.output, changes, func(out io.Writer) error {
+		return printTable(out, changes)
+	})
+}
+
+func NewCmdSync() *cobra.Command {
+	opts := &SyncOptions{
+		out: os.Stdout,
+	}
+	var check bool
+
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Compare variant definitions with upstream Sippy",
+		Long: heredoc.Doc(`
+			Fetch the variant definitions from the Sippy source code and print the
+			variants that are added, removed or changed upstream, so tags stay
+			comparable with Sippy reports.
+
+			With --write, the upstream definitions are written to a file that can
+			be passed to the indexer with --variants. With --check, the command
+			exits with the code 2 if the definitions diverge.
+		`),
+		Example: heredoc.Doc(`
+			ci-results variants sync
+			ci-results variants sync --write=variants.yaml
+		`),
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			changes, err := opts.Run(cmd.Context())
+			if err != nil {
+				klog.Exit(err)
+			}
+			if check && len(changes) > 0 {
+				klog.Flush()
+				os.Exit(ExitDiverged)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.source, "source", sippy.UpstreamVariantsURL, "URL or file with the Sippy source code that defines variants.")
+	cmd.Flags().StringVar(&opts.variantsFile, "variants", "", "YAML file with local variant definitions, the built-in ones are used by default.")
+	cmd.Flags().StringVar(&opts.writeFile, "write", "", "Write the upstream definitions to this YAML file.")
+	cmd.Flags().BoolVar(&check, "check", false, "Exit with the code 2 if the definitions diverge.")
+	output.AddFlag(cmd, &opts.output)
+
+	return cmd
+}
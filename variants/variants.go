@@ -0,0 +1,18 @@
+package variants
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func NewCmdVariants() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "variants",
+		Short: "Manage Sippy variant definitions",
+	}
+
+	cmd.AddCommand(NewCmdApply())
+	cmd.AddCommand(NewCmdList())
+	cmd.AddCommand(NewCmdSync())
+
+	return cmd
+}
@@ -0,0 +1,67 @@
+package version
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+
+	"github.com/dmage/ci-results/database"
+	"github.com/dmage/ci-results/output"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+// These variables are set at build time using
+// -ldflags "-X github.com/dmage/ci-results/version.Version=...".
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+type Info struct {
+	Version       string `json:"version"`
+	Commit        string `json:"commit"`
+	BuildDate     string `json:"build_date"`
+	GoVersion     string `json:"go_version"`
+	SchemaVersion int    `json:"schema_version"`
+}
+
+func Get() Info {
+	return Info{
+		Version:       Version,
+		Commit:        Commit,
+		BuildDate:     BuildDate,
+		GoVersion:     runtime.Version(),
+		SchemaVersion: database.SchemaVersion(),
+	}
+}
+
+func NewCmdVersion() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "version",
+		Short: "Print the version information",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			info := Get()
+			err := output.Print(os.Stdout, format, info, func(out io.Writer) error {
+				fmt.Fprintf(out, "Version:        %s\n", info.Version)
+				fmt.Fprintf(out, "Commit:         %s\n", info.Commit)
+				fmt.Fprintf(out, "Build date:     %s\n", info.BuildDate)
+				fmt.Fprintf(out, "Go version:     %s\n", info.GoVersion)
+				fmt.Fprintf(out, "Schema version: %d\n", info.SchemaVersion)
+				return nil
+			})
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	output.AddFlag(cmd, &format)
+
+	return cmd
+}
@@ -0,0 +1,75 @@
+package watch
+
+import (
+	"context"
+
+	"github.com/dmage/ci-results/client"
+	"github.com/dmage/ci-results/database"
+)
+
+type snapshot struct {
+	Variants *database.Stats
+	Streaks  []database.FailureStreak
+	Jobs     []database.JobInfo
+}
+
+type source interface {
+	Snapshot(ctx context.Context, filter string) (*snapshot, error)
+	String() string
+}
+
+type dbSource struct {
+	db *database.DB
+}
+
+func (s *dbSource) Snapshot(ctx context.Context, filter string) (*snapshot, error) {
+	variants, err := s.db.BuildStats("sippytags", filter, "1,7", "")
+	if err != nil {
+		return nil, err
+	}
+	streaks, err := s.db.FailureStreaks(filter, 14, 3)
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := s.db.ListJobs(filter, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot{
+		Variants: variants,
+		Streaks:  streaks,
+		Jobs:     jobs,
+	}, nil
+}
+
+func (s *dbSource) String() string {
+	return "local database"
+}
+
+type serverSource struct {
+	client *client.Client
+}
+
+func (s *serverSource) Snapshot(ctx context.Context, filter string) (*snapshot, error) {
+	variants, err := s.client.BuildStats(ctx, "sippytags", filter, "1,7", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	streaks, err := s.client.FailureStreaks(ctx, filter, 14, 3)
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := s.client.ListJobs(ctx, filter, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot{
+		Variants: variants,
+		Streaks:  streaks,
+		Jobs:     jobs,
+	}, nil
+}
+
+func (s *serverSource) String() string {
+	return s.client.String()
+}
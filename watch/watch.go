@@ -0,0 +1,347 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dmage/ci-results/client"
+	"github.com/dmage/ci-results/completion"
+	"github.com/dmage/ci-results/database"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+type WatchOptions struct {
+	filter   string
+	server   string
+	interval time.Duration
+	limit    int
+}
+
+func passRate(v database.StatsValues) (float64, bool) {
+	total := v.Pass + v.Flake + v.Fail
+	if total == 0 {
+		return 0, false
+	}
+	return 100 * float64(v.Pass+v.Flake) / float64(total), true
+}
+
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
+type variant struct {
+	name          string
+	recent, prior float64
+	hasRecent     bool
+	hasPrior      bool
+	runs          int
+}
+
+// sortedVariants returns the variants with pass rates in the last day, the
+// ones that dropped the most first.
+func sortedVariants(stats *database.Stats) []variant {
+	var variants []variant
+	for _, row := range stats.Data {
+		v := variant{name: strings.Join(row.Columns, " ")}
+		v.recent, v.hasRecent = passRate(row.Values[0])
+		v.prior, v.hasPrior = passRate(row.Values[1])
+		v.runs = row.Values[0].Pass + row.Values[0].Flake + row.Values[0].Fail
+		variants = append(variants, v)
+	}
+	sort.SliceStable(variants, func(i, j int) bool {
+		if variants[i].hasRecent != variants[j].hasRecent {
+			return variants[i].hasRecent
+		}
+		return variants[i].recent-variants[i].prior < variants[j].recent-variants[j].prior
+	})
+	return variants
+}
+
+// dashboard is the terminal UI: a header, the data freshness and tables of
+// variants and failure streaks that can be scrolled.
+type dashboard struct {
+	opts *WatchOptions
+
+	app       *tview.Application
+	layout    *tview.Flex
+	header    *tview.TextView
+	freshness *tview.TextView
+	variants  *tview.Table
+	streaks   *tview.Table
+	status    *tview.TextView
+}
+
+func newTable(title string) *tview.Table {
+	t := tview.NewTable().SetFixed(1, 0).SetSelectable(true, false)
+	t.SetBorder(true).SetTitle(" " + title + " ")
+	return t
+}
+
+func newDashboard(opts *WatchOptions) *dashboard {
+	d := &dashboard{
+		opts:      opts,
+		app:       tview.NewApplication(),
+		header:    tview.NewTextView().SetDynamicColors(true),
+		freshness: tview.NewTextView().SetDynamicColors(true),
+		variants:  newTable("Variants"),
+		streaks:   newTable("Active failure streaks"),
+		status:    tview.NewTextView().SetDynamicColors(true),
+	}
+	d.freshness.SetBorder(true).SetTitle(" Data freshness ")
+
+	d.layout = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(d.header, 1, 0, false).
+		AddItem(d.freshness, 0, 1, false).
+		AddItem(d.variants, 0, 2, true).
+		AddItem(d.streaks, 0, 2, false).
+		AddItem(d.status, 1, 0, false)
+	d.app.SetRoot(d.layout, true)
+	return d
+}
+
+func (d *dashboard) setHeader(src source, now time.Time) {
+	d.header.SetText(fmt.Sprintf("[::b]ci-results watch[::-]  %s  %s  refresh every %s", tview.Escape(src.String()), now.Format("2006-01-02 15:04:05"), d.opts.interval))
+}
+
+func (d *dashboard) updateFreshness(now time.Time, jobs []database.JobInfo) {
+	var latest int64
+	var stale []string
+	for _, job := range jobs {
+		if job.LastBuild != nil && *job.LastBuild > latest {
+			latest = *job.LastBuild
+		}
+		if job.RecentBuilds == 0 {
+			stale = append(stale, job.Name)
+		}
+	}
+
+	if latest == 0 {
+		d.freshness.SetText("[red]no builds[-]")
+		return
+	}
+	var b strings.Builder
+	age := now.Sub(time.Unix(latest/1000, 0))
+	color := "green"
+	if age > 6*time.Hour {
+		color = "red"
+	}
+	fmt.Fprintf(&b, "latest build [%s]%s ago[-], %d of %d jobs built in the last 24h\n", color, formatAge(age), len(jobs)-len(stale), len(jobs))
+	if d.opts.limit > 0 && len(stale) > d.opts.limit {
+		stale = append(stale[:d.opts.limit], "...")
+	}
+	for _, name := range stale {
+		fmt.Fprintf(&b, "  [yellow]stale[-] %s\n", tview.Escape(name))
+	}
+	d.freshness.SetText(b.String())
+}
+
+func setHeaderRow(t *tview.Table, names ...string) {
+	for i, name := range names {
+		t.SetCell(0, i, tview.NewTableCell(name).SetAttributes(tcell.AttrBold).SetSelectable(false))
+	}
+}
+
+func (d *dashboard) updateVariants(stats *database.Stats) {
+	variants := sortedVariants(stats)
+	if d.opts.limit > 0 && len(variants) > d.opts.limit {
+		variants = variants[:d.opts.limit]
+	}
+
+	t := d.variants
+	t.Clear()
+	setHeaderRow(t, "TAGS", "LAST 24H", "PREVIOUS 7D", "DELTA", "RUNS")
+	for i, v := range variants {
+		recent, prior, delta := "-", "-", "-"
+		if v.hasRecent {
+			recent = fmt.Sprintf("%.1f%%", v.recent)
+		}
+		if v.hasPrior {
+			prior = fmt.Sprintf("%.1f%%", v.prior)
+		}
+		color := tcell.ColorDefault
+		if v.hasRecent && v.hasPrior {
+			d := v.recent - v.prior
+			if d <= -5 {
+				color = tcell.ColorRed
+			} else if d >= 5 {
+				color = tcell.ColorGreen
+			}
+			delta = fmt.Sprintf("%+.1f", d)
+		}
+		row := i + 1
+		t.SetCell(row, 0, tview.NewTableCell(v.name).SetExpansion(1))
+		t.SetCell(row, 1, tview.NewTableCell(recent).SetAlign(tview.AlignRight))
+		t.SetCell(row, 2, tview.NewTableCell(prior).SetAlign(tview.AlignRight))
+		t.SetCell(row, 3, tview.NewTableCell(delta).SetAlign(tview.AlignRight).SetTextColor(color))
+		t.SetCell(row, 4, tview.NewTableCell(strconv.Itoa(v.runs)).SetAlign(tview.AlignRight))
+	}
+}
+
+func (d *dashboard) updateStreaks(now time.Time, streaks []database.FailureStreak) {
+	if d.opts.limit > 0 && len(streaks) > d.opts.limit {
+		streaks = streaks[:d.opts.limit]
+	}
+
+	t := d.streaks
+	t.Clear()
+	setHeaderRow(t, "FAILURES", "SINCE", "JOB", "TEST")
+	if len(streaks) == 0 {
+		t.SetCell(1, 0, tview.NewTableCell("none").SetTextColor(tcell.ColorGreen))
+		return
+	}
+	for i, s := range streaks {
+		row := i + 1
+		since := formatAge(now.Sub(time.Unix(s.Since/1000, 0))) + " ago"
+		t.SetCell(row, 0, tview.NewTableCell(strconv.Itoa(s.Current)).SetAlign(tview.AlignRight).SetTextColor(tcell.ColorRed))
+		t.SetCell(row, 1, tview.NewTableCell(since))
+		t.SetCell(row, 2, tview.NewTableCell(s.Job))
+		t.SetCell(row, 3, tview.NewTableCell(s.Test).SetExpansion(1))
+	}
+}
+
+// update shows the snapshot. If the snapshot couldn't be taken, the previous
+// data stays on the screen with the error below it.
+func (d *dashboard) update(src source, snap *snapshot, now time.Time, err error) {
+	const help = "q quit  r refresh  Tab switch table  ↑/↓ scroll"
+	if err != nil {
+		d.status.SetText(fmt.Sprintf("[red]unable to get data: %s[-]", tview.Escape(err.Error())))
+		return
+	}
+	d.setHeader(src, now)
+	d.updateFreshness(now, snap.Jobs)
+	d.updateVariants(snap.Variants)
+	d.updateStreaks(now, snap.Streaks)
+	d.status.SetText(help)
+}
+
+func (d *dashboard) handleKey(event *tcell.EventKey, refresh chan<- struct{}) *tcell.EventKey {
+	switch {
+	case event.Key() == tcell.KeyRune && event.Rune() == 'q':
+		d.app.Stop()
+		return nil
+	case event.Key() == tcell.KeyRune && event.Rune() == 'r':
+		select {
+		case refresh <- struct{}{}:
+		default:
+		}
+		return nil
+	case event.Key() == tcell.KeyTab:
+		if d.app.GetFocus() == d.variants {
+			d.app.SetFocus(d.streaks)
+		} else {
+			d.app.SetFocus(d.variants)
+		}
+		return nil
+	}
+	return event
+}
+
+func (opts *WatchOptions) Run(ctx context.Context) (err error) {
+	var src source
+	if opts.server != "" {
+		src = &serverSource{client: client.New(opts.server)}
+	} else {
+		db, err := database.OpenDefault()
+		if err != nil {
+			return fmt.Errorf("unable to open database: %w", err)
+		}
+		defer func() {
+			closeErr := db.Close()
+			if err == nil {
+				err = closeErr
+			}
+		}()
+		src = &dbSource{db: db}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	d := newDashboard(opts)
+	d.setHeader(src, time.Now())
+	d.status.SetText("loading...")
+
+	refresh := make(chan struct{}, 1)
+	d.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		return d.handleKey(event, refresh)
+	})
+
+	go func() {
+		for {
+			now := time.Now()
+			snap, err := src.Snapshot(ctx, opts.filter)
+			if ctx.Err() != nil {
+				return
+			}
+			d.app.QueueUpdateDraw(func() {
+				d.update(src, snap, now, err)
+			})
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-refresh:
+			case <-time.After(opts.interval):
+			}
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		d.app.Stop()
+	}()
+
+	return d.app.Run()
+}
+
+func NewCmdWatch() *cobra.Command {
+	opts := &WatchOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Show a live dashboard in the terminal",
+		Long: heredoc.Doc(`
+			Show pass rates of variants, active failure streaks and data freshness
+			in the terminal and refresh them periodically.
+
+			Press r to refresh immediately, Tab to switch between the tables, arrow
+			keys to scroll them, and q or Ctrl-C to quit.
+
+			The data is read from the local database, or from a running server if
+			--server is set.
+		`),
+		Example: heredoc.Doc(`
+			ci-results watch --filter=4.9
+			ci-results watch --server=http://localhost:8001 --interval=5m
+		`),
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := opts.Run(context.Background())
+			if err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.filter, "filter", "", "Space separated list of tags, tags prefixed with - are excluded.")
+	cmd.Flags().StringVar(&opts.server, "server", "", "URL of a ci-results server to get data from instead of the local database.")
+	cmd.Flags().DurationVar(&opts.interval, "interval", time.Minute, "Refresh interval.")
+	cmd.Flags().IntVar(&opts.limit, "limit", 10, "Maximum number of rows in each section, 0 for no limit.")
+
+	completion.RegisterFilterFlag(cmd)
+
+	return cmd
+}
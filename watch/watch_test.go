@@ -0,0 +1,138 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmage/ci-results/database"
+	"github.com/gdamore/tcell/v2"
+)
+
+type fakeSource struct{}
+
+func (fakeSource) Snapshot(ctx context.Context, filter string) (*snapshot, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (fakeSource) String() string {
+	return "fake"
+}
+
+// screenText draws the dashboard on a simulated terminal and returns its
+// lines.
+func screenText(t *testing.T, d *dashboard) []string {
+	t.Helper()
+	screen := tcell.NewSimulationScreen("UTF-8")
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer screen.Fini()
+	screen.SetSize(100, 30)
+	d.layout.SetRect(0, 0, 100, 30)
+	d.layout.Draw(screen)
+	screen.Show()
+
+	cells, width, height := screen.GetContents()
+	lines := make([]string, height)
+	for y := 0; y < height; y++ {
+		var b strings.Builder
+		for x := 0; x < width; x++ {
+			b.Write(cells[y*width+x].Bytes)
+		}
+		lines[y] = strings.TrimRight(b.String(), " ")
+	}
+	return lines
+}
+
+func findLine(lines []string, substr string) (string, bool) {
+	for _, line := range lines {
+		if strings.Contains(line, substr) {
+			return line, true
+		}
+	}
+	return "", false
+}
+
+func TestDashboard(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	lastBuild := now.Add(-2*time.Hour).Unix() * 1000
+	snap := &snapshot{
+		Variants: &database.Stats{
+			Data: []*database.StatsRow{
+				{Columns: []string{"aws"}, Values: []database.StatsValues{{Pass: 9, Fail: 1}, {Pass: 10}}},
+				{Columns: []string{"gcp"}, Values: []database.StatsValues{{Pass: 1, Fail: 1}, {Pass: 10}}},
+				{Columns: []string{"azure"}, Values: []database.StatsValues{{}, {Pass: 5}}},
+			},
+		},
+		Streaks: []database.FailureStreak{
+			{Job: "job-gcp", Test: "[sig-network] Services should serve endpoints", Current: 4, Since: now.Add(-3*time.Hour).Unix() * 1000},
+		},
+		Jobs: []database.JobInfo{
+			{Name: "job-aws", LastBuild: &lastBuild, RecentBuilds: 3},
+			{Name: "job-[stale]", LastBuild: &lastBuild},
+		},
+	}
+
+	d := newDashboard(&WatchOptions{interval: time.Minute, limit: 10})
+	d.update(fakeSource{}, snap, now, nil)
+	lines := screenText(t, d)
+
+	if _, ok := findLine(lines, "latest build 2h ago, 1 of 2 jobs built in the last 24h"); !ok {
+		t.Errorf("no data freshness:\n%s", strings.Join(lines, "\n"))
+	}
+	if _, ok := findLine(lines, "stale job-[stale]"); !ok {
+		t.Errorf("no stale job:\n%s", strings.Join(lines, "\n"))
+	}
+
+	// The variant that dropped the most is the first one, variants without
+	// recent runs are the last ones.
+	var order []string
+	for row := 1; row < d.variants.GetRowCount(); row++ {
+		order = append(order, d.variants.GetCell(row, 0).Text)
+	}
+	if strings.Join(order, ",") != "gcp,aws,azure" {
+		t.Errorf("got variants %v, want [gcp aws azure]", order)
+	}
+	if cell := d.variants.GetCell(1, 3); cell.Text != "-50.0" || cell.Color != tcell.ColorRed {
+		t.Errorf("got delta %q in %v, want -50.0 in red", cell.Text, cell.Color)
+	}
+	if line, ok := findLine(lines, "gcp"); !ok || !strings.Contains(line, "50.0%") || !strings.Contains(line, "100.0%") {
+		t.Errorf("got variant line %q, want pass rates of gcp", line)
+	}
+
+	if line, ok := findLine(lines, "job-gcp"); !ok || !strings.Contains(line, "3h ago") || !strings.Contains(line, "[sig-network] Services") {
+		t.Errorf("got streak line %q, want the streak of job-gcp", line)
+	}
+
+	// The data stays on the screen if it can't be refreshed.
+	d.update(fakeSource{}, nil, now, errors.New("connection refused"))
+	lines = screenText(t, d)
+	if _, ok := findLine(lines, "unable to get data: connection refused"); !ok {
+		t.Errorf("no error:\n%s", strings.Join(lines, "\n"))
+	}
+	if _, ok := findLine(lines, "job-gcp"); !ok {
+		t.Errorf("the streaks are gone after the error:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestDashboardKeys(t *testing.T) {
+	d := newDashboard(&WatchOptions{interval: time.Minute})
+	d.app.SetFocus(d.variants)
+	refresh := make(chan struct{}, 1)
+
+	d.handleKey(tcell.NewEventKey(tcell.KeyTab, 0, tcell.ModNone), refresh)
+	if d.app.GetFocus() != d.streaks {
+		t.Error("Tab didn't move the focus to the streaks")
+	}
+	d.handleKey(tcell.NewEventKey(tcell.KeyRune, 'r', tcell.ModNone), refresh)
+	d.handleKey(tcell.NewEventKey(tcell.KeyRune, 'r', tcell.ModNone), refresh)
+	if len(refresh) != 1 {
+		t.Errorf("got %d pending refreshes, want 1", len(refresh))
+	}
+	if event := d.handleKey(tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone), refresh); event == nil {
+		t.Error("arrow keys are not passed to the tables")
+	}
+}